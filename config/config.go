@@ -0,0 +1,507 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package config holds all settings of the server. They are loaded once at startup, from the environment and an
+// optional YAML file, and validated before anything is served.
+package config
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+	"github.com/sonatype-nexus-community/the-cla/gitlab"
+	"github.com/sonatype-nexus-community/the-cla/reconciler"
+)
+
+// EnvConfigFile is the path of the optional YAML file, whose settings are overridden by those of the environment.
+const EnvConfigFile = "CLA_CONFIG_FILE"
+
+// RedactedValue replaces the value of secrets, see Config.Redacted.
+const RedactedValue = "redacted"
+
+// EnvPrivateKey holds the PEM content of the private keys of our app, see GitHub.PrivateKey.
+const EnvPrivateKey = "GH_APP_PRIVATE_KEY"
+
+// Each setting is read from the environment variable of its env tag. Settings tagged as secret are redacted, and may
+// come from a secrets.Provider too.
+
+type Server struct {
+	// InfoUsername and InfoPassword protect the "info" endpoints
+	InfoUsername string `yaml:"infoUsername" json:"infoUsername" env:"INFO_USERNAME"`
+	InfoPassword string `yaml:"infoPassword" json:"infoPassword" env:"INFO_PASSWORD" secret:"true"`
+	// LogFilterIncludeHostname only logs requests to this host, if set
+	LogFilterIncludeHostname string `yaml:"logFilterIncludeHostname" json:"logFilterIncludeHostname" env:"LOG_FILTER_INCLUDE_HOSTNAME"`
+	// SecretRefreshInterval is how often secrets are read again, to pick up rotated ones
+	SecretRefreshInterval time.Duration `yaml:"secretRefreshInterval" json:"secretRefreshInterval" env:"SECRET_REFRESH_INTERVAL"`
+}
+
+type Database struct {
+	Host     string `yaml:"host" json:"host" env:"PG_HOST"`
+	Port     int    `yaml:"port" json:"port" env:"PG_PORT"`
+	Username string `yaml:"username" json:"username" env:"PG_USERNAME"`
+	Password string `yaml:"password" json:"password" env:"PG_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" json:"name" env:"PG_DB_NAME"`
+	// SSLMode "disable" only exists for local development
+	SSLMode string `yaml:"sslMode" json:"sslMode" env:"SSL_MODE"`
+}
+
+type GitHub struct {
+	AppId int64 `yaml:"appId" json:"appId" env:"GH_APP_ID"`
+	// KeyFile lists the private key files of the app, comma separated during a rotation
+	KeyFile string `yaml:"keyFile" json:"keyFile" env:"CLA_PEM_FILE"`
+	// PrivateKey is the PEM content of the private keys of the app, used rather than KeyFile when set
+	PrivateKey string `yaml:"privateKey" json:"privateKey" env:"GH_APP_PRIVATE_KEY" secret:"true"`
+	// SigningKey is the fingerprint of the key signing our tokens, the first one of the app by default
+	SigningKey    string `yaml:"signingKey" json:"signingKey" env:"CLA_PEM_SIGNING_KEY"`
+	WebhookSecret string `yaml:"webhookSecret" json:"webhookSecret" env:"GH_WEBHOOK_SECRET" secret:"true"`
+	// OAuthClientId and OAuthClientSecret are of the OAuth app signers log in with, unless AppClientId is set
+	OAuthClientId     string `yaml:"oauthClientId" json:"oauthClientId" env:"REACT_APP_GITHUB_CLIENT_ID"`
+	OAuthClientSecret string `yaml:"oauthClientSecret" json:"oauthClientSecret" env:"GITHUB_CLIENT_SECRET" secret:"true"`
+	// AppClientId and AppClientSecret let signers log in through the GitHub App itself
+	AppClientId     string `yaml:"appClientId" json:"appClientId" env:"GH_APP_CLIENT_ID"`
+	AppClientSecret string `yaml:"appClientSecret" json:"appClientSecret" env:"GH_APP_CLIENT_SECRET" secret:"true"`
+	// HostsFile lists our GitHub Enterprise Server instances
+	HostsFile             string        `yaml:"hostsFile" json:"hostsFile" env:"GITHUB_HOSTS_FILE"`
+	TenantRefreshInterval time.Duration `yaml:"tenantRefreshInterval" json:"tenantRefreshInterval" env:"TENANT_REFRESH_INTERVAL"`
+}
+
+type CLA struct {
+	Version string `yaml:"version" json:"version" env:"REACT_APP_CLA_VERSION"`
+	TextURL string `yaml:"textURL" json:"textURL" env:"REACT_APP_CLA_URL"`
+	// SignLinkSecret enables the signing links of PR comments
+	SignLinkSecret   string        `yaml:"signLinkSecret" json:"signLinkSecret" env:"SIGN_LINK_SECRET" secret:"true"`
+	SignLinkTTL      time.Duration `yaml:"signLinkTTL" json:"signLinkTTL" env:"SIGN_LINK_TTL"`
+	MessagesFile     string        `yaml:"messagesFile" json:"messagesFile" env:"MESSAGES_FILE"`
+	RepoMessagesPath string        `yaml:"repoMessagesPath" json:"repoMessagesPath" env:"REPO_MESSAGES_PATH"`
+	OverrideLabel    string        `yaml:"overrideLabel" json:"overrideLabel" env:"CLA_OVERRIDE_LABEL"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host" json:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" json:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" json:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" json:"password" env:"SMTP_PASSWORD" secret:"true"`
+	// NotifyEmail is told about every signature
+	NotifyEmail string `yaml:"notifyEmail" json:"notifyEmail" env:"NOTIFY_EMAIL"`
+}
+
+type Evaluation struct {
+	SkipDraftPRs            bool          `yaml:"skipDraftPRs" json:"skipDraftPRs" env:"SKIP_DRAFT_PRS"`
+	CollaboratorCacheTTL    time.Duration `yaml:"collaboratorCacheTTL" json:"collaboratorCacheTTL" env:"COLLABORATOR_CACHE_TTL"`
+	CollaboratorCacheShared bool          `yaml:"collaboratorCacheShared" json:"collaboratorCacheShared" env:"COLLABORATOR_CACHE_SHARED"`
+
+	ExemptCollaborators        bool     `yaml:"exemptCollaborators" json:"exemptCollaborators" env:"EXEMPT_COLLABORATORS"`
+	ExemptOrgMembers           bool     `yaml:"exemptOrgMembers" json:"exemptOrgMembers" env:"EXEMPT_ORG_MEMBERS"`
+	ExemptOutsideCollaborators bool     `yaml:"exemptOutsideCollaborators" json:"exemptOutsideCollaborators" env:"EXEMPT_OUTSIDE_COLLABORATORS"`
+	ExemptTeams                []string `yaml:"exemptTeams" json:"exemptTeams" env:"EXEMPT_TEAMS"`
+	ExemptBotLogins            []string `yaml:"exemptBotLogins" json:"exemptBotLogins" env:"EXEMPT_BOT_LOGINS"`
+	ExemptBotEmails            []string `yaml:"exemptBotEmails" json:"exemptBotEmails" env:"EXEMPT_BOT_EMAILS"`
+
+	TrivialChangeRepos    []string `yaml:"trivialChangeRepos" json:"trivialChangeRepos" env:"TRIVIAL_CHANGE_REPOS"`
+	TrivialChangeMaxLines int      `yaml:"trivialChangeMaxLines" json:"trivialChangeMaxLines" env:"TRIVIAL_CHANGE_MAX_LINES"`
+	TrivialChangePaths    []string `yaml:"trivialChangePaths" json:"trivialChangePaths" env:"TRIVIAL_CHANGE_PATHS"`
+
+	EnforcedBaseBranches []string   `yaml:"enforcedBaseBranches" json:"enforcedBaseBranches" env:"ENFORCED_BASE_BRANCHES"`
+	ExcludedRepos        []string   `yaml:"excludedRepos" json:"excludedRepos" env:"EXCLUDED_REPOS"`
+	ExcludeArchivedRepos ScopedFlag `yaml:"excludeArchivedRepos" json:"excludeArchivedRepos" env:"EXCLUDE_ARCHIVED_REPOS"`
+	ExcludePrivateRepos  ScopedFlag `yaml:"excludePrivateRepos" json:"excludePrivateRepos" env:"EXCLUDE_PRIVATE_REPOS"`
+}
+
+// ScopedFlag is a boolean setting that organizations and repositories can override, e.g. "true,myOrg:false" or
+// "myOrg/myRepo:true". A plain boolean in the configuration file is a single value without scope.
+type ScopedFlag []string
+
+func (f *ScopedFlag) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*f = ScopedFlag{node.Value}
+		return nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*f = values
+	return nil
+}
+
+// Reconciler intervals of 0 disable it.
+type Reconciler struct {
+	Interval     time.Duration `yaml:"interval" json:"interval" env:"RECONCILE_INTERVAL"`
+	PendingAge   time.Duration `yaml:"pendingAge" json:"pendingAge" env:"RECONCILE_PENDING_AGE"`
+	ActiveWindow time.Duration `yaml:"activeWindow" json:"activeWindow" env:"RECONCILE_ACTIVE_WINDOW"`
+}
+
+// GitLab merge requests are evaluated when Token is set.
+type GitLab struct {
+	URL           string `yaml:"url" json:"url" env:"GITLAB_URL"`
+	Token         string `yaml:"token" json:"token" env:"GITLAB_TOKEN" secret:"true"`
+	WebhookSecret string `yaml:"webhookSecret" json:"webhookSecret" env:"GITLAB_WEBHOOK_SECRET" secret:"true"`
+	SignURL       string `yaml:"signURL" json:"signURL" env:"GITLAB_SIGN_URL"`
+	ClientId      string `yaml:"clientId" json:"clientId" env:"GITLAB_CLIENT_ID"`
+	ClientSecret  string `yaml:"clientSecret" json:"clientSecret" env:"GITLAB_CLIENT_SECRET" secret:"true"`
+}
+
+// Gitea (or Forgejo) pull requests are evaluated when URL and Token are set.
+type Gitea struct {
+	URL           string `yaml:"url" json:"url" env:"GITEA_URL"`
+	Token         string `yaml:"token" json:"token" env:"GITEA_TOKEN" secret:"true"`
+	WebhookSecret string `yaml:"webhookSecret" json:"webhookSecret" env:"GITEA_WEBHOOK_SECRET" secret:"true"`
+	SignURL       string `yaml:"signURL" json:"signURL" env:"GITEA_SIGN_URL"`
+	ClientId      string `yaml:"clientId" json:"clientId" env:"GITEA_CLIENT_ID"`
+	ClientSecret  string `yaml:"clientSecret" json:"clientSecret" env:"GITEA_CLIENT_SECRET" secret:"true"`
+}
+
+// Config holds every setting of the server, grouped by the part of it they configure.
+type Config struct {
+	Server     Server     `yaml:"server" json:"server"`
+	Database   Database   `yaml:"database" json:"database"`
+	GitHub     GitHub     `yaml:"github" json:"github"`
+	CLA        CLA        `yaml:"cla" json:"cla"`
+	SMTP       SMTP       `yaml:"smtp" json:"smtp"`
+	Evaluation Evaluation `yaml:"evaluation" json:"evaluation"`
+	Reconciler Reconciler `yaml:"reconciler" json:"reconciler"`
+	GitLab     GitLab     `yaml:"gitlab" json:"gitlab"`
+	Gitea      Gitea      `yaml:"gitea" json:"gitea"`
+}
+
+// Default is the configuration before any setting is applied.
+func Default() *Config {
+	return &Config{
+		Server: Server{SecretRefreshInterval: 5 * time.Minute},
+		GitHub: GitHub{
+			KeyFile:               ourGithub.FilenameTheClaPem,
+			TenantRefreshInterval: time.Minute,
+		},
+		CLA: CLA{SignLinkTTL: ourGithub.DefaultSignLinkTTL},
+		Evaluation: Evaluation{
+			CollaboratorCacheTTL: ourGithub.DefaultCollaboratorCacheTTL,
+			ExemptCollaborators:  true,
+		},
+		Reconciler: Reconciler{
+			Interval:     reconciler.DefaultInterval,
+			PendingAge:   reconciler.DefaultPendingAge,
+			ActiveWindow: reconciler.DefaultActiveWindow,
+		},
+		GitLab: GitLab{URL: gitlab.DefaultBaseURL},
+	}
+}
+
+// Load applies the settings of the YAML file at path (if any), then those of the environment, to the defaults, and
+// validates the result. All problems are reported at once.
+func Load(path string, getenv func(string) string) (config *Config, err error) {
+	config = Default()
+	if path != "" {
+		if err = config.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err = applyEnv(reflect.ValueOf(config).Elem(), getenv); err != nil {
+		return nil, err
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (c *Config) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	// a misspelled setting would otherwise be silently ignored
+	decoder.KnownFields(true)
+	if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv sets the fields of a section from the environment variables of their env tags, if set.
+func applyEnv(section reflect.Value, getenv func(string) string) error {
+	var problems []error
+	for i := 0; i < section.NumField(); i++ {
+		field, value := section.Type().Field(i), section.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(value, getenv); err != nil {
+				problems = append(problems, err)
+			}
+			continue
+		}
+		envName := field.Tag.Get("env")
+		raw := getenv(envName)
+		if envName == "" || raw == "" {
+			continue
+		}
+		if err := setValue(value, raw); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", envName, err))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+func setValue(value reflect.Value, raw string) error {
+	switch {
+	case value.Type() == durationType:
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		value.SetInt(int64(duration))
+	case value.Kind() == reflect.String:
+		value.SetString(raw)
+	case value.Kind() == reflect.Int || value.Kind() == reflect.Int64:
+		number, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		value.SetInt(number)
+	case value.Kind() == reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		value.SetBool(parsed)
+	case value.Kind() == reflect.Slice:
+		var values []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		value.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported setting type %s", value.Type())
+	}
+	return nil
+}
+
+// validation collects the problems of a configuration, naming settings by their environment variable.
+type validation struct {
+	problems []error
+}
+
+func (v *validation) check(ok bool, format string, args ...any) {
+	if !ok {
+		v.problems = append(v.problems, fmt.Errorf(format, args...))
+	}
+}
+
+func (v *validation) required(value, envName string) {
+	v.check(value != "", "%s is required", envName)
+}
+
+func (v *validation) url(value, envName string) {
+	if value == "" {
+		return
+	}
+	parsed, err := url.Parse(value)
+	v.check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "",
+		"%s is not an http(s) URL: %q", envName, value)
+}
+
+func (v *validation) port(value int, envName string) {
+	v.check(value > 0 && value < 65536, "%s is not a port: %d", envName, value)
+}
+
+func (v *validation) notNegative(value time.Duration, envName string) {
+	v.check(value >= 0, "%s is negative: %s", envName, value)
+}
+
+func (v *validation) scopedFlag(values ScopedFlag, envName string) {
+	for _, value := range values {
+		flag := value
+		if i := strings.LastIndex(value, ":"); i >= 0 {
+			flag = value[i+1:]
+		}
+		_, err := strconv.ParseBool(flag)
+		v.check(err == nil, "%s is not a boolean: %q", envName, value)
+	}
+}
+
+func (v *validation) readable(path, envName string) {
+	if path == "" {
+		return
+	}
+	_, err := os.Stat(path)
+	v.check(err == nil, "%s is not readable: %v", envName, err)
+}
+
+// Validate reports every missing or invalid setting, so a misconfiguration is found at startup, not when a request
+// needs the setting.
+func (c *Config) Validate() error {
+	var v validation
+
+	v.required(c.Server.InfoUsername, "INFO_USERNAME")
+	v.required(c.Server.InfoPassword, "INFO_PASSWORD")
+
+	v.required(c.Database.Host, "PG_HOST")
+	v.port(c.Database.Port, "PG_PORT")
+	v.required(c.Database.Username, "PG_USERNAME")
+	v.required(c.Database.Name, "PG_DB_NAME")
+
+	v.notNegative(c.Server.SecretRefreshInterval, "SECRET_REFRESH_INTERVAL")
+
+	v.check(c.GitHub.AppId > 0, "GH_APP_ID is required")
+	if c.GitHub.PrivateKey != "" {
+		block, _ := pem.Decode([]byte(c.GitHub.PrivateKey))
+		v.check(block != nil, "%s is not PEM encoded", EnvPrivateKey)
+	} else {
+		v.required(c.GitHub.KeyFile, "CLA_PEM_FILE")
+		for _, keyFile := range strings.Split(c.GitHub.KeyFile, ",") {
+			if keyFile = strings.TrimSpace(keyFile); keyFile != "" {
+				v.readable(keyFile, "CLA_PEM_FILE")
+			}
+		}
+	}
+	v.required(c.GitHub.WebhookSecret, "GH_WEBHOOK_SECRET")
+	if c.GitHub.AppClientId != "" {
+		v.required(c.GitHub.AppClientSecret, "GH_APP_CLIENT_SECRET")
+	} else {
+		v.check(c.GitHub.OAuthClientId != "" && c.GitHub.OAuthClientSecret != "",
+			"GH_APP_CLIENT_ID and GH_APP_CLIENT_SECRET, or REACT_APP_GITHUB_CLIENT_ID and GITHUB_CLIENT_SECRET are required")
+	}
+	v.readable(c.GitHub.HostsFile, "GITHUB_HOSTS_FILE")
+	v.notNegative(c.GitHub.TenantRefreshInterval, "TENANT_REFRESH_INTERVAL")
+
+	v.required(c.CLA.Version, "REACT_APP_CLA_VERSION")
+	v.required(c.CLA.TextURL, "REACT_APP_CLA_URL")
+	v.url(c.CLA.TextURL, "REACT_APP_CLA_URL")
+	v.check(c.CLA.SignLinkTTL > 0, "SIGN_LINK_TTL is not positive: %s", c.CLA.SignLinkTTL)
+	v.readable(c.CLA.MessagesFile, "MESSAGES_FILE")
+
+	v.required(c.SMTP.Host, "SMTP_HOST")
+	v.port(c.SMTP.Port, "SMTP_PORT")
+	v.required(c.SMTP.NotifyEmail, "NOTIFY_EMAIL")
+	if c.SMTP.NotifyEmail != "" {
+		_, err := mail.ParseAddress(c.SMTP.NotifyEmail)
+		v.check(err == nil, "NOTIFY_EMAIL is not an email address: %q", c.SMTP.NotifyEmail)
+	}
+
+	v.notNegative(c.Evaluation.CollaboratorCacheTTL, "COLLABORATOR_CACHE_TTL")
+	v.check(c.Evaluation.TrivialChangeMaxLines >= 0, "TRIVIAL_CHANGE_MAX_LINES is negative: %d", c.Evaluation.TrivialChangeMaxLines)
+	for _, excluded := range c.Evaluation.ExcludedRepos {
+		// scoped entries override the patterns for an organization or repository
+		if strings.Contains(excluded, ":") {
+			v.scopedFlag(ScopedFlag{excluded}, "EXCLUDED_REPOS")
+		}
+	}
+	v.scopedFlag(c.Evaluation.ExcludeArchivedRepos, "EXCLUDE_ARCHIVED_REPOS")
+	v.scopedFlag(c.Evaluation.ExcludePrivateRepos, "EXCLUDE_PRIVATE_REPOS")
+
+	v.notNegative(c.Reconciler.Interval, "RECONCILE_INTERVAL")
+	v.notNegative(c.Reconciler.PendingAge, "RECONCILE_PENDING_AGE")
+	v.notNegative(c.Reconciler.ActiveWindow, "RECONCILE_ACTIVE_WINDOW")
+
+	if c.GitLab.Token != "" {
+		v.url(c.GitLab.URL, "GITLAB_URL")
+		v.url(c.GitLab.SignURL, "GITLAB_SIGN_URL")
+		v.required(c.GitLab.WebhookSecret, "GITLAB_WEBHOOK_SECRET")
+		if c.GitLab.ClientId != "" {
+			v.required(c.GitLab.ClientSecret, "GITLAB_CLIENT_SECRET")
+		}
+	}
+	if c.Gitea.Token != "" {
+		v.required(c.Gitea.URL, "GITEA_URL")
+		v.url(c.Gitea.URL, "GITEA_URL")
+		v.url(c.Gitea.SignURL, "GITEA_SIGN_URL")
+		v.required(c.Gitea.WebhookSecret, "GITEA_WEBHOOK_SECRET")
+		if c.Gitea.ClientId != "" {
+			v.required(c.Gitea.ClientSecret, "GITEA_CLIENT_SECRET")
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(v.problems...))
+	}
+	return nil
+}
+
+// Redacted is a copy of the configuration safe to show, with the value of every secret that is set replaced.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redact(reflect.ValueOf(&redacted).Elem())
+	return &redacted
+}
+
+func redact(section reflect.Value) {
+	forEachSecret(section, func(_ string, value reflect.Value) {
+		if value.String() != "" {
+			value.SetString(RedactedValue)
+		}
+	})
+}
+
+// SecretNames are the environment variables of all secrets, which a secrets.Provider may have.
+func SecretNames() (names []string) {
+	forEachSecret(reflect.ValueOf(Default()).Elem(), func(envName string, _ reflect.Value) {
+		names = append(names, envName)
+	})
+	return
+}
+
+// WithSecrets is a copy of the configuration with the secrets of another one, e.g. loaded again after secrets were
+// rotated, and the environment variables of the secrets that changed.
+func (c *Config) WithSecrets(from *Config) (updated *Config, changed []string) {
+	copied := *c
+	updated = &copied
+	fromValue := reflect.ValueOf(from).Elem()
+	forEachSecret(reflect.ValueOf(updated).Elem(), func(envName string, value reflect.Value) {
+		if newValue := secretOf(fromValue, envName); newValue.String() != value.String() {
+			value.SetString(newValue.String())
+			changed = append(changed, envName)
+		}
+	})
+	return
+}
+
+// forEachSecret calls fn with every secret setting of a section, named by its environment variable.
+func forEachSecret(section reflect.Value, fn func(envName string, value reflect.Value)) {
+	for i := 0; i < section.NumField(); i++ {
+		field, value := section.Type().Field(i), section.Field(i)
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			forEachSecret(value, fn)
+		case field.Tag.Get("secret") == "true":
+			fn(field.Tag.Get("env"), value)
+		}
+	}
+}
+
+func secretOf(section reflect.Value, envName string) (secret reflect.Value) {
+	forEachSecret(section, func(name string, value reflect.Value) {
+		if name == envName {
+			secret = value
+		}
+	})
+	return
+}
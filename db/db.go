@@ -29,6 +29,7 @@ import (
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
 )
 
 const sqlInsertSignature = `INSERT INTO signatures
@@ -43,6 +44,24 @@ type IClaDB interface {
 	StorePRAuthorsMissingSignature(evalInfo *types.EvaluationInfo, checkedAt time.Time) error
 	GetPRsForUser(*types.UserSignature) ([]types.EvaluationInfo, error)
 	RemovePRsForUsers([]types.UserSignature, *types.EvaluationInfo) error
+	UpdateRepositoryNames(provider string, repoId int64, repoOwner, repoName string) error
+	GetLegacyPRRepositories() ([]types.EvaluationInfo, error)
+	AdoptLegacyPRs(repoId int64, legacyOwner, legacyName, repoOwner, repoName string) (int64, error)
+	StorePRStatus(evalInfo *types.EvaluationInfo, state string, updatedAt time.Time) error
+	StorePRFailure(evalInfo *types.EvaluationInfo, lastError string, failedAt time.Time) (int, error)
+	SchedulePRRetry(evalInfo *types.EvaluationInfo, nextAttemptAt time.Time) error
+	GetPRStatus(provider string, repoId, prNumber int64) (*types.PRStatus, error)
+	GetStalePRs(state string, updatedBefore, updatedAfter time.Time) ([]types.EvaluationInfo, error)
+	GetPRsDueForRetry(now time.Time) ([]types.EvaluationInfo, error)
+	GetPRsWithAllAuthorsSigned(activeAfter time.Time) ([]types.EvaluationInfo, error)
+	AcquireLease(name, holder string, now time.Time, ttl time.Duration) (bool, error)
+	ReleaseLease(name, holder string) error
+	GetCachedCollaborator(repoId int64, login string, checkedAfter time.Time) (*types.Collaborator, error)
+	StoreCachedCollaborator(collaborator *types.Collaborator) error
+	InvalidateCachedCollaborators(repoOwner string, repoId int64, login string) error
+	InsertAuditEvent(event *types.AuditEvent) error
+	GetPROverride(provider string, repoId, prNumber int64) (*types.AuditEvent, error)
+	GetTenants() ([]types.Tenant, error)
 	MigrateDB(migrateSourceURL string) error
 }
 
@@ -135,12 +154,16 @@ func (p *ClaDB) MigrateDB(migrateSourceURL string) (err error) {
 }
 
 const sqlInsertPRMissing = `INSERT INTO unsigned_pr
-		(RepoOwner, RepoName, sha, PRNumber, AppID, InstallID)
-		VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING RETURNING id`
-const msgTemplateErrInsertPRMissing = "insert error tracking missing PR CLA. repo: %s, PR: %d, error: %+v"
+		(RepoID, RepoOwner, RepoName, sha, PRNumber, AppID, InstallID, Provider)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING RETURNING id`
+const msgTemplateErrInsertPRMissing = "insert error tracking missing PR CLA. repo: %s/%s, PR: %d, error: %+v"
+
+// sqlAdoptLegacyPRs assigns the repository ID to rows stored before PRs were keyed by repository ID.
+const sqlAdoptLegacyPRs = `UPDATE unsigned_pr SET RepoID = $1
+		WHERE RepoID IS NULL AND RepoOwner = $2 AND RepoName = $3 AND Provider = 'github'`
 
 const errMsgInsertedRowExists = "sql: no rows in result set"
-const sqlSelectPR = `SELECT Id from unsigned_pr WHERE RepoName = $1 AND PRNumber = $2`
+const sqlSelectPR = `SELECT Id from unsigned_pr WHERE RepoID = $1 AND PRNumber = $2 AND Provider = $3`
 
 const sqlInsertUserMissing = `INSERT INTO unsigned_user
 		(UnsignedPRID, LoginName, Email, GivenName, ClaVersion, CheckedAt)
@@ -149,26 +172,36 @@ const sqlInsertUserMissing = `INSERT INTO unsigned_user
 const msgTemplateErrInsertAuthorMissing = "insert error tracking missing author CLA. user: %+v, error: %+v"
 
 func (p *ClaDB) StorePRAuthorsMissingSignature(evalInfo *types.EvaluationInfo, checkedAt time.Time) (err error) {
+	provider := vcs.ProviderOf(evalInfo)
+	// only GitHub PRs were stored before we had repository IDs
+	if evalInfo.RepoId != 0 && provider == vcs.ProviderGitHub {
+		_, err = p.db.Exec(sqlAdoptLegacyPRs, evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName)
+		if err != nil {
+			return fmt.Errorf(msgTemplateErrInsertPRMissing, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, err)
+		}
+	}
+
 	var parentUUID string
-	err = p.db.QueryRow(sqlInsertPRMissing, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId).
+	err = p.db.QueryRow(sqlInsertPRMissing, evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, provider).
 		Scan(&parentUUID)
 	if err != nil {
 		if errMsgInsertedRowExists == err.Error() {
 			p.logger.Info("special case, try to read the UUID of the existing parent",
+				zap.Int64("repoId", evalInfo.RepoId),
 				zap.String("repoName", evalInfo.RepoName),
 				zap.Int64("PRNumber", evalInfo.PRNumber),
 			)
-			err = p.db.QueryRow(sqlSelectPR, evalInfo.RepoName, evalInfo.PRNumber).Scan(&parentUUID)
+			err = p.db.QueryRow(sqlSelectPR, evalInfo.RepoId, evalInfo.PRNumber, provider).Scan(&parentUUID)
 			if err != nil {
-				return fmt.Errorf(msgTemplateErrInsertPRMissing, evalInfo.RepoName, evalInfo.PRNumber, err)
+				return fmt.Errorf(msgTemplateErrInsertPRMissing, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, err)
 			}
 		} else {
-			return fmt.Errorf(msgTemplateErrInsertPRMissing, evalInfo.RepoName, evalInfo.PRNumber, err)
+			return fmt.Errorf(msgTemplateErrInsertPRMissing, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, err)
 		}
 	}
 	if parentUUID == "" {
 		// we can not ignore an empty parentId, so fail loudly
-		return fmt.Errorf(msgTemplateErrInsertPRMissing, evalInfo.RepoName, evalInfo.PRNumber, fmt.Errorf("empty parentUUID"))
+		return fmt.Errorf(msgTemplateErrInsertPRMissing, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, fmt.Errorf("empty parentUUID"))
 	}
 
 	for _, missingAuthor := range evalInfo.UserSignatures {
@@ -193,7 +226,9 @@ func (p *ClaDB) StorePRAuthorsMissingSignature(evalInfo *types.EvaluationInfo, c
 	return
 }
 
-const sqlSelectPRsForUser = `SELECT DISTINCT unsigned_pr.* from unsigned_pr, unsigned_user 
+const sqlSelectPRsForUser = `SELECT DISTINCT unsigned_pr.Id, COALESCE(unsigned_pr.RepoID, 0), unsigned_pr.RepoOwner,
+unsigned_pr.RepoName, unsigned_pr.sha, unsigned_pr.PRNumber, unsigned_pr.AppID, unsigned_pr.InstallID, unsigned_pr.Provider
+FROM unsigned_pr, unsigned_user 
 WHERE unsigned_pr.Id = unsigned_user.UnsignedPRID AND LoginName = $1 AND ClaVersion = $2`
 
 func (p *ClaDB) GetPRsForUser(user *types.UserSignature) (evalInfos []types.EvaluationInfo, err error) {
@@ -207,12 +242,14 @@ func (p *ClaDB) GetPRsForUser(user *types.UserSignature) (evalInfos []types.Eval
 		evalInfo = &types.EvaluationInfo{}
 		err = rows.Scan(
 			&evalInfo.UnsignedPRID,
+			&evalInfo.RepoId,
 			&evalInfo.RepoOwner,
 			&evalInfo.RepoName,
 			&evalInfo.Sha,
 			&evalInfo.PRNumber,
 			&evalInfo.AppId,
 			&evalInfo.InstallId,
+			&evalInfo.Provider,
 		)
 		if err != nil {
 			return
@@ -265,3 +302,454 @@ func (p *ClaDB) RemovePRsForUsers(usersSigned []types.UserSignature, evalInfo *t
 	}
 	return
 }
+
+const sqlUpdateRepositoryNames = `UPDATE unsigned_pr SET RepoOwner = $2, RepoName = $3 WHERE RepoID = $1 AND Provider = $4`
+
+// UpdateRepositoryNames refreshes the display owner/name of tracked PRs after a GitHub repository is renamed or
+// transferred. The provider is github, or the GitHub Enterprise Server host of the repository.
+func (p *ClaDB) UpdateRepositoryNames(provider string, repoId int64, repoOwner, repoName string) (err error) {
+	var result sql.Result
+	if result, err = p.db.Exec(sqlUpdateRepositoryNames, repoId, repoOwner, repoName, provider); err != nil {
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	p.logger.Debug("updated repository names",
+		zap.Int64("repoId", repoId),
+		zap.String("repoOwner", repoOwner),
+		zap.String("repoName", repoName),
+		zap.Int64("rowsAffected", rowsAffected),
+	)
+	return
+}
+
+const SqlSelectLegacyPRRepositories = `SELECT DISTINCT RepoOwner, RepoName, AppID, InstallID FROM unsigned_pr
+		WHERE RepoID IS NULL AND Provider = 'github'`
+
+// GetLegacyPRRepositories lists the repositories of PRs stored before PRs were keyed by repository ID, along with
+// the installation to look them up with.
+func (p *ClaDB) GetLegacyPRRepositories() (repos []types.EvaluationInfo, err error) {
+	var rows *sql.Rows
+	if rows, err = p.db.Query(SqlSelectLegacyPRRepositories); err != nil {
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		repo := types.EvaluationInfo{}
+		if err = rows.Scan(&repo.RepoOwner, &repo.RepoName, &repo.AppId, &repo.InstallId); err != nil {
+			return
+		}
+		repos = append(repos, repo)
+	}
+	err = rows.Err()
+	return
+}
+
+// sqlBackfillLegacyPRs skips PRs tracked again by repository ID since, which would otherwise be duplicated.
+const sqlBackfillLegacyPRs = `UPDATE unsigned_pr SET RepoID = $1, RepoOwner = $4, RepoName = $5
+		WHERE RepoID IS NULL AND RepoOwner = $2 AND RepoName = $3 AND Provider = 'github'
+		AND NOT EXISTS (SELECT 1 FROM unsigned_pr adopted
+			WHERE adopted.Provider = 'github' AND adopted.RepoID = $1 AND adopted.PRNumber = unsigned_pr.PRNumber)`
+
+// AdoptLegacyPRs assigns the repository ID to PRs stored by the legacy owner/name, and refreshes their owner/name
+// in case the repository was renamed or transferred since. It returns the number of PRs adopted.
+func (p *ClaDB) AdoptLegacyPRs(repoId int64, legacyOwner, legacyName, repoOwner, repoName string) (adopted int64, err error) {
+	var result sql.Result
+	if result, err = p.db.Exec(sqlBackfillLegacyPRs, repoId, legacyOwner, legacyName, repoOwner, repoName); err != nil {
+		return
+	}
+	adopted, _ = result.RowsAffected()
+	p.logger.Debug("adopted legacy PRs",
+		zap.Int64("repoId", repoId),
+		zap.String("legacyOwner", legacyOwner),
+		zap.String("legacyName", legacyName),
+		zap.Int64("adopted", adopted),
+	)
+	return
+}
+
+const SqlUpsertPRStatus = `INSERT INTO pr_status
+		(RepoID, RepoOwner, RepoName, PRNumber, sha, AppID, InstallID, State, UpdatedAt, Provider)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (Provider, RepoID, PRNumber) DO UPDATE SET
+		RepoOwner = EXCLUDED.RepoOwner, RepoName = EXCLUDED.RepoName, sha = EXCLUDED.sha,
+		AppID = EXCLUDED.AppID, InstallID = EXCLUDED.InstallID, State = EXCLUDED.State, UpdatedAt = EXCLUDED.UpdatedAt,
+		LastError = CASE WHEN EXCLUDED.State IN ('pending', 'deferred') THEN pr_status.LastError END,
+		Attempts = CASE WHEN EXCLUDED.State IN ('pending', 'deferred') THEN pr_status.Attempts ELSE 0 END,
+		NextAttemptAt = CASE WHEN EXCLUDED.State IN ('pending', 'deferred') THEN pr_status.NextAttemptAt END`
+
+// StorePRStatus records the latest commit status we reported for a PR. A "pending" or "deferred" status keeps
+// any prior failure details (it is usually a retry in progress), while a final status clears them.
+func (p *ClaDB) StorePRStatus(evalInfo *types.EvaluationInfo, state string, updatedAt time.Time) (err error) {
+	_, err = p.db.Exec(SqlUpsertPRStatus, evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber,
+		evalInfo.Sha, evalInfo.AppId, evalInfo.InstallId, state, updatedAt, vcs.ProviderOf(evalInfo))
+	return
+}
+
+const SqlUpsertPRFailure = `INSERT INTO pr_status
+		(RepoID, RepoOwner, RepoName, PRNumber, sha, AppID, InstallID, State, UpdatedAt, LastError, Attempts, Provider)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, 'error', $8, $9, 1, $10)
+		ON CONFLICT (Provider, RepoID, PRNumber) DO UPDATE SET
+		RepoOwner = EXCLUDED.RepoOwner, RepoName = EXCLUDED.RepoName, sha = EXCLUDED.sha,
+		AppID = EXCLUDED.AppID, InstallID = EXCLUDED.InstallID, State = EXCLUDED.State, UpdatedAt = EXCLUDED.UpdatedAt,
+		LastError = EXCLUDED.LastError, Attempts = pr_status.Attempts + 1, NextAttemptAt = NULL
+		RETURNING Attempts`
+
+// StorePRFailure records a failed evaluation of a PR, and returns how many evaluations in a row have failed.
+func (p *ClaDB) StorePRFailure(evalInfo *types.EvaluationInfo, lastError string, failedAt time.Time) (attempts int, err error) {
+	err = p.db.QueryRow(SqlUpsertPRFailure, evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber,
+		evalInfo.Sha, evalInfo.AppId, evalInfo.InstallId, failedAt, lastError, vcs.ProviderOf(evalInfo)).Scan(&attempts)
+	return
+}
+
+const SqlUpdatePRNextAttempt = `UPDATE pr_status SET NextAttemptAt = $1 WHERE RepoID = $2 AND PRNumber = $3 AND Provider = $4`
+
+// SchedulePRRetry sets when a failed PR evaluation should be attempted again.
+func (p *ClaDB) SchedulePRRetry(evalInfo *types.EvaluationInfo, nextAttemptAt time.Time) (err error) {
+	_, err = p.db.Exec(SqlUpdatePRNextAttempt, nextAttemptAt, evalInfo.RepoId, evalInfo.PRNumber, vcs.ProviderOf(evalInfo))
+	return
+}
+
+const SqlSelectPRStatus = `SELECT RepoID, RepoOwner, RepoName, PRNumber, sha, State, UpdatedAt,
+		COALESCE(LastError, ''), Attempts, NextAttemptAt
+		FROM pr_status
+		WHERE RepoID = $1 AND PRNumber = $2 AND Provider = $3`
+
+// GetPRStatus returns the latest status we reported for a PR of the provider, or nil if we have never reported one.
+func (p *ClaDB) GetPRStatus(provider string, repoId, prNumber int64) (prStatus *types.PRStatus, err error) {
+	status := types.PRStatus{}
+	var nextAttemptAt sql.NullTime
+	err = p.db.QueryRow(SqlSelectPRStatus, repoId, prNumber, provider).Scan(
+		&status.RepoId,
+		&status.RepoOwner,
+		&status.RepoName,
+		&status.PRNumber,
+		&status.Sha,
+		&status.State,
+		&status.UpdatedAt,
+		&status.LastError,
+		&status.Attempts,
+		&nextAttemptAt,
+	)
+	if err != nil {
+		if errMsgInsertedRowExists == err.Error() {
+			err = nil
+		}
+		return
+	}
+	if nextAttemptAt.Valid {
+		status.NextAttemptAt = &nextAttemptAt.Time
+	}
+	prStatus = &status
+	return
+}
+
+const sqlSelectStalePRs = `SELECT RepoID, RepoOwner, RepoName, sha, PRNumber, AppID, InstallID, Provider
+		FROM pr_status
+		WHERE State = $1 AND UpdatedAt < $2 AND UpdatedAt > $3`
+
+// GetStalePRs returns PRs whose last reported status is still the given state, and has not changed within
+// the window between updatedAfter and updatedBefore.
+func (p *ClaDB) GetStalePRs(state string, updatedBefore, updatedAfter time.Time) (evalInfos []types.EvaluationInfo, err error) {
+	var rows *sql.Rows
+	if rows, err = p.db.Query(sqlSelectStalePRs, state, updatedBefore, updatedAfter); err != nil {
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		evalInfo := types.EvaluationInfo{}
+		err = rows.Scan(
+			&evalInfo.RepoId,
+			&evalInfo.RepoOwner,
+			&evalInfo.RepoName,
+			&evalInfo.Sha,
+			&evalInfo.PRNumber,
+			&evalInfo.AppId,
+			&evalInfo.InstallId,
+			&evalInfo.Provider,
+		)
+		if err != nil {
+			return
+		}
+		evalInfos = append(evalInfos, evalInfo)
+	}
+	return
+}
+
+const sqlSelectPRsDueForRetry = `SELECT RepoID, RepoOwner, RepoName, sha, PRNumber, AppID, InstallID, Provider
+		FROM pr_status
+		WHERE State IN ('error', 'deferred') AND NextAttemptAt <= $1`
+
+// GetPRsDueForRetry returns PRs whose evaluation failed or was deferred, and whose scheduled retry time has arrived.
+func (p *ClaDB) GetPRsDueForRetry(now time.Time) (evalInfos []types.EvaluationInfo, err error) {
+	var rows *sql.Rows
+	if rows, err = p.db.Query(sqlSelectPRsDueForRetry, now); err != nil {
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		evalInfo := types.EvaluationInfo{}
+		err = rows.Scan(
+			&evalInfo.RepoId,
+			&evalInfo.RepoOwner,
+			&evalInfo.RepoName,
+			&evalInfo.Sha,
+			&evalInfo.PRNumber,
+			&evalInfo.AppId,
+			&evalInfo.InstallId,
+			&evalInfo.Provider,
+		)
+		if err != nil {
+			return
+		}
+		evalInfos = append(evalInfos, evalInfo)
+	}
+	return
+}
+
+// sqlSelectPRsWithAllAuthorsSigned finds tracked PRs where every author we were waiting on has since signed,
+// which means the re-evaluation after signing did not happen (or did not finish). Only PRs checked, or with an
+// author who signed, after $1 are considered, so PRs abandoned long ago are not looked at on every pass.
+const sqlSelectPRsWithAllAuthorsSigned = `SELECT unsigned_pr.Id, COALESCE(unsigned_pr.RepoID, 0), unsigned_pr.RepoOwner,
+unsigned_pr.RepoName, unsigned_pr.sha, unsigned_pr.PRNumber, unsigned_pr.AppID, unsigned_pr.InstallID, unsigned_pr.Provider
+FROM unsigned_pr
+WHERE EXISTS (
+    SELECT 1 FROM unsigned_user
+    JOIN signatures ON signatures.LoginName = unsigned_user.LoginName AND signatures.ClaVersion = unsigned_user.ClaVersion
+    WHERE unsigned_user.UnsignedPRID = unsigned_pr.Id
+    AND (unsigned_user.CheckedAt > $1 OR signatures.SignedAt > $1)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM unsigned_user
+    WHERE unsigned_user.UnsignedPRID = unsigned_pr.Id
+    AND NOT EXISTS (
+        SELECT 1 FROM signatures
+        WHERE signatures.LoginName = unsigned_user.LoginName AND signatures.ClaVersion = unsigned_user.ClaVersion
+    )
+)`
+
+func (p *ClaDB) GetPRsWithAllAuthorsSigned(activeAfter time.Time) (evalInfos []types.EvaluationInfo, err error) {
+	var rows *sql.Rows
+	if rows, err = p.db.Query(sqlSelectPRsWithAllAuthorsSigned, activeAfter); err != nil {
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		evalInfo := types.EvaluationInfo{}
+		err = rows.Scan(
+			&evalInfo.UnsignedPRID,
+			&evalInfo.RepoId,
+			&evalInfo.RepoOwner,
+			&evalInfo.RepoName,
+			&evalInfo.Sha,
+			&evalInfo.PRNumber,
+			&evalInfo.AppId,
+			&evalInfo.InstallId,
+			&evalInfo.Provider,
+		)
+		if err != nil {
+			return
+		}
+		evalInfos = append(evalInfos, evalInfo)
+	}
+	return
+}
+
+// sqlAcquireLease takes the lease if nobody holds it, if it expired, or renews it if we already hold it.
+const sqlAcquireLease = `INSERT INTO lease (Name, Holder, ExpiresAt) VALUES ($1, $2, $3)
+		ON CONFLICT (Name) DO UPDATE SET Holder = EXCLUDED.Holder, ExpiresAt = EXCLUDED.ExpiresAt
+		WHERE lease.Holder = EXCLUDED.Holder OR lease.ExpiresAt < $4
+		RETURNING Holder`
+
+// AcquireLease attempts to take (or renew) the named lease for the given holder until now + ttl.
+func (p *ClaDB) AcquireLease(name, holder string, now time.Time, ttl time.Duration) (acquired bool, err error) {
+	var currentHolder string
+	err = p.db.QueryRow(sqlAcquireLease, name, holder, now.Add(ttl), now).Scan(&currentHolder)
+	if err != nil {
+		if errMsgInsertedRowExists == err.Error() {
+			// someone else holds an unexpired lease
+			err = nil
+		}
+		return
+	}
+	acquired = currentHolder == holder
+	return
+}
+
+const sqlReleaseLease = `DELETE FROM lease WHERE Name = $1 AND Holder = $2`
+
+func (p *ClaDB) ReleaseLease(name, holder string) (err error) {
+	_, err = p.db.Exec(sqlReleaseLease, name, holder)
+	return
+}
+
+const sqlSelectCachedCollaborator = `SELECT RepoID, RepoOwner, LoginName, IsCollaborator, CheckedAt
+		FROM collaborator_cache
+		WHERE RepoID = $1 AND LoginName = LOWER($2) AND CheckedAt > $3`
+
+// GetCachedCollaborator returns a collaborator lookup checked after the given time, or nil if there is none.
+func (p *ClaDB) GetCachedCollaborator(repoId int64, login string, checkedAfter time.Time) (collaborator *types.Collaborator, err error) {
+	found := types.Collaborator{}
+	err = p.db.QueryRow(sqlSelectCachedCollaborator, repoId, login, checkedAfter).Scan(
+		&found.RepoId,
+		&found.RepoOwner,
+		&found.Login,
+		&found.IsCollaborator,
+		&found.CheckedAt,
+	)
+	if err != nil {
+		if errMsgInsertedRowExists == err.Error() {
+			err = nil
+		}
+		return
+	}
+	collaborator = &found
+	return
+}
+
+const sqlUpsertCachedCollaborator = `INSERT INTO collaborator_cache
+		(RepoID, RepoOwner, LoginName, IsCollaborator, CheckedAt)
+		VALUES ($1, LOWER($2), LOWER($3), $4, $5)
+		ON CONFLICT (RepoID, LoginName) DO UPDATE SET
+		RepoOwner = EXCLUDED.RepoOwner, IsCollaborator = EXCLUDED.IsCollaborator, CheckedAt = EXCLUDED.CheckedAt`
+
+func (p *ClaDB) StoreCachedCollaborator(collaborator *types.Collaborator) (err error) {
+	_, err = p.db.Exec(sqlUpsertCachedCollaborator, collaborator.RepoId, collaborator.RepoOwner, collaborator.Login,
+		collaborator.IsCollaborator, collaborator.CheckedAt)
+	return
+}
+
+const sqlDeleteCachedCollaboratorsForRepo = `DELETE FROM collaborator_cache WHERE RepoID = $1 AND LoginName = LOWER($2)`
+
+const sqlDeleteCachedCollaboratorsForOwner = `DELETE FROM collaborator_cache WHERE RepoOwner = LOWER($1) AND LoginName = LOWER($2)`
+
+// InvalidateCachedCollaborators forgets lookups for a login, either on one repository, or (with a zero repoId)
+// on every repository of the owner.
+func (p *ClaDB) InvalidateCachedCollaborators(repoOwner string, repoId int64, login string) (err error) {
+	if repoId != 0 {
+		_, err = p.db.Exec(sqlDeleteCachedCollaboratorsForRepo, repoId, login)
+	} else {
+		_, err = p.db.Exec(sqlDeleteCachedCollaboratorsForOwner, repoOwner, login)
+	}
+	return
+}
+
+const sqlInsertAuditEvent = `INSERT INTO audit_log
+		(CreatedAt, Actor, Action, RepoID, RepoOwner, RepoName, PRNumber, Detail, Provider, Sha)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+func (p *ClaDB) InsertAuditEvent(event *types.AuditEvent) (err error) {
+	provider := event.Provider
+	if provider == "" {
+		provider = vcs.ProviderGitHub
+	}
+	_, err = p.db.Exec(sqlInsertAuditEvent, event.CreatedAt, event.Actor, event.Action, event.RepoId, event.RepoOwner,
+		event.RepoName, event.PRNumber, event.Detail, provider, event.Sha)
+	return
+}
+
+const sqlSelectLatestOverrideEvent = `SELECT CreatedAt, Actor, Action, RepoID, RepoOwner, RepoName, PRNumber, COALESCE(Detail, ''), Provider,
+		COALESCE(Sha, '')
+		FROM audit_log
+		WHERE RepoID = $1 AND PRNumber = $2 AND Provider = $3 AND Action IN ('` + types.AuditActionOverrideApplied + `', '` + types.AuditActionOverrideRemoved + `')
+		ORDER BY CreatedAt DESC
+		LIMIT 1`
+
+// GetPROverride returns the audit event of the override in effect for a PR, or nil if the PR was never
+// overridden, or the override was removed since.
+func (p *ClaDB) GetPROverride(provider string, repoId, prNumber int64) (override *types.AuditEvent, err error) {
+	event := types.AuditEvent{}
+	err = p.db.QueryRow(sqlSelectLatestOverrideEvent, repoId, prNumber, provider).Scan(
+		&event.CreatedAt,
+		&event.Actor,
+		&event.Action,
+		&event.RepoId,
+		&event.RepoOwner,
+		&event.RepoName,
+		&event.PRNumber,
+		&event.Detail,
+		&event.Provider,
+		&event.Sha,
+	)
+	if err != nil {
+		if errMsgInsertedRowExists == err.Error() {
+			err = nil
+		}
+		return
+	}
+	if event.Action == types.AuditActionOverrideApplied {
+		override = &event
+	}
+	return
+}
+
+const sqlSelectTenants = `SELECT Name, AppID, KeyFile, WebhookSecret, ClaVersion, ClaTextUrl, NotifyEmail
+		FROM tenant
+		ORDER BY Name`
+
+const sqlSelectTenantAdmins = `SELECT TenantName, LoginName FROM tenant_admin ORDER BY TenantName, LoginName`
+
+// GetTenants returns all tenants, along with their admins.
+func (p *ClaDB) GetTenants() (tenants []types.Tenant, err error) {
+	var rows *sql.Rows
+	if rows, err = p.db.Query(sqlSelectTenants); err != nil {
+		return
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	byName := make(map[string]int)
+	for rows.Next() {
+		tenant := types.Tenant{}
+		err = rows.Scan(
+			&tenant.Name,
+			&tenant.AppId,
+			&tenant.KeyFile,
+			&tenant.WebhookSecret,
+			&tenant.CLAVersion,
+			&tenant.CLATextUrl,
+			&tenant.NotifyEmail,
+		)
+		if err != nil {
+			return
+		}
+		byName[tenant.Name] = len(tenants)
+		tenants = append(tenants, tenant)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	var adminRows *sql.Rows
+	if adminRows, err = p.db.Query(sqlSelectTenantAdmins); err != nil {
+		return
+	}
+	defer func() {
+		_ = adminRows.Close()
+	}()
+
+	for adminRows.Next() {
+		var tenantName, login string
+		if err = adminRows.Scan(&tenantName, &login); err != nil {
+			return
+		}
+		if i, ok := byName[tenantName]; ok {
+			tenants[i].Admins = append(tenants[i].Admins, login)
+		}
+	}
+	err = adminRows.Err()
+	return
+}
@@ -66,5 +66,8 @@ func ConvertSqlToDbMockExpect(realSql string) string {
 
 	reStar := regexp.MustCompile(`(\*)`)
 	sqlMatch = reStar.ReplaceAll(sqlMatch, []byte(`\*`))
+
+	rePlus := regexp.MustCompile(`(\+)`)
+	sqlMatch = rePlus.ReplaceAll(sqlMatch, []byte(`\+`))
 	return string(sqlMatch)
 }
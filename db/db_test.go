@@ -19,6 +19,7 @@
 package db
 
 import (
+	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"fmt"
@@ -28,6 +29,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/go-github/v64/github"
 	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -210,11 +212,11 @@ func TestStorePRAuthorsMissingSignatureInsertError(t *testing.T) {
 
 	forcedError := errors.New("forced insert error")
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
-		WithArgs(evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "github").
 		WillReturnError(forcedError)
 
 	assert.EqualError(t, db.StorePRAuthorsMissingSignature(&evalInfo, time.Now()),
-		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoName, pullRequestID, forcedError))
+		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoOwner, repoName, pullRequestID, forcedError))
 }
 
 func TestStorePRAuthorsMissingSignatureInsertErrorRowExists(t *testing.T) {
@@ -252,16 +254,16 @@ func TestStorePRAuthorsMissingSignatureInsertErrorRowExists(t *testing.T) {
 
 	forcedRowExistsError := errors.New(errMsgInsertedRowExists)
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
-		WithArgs(evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "github").
 		WillReturnError(forcedRowExistsError)
 
 	forcedError := errors.New("forced insert error")
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectPR)).
-		WithArgs(evalInfo.RepoName, evalInfo.PRNumber).
+		WithArgs(evalInfo.RepoId, evalInfo.PRNumber, "github").
 		WillReturnError(forcedError)
 
 	assert.EqualError(t, db.StorePRAuthorsMissingSignature(&evalInfo, time.Now()),
-		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoName, pullRequestID, forcedError))
+		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoOwner, repoName, pullRequestID, forcedError))
 }
 
 func TestStorePRAuthorsMissingSignatureQueryParentPRError(t *testing.T) {
@@ -299,15 +301,15 @@ func TestStorePRAuthorsMissingSignatureQueryParentPRError(t *testing.T) {
 
 	forcedRowExistsError := errors.New(errMsgInsertedRowExists)
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
-		WithArgs(evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "github").
 		WillReturnError(forcedRowExistsError)
 
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectPR)).
-		WithArgs(evalInfo.RepoName, evalInfo.PRNumber).
+		WithArgs(evalInfo.RepoId, evalInfo.PRNumber, "github").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}))
 
 	assert.EqualError(t, db.StorePRAuthorsMissingSignature(&evalInfo, time.Now()),
-		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoName, pullRequestID, errors.New(errMsgInsertedRowExists)))
+		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoOwner, repoName, pullRequestID, errors.New(errMsgInsertedRowExists)))
 }
 
 func TestStorePRAuthorsMissingSignatureInsertEmptyParentUUID(t *testing.T) {
@@ -345,16 +347,16 @@ func TestStorePRAuthorsMissingSignatureInsertEmptyParentUUID(t *testing.T) {
 
 	forcedRowExistsError := errors.New(errMsgInsertedRowExists)
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
-		WithArgs(evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "github").
 		WillReturnError(forcedRowExistsError)
 
 	parentUUID := ""
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectPR)).
-		WithArgs(evalInfo.RepoName, evalInfo.PRNumber).
+		WithArgs(evalInfo.RepoId, evalInfo.PRNumber, "github").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(parentUUID))
 
 	assert.EqualError(t, db.StorePRAuthorsMissingSignature(&evalInfo, time.Now()),
-		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoName, pullRequestID, errors.New("empty parentUUID")))
+		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoOwner, repoName, pullRequestID, errors.New("empty parentUUID")))
 }
 
 func TestStorePRAuthorsMissingSignatureParentInsertError(t *testing.T) {
@@ -392,11 +394,11 @@ func TestStorePRAuthorsMissingSignatureParentInsertError(t *testing.T) {
 
 	forcedError := errors.New("forced insert error")
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
-		WithArgs(evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "github").
 		WillReturnError(forcedError)
 
 	assert.EqualError(t, db.StorePRAuthorsMissingSignature(&evalInfo, time.Now()),
-		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoName, pullRequestID, forcedError))
+		fmt.Sprintf(msgTemplateErrInsertPRMissing, repoOwner, repoName, pullRequestID, forcedError))
 }
 
 func TestStorePRAuthorsMissingSignatureUserInsertError(t *testing.T) {
@@ -434,7 +436,7 @@ func TestStorePRAuthorsMissingSignatureUserInsertError(t *testing.T) {
 
 	parentUUID := "myParentUUID"
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
-		WithArgs(evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "github").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(parentUUID))
 
 	forcedError := errors.New("forced insert error")
@@ -481,7 +483,7 @@ func TestStorePRAuthorsMissingSignatureUserInsertZero(t *testing.T) {
 
 	parentUUID := "myParentUUID"
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
-		WithArgs(evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "github").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(parentUUID))
 
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertUserMissing)).
@@ -526,7 +528,7 @@ func TestStorePRAuthorsMissingSignatureUserInsert(t *testing.T) {
 
 	parentUUID := "myParentUUID"
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
-		WithArgs(evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "github").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(parentUUID))
 
 	authorUUID := "myAuthorUUID"
@@ -537,6 +539,78 @@ func TestStorePRAuthorsMissingSignatureUserInsert(t *testing.T) {
 	assert.NoError(t, db.StorePRAuthorsMissingSignature(&evalInfo, time.Now()))
 }
 
+func TestStorePRAuthorsMissingSignatureAdoptLegacyError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	evalInfo := types.EvaluationInfo{
+		RepoId:    -4,
+		RepoOwner: "myRepoOwner",
+		RepoName:  "myRepoName",
+		PRNumber:  -1,
+	}
+
+	forcedError := errors.New("forced adopt error")
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlAdoptLegacyPRs)).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName).
+		WillReturnError(forcedError)
+
+	assert.EqualError(t, db.StorePRAuthorsMissingSignature(&evalInfo, time.Now()),
+		fmt.Sprintf(msgTemplateErrInsertPRMissing, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, forcedError))
+}
+
+func TestStorePRAuthorsMissingSignatureAdoptsLegacyRows(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	evalInfo := types.EvaluationInfo{
+		RepoId:    -4,
+		RepoOwner: "myRepoOwner",
+		RepoName:  "myRepoName",
+		Sha:       "mySha",
+		PRNumber:  -1,
+		AppId:     -2,
+		InstallId: -3,
+	}
+
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlAdoptLegacyPRs)).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "github").
+		WillReturnError(errors.New(errMsgInsertedRowExists))
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectPR)).
+		WithArgs(evalInfo.RepoId, evalInfo.PRNumber, "github").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("myParentUUID"))
+
+	assert.NoError(t, db.StorePRAuthorsMissingSignature(&evalInfo, time.Now()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStorePRAuthorsMissingSignatureGitLab(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	evalInfo := types.EvaluationInfo{
+		Provider:  "gitlab",
+		RepoId:    -4,
+		RepoOwner: "myGroup",
+		RepoName:  "myProject",
+		Sha:       "mySha",
+		PRNumber:  -1,
+	}
+
+	// merge requests never had legacy rows to adopt
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlInsertPRMissing)).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, evalInfo.PRNumber, evalInfo.AppId, evalInfo.InstallId, "gitlab").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("myParentUUID"))
+
+	assert.NoError(t, db.StorePRAuthorsMissingSignature(&evalInfo, time.Now()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetPRsForUserSelectPRsError(t *testing.T) {
 	mock, db, closeDbFunc := SetupMockDB(t)
 	defer closeDbFunc()
@@ -594,7 +668,7 @@ func TestGetPRsForUserScanError(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"tooFewCollumns"}).AddRow("oneValue"))
 
 	evalInfos, err := db.GetPRsForUser(&user)
-	assert.EqualError(t, err, "sql: expected 1 destination arguments in Scan, not 7")
+	assert.EqualError(t, err, "sql: expected 1 destination arguments in Scan, not 9")
 	assert.Equal(t, []types.EvaluationInfo(nil), evalInfos)
 }
 
@@ -613,9 +687,9 @@ func TestGetPRsForUserTwoRows(t *testing.T) {
 
 	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectPRsForUser)).
 		WithArgs(user.User.Login, user.CLAVersion).
-		WillReturnRows(sqlmock.NewRows([]string{"1", "2", "3", "4", "5", "6", "7"}).
-			AddRow("UnsignedPRID", "RepoOwner", "RepoName", "Sha", -1, -2, -3).
-			AddRow("1", "2", "3", "4", "5", "6", "7"),
+		WillReturnRows(sqlmock.NewRows([]string{"1", "2", "3", "4", "5", "6", "7", "8", "9"}).
+			AddRow("UnsignedPRID", -4, "RepoOwner", "RepoName", "Sha", -1, -2, -3, "github").
+			AddRow("1", "2", "3", "4", "5", "6", "7", "8", "gitlab"),
 		)
 
 	evalInfos, err := db.GetPRsForUser(&user)
@@ -624,12 +698,14 @@ func TestGetPRsForUserTwoRows(t *testing.T) {
 	assert.Equal(t,
 		types.EvaluationInfo{
 			UnsignedPRID: "UnsignedPRID",
+			RepoId:       -4,
 			RepoOwner:    "RepoOwner",
 			RepoName:     "RepoName",
 			Sha:          "Sha",
 			PRNumber:     -1,
 			AppId:        -2,
 			InstallId:    -3,
+			Provider:     "github",
 		},
 		evalInfos[0],
 	)
@@ -750,3 +826,565 @@ func TestRemovePRsForUsersEmptyPRUUID(t *testing.T) {
 
 	assert.NoError(t, db.RemovePRsForUsers(nil, &types.EvaluationInfo{}))
 }
+
+func TestUpdateRepositoryNamesError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced update repository names error")
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlUpdateRepositoryNames)).
+		WithArgs(int64(-1), "newOwner", "newName", "ghe.example.com").
+		WillReturnError(forcedError)
+
+	assert.EqualError(t, db.UpdateRepositoryNames("ghe.example.com", -1, "newOwner", "newName"), forcedError.Error())
+}
+
+func TestUpdateRepositoryNames(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlUpdateRepositoryNames)).
+		WithArgs(int64(-1), "newOwner", "newName", "ghe.example.com").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	assert.NoError(t, db.UpdateRepositoryNames("ghe.example.com", -1, "newOwner", "newName"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLegacyPRRepositories(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(SqlSelectLegacyPRRepositories)).
+		WillReturnRows(sqlmock.NewRows([]string{"RepoOwner", "RepoName", "AppID", "InstallID"}).
+			AddRow("oldOwner", "oldName", -2, -3))
+
+	repos, err := db.GetLegacyPRRepositories()
+	assert.NoError(t, err)
+	assert.Equal(t, []types.EvaluationInfo{{RepoOwner: "oldOwner", RepoName: "oldName", AppId: -2, InstallId: -3}}, repos)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLegacyPRRepositoriesError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced select legacy repositories error")
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(SqlSelectLegacyPRRepositories)).
+		WillReturnError(forcedError)
+
+	repos, err := db.GetLegacyPRRepositories()
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, repos)
+}
+
+func TestAdoptLegacyPRs(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlBackfillLegacyPRs)).
+		WithArgs(int64(-1), "oldOwner", "oldName", "newOwner", "newName").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	adopted, err := db.AdoptLegacyPRs(-1, "oldOwner", "oldName", "newOwner", "newName")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), adopted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdoptLegacyPRsError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced adopt legacy PRs error")
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlBackfillLegacyPRs)).
+		WithArgs(int64(-1), "oldOwner", "oldName", "newOwner", "newName").
+		WillReturnError(forcedError)
+
+	_, err := db.AdoptLegacyPRs(-1, "oldOwner", "oldName", "newOwner", "newName")
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestStorePRStatus(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	evalInfo := types.EvaluationInfo{RepoId: -4, RepoOwner: "myRepoOwner", RepoName: "myRepoName", Sha: "mySha", PRNumber: -1, AppId: -2, InstallId: -3}
+	mock.ExpectExec(ConvertSqlToDbMockExpect(SqlUpsertPRStatus)).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, evalInfo.Sha, evalInfo.AppId, evalInfo.InstallId, "pending", AnyTime{}, "github").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, db.StorePRStatus(&evalInfo, "pending", time.Now()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStorePRFailure(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	evalInfo := types.EvaluationInfo{RepoId: -4, RepoOwner: "myRepoOwner", RepoName: "myRepoName", Sha: "mySha", PRNumber: -1, AppId: -2, InstallId: -3}
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(SqlUpsertPRFailure)).
+		WithArgs(evalInfo.RepoId, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, evalInfo.Sha, evalInfo.AppId, evalInfo.InstallId, AnyTime{}, "myError", "github").
+		WillReturnRows(sqlmock.NewRows([]string{"Attempts"}).AddRow(3))
+
+	attempts, err := db.StorePRFailure(&evalInfo, "myError", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStorePRFailureError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced store PR failure error")
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(SqlUpsertPRFailure)).
+		WillReturnError(forcedError)
+
+	attempts, err := db.StorePRFailure(&types.EvaluationInfo{}, "myError", time.Now())
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Equal(t, 0, attempts)
+}
+
+func TestSchedulePRRetry(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	evalInfo := types.EvaluationInfo{RepoId: -4, PRNumber: -1}
+	nextAttemptAt := time.Now()
+	mock.ExpectExec(ConvertSqlToDbMockExpect(SqlUpdatePRNextAttempt)).
+		WithArgs(nextAttemptAt, evalInfo.RepoId, evalInfo.PRNumber, "github").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, db.SchedulePRRetry(&evalInfo, nextAttemptAt))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPRStatusNotFound(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(SqlSelectPRStatus)).
+		WithArgs(-4, -1, "github").
+		WillReturnError(sql.ErrNoRows)
+
+	prStatus, err := db.GetPRStatus(vcs.ProviderGitHub, -4, -1)
+	assert.NoError(t, err)
+	assert.Nil(t, prStatus)
+}
+
+func TestGetPRStatusError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced select PR status error")
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(SqlSelectPRStatus)).
+		WillReturnError(forcedError)
+
+	prStatus, err := db.GetPRStatus(vcs.ProviderGitHub, -4, -1)
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, prStatus)
+}
+
+func TestGetPRStatus(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	updatedAt := time.Now()
+	nextAttemptAt := updatedAt.Add(time.Minute)
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(SqlSelectPRStatus)).
+		WithArgs(-4, -1, "github").
+		WillReturnRows(sqlmock.NewRows([]string{"RepoID", "RepoOwner", "RepoName", "PRNumber", "sha", "State", "UpdatedAt", "LastError", "Attempts", "NextAttemptAt"}).
+			AddRow(-4, "myRepoOwner", "myRepoName", -1, "mySha", "error", updatedAt, "myError", 2, nextAttemptAt))
+
+	prStatus, err := db.GetPRStatus(vcs.ProviderGitHub, -4, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.PRStatus{
+		RepoId:        -4,
+		RepoOwner:     "myRepoOwner",
+		RepoName:      "myRepoName",
+		PRNumber:      -1,
+		Sha:           "mySha",
+		State:         "error",
+		UpdatedAt:     updatedAt,
+		LastError:     "myError",
+		Attempts:      2,
+		NextAttemptAt: &nextAttemptAt,
+	}, prStatus)
+}
+
+func TestGetStalePRsError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced select stale PRs error")
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectStalePRs)).
+		WillReturnError(forcedError)
+
+	evalInfos, err := db.GetStalePRs("pending", time.Now(), time.Now())
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, evalInfos)
+}
+
+func TestGetStalePRs(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	before := time.Now()
+	after := before.Add(-time.Hour)
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectStalePRs)).
+		WithArgs("pending", before, after).
+		WillReturnRows(sqlmock.NewRows([]string{"RepoID", "RepoOwner", "RepoName", "sha", "PRNumber", "AppID", "InstallID", "Provider"}).
+			AddRow(-4, "myRepoOwner", "myRepoName", "mySha", -1, -2, -3, "github"))
+
+	evalInfos, err := db.GetStalePRs("pending", before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.EvaluationInfo{
+		{RepoId: -4, RepoOwner: "myRepoOwner", RepoName: "myRepoName", Sha: "mySha", PRNumber: -1, AppId: -2, InstallId: -3, Provider: "github"},
+	}, evalInfos)
+}
+
+func TestGetPRsDueForRetry(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	now := time.Now()
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectPRsDueForRetry)).
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"RepoID", "RepoOwner", "RepoName", "sha", "PRNumber", "AppID", "InstallID", "Provider"}).
+			AddRow(-4, "myRepoOwner", "myRepoName", "mySha", -1, -2, -3, "github"))
+
+	evalInfos, err := db.GetPRsDueForRetry(now)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.EvaluationInfo{
+		{RepoId: -4, RepoOwner: "myRepoOwner", RepoName: "myRepoName", Sha: "mySha", PRNumber: -1, AppId: -2, InstallId: -3, Provider: "github"},
+	}, evalInfos)
+}
+
+func TestGetPRsWithAllAuthorsSignedScanError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectPRsWithAllAuthorsSigned)).
+		WillReturnRows(sqlmock.NewRows([]string{"tooFewColumns"}).AddRow("oneValue"))
+
+	_, err := db.GetPRsWithAllAuthorsSigned(time.Now())
+	assert.EqualError(t, err, "sql: expected 1 destination arguments in Scan, not 9")
+}
+
+func TestGetPRsWithAllAuthorsSigned(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	activeAfter := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectPRsWithAllAuthorsSigned)).
+		WithArgs(activeAfter).
+		WillReturnRows(sqlmock.NewRows([]string{"1", "2", "3", "4", "5", "6", "7", "8", "9"}).
+			AddRow("UnsignedPRID", -4, "RepoOwner", "RepoName", "Sha", -1, -2, -3, "gitlab"))
+
+	evalInfos, err := db.GetPRsWithAllAuthorsSigned(activeAfter)
+	assert.NoError(t, err)
+	assert.Equal(t, []types.EvaluationInfo{
+		{UnsignedPRID: "UnsignedPRID", RepoId: -4, RepoOwner: "RepoOwner", RepoName: "RepoName", Sha: "Sha", PRNumber: -1, AppId: -2, InstallId: -3, Provider: "gitlab"},
+	}, evalInfos)
+}
+
+func TestAcquireLeaseAcquired(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	now := time.Now()
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlAcquireLease)).
+		WithArgs("myLease", "me", now.Add(time.Minute), now).
+		WillReturnRows(sqlmock.NewRows([]string{"Holder"}).AddRow("me"))
+
+	acquired, err := db.AcquireLease("myLease", "me", now, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestAcquireLeaseHeldElsewhere(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlAcquireLease)).
+		WillReturnRows(sqlmock.NewRows([]string{"Holder"}))
+
+	acquired, err := db.AcquireLease("myLease", "me", time.Now(), time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, acquired)
+}
+
+func TestAcquireLeaseError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced lease error")
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlAcquireLease)).
+		WillReturnError(forcedError)
+
+	acquired, err := db.AcquireLease("myLease", "me", time.Now(), time.Minute)
+	assert.EqualError(t, err, forcedError.Error())
+	assert.False(t, acquired)
+}
+
+func TestReleaseLease(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlReleaseLease)).
+		WithArgs("myLease", "me").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, db.ReleaseLease("myLease", "me"))
+}
+
+func TestGetCachedCollaboratorNotFound(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	checkedAfter := time.Now()
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectCachedCollaborator)).
+		WithArgs(-1, "myLogin", checkedAfter).
+		WillReturnError(sql.ErrNoRows)
+
+	collaborator, err := db.GetCachedCollaborator(-1, "myLogin", checkedAfter)
+	assert.NoError(t, err)
+	assert.Nil(t, collaborator)
+}
+
+func TestGetCachedCollaboratorError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced select collaborator error")
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectCachedCollaborator)).
+		WillReturnError(forcedError)
+
+	collaborator, err := db.GetCachedCollaborator(-1, "myLogin", time.Now())
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, collaborator)
+}
+
+func TestGetCachedCollaborator(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	checkedAt := time.Now()
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectCachedCollaborator)).
+		WithArgs(-1, "myLogin", checkedAt.Add(-time.Minute)).
+		WillReturnRows(sqlmock.NewRows([]string{"RepoID", "RepoOwner", "LoginName", "IsCollaborator", "CheckedAt"}).
+			AddRow(-1, "myowner", "mylogin", true, checkedAt))
+
+	collaborator, err := db.GetCachedCollaborator(-1, "myLogin", checkedAt.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, &types.Collaborator{
+		RepoId:         -1,
+		RepoOwner:      "myowner",
+		Login:          "mylogin",
+		IsCollaborator: true,
+		CheckedAt:      checkedAt,
+	}, collaborator)
+}
+
+func TestStoreCachedCollaborator(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	checkedAt := time.Now()
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlUpsertCachedCollaborator)).
+		WithArgs(-1, "myOwner", "myLogin", false, checkedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, db.StoreCachedCollaborator(&types.Collaborator{
+		RepoId:    -1,
+		RepoOwner: "myOwner",
+		Login:     "myLogin",
+		CheckedAt: checkedAt,
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInvalidateCachedCollaboratorsForRepo(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlDeleteCachedCollaboratorsForRepo)).
+		WithArgs(-1, "myLogin").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, db.InvalidateCachedCollaborators("myOwner", -1, "myLogin"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInvalidateCachedCollaboratorsForOwner(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced delete collaborators error")
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlDeleteCachedCollaboratorsForOwner)).
+		WithArgs("myOwner", "myLogin").
+		WillReturnError(forcedError)
+
+	assert.EqualError(t, db.InvalidateCachedCollaborators("myOwner", 0, "myLogin"), forcedError.Error())
+}
+
+func TestInsertAuditEvent(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	now := time.Now()
+	mock.ExpectExec(ConvertSqlToDbMockExpect(sqlInsertAuditEvent)).
+		WithArgs(now, "maintainer", types.AuditActionOverrideApplied, -1, "myOwner", "myRepo", -2, "cla: override", "github", "headSha").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, db.InsertAuditEvent(&types.AuditEvent{
+		CreatedAt: now,
+		Actor:     "maintainer",
+		Action:    types.AuditActionOverrideApplied,
+		RepoId:    -1,
+		RepoOwner: "myOwner",
+		RepoName:  "myRepo",
+		PRNumber:  -2,
+		Sha:       "headSha",
+		Detail:    "cla: override",
+	}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPROverrideNotFound(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectLatestOverrideEvent)).
+		WithArgs(-1, -2, "github").
+		WillReturnError(sql.ErrNoRows)
+
+	override, err := db.GetPROverride(vcs.ProviderGitHub, -1, -2)
+	assert.NoError(t, err)
+	assert.Nil(t, override)
+}
+
+func TestGetPROverrideError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced select override error")
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectLatestOverrideEvent)).
+		WillReturnError(forcedError)
+
+	override, err := db.GetPROverride(vcs.ProviderGitHub, -1, -2)
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, override)
+}
+
+var auditEventColumns = []string{"CreatedAt", "Actor", "Action", "RepoID", "RepoOwner", "RepoName", "PRNumber", "Detail", "Provider", "Sha"}
+
+func TestGetPROverrideRemoved(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectLatestOverrideEvent)).
+		WithArgs(-1, -2, "github").
+		WillReturnRows(sqlmock.NewRows(auditEventColumns).
+			AddRow(time.Now(), "maintainer", types.AuditActionOverrideRemoved, -1, "myOwner", "myRepo", -2, "cla: override", "github", "headSha"))
+
+	override, err := db.GetPROverride(vcs.ProviderGitHub, -1, -2)
+	assert.NoError(t, err)
+	assert.Nil(t, override)
+}
+
+func TestGetPROverride(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	now := time.Now()
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectLatestOverrideEvent)).
+		WithArgs(-1, -2, "github").
+		WillReturnRows(sqlmock.NewRows(auditEventColumns).
+			AddRow(now, "maintainer", types.AuditActionOverrideApplied, -1, "myOwner", "myRepo", -2, "cla: override", "github", "headSha"))
+
+	override, err := db.GetPROverride(vcs.ProviderGitHub, -1, -2)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.AuditEvent{
+		Provider:  vcs.ProviderGitHub,
+		CreatedAt: now,
+		Actor:     "maintainer",
+		Action:    types.AuditActionOverrideApplied,
+		RepoId:    -1,
+		RepoOwner: "myOwner",
+		RepoName:  "myRepo",
+		PRNumber:  -2,
+		Sha:       "headSha",
+		Detail:    "cla: override",
+	}, override)
+}
+
+var tenantColumns = []string{"Name", "AppID", "KeyFile", "WebhookSecret", "ClaVersion", "ClaTextUrl", "NotifyEmail"}
+
+func TestGetTenants(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectTenants)).
+		WillReturnRows(sqlmock.NewRows(tenantColumns).
+			AddRow("apache", 11, "apache.pem", "apacheSecret", "2", "https://example.com/apache-cla.txt", "legal@apache.example").
+			AddRow("eclipse", 12, "eclipse.pem", "eclipseSecret", "1", "https://example.com/eclipse-cla.txt", ""))
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectTenantAdmins)).
+		WillReturnRows(sqlmock.NewRows([]string{"TenantName", "LoginName"}).
+			AddRow("apache", "alice").
+			AddRow("apache", "bob").
+			AddRow("eclipse", "carol"))
+
+	tenants, err := db.GetTenants()
+	assert.NoError(t, err)
+	assert.Equal(t, []types.Tenant{
+		{Name: "apache", AppId: 11, KeyFile: "apache.pem", WebhookSecret: "apacheSecret", CLAVersion: "2",
+			CLATextUrl: "https://example.com/apache-cla.txt", NotifyEmail: "legal@apache.example", Admins: []string{"alice", "bob"}},
+		{Name: "eclipse", AppId: 12, KeyFile: "eclipse.pem", WebhookSecret: "eclipseSecret", CLAVersion: "1",
+			CLATextUrl: "https://example.com/eclipse-cla.txt", Admins: []string{"carol"}},
+	}, tenants)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTenantsNone(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectTenants)).
+		WillReturnRows(sqlmock.NewRows(tenantColumns))
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectTenantAdmins)).
+		WillReturnRows(sqlmock.NewRows([]string{"TenantName", "LoginName"}))
+
+	tenants, err := db.GetTenants()
+	assert.NoError(t, err)
+	assert.Nil(t, tenants)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTenantsError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	forcedError := errors.New("forced select tenants error")
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectTenants)).
+		WillReturnError(forcedError)
+
+	tenants, err := db.GetTenants()
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, tenants)
+}
+
+func TestGetTenantsAdminsError(t *testing.T) {
+	mock, db, closeDbFunc := SetupMockDB(t)
+	defer closeDbFunc()
+
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectTenants)).
+		WillReturnRows(sqlmock.NewRows(tenantColumns))
+	forcedError := errors.New("forced select tenant admins error")
+	mock.ExpectQuery(ConvertSqlToDbMockExpect(sqlSelectTenantAdmins)).
+		WillReturnError(forcedError)
+
+	_, err := db.GetTenants()
+	assert.EqualError(t, err, forcedError.Error())
+}
@@ -0,0 +1,22 @@
+BEGIN;
+
+-- Without RepoID, PRs are unique by name again, which PRs of different repositories sharing a name can't be.
+-- Refuse to run rather than drop PRs still waiting on signatures.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM unsigned_pr GROUP BY RepoName, PRNumber HAVING count(*) > 1) THEN
+        RAISE EXCEPTION 'unsigned_pr has PRs of repositories sharing a name, remove them before downgrading';
+    END IF;
+END
+$$;
+
+DROP INDEX IF EXISTS unsigned_pr_legacy_repo_prnumber_key;
+DROP INDEX IF EXISTS unsigned_pr_repoid_prnumber_key;
+
+ALTER TABLE unsigned_pr
+    DROP COLUMN RepoID;
+
+ALTER TABLE unsigned_pr
+    ADD CONSTRAINT unsigned_pr_reponame_prnumber_key UNIQUE (RepoName, PRNumber);
+
+COMMIT;
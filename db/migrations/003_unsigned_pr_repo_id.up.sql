@@ -0,0 +1,19 @@
+BEGIN;
+
+-- PRs are now identified by the GitHub repository ID, which survives renames and transfers.
+-- Existing rows are not backfilled here: the IDs are only known to GitHub, not to this database. They keep a NULL
+-- RepoID, and stay unique by owner and name, until the next evaluation of a PR in that repository adopts them by name,
+-- or POST /info/backfill-repo-ids looks their repositories up on GitHub, renamed and transferred ones included.
+ALTER TABLE unsigned_pr
+    ADD COLUMN RepoID BIGINT;
+
+ALTER TABLE unsigned_pr
+    DROP CONSTRAINT unsigned_pr_reponame_prnumber_key;
+
+CREATE UNIQUE INDEX unsigned_pr_repoid_prnumber_key ON unsigned_pr (RepoID, PRNumber)
+    WHERE RepoID IS NOT NULL;
+
+CREATE UNIQUE INDEX unsigned_pr_legacy_repo_prnumber_key ON unsigned_pr (RepoOwner, RepoName, PRNumber)
+    WHERE RepoID IS NULL;
+
+COMMIT;
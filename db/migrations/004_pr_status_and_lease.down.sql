@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS lease;
+DROP TABLE IF EXISTS pr_status;
+
+COMMIT;
@@ -0,0 +1,29 @@
+BEGIN;
+
+-- Latest commit status we reported for each PR, used to find evaluations that never finished.
+CREATE TABLE pr_status
+(
+    Id        UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    RepoID    BIGINT       NOT NULL,
+    RepoOwner varchar(250) NOT NULL,
+    RepoName  varchar(250) NOT NULL,
+    PRNumber  int          NOT NULL,
+    sha       varchar(250) NOT NULL,
+    AppID     int          NOT NULL,
+    InstallID BIGINT       NOT NULL,
+    State     varchar(20)  NOT NULL,
+    UpdatedAt timestamp    NOT NULL,
+    UNIQUE (RepoID, PRNumber)
+);
+
+CREATE INDEX pr_status_state_updatedat ON pr_status (State, UpdatedAt);
+
+-- Named leases let a single replica own a background job at a time.
+CREATE TABLE lease
+(
+    Name      varchar(100) PRIMARY KEY,
+    Holder    varchar(250) NOT NULL,
+    ExpiresAt timestamp    NOT NULL
+);
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS pr_status_state_nextattemptat;
+
+ALTER TABLE pr_status DROP COLUMN IF EXISTS NextAttemptAt;
+ALTER TABLE pr_status DROP COLUMN IF EXISTS Attempts;
+ALTER TABLE pr_status DROP COLUMN IF EXISTS LastError;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Track failed evaluations, so they can be shown on the diagnostics page and retried with backoff.
+ALTER TABLE pr_status ADD COLUMN LastError TEXT;
+ALTER TABLE pr_status ADD COLUMN Attempts int NOT NULL DEFAULT 0;
+ALTER TABLE pr_status ADD COLUMN NextAttemptAt timestamp;
+
+CREATE INDEX pr_status_state_nextattemptat ON pr_status (State, NextAttemptAt);
+
+COMMIT;
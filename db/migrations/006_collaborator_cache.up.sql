@@ -0,0 +1,16 @@
+BEGIN;
+
+-- Collaborator lookups shared between replicas, to save GitHub API calls. Logins are stored lower case.
+CREATE TABLE collaborator_cache
+(
+    RepoID         BIGINT       NOT NULL,
+    RepoOwner      varchar(250) NOT NULL,
+    LoginName      varchar(250) NOT NULL,
+    IsCollaborator boolean      NOT NULL,
+    CheckedAt      timestamp    NOT NULL,
+    PRIMARY KEY (RepoID, LoginName)
+);
+
+CREATE INDEX collaborator_cache_owner_login ON collaborator_cache (RepoOwner, LoginName);
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Who did what to a PR outside the normal evaluation, e.g. overriding the CLA check with a label.
+CREATE TABLE audit_log
+(
+    Id        UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    CreatedAt timestamp    NOT NULL,
+    Actor     varchar(250) NOT NULL,
+    Action    varchar(50)  NOT NULL,
+    RepoID    BIGINT       NOT NULL,
+    RepoOwner varchar(250) NOT NULL,
+    RepoName  varchar(250) NOT NULL,
+    PRNumber  int          NOT NULL,
+    Detail    TEXT
+);
+
+CREATE INDEX audit_log_repoid_prnumber ON audit_log (RepoID, PRNumber, CreatedAt);
+
+COMMIT;
@@ -0,0 +1,25 @@
+BEGIN;
+
+DELETE FROM pr_status WHERE Provider <> 'github';
+
+ALTER TABLE pr_status
+    DROP CONSTRAINT pr_status_provider_repoid_prnumber_key;
+
+ALTER TABLE pr_status
+    ADD CONSTRAINT pr_status_repoid_prnumber_key UNIQUE (RepoID, PRNumber);
+
+ALTER TABLE pr_status
+    DROP COLUMN Provider;
+
+DELETE FROM unsigned_user WHERE UnsignedPRID IN (SELECT Id FROM unsigned_pr WHERE Provider <> 'github');
+DELETE FROM unsigned_pr WHERE Provider <> 'github';
+
+DROP INDEX unsigned_pr_provider_repoid_prnumber_key;
+
+CREATE UNIQUE INDEX unsigned_pr_repoid_prnumber_key ON unsigned_pr (RepoID, PRNumber)
+    WHERE RepoID IS NOT NULL;
+
+ALTER TABLE unsigned_pr
+    DROP COLUMN Provider;
+
+COMMIT;
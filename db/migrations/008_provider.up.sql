@@ -0,0 +1,21 @@
+BEGIN;
+
+-- PRs can be GitLab merge requests too, whose project IDs may clash with GitHub repository IDs.
+ALTER TABLE unsigned_pr
+    ADD COLUMN Provider varchar(20) NOT NULL DEFAULT 'github';
+
+DROP INDEX unsigned_pr_repoid_prnumber_key;
+
+CREATE UNIQUE INDEX unsigned_pr_provider_repoid_prnumber_key ON unsigned_pr (Provider, RepoID, PRNumber)
+    WHERE RepoID IS NOT NULL;
+
+ALTER TABLE pr_status
+    ADD COLUMN Provider varchar(20) NOT NULL DEFAULT 'github';
+
+ALTER TABLE pr_status
+    DROP CONSTRAINT pr_status_repoid_prnumber_key;
+
+ALTER TABLE pr_status
+    ADD CONSTRAINT pr_status_provider_repoid_prnumber_key UNIQUE (Provider, RepoID, PRNumber);
+
+COMMIT;
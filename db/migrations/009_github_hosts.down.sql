@@ -0,0 +1,23 @@
+BEGIN;
+
+DELETE FROM audit_log WHERE Provider <> 'github';
+
+DROP INDEX audit_log_provider_repoid_prnumber;
+
+CREATE INDEX audit_log_repoid_prnumber ON audit_log (RepoID, PRNumber, CreatedAt);
+
+ALTER TABLE audit_log
+    DROP COLUMN Provider;
+
+DELETE FROM pr_status WHERE length(Provider) > 20;
+
+ALTER TABLE pr_status
+    ALTER COLUMN Provider TYPE varchar(20);
+
+DELETE FROM unsigned_user WHERE UnsignedPRID IN (SELECT Id FROM unsigned_pr WHERE length(Provider) > 20);
+DELETE FROM unsigned_pr WHERE length(Provider) > 20;
+
+ALTER TABLE unsigned_pr
+    ALTER COLUMN Provider TYPE varchar(20);
+
+COMMIT;
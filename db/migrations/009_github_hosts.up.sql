@@ -0,0 +1,18 @@
+BEGIN;
+
+-- PRs can come from GitHub Enterprise Server instances too, whose provider is their host name. Their repository IDs
+-- may clash with github.com ones, so overrides are recorded per provider as well.
+ALTER TABLE unsigned_pr
+    ALTER COLUMN Provider TYPE varchar(255);
+
+ALTER TABLE pr_status
+    ALTER COLUMN Provider TYPE varchar(255);
+
+ALTER TABLE audit_log
+    ADD COLUMN Provider varchar(255) NOT NULL DEFAULT 'github';
+
+DROP INDEX audit_log_repoid_prnumber;
+
+CREATE INDEX audit_log_provider_repoid_prnumber ON audit_log (Provider, RepoID, PRNumber, CreatedAt);
+
+COMMIT;
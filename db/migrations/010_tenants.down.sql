@@ -0,0 +1,18 @@
+BEGIN;
+
+DROP TABLE tenant_admin;
+
+DROP TABLE tenant;
+
+-- signatures of tenant CLAs do not fit anymore
+DELETE FROM unsigned_user WHERE length(ClaVersion) > 10;
+
+DELETE FROM signatures WHERE length(ClaVersion) > 10;
+
+ALTER TABLE unsigned_user
+    ALTER COLUMN ClaVersion TYPE varchar(10);
+
+ALTER TABLE signatures
+    ALTER COLUMN ClaVersion TYPE varchar(10);
+
+COMMIT;
@@ -0,0 +1,29 @@
+BEGIN;
+
+-- Tenants run their own GitHub App with their own CLA. Their CLA versions are qualified by the tenant name, see
+-- github.QualifiedCLAVersion, which needs more than 10 characters.
+CREATE TABLE tenant
+(
+    Name          varchar(63)   PRIMARY KEY,
+    AppID         bigint        NOT NULL UNIQUE,
+    KeyFile       varchar(1024) NOT NULL,
+    WebhookSecret varchar(255)  NOT NULL,
+    ClaVersion    varchar(10)   NOT NULL,
+    ClaTextUrl    varchar(250)  NOT NULL,
+    NotifyEmail   varchar(250)  NOT NULL DEFAULT ''
+);
+
+CREATE TABLE tenant_admin
+(
+    TenantName varchar(63)  NOT NULL REFERENCES tenant (Name) ON DELETE CASCADE,
+    LoginName  varchar(250) NOT NULL,
+    PRIMARY KEY (TenantName, LoginName)
+);
+
+ALTER TABLE signatures
+    ALTER COLUMN ClaVersion TYPE varchar(80);
+
+ALTER TABLE unsigned_user
+    ALTER COLUMN ClaVersion TYPE varchar(80);
+
+COMMIT;
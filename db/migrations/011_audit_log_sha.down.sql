@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE audit_log
+    DROP COLUMN Sha;
+
+COMMIT;
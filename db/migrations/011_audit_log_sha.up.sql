@@ -0,0 +1,8 @@
+BEGIN;
+
+-- An override accepts the commits it was applied to, not whatever is pushed after it. Overrides recorded before
+-- this have no sha, and stop counting at the next evaluation.
+ALTER TABLE audit_log
+    ADD COLUMN Sha varchar(250);
+
+COMMIT;
@@ -0,0 +1,129 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// pageLimit is the page size we ask for, Gitea caps it at its MAX_RESPONSE_ITEMS setting (50 by default)
+const pageLimit = 50
+
+// Client is a minimal client of the Gitea REST API (v1), which Forgejo serves as well, covering what evaluating pull
+// requests needs.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient talks to the Gitea instance at baseURL (e.g. "https://gitea.example.com"), authenticated by an access
+// token.
+func NewClient(baseURL, token string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, httpClient: http.DefaultClient}
+}
+
+// Error is a request the Gitea API refused.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gitea: %d %s", e.StatusCode, e.Message)
+}
+
+// isStatus tells if err is a response of the Gitea API with the given status code.
+func isStatus(err error, statusCode int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+func repoPath(owner, repo string) string {
+	return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
+
+// do sends a request to the API, with body encoded as JSON, and decodes the response into result unless it is nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result any) error {
+	endpoint := c.baseURL + "/api/v1" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if result != nil && resp.StatusCode != http.StatusNoContent {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// listAll gets every page of a list, until a page is not full.
+func listAll[T any](ctx context.Context, c *Client, path string, query url.Values) (all []T, err error) {
+	pageQuery := url.Values{}
+	for key, values := range query {
+		pageQuery[key] = values
+	}
+	pageQuery.Set("limit", strconv.Itoa(pageLimit))
+	for page := 1; ; page++ {
+		pageQuery.Set("page", strconv.Itoa(page))
+		var items []T
+		if err = c.do(ctx, http.MethodGet, path, pageQuery, nil, &items); err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if len(items) < pageLimit {
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gitea
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoSendsToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/user", r.URL.Path)
+		assert.Equal(t, "token myToken", r.Header.Get("Authorization"))
+		_, _ = fmt.Fprint(w, `{"login": "alice"}`)
+	}))
+	defer server.Close()
+
+	var found user
+	assert.NoError(t, NewClient(server.URL+"/", "myToken").do(context.Background(), http.MethodGet, "/user", nil, nil, &found))
+	assert.Equal(t, user{Login: "alice"}, found)
+}
+
+func TestDoNoContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	var found user
+	assert.NoError(t, NewClient(server.URL, "myToken").do(context.Background(), http.MethodDelete, "/thing", nil, nil, &found))
+}
+
+func TestDoError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"message":"not found"}`)
+	}))
+	defer server.Close()
+
+	err := NewClient(server.URL, "myToken").do(context.Background(), http.MethodGet, "/user", nil, nil, nil)
+	assert.EqualError(t, err, `gitea: 404 {"message":"not found"}`)
+	assert.True(t, isStatus(err, http.StatusNotFound))
+	assert.False(t, isStatus(err, http.StatusConflict))
+}
+
+func TestListAllFollowsPages(t *testing.T) {
+	fake := NewFakeServer(t, "myToken")
+	for i := 0; i < pageLimit+1; i++ {
+		fake.Comments["owner/repo#1"] = append(fake.Comments["owner/repo#1"], fmt.Sprintf("comment %d", i))
+	}
+
+	comments, err := listAll[comment](context.Background(), NewClient(fake.URL, "myToken"), "/repos/owner/repo/issues/1/comments", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, pageLimit+1, len(comments))
+	assert.Equal(t, comment{Body: fmt.Sprintf("comment %d", pageLimit)}, comments[pageLimit])
+}
@@ -0,0 +1,385 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package gitea evaluates the CLA on Gitea (and Forgejo) pull requests, see vcs.Provider.
+package gitea
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// BaseURL is the Gitea instance hosting pull requests
+var BaseURL string
+
+// token authenticates the user commenting, labeling and setting statuses on pull requests. It needs write access to
+// the issues and repositories. Gitea pull requests are not evaluated while it is empty.
+var token atomic.Pointer[string]
+
+// Token is the token of SetToken.
+func Token() string {
+	if t := token.Load(); t != nil {
+		return *t
+	}
+	return ""
+}
+
+// SetToken sets the token, which may be rotated while we run.
+func SetToken(t string) {
+	token.Store(&t)
+}
+
+// SignURL is the signing page linked from our comments
+var SignURL string
+
+// StatusContext is the context of our commit status, which branch protection can require
+var StatusContext = "the-cla"
+
+// Enabled tells if Gitea pull requests are evaluated.
+func Enabled() bool {
+	return BaseURL != "" && Token() != ""
+}
+
+type user struct {
+	Login string `json:"login"`
+}
+
+type commit struct {
+	SHA     string `json:"sha"`
+	HTMLURL string `json:"html_url"`
+	Commit  struct {
+		Author struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"author"`
+		Verification *struct {
+			Verified bool `json:"verified"`
+		} `json:"verification"`
+	} `json:"commit"`
+	// Author is the user the commit author email belongs to, if any
+	Author *user `json:"author"`
+}
+
+type label struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type comment struct {
+	Body string `json:"body"`
+}
+
+type permission struct {
+	Permission string `json:"permission"`
+}
+
+type pullRequest struct {
+	State string `json:"state"`
+	Head  struct {
+		Sha string `json:"sha"`
+	} `json:"head"`
+}
+
+// Provider is the vcs.Provider for Gitea pull requests.
+type Provider struct {
+	logger *zap.Logger
+	client *Client
+}
+
+var _ vcs.Provider = (*Provider)(nil)
+
+func NewProvider(logger *zap.Logger, client *Client) *Provider {
+	return &Provider{logger: logger, client: client}
+}
+
+func (p *Provider) Name() string {
+	return vcs.ProviderGitea
+}
+
+func issuePath(evalInfo *types.EvaluationInfo) string {
+	return repoPath(evalInfo.RepoOwner, evalInfo.RepoName) + "/issues/" + strconv.FormatInt(evalInfo.PRNumber, 10)
+}
+
+func (p *Provider) ListCommits(ctx context.Context, evalInfo *types.EvaluationInfo) (commits []vcs.Commit, err error) {
+	path := repoPath(evalInfo.RepoOwner, evalInfo.RepoName) + "/pulls/" + strconv.FormatInt(evalInfo.PRNumber, 10) + "/commits"
+	prCommits, err := listAll[commit](ctx, p.client, path, url.Values{"verification": {"true"}, "files": {"false"}})
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range prCommits {
+		listed := vcs.Commit{
+			SHA:         c.SHA,
+			URL:         c.HTMLURL,
+			AuthorEmail: c.Commit.Author.Email,
+			AuthorName:  c.Commit.Author.Name,
+			Verified:    c.Commit.Verification != nil && c.Commit.Verification.Verified,
+		}
+		if c.Author != nil {
+			listed.AuthorLogin = c.Author.Login
+		}
+		commits = append(commits, listed)
+	}
+	return
+}
+
+func (p *Provider) SetStatus(ctx context.Context, evalInfo *types.EvaluationInfo, state, description string) error {
+	// Gitea statuses have the same states as ours
+	status := map[string]string{
+		"state":       state,
+		"context":     StatusContext,
+		"description": description,
+	}
+	return p.client.do(ctx, http.MethodPost, repoPath(evalInfo.RepoOwner, evalInfo.RepoName)+"/statuses/"+url.PathEscape(evalInfo.Sha), nil, status, nil)
+}
+
+// findLabel returns the repository label with the given name, or nil if there is none.
+func (p *Provider) findLabel(ctx context.Context, evalInfo *types.EvaluationInfo, name string) (*label, error) {
+	labels, err := listAll[label](ctx, p.client, repoPath(evalInfo.RepoOwner, evalInfo.RepoName)+"/labels", nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range labels {
+		if labels[i].Name == name {
+			return &labels[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *Provider) AddLabel(ctx context.Context, evalInfo *types.EvaluationInfo, name, color, description string) error {
+	existing, err := p.findLabel(ctx, evalInfo, name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		existing = &label{}
+		newLabel := map[string]string{
+			"name":        name,
+			"color":       "#" + strings.TrimPrefix(color, "#"),
+			"description": description,
+		}
+		if err = p.client.do(ctx, http.MethodPost, repoPath(evalInfo.RepoOwner, evalInfo.RepoName)+"/labels", nil, newLabel, existing); err != nil {
+			return err
+		}
+	}
+	// adding a label the pull request has already changes nothing
+	return p.client.do(ctx, http.MethodPost, issuePath(evalInfo)+"/labels", nil, map[string][]int64{"labels": {existing.ID}}, nil)
+}
+
+func (p *Provider) RemoveLabel(ctx context.Context, evalInfo *types.EvaluationInfo, name string) error {
+	existing, err := p.findLabel(ctx, evalInfo, name)
+	if err != nil || existing == nil {
+		return err
+	}
+	err = p.client.do(ctx, http.MethodDelete, issuePath(evalInfo)+"/labels/"+strconv.FormatInt(existing.ID, 10), nil, nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		// the label was not applied
+		return nil
+	}
+	return err
+}
+
+func (p *Provider) Comment(ctx context.Context, evalInfo *types.EvaluationInfo, body string) error {
+	comments, err := listAll[comment](ctx, p.client, issuePath(evalInfo)+"/comments", nil)
+	if err != nil {
+		return err
+	}
+	for _, existing := range comments {
+		if existing.Body == body {
+			return nil
+		}
+	}
+	return p.client.do(ctx, http.MethodPost, issuePath(evalInfo)+"/comments", nil, map[string]string{"body": body}, nil)
+}
+
+// MembershipReason exempts users allowed to push to the repository (as owner, collaborator or through a team), if the
+// exemption policy exempts collaborators. Other policies only apply to GitHub.
+func (p *Provider) MembershipReason(ctx context.Context, evalInfo *types.EvaluationInfo, login string) (string, error) {
+	if !ourGithub.Exemptions.Collaborators {
+		return "", nil
+	}
+	var userPermission permission
+	err := p.client.do(ctx, http.MethodGet, repoPath(evalInfo.RepoOwner, evalInfo.RepoName)+"/collaborators/"+url.PathEscape(login)+"/permission", nil, nil, &userPermission)
+	if isStatus(err, http.StatusNotFound) || isStatus(err, http.StatusForbidden) {
+		// not a collaborator, or not even a user
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch userPermission.Permission {
+	case "write", "admin", "owner":
+		return ourGithub.ExemptionReasonCollaborator, nil
+	}
+	return "", nil
+}
+
+func (p *Provider) ChangeURL(evalInfo *types.EvaluationInfo) string {
+	return fmt.Sprintf("%s/%s/%s/pulls/%d", p.client.baseURL, url.PathEscape(evalInfo.RepoOwner), url.PathEscape(evalInfo.RepoName), evalInfo.PRNumber)
+}
+
+// EvaluatePullRequest evaluates a pull request, and is the evaluator of tracked Gitea pull requests, see
+// github.RegisterEvaluator.
+func EvaluatePullRequest(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, claVersion string) error {
+	if !Enabled() {
+		return errors.New("gitea is not configured")
+	}
+	provider := NewProvider(logger, NewClient(BaseURL, Token()))
+	return ourGithub.EvaluateChange(logger, postgres, provider, evalInfo, SignURL, claVersion)
+}
+
+// Head reads the head commit of the pull request, and tells if it is still open.
+func (p *Provider) Head(ctx context.Context, evalInfo *types.EvaluationInfo) (sha string, open bool, err error) {
+	var pr pullRequest
+	path := repoPath(evalInfo.RepoOwner, evalInfo.RepoName) + "/pulls/" + strconv.FormatInt(evalInfo.PRNumber, 10)
+	if err = p.client.do(ctx, http.MethodGet, path, nil, nil, &pr); err != nil {
+		return
+	}
+	return pr.Head.Sha, pr.State == "open", nil
+}
+
+// PullRequestHead reads the head of a tracked pull request, and is the head reader of Gitea pull requests, see
+// github.RegisterHeadReader.
+func PullRequestHead(logger *zap.Logger, evalInfo *types.EvaluationInfo) (string, bool, error) {
+	if !Enabled() {
+		return "", false, errors.New("gitea is not configured")
+	}
+	return NewProvider(logger, NewClient(BaseURL, Token())).Head(context.Background(), evalInfo)
+}
+
+// EventPullRequest is the event of pull request webhooks
+const EventPullRequest = "pull_request"
+
+var (
+	ErrInvalidSignature = errors.New("invalid gitea webhook signature")
+	ErrUnsupportedEvent = errors.New("unsupported gitea event")
+)
+
+// PullRequestPayload is the part of a pull request webhook we need.
+type PullRequestPayload struct {
+	Action string `json:"action"`
+	Number int64  `json:"number"`
+	// Changes tells what an edit changed, drafts are marked by a title prefix
+	Changes struct {
+		Title *struct {
+			From string `json:"from"`
+		} `json:"title"`
+	} `json:"changes"`
+	PullRequest struct {
+		Draft bool `json:"draft"`
+		Head  struct {
+			Sha string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Repository struct {
+		ID    int64  `json:"id"`
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+}
+
+// webhookHeader reads a webhook header, which Forgejo sends with its own prefix, and Gitea's for compatibility.
+func webhookHeader(r *http.Request, name string) string {
+	if value := r.Header.Get("X-Forgejo-" + name); value != "" {
+		return value
+	}
+	return r.Header.Get("X-Gitea-" + name)
+}
+
+// ParsePullRequestEvent checks the signature of a pull request webhook, the hex encoded HMAC-SHA256 of its body,
+// and parses it.
+func ParsePullRequestEvent(r *http.Request, secret string) (*PullRequestPayload, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := hex.DecodeString(webhookHeader(r, "Signature"))
+	if secret == "" || err != nil {
+		return nil, ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
+	}
+	if webhookHeader(r, "Event") != EventPullRequest {
+		return nil, ErrUnsupportedEvent
+	}
+	var payload PullRequestPayload
+	if err = json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// NeedsEvaluation tells if the pull request is new, or got new commits, or its title changed while it is not a
+// draft, which is how pull requests stop being drafts.
+func (p *PullRequestPayload) NeedsEvaluation() bool {
+	switch p.Action {
+	case "opened", "reopened", "synchronized":
+		return true
+	case "edited":
+		return p.Changes.Title != nil && !p.PullRequest.Draft
+	}
+	return false
+}
+
+// evaluationInfo returns the evaluation of the pull request of a webhook.
+func (p *PullRequestPayload) evaluationInfo() *types.EvaluationInfo {
+	return &types.EvaluationInfo{
+		Provider:  vcs.ProviderGitea,
+		RepoId:    p.Repository.ID,
+		RepoOwner: p.Repository.Owner.Login,
+		RepoName:  p.Repository.Name,
+		Sha:       p.PullRequest.Head.Sha,
+		PRNumber:  p.Number,
+	}
+}
+
+// HandlePullRequest evaluates the pull request of a webhook. Drafts are left alone while drafts are skipped, see
+// github.SkipDrafts.
+func HandlePullRequest(logger *zap.Logger, postgres db.IClaDB, payload *PullRequestPayload, claVersion string) error {
+	evalInfo := payload.evaluationInfo()
+	if ourGithub.SkipDrafts && payload.PullRequest.Draft {
+		logger.Debug("skip draft pull request",
+			zap.String("owner", evalInfo.RepoOwner),
+			zap.String("repo", evalInfo.RepoName),
+			zap.Int64("pullRequestID", evalInfo.PRNumber),
+		)
+		return nil
+	}
+	return EvaluatePullRequest(logger, postgres, evalInfo, claVersion)
+}
@@ -0,0 +1,294 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gitea
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// FakeCommit is a commit of a pull request on a FakeServer
+type FakeCommit struct {
+	SHA string
+	// AuthorLogin is the user the author email belongs to, empty if none
+	AuthorLogin string
+	AuthorName  string
+	AuthorEmail string
+	Verified    bool
+}
+
+// FakePullRequest is the state of a pull request on a FakeServer
+type FakePullRequest struct {
+	State   string
+	HeadSha string
+}
+
+// FakeStatus is a commit status set on a FakeServer
+type FakeStatus struct {
+	State       string `json:"state"`
+	Context     string `json:"context"`
+	Description string `json:"description"`
+}
+
+// FakeServer is an in-memory Gitea serving the API endpoints the Provider uses. Repositories are keyed by
+// "owner/repo", and pull requests by "owner/repo#number".
+type FakeServer struct {
+	*httptest.Server
+	t     *testing.T
+	token string
+	mu    sync.Mutex
+
+	// PullRequests that can be read, others are not found
+	PullRequests map[string]FakePullRequest
+	// Commits of each pull request
+	Commits map[string][]FakeCommit
+	// Permissions of users on each repository, users without one are not collaborators
+	Permissions map[string]map[string]string
+	// Labels of each repository
+	Labels map[string][]label
+	// IssueLabels are the IDs of the labels applied to each pull request
+	IssueLabels map[string][]int64
+	// Comments on each pull request
+	Comments map[string][]string
+	// Statuses of each commit, keyed by "owner/repo@sha"
+	Statuses map[string][]FakeStatus
+}
+
+// NewFakeServer starts a fake Gitea accepting token, which is closed when the test finishes.
+func NewFakeServer(t *testing.T, token string) *FakeServer {
+	f := &FakeServer{
+		t:            t,
+		token:        token,
+		PullRequests: make(map[string]FakePullRequest),
+		Commits:      make(map[string][]FakeCommit),
+		Permissions:  make(map[string]map[string]string),
+		Labels:       make(map[string][]label),
+		IssueLabels:  make(map[string][]int64),
+		Comments:     make(map[string][]string),
+		Statuses:     make(map[string][]FakeStatus),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{index}", f.getPullRequest)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/pulls/{index}/commits", f.listCommits)
+	mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/statuses/{sha}", f.createStatus)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/labels", f.listLabels)
+	mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/labels", f.createLabel)
+	mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/issues/{index}/labels", f.addIssueLabels)
+	mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/issues/{index}/labels/{id}", f.removeIssueLabel)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/issues/{index}/comments", f.listComments)
+	mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/issues/{index}/comments", f.createComment)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/collaborators/{user}/permission", f.getPermission)
+	f.Server = httptest.NewServer(f.authorize(mux))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// SignFakePayload returns the signature Gitea sends along with a webhook body.
+func SignFakePayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IssueLabelNames are the names of the labels applied to a pull request.
+func (f *FakeServer) IssueLabelNames(repo string, number int64) (names []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range f.IssueLabels[prKey(repo, number)] {
+		for _, l := range f.Labels[repo] {
+			if l.ID == id {
+				names = append(names, l.Name)
+			}
+		}
+	}
+	return
+}
+
+func prKey(repo string, number int64) string {
+	return repo + "#" + strconv.FormatInt(number, 10)
+}
+
+func (f *FakeServer) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token "+f.token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func repoKey(r *http.Request) string {
+	return r.PathValue("owner") + "/" + r.PathValue("repo")
+}
+
+func issueKey(r *http.Request) string {
+	return repoKey(r) + "#" + r.PathValue("index")
+}
+
+func (f *FakeServer) respond(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		f.t.Errorf("failed to encode fake gitea response: %v", err)
+	}
+}
+
+func (f *FakeServer) decode(r *http.Request, body any) {
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		f.t.Errorf("failed to decode fake gitea request: %v", err)
+	}
+}
+
+// page returns the items of the requested page.
+func page[T any](r *http.Request, items []T) []T {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = pageLimit
+	}
+	number, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || number <= 0 {
+		number = 1
+	}
+	start := (number - 1) * limit
+	if start >= len(items) {
+		return []T{}
+	}
+	return items[start:min(start+limit, len(items))]
+}
+
+func (f *FakeServer) getPullRequest(w http.ResponseWriter, r *http.Request) {
+	fake, ok := f.PullRequests[issueKey(r)]
+	if !ok {
+		f.respond(w, http.StatusNotFound, map[string]string{"message": "pull request not found"})
+		return
+	}
+	var pr pullRequest
+	pr.State = fake.State
+	pr.Head.Sha = fake.HeadSha
+	f.respond(w, http.StatusOK, pr)
+}
+
+func (f *FakeServer) listCommits(w http.ResponseWriter, r *http.Request) {
+	listed := make([]commit, 0)
+	for _, fake := range f.Commits[issueKey(r)] {
+		var c commit
+		c.SHA = fake.SHA
+		c.HTMLURL = f.URL + "/" + repoKey(r) + "/commit/" + fake.SHA
+		c.Commit.Author.Name = fake.AuthorName
+		c.Commit.Author.Email = fake.AuthorEmail
+		c.Commit.Verification = &struct {
+			Verified bool `json:"verified"`
+		}{Verified: fake.Verified}
+		if fake.AuthorLogin != "" {
+			c.Author = &user{Login: fake.AuthorLogin}
+		}
+		listed = append(listed, c)
+	}
+	f.respond(w, http.StatusOK, page(r, listed))
+}
+
+func (f *FakeServer) createStatus(w http.ResponseWriter, r *http.Request) {
+	var status FakeStatus
+	f.decode(r, &status)
+	key := repoKey(r) + "@" + r.PathValue("sha")
+	f.Statuses[key] = append(f.Statuses[key], status)
+	f.respond(w, http.StatusCreated, status)
+}
+
+func (f *FakeServer) listLabels(w http.ResponseWriter, r *http.Request) {
+	f.respond(w, http.StatusOK, page(r, append([]label{}, f.Labels[repoKey(r)]...)))
+}
+
+func (f *FakeServer) createLabel(w http.ResponseWriter, r *http.Request) {
+	var created label
+	f.decode(r, &created)
+	for _, existing := range f.Labels[repoKey(r)] {
+		if existing.Name == created.Name {
+			f.respond(w, http.StatusConflict, map[string]string{"message": "label already exists"})
+			return
+		}
+	}
+	created.ID = int64(len(f.Labels[repoKey(r)]) + 1)
+	f.Labels[repoKey(r)] = append(f.Labels[repoKey(r)], created)
+	f.respond(w, http.StatusCreated, created)
+}
+
+func (f *FakeServer) addIssueLabels(w http.ResponseWriter, r *http.Request) {
+	var added struct {
+		Labels []int64 `json:"labels"`
+	}
+	f.decode(r, &added)
+	applied := f.IssueLabels[issueKey(r)]
+	for _, id := range added.Labels {
+		found := false
+		for _, existing := range applied {
+			found = found || existing == id
+		}
+		if !found {
+			applied = append(applied, id)
+		}
+	}
+	f.IssueLabels[issueKey(r)] = applied
+	f.respond(w, http.StatusOK, applied)
+}
+
+func (f *FakeServer) removeIssueLabel(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	applied := f.IssueLabels[issueKey(r)]
+	for i, existing := range applied {
+		if existing == id {
+			f.IssueLabels[issueKey(r)] = append(applied[:i:i], applied[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	f.respond(w, http.StatusNotFound, map[string]string{"message": "label not applied"})
+}
+
+func (f *FakeServer) listComments(w http.ResponseWriter, r *http.Request) {
+	listed := make([]comment, 0)
+	for _, body := range f.Comments[issueKey(r)] {
+		listed = append(listed, comment{Body: body})
+	}
+	f.respond(w, http.StatusOK, page(r, listed))
+}
+
+func (f *FakeServer) createComment(w http.ResponseWriter, r *http.Request) {
+	var created comment
+	f.decode(r, &created)
+	f.Comments[issueKey(r)] = append(f.Comments[issueKey(r)], created.Body)
+	f.respond(w, http.StatusCreated, created)
+}
+
+func (f *FakeServer) getPermission(w http.ResponseWriter, r *http.Request) {
+	userPermission, ok := f.Permissions[repoKey(r)][r.PathValue("user")]
+	if !ok {
+		f.respond(w, http.StatusNotFound, map[string]string{"message": "not a collaborator"})
+		return
+	}
+	f.respond(w, http.StatusOK, permission{Permission: userPermission})
+}
@@ -0,0 +1,314 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+func testEvalInfo() *types.EvaluationInfo {
+	return &types.EvaluationInfo{Provider: vcs.ProviderGitea, RepoId: 7, RepoOwner: "owner", RepoName: "repo", Sha: "headSHA", PRNumber: 3}
+}
+
+func setupFakeGitea(t *testing.T) (fake *FakeServer, provider *Provider) {
+	fake = NewFakeServer(t, "myToken")
+	return fake, NewProvider(zaptest.NewLogger(t), NewClient(fake.URL, "myToken"))
+}
+
+func TestListCommits(t *testing.T) {
+	fake, provider := setupFakeGitea(t)
+	fake.Commits["owner/repo#3"] = []FakeCommit{
+		{SHA: "sha1", AuthorLogin: "alice", AuthorName: "Alice", AuthorEmail: "alice@example.com", Verified: true},
+		{SHA: "sha2", AuthorName: "Nobody", AuthorEmail: "nobody@example.com"},
+	}
+
+	commits, err := provider.ListCommits(context.Background(), testEvalInfo())
+	assert.NoError(t, err)
+	assert.Equal(t, []vcs.Commit{
+		{SHA: "sha1", URL: fake.URL + "/owner/repo/commit/sha1", AuthorLogin: "alice", AuthorEmail: "alice@example.com", AuthorName: "Alice", Verified: true},
+		{SHA: "sha2", URL: fake.URL + "/owner/repo/commit/sha2", AuthorEmail: "nobody@example.com", AuthorName: "Nobody"},
+	}, commits)
+}
+
+func TestListCommitsUnauthorized(t *testing.T) {
+	fake, _ := setupFakeGitea(t)
+	provider := NewProvider(zaptest.NewLogger(t), NewClient(fake.URL, "wrongToken"))
+
+	_, err := provider.ListCommits(context.Background(), testEvalInfo())
+	assert.True(t, isStatus(err, http.StatusUnauthorized))
+}
+
+func TestSetStatus(t *testing.T) {
+	fake, provider := setupFakeGitea(t)
+
+	assert.NoError(t, provider.SetStatus(context.Background(), testEvalInfo(), "failure", "sign please"))
+	assert.Equal(t, []FakeStatus{{State: "failure", Context: StatusContext, Description: "sign please"}}, fake.Statuses["owner/repo@headSHA"])
+}
+
+func TestAddAndRemoveLabel(t *testing.T) {
+	fake, provider := setupFakeGitea(t)
+	evalInfo := testEvalInfo()
+
+	assert.NoError(t, provider.AddLabel(context.Background(), evalInfo, "cla:signed", "0e8a16", "signed"))
+	// adding it again neither creates nor applies it twice
+	assert.NoError(t, provider.AddLabel(context.Background(), evalInfo, "cla:signed", "0e8a16", "signed"))
+	assert.NoError(t, provider.AddLabel(context.Background(), evalInfo, "cla:missing", "ff0000", "missing"))
+	assert.Equal(t, 2, len(fake.Labels["owner/repo"]))
+	assert.Equal(t, []string{"cla:signed", "cla:missing"}, fake.IssueLabelNames("owner/repo", 3))
+
+	assert.NoError(t, provider.RemoveLabel(context.Background(), evalInfo, "cla:signed"))
+	assert.Equal(t, []string{"cla:missing"}, fake.IssueLabelNames("owner/repo", 3))
+
+	// neither applied nor existing labels are fine to remove
+	assert.NoError(t, provider.RemoveLabel(context.Background(), evalInfo, "cla:signed"))
+	assert.NoError(t, provider.RemoveLabel(context.Background(), evalInfo, "unknown"))
+}
+
+func TestComment(t *testing.T) {
+	fake, provider := setupFakeGitea(t)
+
+	assert.NoError(t, provider.Comment(context.Background(), testEvalInfo(), "please sign"))
+	assert.NoError(t, provider.Comment(context.Background(), testEvalInfo(), "please sign"))
+	assert.Equal(t, []string{"please sign"}, fake.Comments["owner/repo#3"])
+}
+
+func TestMembershipReason(t *testing.T) {
+	fake, provider := setupFakeGitea(t)
+	fake.Permissions["owner/repo"] = map[string]string{"owner": "owner", "writer": "write", "reader": "read"}
+
+	for login, expected := range map[string]string{
+		"owner":    ourGithub.ExemptionReasonCollaborator,
+		"writer":   ourGithub.ExemptionReasonCollaborator,
+		"reader":   "",
+		"outsider": "",
+	} {
+		reason, err := provider.MembershipReason(context.Background(), testEvalInfo(), login)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, reason, login)
+	}
+}
+
+func TestMembershipReasonPolicyOff(t *testing.T) {
+	origExemptions := ourGithub.Exemptions
+	defer func() {
+		ourGithub.Exemptions = origExemptions
+	}()
+	ourGithub.Exemptions = ourGithub.ExemptionPolicy{}
+
+	fake, provider := setupFakeGitea(t)
+	fake.Permissions["owner/repo"] = map[string]string{"writer": "write"}
+
+	reason, err := provider.MembershipReason(context.Background(), testEvalInfo(), "writer")
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestChangeURL(t *testing.T) {
+	provider := NewProvider(zaptest.NewLogger(t), NewClient("https://gitea.example.com/", "myToken"))
+	assert.Equal(t, "https://gitea.example.com/owner/repo/pulls/3", provider.ChangeURL(testEvalInfo()))
+}
+
+// claDBStub keeps what an evaluation stores, any other use of the db panics
+type claDBStub struct {
+	db.IClaDB
+	signed   map[string]bool
+	statuses []string
+	missing  []types.UserSignature
+}
+
+func (s *claDBStub) HasAuthorSignedTheCla(login, claVersion string) (bool, *types.UserSignature, error) {
+	if !s.signed[login] {
+		return false, nil, nil
+	}
+	return true, &types.UserSignature{User: types.User{Login: login}, CLAVersion: claVersion}, nil
+}
+
+func (s *claDBStub) StorePRStatus(_ *types.EvaluationInfo, state string, _ time.Time) error {
+	s.statuses = append(s.statuses, state)
+	return nil
+}
+
+func (s *claDBStub) StorePRAuthorsMissingSignature(evalInfo *types.EvaluationInfo, _ time.Time) error {
+	s.missing = evalInfo.UserSignatures
+	return nil
+}
+
+func (s *claDBStub) RemovePRsForUsers([]types.UserSignature, *types.EvaluationInfo) error {
+	return nil
+}
+
+func setupEvaluation(t *testing.T) (fake *FakeServer) {
+	fake = NewFakeServer(t, "myToken")
+	origBaseURL, origToken, origSignURL := BaseURL, Token(), SignURL
+	BaseURL, SignURL = fake.URL, "https://cla.example.com"
+	SetToken("myToken")
+	t.Cleanup(func() {
+		BaseURL, SignURL = origBaseURL, origSignURL
+		SetToken(origToken)
+	})
+	return
+}
+
+func TestEvaluatePullRequest(t *testing.T) {
+	fake := setupEvaluation(t)
+	fake.Commits["owner/repo#3"] = []FakeCommit{
+		{SHA: "sha1", AuthorLogin: "alice", AuthorEmail: "alice@example.com", Verified: true},
+		{SHA: "sha2", AuthorLogin: "bob", AuthorEmail: "bob@example.com", Verified: true},
+		{SHA: "sha3", AuthorLogin: "carol", AuthorEmail: "carol@example.com", Verified: true},
+	}
+	fake.Permissions["owner/repo"] = map[string]string{"carol": "write"}
+	postgres := &claDBStub{signed: map[string]bool{"gitea:bob": true}}
+
+	assert.NoError(t, EvaluatePullRequest(zaptest.NewLogger(t), postgres, testEvalInfo(), "1"))
+
+	assert.Equal(t, []string{"pending", "failure"}, postgres.statuses)
+	assert.Equal(t, []string{"pending", "failure"}, []string{fake.Statuses["owner/repo@headSHA"][0].State, fake.Statuses["owner/repo@headSHA"][1].State})
+	assert.Equal(t, 1, len(postgres.missing))
+	assert.Equal(t, "gitea:alice", postgres.missing[0].User.Login)
+	assert.Equal(t, []string{ourGithub.Messages.LabelUnsigned.Name}, fake.IssueLabelNames("owner/repo", 3))
+	assert.Equal(t, 1, len(fake.Comments["owner/repo#3"]))
+	assert.Contains(t, fake.Comments["owner/repo#3"][0], "@alice to [sign the Contributor License Agreement](https://cla.example.com?provider=gitea)")
+
+	// once alice signed, the PR passes
+	postgres.signed["gitea:alice"] = true
+	assert.NoError(t, EvaluatePullRequest(zaptest.NewLogger(t), postgres, testEvalInfo(), "1"))
+	assert.Equal(t, "success", fake.Statuses["owner/repo@headSHA"][3].State)
+	assert.Equal(t, []string{ourGithub.Messages.LabelSigned.Name}, fake.IssueLabelNames("owner/repo", 3))
+}
+
+func TestEvaluatePullRequestNotConfigured(t *testing.T) {
+	origBaseURL := BaseURL
+	defer func() {
+		BaseURL = origBaseURL
+	}()
+	BaseURL = ""
+
+	assert.EqualError(t, EvaluatePullRequest(zaptest.NewLogger(t), nil, testEvalInfo(), "1"), "gitea is not configured")
+}
+
+func TestHead(t *testing.T) {
+	fake, provider := setupFakeGitea(t)
+	fake.PullRequests["owner/repo#3"] = FakePullRequest{State: "open", HeadSha: "newHeadSHA"}
+
+	sha, open, err := provider.Head(context.Background(), testEvalInfo())
+	assert.NoError(t, err)
+	assert.True(t, open)
+	assert.Equal(t, "newHeadSHA", sha)
+
+	fake.PullRequests["owner/repo#3"] = FakePullRequest{State: "closed", HeadSha: "newHeadSHA"}
+	_, open, err = provider.Head(context.Background(), testEvalInfo())
+	assert.NoError(t, err)
+	assert.False(t, open)
+}
+
+func TestHeadNotFound(t *testing.T) {
+	_, provider := setupFakeGitea(t)
+
+	_, _, err := provider.Head(context.Background(), testEvalInfo())
+	assert.True(t, isStatus(err, http.StatusNotFound))
+}
+
+func TestPullRequestHeadNotConfigured(t *testing.T) {
+	origBaseURL := BaseURL
+	defer func() {
+		BaseURL = origBaseURL
+	}()
+	BaseURL = ""
+
+	_, _, err := PullRequestHead(zaptest.NewLogger(t), testEvalInfo())
+	assert.EqualError(t, err, "gitea is not configured")
+}
+
+const testPullRequestPayload = `{
+	"action": "synchronized",
+	"number": 3,
+	"pull_request": {"number": 3, "draft": false, "head": {"sha": "headSHA"}},
+	"repository": {"id": 7, "name": "repo", "full_name": "owner/repo", "owner": {"login": "owner"}}
+}`
+
+func pullRequestHook(prefix, signature, event string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhook-gitea", strings.NewReader(testPullRequestPayload))
+	req.Header.Set("X-"+prefix+"-Signature", signature)
+	req.Header.Set("X-"+prefix+"-Event", event)
+	return req
+}
+
+func TestParsePullRequestEvent(t *testing.T) {
+	signature := SignFakePayload("mySecret", []byte(testPullRequestPayload))
+	for _, prefix := range []string{"Gitea", "Forgejo"} {
+		payload, err := ParsePullRequestEvent(pullRequestHook(prefix, signature, EventPullRequest), "mySecret")
+		assert.NoError(t, err, prefix)
+		assert.True(t, payload.NeedsEvaluation())
+		assert.Equal(t, testEvalInfo(), payload.evaluationInfo())
+	}
+}
+
+func TestParsePullRequestEventInvalid(t *testing.T) {
+	signature := SignFakePayload("mySecret", []byte(testPullRequestPayload))
+
+	_, err := ParsePullRequestEvent(pullRequestHook("Gitea", SignFakePayload("wrong", []byte(testPullRequestPayload)), EventPullRequest), "mySecret")
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	_, err = ParsePullRequestEvent(pullRequestHook("Gitea", "not hex", EventPullRequest), "mySecret")
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	_, err = ParsePullRequestEvent(pullRequestHook("Gitea", signature, EventPullRequest), "")
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	_, err = ParsePullRequestEvent(pullRequestHook("Gitea", signature, "push"), "mySecret")
+	assert.Equal(t, ErrUnsupportedEvent, err)
+}
+
+func TestNeedsEvaluation(t *testing.T) {
+	for action, expected := range map[string]bool{"opened": true, "reopened": true, "synchronized": true, "edited": false, "closed": false} {
+		assert.Equal(t, expected, (&PullRequestPayload{Action: action}).NeedsEvaluation(), action)
+	}
+
+	// no longer a draft
+	var payload PullRequestPayload
+	assert.NoError(t, json.Unmarshal([]byte(`{"action":"edited","changes":{"title":{"from":"WIP: fix typo"}},"pull_request":{"draft":false}}`), &payload))
+	assert.True(t, payload.NeedsEvaluation())
+
+	payload.PullRequest.Draft = true
+	assert.False(t, payload.NeedsEvaluation())
+}
+
+func TestHandlePullRequestSkipsDrafts(t *testing.T) {
+	origSkipDrafts := ourGithub.SkipDrafts
+	defer func() {
+		ourGithub.SkipDrafts = origSkipDrafts
+	}()
+	ourGithub.SkipDrafts = true
+
+	payload := &PullRequestPayload{}
+	payload.PullRequest.Draft = true
+	assert.NoError(t, HandlePullRequest(zaptest.NewLogger(t), nil, payload, "1"))
+}
@@ -0,0 +1,261 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	webhook "gopkg.in/go-playground/webhooks.v5/github"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+const DefaultCollaboratorCacheTTL = 10 * time.Minute
+
+// maxCollaboratorCacheEntries bounds the in-memory cache, expired entries are dropped once it fills up
+const maxCollaboratorCacheEntries = 10000
+
+// collaboratorKey identifies a cached lookup. Repository collaborator lookups have a repoId, organization wide
+// lookups (e.g. team membership) have a zero repoId and a scope instead.
+type collaboratorKey struct {
+	repoId int64
+	scope  string
+	login  string
+}
+
+// loginList is an organization wide list of logins, like its outside collaborators.
+type loginList struct {
+	owner     string
+	logins    map[string]bool
+	checkedAt time.Time
+}
+
+// CollaboratorCache remembers collaborator and membership lookups for TTL. When Shared is set, repository
+// collaborator results are also kept in the database, so replicas can reuse each other's lookups. Invalidating
+// clears the database and the memory of this replica only, other replicas may use what they remember until TTL
+// expires.
+type CollaboratorCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[collaboratorKey]types.Collaborator
+	lists   map[string]loginList
+	// TTL is how long a result is trusted, zero or less disables caching
+	TTL    time.Duration
+	Shared bool
+}
+
+func NewCollaboratorCache(ttl time.Duration) *CollaboratorCache {
+	return &CollaboratorCache{
+		now:     time.Now,
+		entries: make(map[collaboratorKey]types.Collaborator),
+		lists:   make(map[string]loginList),
+		TTL:     ttl,
+	}
+}
+
+// Collaborators is the cache used for all evaluations.
+var Collaborators = NewCollaboratorCache(DefaultCollaboratorCacheTTL)
+
+// Reset forgets all results cached in memory.
+func (c *CollaboratorCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[collaboratorKey]types.Collaborator)
+	c.lists = make(map[string]loginList)
+}
+
+// IsCollaborator tells if login is a collaborator on the repository being evaluated, asking GitHub only if we
+// don't have a fresh enough answer. Problems with the shared cache are logged, and fall back to asking GitHub.
+// Logins of GitHub Enterprise Server instances are cached qualified by their host, see vcs.QualifiedLogin.
+func (c *CollaboratorCache) IsCollaborator(logger *zap.Logger, postgres db.IClaDB, repositoryService RepositoriesService,
+	evalInfo *types.EvaluationInfo, login string) (isCollaborator bool, err error) {
+	if c.TTL <= 0 {
+		isCollaborator, _, err = repositoryService.IsCollaborator(context.Background(), evalInfo.RepoOwner, evalInfo.RepoName, login)
+		return
+	}
+
+	now := c.now()
+	cachedLogin := vcs.QualifiedLogin(vcs.ProviderOf(evalInfo), login)
+	key := collaboratorKey{repoId: evalInfo.RepoId, login: strings.ToLower(cachedLogin)}
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Sub(cached.CheckedAt) < c.TTL {
+		return cached.IsCollaborator, nil
+	}
+
+	if c.Shared {
+		shared, sharedErr := postgres.GetCachedCollaborator(evalInfo.RepoId, cachedLogin, now.Add(-c.TTL))
+		if sharedErr != nil {
+			logger.Warn("failed to read shared collaborator cache", zap.Error(sharedErr))
+		} else if shared != nil {
+			c.store(key, *shared)
+			return shared.IsCollaborator, nil
+		}
+	}
+
+	if isCollaborator, _, err = repositoryService.IsCollaborator(context.Background(), evalInfo.RepoOwner, evalInfo.RepoName, login); err != nil {
+		return
+	}
+	checked := types.Collaborator{
+		RepoId:         evalInfo.RepoId,
+		RepoOwner:      evalInfo.RepoOwner,
+		Login:          cachedLogin,
+		IsCollaborator: isCollaborator,
+		CheckedAt:      now,
+	}
+	c.store(key, checked)
+	if c.Shared {
+		if sharedErr := postgres.StoreCachedCollaborator(&checked); sharedErr != nil {
+			logger.Warn("failed to update shared collaborator cache", zap.Error(sharedErr))
+		}
+	}
+	return
+}
+
+// remember caches the result of an organization wide lookup in memory.
+func (c *CollaboratorCache) remember(scope, owner, login string, lookup func() (bool, error)) (result bool, err error) {
+	if c.TTL <= 0 {
+		return lookup()
+	}
+
+	now := c.now()
+	key := collaboratorKey{scope: strings.ToLower(scope), login: strings.ToLower(login)}
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Sub(cached.CheckedAt) < c.TTL {
+		return cached.IsCollaborator, nil
+	}
+
+	if result, err = lookup(); err != nil {
+		return
+	}
+	c.store(key, types.Collaborator{RepoOwner: owner, Login: login, IsCollaborator: result, CheckedAt: now})
+	return
+}
+
+// isListed tells if login is on an organization wide list, which is cached in memory as a whole, so it is listed once
+// for all logins rather than once per login.
+func (c *CollaboratorCache) isListed(scope, owner, login string, lookup func() ([]string, error)) (bool, error) {
+	now := c.now()
+	key := strings.ToLower(scope)
+	c.mu.Lock()
+	cached, ok := c.lists[key]
+	c.mu.Unlock()
+	if !ok || now.Sub(cached.checkedAt) >= c.TTL {
+		logins, err := lookup()
+		if err != nil {
+			return false, err
+		}
+		cached = loginList{owner: owner, logins: make(map[string]bool, len(logins)), checkedAt: now}
+		for _, listed := range logins {
+			cached.logins[strings.ToLower(listed)] = true
+		}
+		if c.TTL > 0 {
+			c.mu.Lock()
+			if len(c.lists) >= maxCollaboratorCacheEntries {
+				c.lists = make(map[string]loginList)
+			}
+			c.lists[key] = cached
+			c.mu.Unlock()
+		}
+	}
+	return cached.logins[strings.ToLower(login)], nil
+}
+
+func (c *CollaboratorCache) store(key collaboratorKey, collaborator types.Collaborator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCollaboratorCacheEntries {
+		now := c.now()
+		for k, v := range c.entries {
+			if now.Sub(v.CheckedAt) >= c.TTL {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCollaboratorCacheEntries {
+			c.entries = make(map[collaboratorKey]types.Collaborator)
+		}
+	}
+	c.entries[key] = collaborator
+}
+
+// Invalidate forgets cached results for login, either on one repository, or (with a zero repoId) on every
+// repository of the owner. Organization wide lists of the owner are forgotten either way, since they may include
+// login.
+func (c *CollaboratorCache) Invalidate(postgres db.IClaDB, repoOwner string, repoId int64, login string) error {
+	c.mu.Lock()
+	for key, cached := range c.entries {
+		if key.login != strings.ToLower(login) {
+			continue
+		}
+		if (repoId != 0 && key.repoId == repoId) || (repoId == 0 && strings.EqualFold(cached.RepoOwner, repoOwner)) {
+			delete(c.entries, key)
+		}
+	}
+	for key, cached := range c.lists {
+		if strings.EqualFold(cached.owner, repoOwner) {
+			delete(c.lists, key)
+		}
+	}
+	c.mu.Unlock()
+
+	if c.Shared {
+		return postgres.InvalidateCachedCollaborators(repoOwner, repoId, login)
+	}
+	return nil
+}
+
+// HandleMember drops cached collaborator results after a collaborator was added to, removed from, or changed on
+// a repository.
+func HandleMember(logger *zap.Logger, postgres db.IClaDB, payload webhook.MemberPayload, host *Host) error {
+	logger.Info("repository collaborator changed",
+		zap.String("action", payload.Action),
+		zap.Int64("repoId", payload.Repository.ID),
+		zap.String("login", payload.Member.Login),
+	)
+	return Collaborators.Invalidate(postgres, payload.Repository.Owner.Login, payload.Repository.ID, vcs.QualifiedLogin(host.Provider(), payload.Member.Login))
+}
+
+// HandleMembership drops cached collaborator results for every repository of the organization after a team
+// membership changed, since teams can grant access to any of them.
+func HandleMembership(logger *zap.Logger, postgres db.IClaDB, payload webhook.MembershipPayload, host *Host) error {
+	logger.Info("team membership changed",
+		zap.String("action", payload.Action),
+		zap.String("org", payload.Organization.Login),
+		zap.String("login", payload.Member.Login),
+	)
+	return Collaborators.Invalidate(postgres, payload.Organization.Login, 0, vcs.QualifiedLogin(host.Provider(), payload.Member.Login))
+}
+
+// HandleOrganization drops cached collaborator results for every repository of the organization after a member was
+// added to or removed from it, since base permissions of the organization can grant access to any of them.
+func HandleOrganization(logger *zap.Logger, postgres db.IClaDB, payload webhook.OrganizationPayload, host *Host) error {
+	logger.Info("organization membership changed",
+		zap.String("action", payload.Action),
+		zap.String("org", payload.Organization.Login),
+		zap.String("login", payload.Membership.User.Login),
+	)
+	return Collaborators.Invalidate(postgres, payload.Organization.Login, 0, vcs.QualifiedLogin(host.Provider(), payload.Membership.User.Login))
+}
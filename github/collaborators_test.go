@@ -0,0 +1,257 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	webhook "gopkg.in/go-playground/webhooks.v5/github"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+func setupTestCollaboratorCache(ttl time.Duration) (cache *CollaboratorCache, now *time.Time) {
+	cache = NewCollaboratorCache(ttl)
+	current := time.Now()
+	now = &current
+	cache.now = func() time.Time { return *now }
+	return
+}
+
+func TestCollaboratorCacheRemembersResult(t *testing.T) {
+	cache, now := setupTestCollaboratorCache(time.Minute)
+	mockDB, logger := setupMockDB(t, false)
+	repositoriesMock := &RepositoriesMock{isCollaboratorResult: true}
+	evalInfo := &types.EvaluationInfo{RepoId: 1, RepoOwner: "myOwner", RepoName: "myRepo"}
+
+	isCollaborator, err := cache.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "myLogin")
+	assert.NoError(t, err)
+	assert.True(t, isCollaborator)
+
+	// logins are not case-sensitive
+	isCollaborator, err = cache.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "MyLogin")
+	assert.NoError(t, err)
+	assert.True(t, isCollaborator)
+	assert.Equal(t, 1, repositoriesMock.isCollaboratorCalls)
+
+	// other repositories are looked up separately
+	_, err = cache.IsCollaborator(logger, mockDB, repositoriesMock, &types.EvaluationInfo{RepoId: 2}, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repositoriesMock.isCollaboratorCalls)
+
+	*now = now.Add(time.Minute)
+	_, err = cache.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, repositoriesMock.isCollaboratorCalls)
+}
+
+func TestCollaboratorCacheErrorNotCached(t *testing.T) {
+	cache, _ := setupTestCollaboratorCache(time.Minute)
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced IsCollaborator error")
+	repositoriesMock := &RepositoriesMock{isCollaboratorErr: forcedError}
+
+	_, err := cache.IsCollaborator(logger, mockDB, repositoriesMock, &types.EvaluationInfo{}, "myLogin")
+	assert.EqualError(t, err, forcedError.Error())
+	_, err = cache.IsCollaborator(logger, mockDB, repositoriesMock, &types.EvaluationInfo{}, "myLogin")
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Equal(t, 2, repositoriesMock.isCollaboratorCalls)
+}
+
+func TestCollaboratorCacheDisabled(t *testing.T) {
+	cache, _ := setupTestCollaboratorCache(0)
+	mockDB, logger := setupMockDB(t, false)
+	repositoriesMock := &RepositoriesMock{isCollaboratorResult: true}
+
+	for i := 0; i < 2; i++ {
+		isCollaborator, err := cache.IsCollaborator(logger, mockDB, repositoriesMock, &types.EvaluationInfo{}, "myLogin")
+		assert.NoError(t, err)
+		assert.True(t, isCollaborator)
+	}
+	assert.Equal(t, 2, repositoriesMock.isCollaboratorCalls)
+}
+
+func TestCollaboratorCacheSharedHit(t *testing.T) {
+	cache, now := setupTestCollaboratorCache(time.Minute)
+	cache.Shared = true
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.getCachedCollaborator = &types.Collaborator{RepoId: 1, Login: "mylogin", IsCollaborator: true, CheckedAt: *now}
+	repositoriesMock := &RepositoriesMock{}
+
+	isCollaborator, err := cache.IsCollaborator(logger, mockDB, repositoriesMock, &types.EvaluationInfo{RepoId: 1}, "myLogin")
+	assert.NoError(t, err)
+	assert.True(t, isCollaborator)
+	assert.Equal(t, 0, repositoriesMock.isCollaboratorCalls)
+}
+
+func TestCollaboratorCacheSharedErrorsIgnored(t *testing.T) {
+	cache, _ := setupTestCollaboratorCache(time.Minute)
+	cache.Shared = true
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.getCachedCollaboratorError = fmt.Errorf("forced get cached collaborator error")
+	mockDB.storeCachedCollaboratorError = fmt.Errorf("forced store cached collaborator error")
+	repositoriesMock := &RepositoriesMock{isCollaboratorResult: true}
+
+	isCollaborator, err := cache.IsCollaborator(logger, mockDB, repositoriesMock, &types.EvaluationInfo{RepoId: 1}, "myLogin")
+	assert.NoError(t, err)
+	assert.True(t, isCollaborator)
+	assert.Equal(t, 1, repositoriesMock.isCollaboratorCalls)
+}
+
+func TestCollaboratorCacheInvalidate(t *testing.T) {
+	cache, _ := setupTestCollaboratorCache(time.Minute)
+	mockDB, logger := setupMockDB(t, false)
+	repositoriesMock := &RepositoriesMock{}
+	repo1 := &types.EvaluationInfo{RepoId: 1, RepoOwner: "myOwner"}
+	repo2 := &types.EvaluationInfo{RepoId: 2, RepoOwner: "myOwner"}
+	otherOwner := &types.EvaluationInfo{RepoId: 3, RepoOwner: "otherOwner"}
+	lookupAll := func() {
+		for _, evalInfo := range []*types.EvaluationInfo{repo1, repo2, otherOwner} {
+			_, err := cache.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "myLogin")
+			assert.NoError(t, err)
+		}
+	}
+	lookupAll()
+	assert.Equal(t, 3, repositoriesMock.isCollaboratorCalls)
+
+	assert.NoError(t, cache.Invalidate(mockDB, "myOwner", 1, "MYLOGIN"))
+	lookupAll()
+	assert.Equal(t, 4, repositoriesMock.isCollaboratorCalls)
+
+	assert.NoError(t, cache.Invalidate(mockDB, "MyOwner", 0, "myLogin"))
+	lookupAll()
+	assert.Equal(t, 6, repositoriesMock.isCollaboratorCalls)
+}
+
+func TestCollaboratorCacheIsListed(t *testing.T) {
+	cache, now := setupTestCollaboratorCache(time.Minute)
+	lookups := 0
+	lookup := func() ([]string, error) {
+		lookups++
+		return []string{"Alice", "bob"}, nil
+	}
+
+	listed, err := cache.isListed("outside-collaborators:myOrg", "myOrg", "alice", lookup)
+	assert.NoError(t, err)
+	assert.True(t, listed)
+	listed, err = cache.isListed("outside-collaborators:myOrg", "myOrg", "carol", lookup)
+	assert.NoError(t, err)
+	assert.False(t, listed)
+	assert.Equal(t, 1, lookups)
+
+	// collaborator changes anywhere in the organization may change the list
+	assert.NoError(t, cache.Invalidate(nil, "MyOrg", 1, "carol"))
+	_, err = cache.isListed("outside-collaborators:myOrg", "myOrg", "carol", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, lookups)
+
+	*now = now.Add(time.Minute)
+	_, err = cache.isListed("outside-collaborators:myOrg", "myOrg", "carol", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, lookups)
+
+	forcedError := fmt.Errorf("forced list error")
+	*now = now.Add(time.Minute)
+	_, err = cache.isListed("outside-collaborators:myOrg", "myOrg", "alice", func() ([]string, error) {
+		return nil, forcedError
+	})
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestCollaboratorCacheIsListedDisabled(t *testing.T) {
+	cache, _ := setupTestCollaboratorCache(0)
+	lookups := 0
+	lookup := func() ([]string, error) {
+		lookups++
+		return []string{"alice"}, nil
+	}
+
+	for range 2 {
+		listed, err := cache.isListed("outside-collaborators:myOrg", "myOrg", "alice", lookup)
+		assert.NoError(t, err)
+		assert.True(t, listed)
+	}
+	assert.Equal(t, 2, lookups)
+}
+
+func TestCollaboratorCacheInvalidateSharedError(t *testing.T) {
+	cache, _ := setupTestCollaboratorCache(time.Minute)
+	cache.Shared = true
+	mockDB, _ := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced invalidate error")
+	mockDB.invalidateCollaboratorsError = forcedError
+
+	assert.EqualError(t, cache.Invalidate(mockDB, "myOwner", 1, "myLogin"), forcedError.Error())
+}
+
+func TestHandleMember(t *testing.T) {
+	defer Collaborators.Reset()
+	mockDB, logger := setupMockDB(t, false)
+	repositoriesMock := &RepositoriesMock{}
+	evalInfo := &types.EvaluationInfo{RepoId: 1, RepoOwner: "myOwner"}
+	_, err := Collaborators.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "myLogin")
+	assert.NoError(t, err)
+
+	payload := webhook.MemberPayload{Action: "added"}
+	payload.Repository.ID = 1
+	payload.Repository.Owner.Login = "myOwner"
+	payload.Member.Login = "myLogin"
+	assert.NoError(t, HandleMember(logger, mockDB, payload, nil))
+
+	_, err = Collaborators.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repositoriesMock.isCollaboratorCalls)
+}
+
+func TestHandleMembership(t *testing.T) {
+	defer Collaborators.Reset()
+	mockDB, logger := setupMockDB(t, false)
+	repositoriesMock := &RepositoriesMock{}
+	evalInfo := &types.EvaluationInfo{RepoId: 1, RepoOwner: "myOrg"}
+	_, err := Collaborators.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "myLogin")
+	assert.NoError(t, err)
+
+	payload := webhook.MembershipPayload{Action: "removed", Scope: "team"}
+	payload.Organization.Login = "myOrg"
+	payload.Member.Login = "myLogin"
+	assert.NoError(t, HandleMembership(logger, mockDB, payload, nil))
+
+	_, err = Collaborators.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repositoriesMock.isCollaboratorCalls)
+}
+
+func TestHandleOrganization(t *testing.T) {
+	defer Collaborators.Reset()
+	mockDB, logger := setupMockDB(t, false)
+	repositoriesMock := &RepositoriesMock{}
+	evalInfo := &types.EvaluationInfo{RepoId: 1, RepoOwner: "myOrg"}
+	_, err := Collaborators.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "myLogin")
+	assert.NoError(t, err)
+
+	payload := webhook.OrganizationPayload{Action: "member_removed"}
+	payload.Organization.Login = "myOrg"
+	payload.Membership.User.Login = "myLogin"
+	assert.NoError(t, HandleOrganization(logger, mockDB, payload, nil))
+
+	_, err = Collaborators.IsCollaborator(logger, mockDB, repositoriesMock, evalInfo, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repositoriesMock.isCollaboratorCalls)
+}
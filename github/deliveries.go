@@ -0,0 +1,193 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+	webhook "gopkg.in/go-playground/webhooks.v5/github"
+)
+
+const headerDelivery = "X-GitHub-Delivery"
+const headerEvent = "X-GitHub-Event"
+
+// settingSeparator separates the webhook secrets, or the private key files, active during a rotation
+const settingSeparator = ","
+
+// recentDeliveries is how many webhook deliveries we remember, see DeliveryLog
+const recentDeliveries = 100
+
+// WebhookSecrets splits a webhook secret setting into the secrets accepted during a rotation, e.g. "new,old".
+func WebhookSecrets(setting string) (secrets []string) {
+	for _, secret := range strings.Split(setting, settingSeparator) {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return
+}
+
+// SecretFingerprint identifies a webhook secret in reports, without giving it away.
+func SecretFingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// ErrNoWebhookSecret rejects webhooks of an app we know no webhook secret of, as anyone could have sent them.
+var ErrNoWebhookSecret = errors.New("no webhook secret configured")
+
+// VerifyWebhookSignature checks a webhook was signed with one of the secrets, and returns the fingerprint of that
+// secret. Without secrets every webhook is rejected. The body is put back, so the webhook can be parsed afterwards.
+func VerifyWebhookSignature(r *http.Request, secrets []string) (fingerprint string, err error) {
+	if len(secrets) == 0 {
+		return "", ErrNoWebhookSecret
+	}
+	signature := r.Header.Get(github.SHA256SignatureHeader)
+	if signature == "" {
+		signature = r.Header.Get(github.SHA1SignatureHeader)
+	}
+	if signature == "" {
+		return "", webhook.ErrMissingHubSignatureHeader
+	}
+
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	for _, secret := range secrets {
+		if github.ValidateSignature(signature, body, []byte(secret)) == nil {
+			return SecretFingerprint(secret), nil
+		}
+	}
+	return "", webhook.ErrHMACVerificationFailed
+}
+
+// Delivery is a webhook we received from GitHub, and the credentials it was handled with.
+type Delivery struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	// Host is the GitHub Enterprise Server instance of the webhook, empty for github.com
+	Host   string `json:"host,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	AppId  int64  `json:"appId,omitempty"`
+	// Secret is the fingerprint of the webhook secret that verified the delivery, empty if it was not verified
+	Secret string `json:"secret,omitempty"`
+	// SigningKey is the fingerprint of the private key signing the app's tokens when the delivery came in
+	SigningKey string    `json:"signingKey,omitempty"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// SecretUsage tells when a webhook secret last verified a delivery, so we know when an old one can be retired.
+type SecretUsage struct {
+	Fingerprint string    `json:"fingerprint"`
+	Deliveries  int       `json:"deliveries"`
+	LastUsed    time.Time `json:"lastUsed"`
+}
+
+// DeliveryLog keeps the most recent webhook deliveries, and the use of every webhook secret since we started.
+type DeliveryLog struct {
+	mu         sync.Mutex
+	size       int
+	now        func() time.Time
+	deliveries []Delivery
+	secrets    map[string]*SecretUsage
+}
+
+func NewDeliveryLog(size int) *DeliveryLog {
+	return &DeliveryLog{size: size, now: time.Now, secrets: make(map[string]*SecretUsage)}
+}
+
+// Deliveries are the webhooks of github.com and of our hosts.
+var Deliveries = NewDeliveryLog(recentDeliveries)
+
+// RecordDelivery remembers a verified webhook, along with the key signing the tokens of its app.
+func RecordDelivery(r *http.Request, host *Host, tenant string, appId int64, secret string) {
+	delivery := Delivery{
+		ID:     r.Header.Get(headerDelivery),
+		Event:  r.Header.Get(headerEvent),
+		Host:   host.Provider(),
+		Tenant: tenant,
+		AppId:  appId,
+		Secret: secret,
+	}
+	if appId != 0 {
+		apps := Apps
+		if host != nil {
+			apps = host.apps
+		}
+		// an app without a usable key fails later on, with a better error
+		delivery.SigningKey, _ = apps.SigningKey(appId)
+	}
+	Deliveries.Record(delivery)
+}
+
+func (l *DeliveryLog) Record(delivery Delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delivery.ReceivedAt = l.now()
+	l.deliveries = append(l.deliveries, delivery)
+	if len(l.deliveries) > l.size {
+		l.deliveries = l.deliveries[len(l.deliveries)-l.size:]
+	}
+	if delivery.Secret == "" {
+		return
+	}
+	usage, ok := l.secrets[delivery.Secret]
+	if !ok {
+		usage = &SecretUsage{Fingerprint: delivery.Secret}
+		l.secrets[delivery.Secret] = usage
+	}
+	usage.Deliveries++
+	usage.LastUsed = delivery.ReceivedAt
+}
+
+// Recent returns the deliveries we remember, newest first.
+func (l *DeliveryLog) Recent() (deliveries []Delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	deliveries = make([]Delivery, 0, len(l.deliveries))
+	for i := len(l.deliveries) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, l.deliveries[i])
+	}
+	return
+}
+
+// Secrets returns the use of every webhook secret that verified a delivery, most recently used first.
+func (l *DeliveryLog) Secrets() (secrets []SecretUsage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	secrets = make([]SecretUsage, 0, len(l.secrets))
+	for _, usage := range l.secrets {
+		secrets = append(secrets, *usage)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].LastUsed.After(secrets[j].LastUsed)
+	})
+	return
+}
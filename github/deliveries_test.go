@@ -0,0 +1,158 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+	webhook "gopkg.in/go-playground/webhooks.v5/github"
+)
+
+func signedWebhookRequest(header, signature string, body []byte) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhook-integration", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(header, signature)
+	}
+	return req
+}
+
+func TestWebhookSecrets(t *testing.T) {
+	assert.Nil(t, WebhookSecrets(""))
+	assert.Equal(t, []string{"mySecret"}, WebhookSecrets("mySecret"))
+	assert.Equal(t, []string{"new", "old"}, WebhookSecrets(" new, old ,"))
+}
+
+func TestSecretFingerprint(t *testing.T) {
+	fingerprint := SecretFingerprint("mySecret")
+	assert.Regexp(t, "^sha256:[0-9a-f]{12}$", fingerprint)
+	assert.NotContains(t, fingerprint, "mySecret")
+	assert.NotEqual(t, fingerprint, SecretFingerprint("myOtherSecret"))
+}
+
+func TestVerifyWebhookSignatureNoSecrets(t *testing.T) {
+	body := []byte("{}")
+	secret, err := VerifyWebhookSignature(signedWebhookRequest(github.SHA256SignatureHeader, SignFakeWebhook("", body), body), nil)
+	assert.Equal(t, ErrNoWebhookSecret, err)
+	assert.Equal(t, "", secret)
+}
+
+func TestVerifyWebhookSignatureMissing(t *testing.T) {
+	_, err := VerifyWebhookSignature(signedWebhookRequest(github.SHA256SignatureHeader, "", []byte("{}")), []string{"mySecret"})
+	assert.Equal(t, webhook.ErrMissingHubSignatureHeader, err)
+}
+
+func TestVerifyWebhookSignatureRotation(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	secrets := []string{"newSecret", "oldSecret"}
+
+	for _, signingSecret := range secrets {
+		req := signedWebhookRequest(github.SHA256SignatureHeader, SignFakeWebhook(signingSecret, body), body)
+		secret, err := VerifyWebhookSignature(req, secrets)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretFingerprint(signingSecret), secret)
+
+		// the body can still be parsed
+		parsedBody, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, body, parsedBody)
+	}
+
+	req := signedWebhookRequest(github.SHA256SignatureHeader, SignFakeWebhook("retiredSecret", body), body)
+	_, err := VerifyWebhookSignature(req, secrets)
+	assert.Equal(t, webhook.ErrHMACVerificationFailed, err)
+}
+
+func TestVerifyWebhookSignatureSHA1(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	mac := hmac.New(sha1.New, []byte("oldSecret"))
+	mac.Write(body)
+	req := signedWebhookRequest(github.SHA1SignatureHeader, "sha1="+hex.EncodeToString(mac.Sum(nil)), body)
+
+	secret, err := VerifyWebhookSignature(req, []string{"newSecret", "oldSecret"})
+	assert.NoError(t, err)
+	assert.Equal(t, SecretFingerprint("oldSecret"), secret)
+}
+
+func TestDeliveryLogRecent(t *testing.T) {
+	log := NewDeliveryLog(2)
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	log.now = func() time.Time { return now }
+
+	log.Record(Delivery{ID: "1", Secret: "sha256:old"})
+	now = now.Add(time.Minute)
+	log.Record(Delivery{ID: "2", Secret: "sha256:new"})
+	now = now.Add(time.Minute)
+	log.Record(Delivery{ID: "3", Secret: "sha256:new"})
+	log.Record(Delivery{ID: "4"})
+
+	recent := log.Recent()
+	assert.Equal(t, 2, len(recent))
+	assert.Equal(t, "4", recent[0].ID)
+	assert.Equal(t, "3", recent[1].ID)
+	assert.Equal(t, now, recent[1].ReceivedAt)
+
+	// secrets are counted beyond the recent deliveries
+	assert.Equal(t, []SecretUsage{
+		{Fingerprint: "sha256:new", Deliveries: 2, LastUsed: now},
+		{Fingerprint: "sha256:old", Deliveries: 1, LastUsed: now.Add(-2 * time.Minute)},
+	}, log.Secrets())
+}
+
+func TestRecordDelivery(t *testing.T) {
+	SetupTestDeliveries(t)
+	SetupTestPrivateKeys(t)
+	host := setupTestHost(t)
+
+	req := signedWebhookRequest(github.SHA256SignatureHeader, "", []byte("{}"))
+	req.Header.Set(headerDelivery, "myDelivery")
+	req.Header.Set(headerEvent, "pull_request")
+	RecordDelivery(req, host, "apache", 5, SecretFingerprint("mySecret"))
+
+	signingKey, err := host.apps.SigningKey(5)
+	assert.NoError(t, err)
+	recent := Deliveries.Recent()
+	assert.Equal(t, 1, len(recent))
+	assert.Equal(t, "myDelivery", recent[0].ID)
+	assert.Equal(t, "pull_request", recent[0].Event)
+	assert.Equal(t, "github.example.com", recent[0].Host)
+	assert.Equal(t, "apache", recent[0].Tenant)
+	assert.Equal(t, int64(5), recent[0].AppId)
+	assert.Equal(t, SecretFingerprint("mySecret"), recent[0].Secret)
+	assert.Equal(t, signingKey, recent[0].SigningKey)
+}
+
+func TestRecordDeliveryWithoutKey(t *testing.T) {
+	SetupTestDeliveries(t)
+	SetupTestPrivateKeys(t)
+
+	RecordDelivery(signedWebhookRequest(github.SHA256SignatureHeader, "", []byte("{}")), nil, "", 0, "")
+	recent := Deliveries.Recent()
+	assert.Equal(t, 1, len(recent))
+	assert.Equal(t, "", recent[0].Host)
+	assert.Equal(t, "", recent[0].SigningKey)
+}
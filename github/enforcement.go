@@ -0,0 +1,177 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+// EnforcementPolicy decides which PRs need the CLA at all. PRs it does not enforce get a successful status, so
+// branch protection requiring our status still lets them through. Every rule can be scoped to an organization
+// ("myOrg:...") or repository ("myOrg/myRepo:..."), and the most specific scope with any entries wins.
+type EnforcementPolicy struct {
+	// BaseBranches are the base branch patterns to enforce, where "*" matches anything, e.g. "main" or
+	// "myOrg/myRepo:develop". Without patterns, every base branch is enforced.
+	BaseBranches []string
+	// ExcludeRepos are "owner/name" patterns of repositories that are never enforced, e.g. "myOrg/*". Scoped
+	// entries, e.g. "myOrg/myRepo:false", decide for their organization or repository instead of the patterns.
+	ExcludeRepos []string
+	// ExcludeArchived skips PRs on archived repositories, e.g. "true" or "myOrg:true"
+	ExcludeArchived []string
+	// ExcludePrivate skips PRs on private repositories, e.g. "true,myOrg:false"
+	ExcludePrivate []string
+}
+
+// Enforcement is the policy used for all evaluations. Every PR is enforced by default.
+var Enforcement EnforcementPolicy
+
+// needsPullRequest tells if deciding needs more than the repository name, i.e. the PR base and repository details
+func (p EnforcementPolicy) needsPullRequest() bool {
+	return len(p.BaseBranches) > 0 || anyFlagSet(p.ExcludeArchived) || anyFlagSet(p.ExcludePrivate)
+}
+
+// scopedValues returns the values of the most specific scope that has any for the repository, and tells if they
+// are scoped to its organization or the repository itself.
+func scopedValues(entries []string, owner, repo string) (values []string, scoped bool) {
+	var orgValues, repoValues []string
+	for _, entry := range entries {
+		scope, value, isScoped := strings.Cut(entry, ":")
+		switch {
+		case !isScoped:
+			values = append(values, entry)
+		case strings.EqualFold(scope, owner+"/"+repo):
+			repoValues = append(repoValues, value)
+		case strings.EqualFold(scope, owner):
+			orgValues = append(orgValues, value)
+		}
+	}
+	if len(repoValues) > 0 {
+		return repoValues, true
+	}
+	if len(orgValues) > 0 {
+		return orgValues, true
+	}
+	return
+}
+
+// scopedFlag tells if a flag like "true,myOrg:false" is set for the repository, the last value of the most
+// specific scope counts.
+func scopedFlag(entries []string, owner, repo string) bool {
+	values, _ := scopedValues(entries, owner, repo)
+	return flagSet(values)
+}
+
+func flagSet(values []string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	set, _ := strconv.ParseBool(values[len(values)-1])
+	return set
+}
+
+// anyFlagSet tells if a flag is set for any scope.
+func anyFlagSet(entries []string) bool {
+	for _, entry := range entries {
+		_, value, scoped := strings.Cut(entry, ":")
+		if !scoped {
+			value = entry
+		}
+		if set, _ := strconv.ParseBool(value); set {
+			return true
+		}
+	}
+	return false
+}
+
+// baseBranchPatterns returns the patterns of the most specific scope that has any for the repository.
+func (p EnforcementPolicy) baseBranchPatterns(owner, repo string) []string {
+	patterns, _ := scopedValues(p.BaseBranches, owner, repo)
+	return patterns
+}
+
+// excludesRepo tells if the repository is never enforced.
+func (p EnforcementPolicy) excludesRepo(owner, repo string) bool {
+	values, scoped := scopedValues(p.ExcludeRepos, owner, repo)
+	if scoped {
+		return flagSet(values)
+	}
+	for _, pattern := range values {
+		if matchesPattern(pattern, owner+"/"+repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipReason tells why a PR is not enforced, or returns an empty reason if it is.
+func (p EnforcementPolicy) skipReason(ctx context.Context, pullRequestsService PullRequestsService, evalInfo *types.EvaluationInfo) (reason string, err error) {
+	if p.excludesRepo(evalInfo.RepoOwner, evalInfo.RepoName) {
+		return "excluded repository", nil
+	}
+	if !p.needsPullRequest() {
+		return
+	}
+
+	pr, _, err := pullRequestsService.Get(ctx, evalInfo.RepoOwner, evalInfo.RepoName, int(evalInfo.PRNumber))
+	if err != nil {
+		return
+	}
+	repo := pr.GetBase().GetRepo()
+	if repo.GetArchived() && scopedFlag(p.ExcludeArchived, evalInfo.RepoOwner, evalInfo.RepoName) {
+		return "archived repository", nil
+	}
+	if repo.GetPrivate() && scopedFlag(p.ExcludePrivate, evalInfo.RepoOwner, evalInfo.RepoName) {
+		return "private repository", nil
+	}
+
+	patterns := p.baseBranchPatterns(evalInfo.RepoOwner, evalInfo.RepoName)
+	if len(patterns) == 0 {
+		return
+	}
+	baseBranch := pr.GetBase().GetRef()
+	for _, pattern := range patterns {
+		if matchesCaseSensitivePattern(pattern, baseBranch) {
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("not enforced on %s", baseBranch), nil
+}
+
+// applyEnforcement reports a successful status on PRs the policy does not enforce, telling if it did.
+func applyEnforcement(logger *zap.Logger, postgres db.IClaDB, client GHClient, evalInfo *types.EvaluationInfo, botName string) (skipped bool, err error) {
+	reason, err := Enforcement.skipReason(context.Background(), client.PullRequests, evalInfo)
+	if err != nil || reason == "" {
+		return
+	}
+	logger.Debug("CLA not enforced",
+		zap.String("owner", evalInfo.RepoOwner),
+		zap.String("repo", evalInfo.RepoName),
+		zap.Int64("pullRequestID", evalInfo.PRNumber),
+		zap.String("reason", reason),
+	)
+	data := messageData(evalInfo)
+	data.Reason = reason
+	return true, reportMessageStatus(postgres, client.Repositories, messagesFor(logger, client.Repositories, evalInfo), evalInfo, "success", "statusNotEnforced", data, botName)
+}
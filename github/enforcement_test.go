@@ -0,0 +1,159 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+func prWithBase(ref string, archived, private bool) *PullRequestsMock {
+	return &PullRequestsMock{mockPullRequest: &github.PullRequest{Base: &github.PullRequestBranch{
+		Ref:  github.String(ref),
+		Repo: &github.Repository{Archived: github.Bool(archived), Private: github.Bool(private)},
+	}}}
+}
+
+func TestBaseBranchPatterns(t *testing.T) {
+	policy := EnforcementPolicy{BaseBranches: []string{"main", "release/*", "myOrg:master", "myOrg/legacy:develop", "otherOrg/repo:trunk"}}
+
+	assert.Equal(t, []string{"main", "release/*"}, policy.baseBranchPatterns("someOrg", "someRepo"))
+	assert.Equal(t, []string{"master"}, policy.baseBranchPatterns("MyOrg", "someRepo"))
+	assert.Equal(t, []string{"develop"}, policy.baseBranchPatterns("myOrg", "Legacy"))
+	assert.Nil(t, EnforcementPolicy{}.baseBranchPatterns("myOrg", "myRepo"))
+}
+
+func TestScopedFlag(t *testing.T) {
+	flag := []string{"true", "myOrg:false", "myOrg/legacy:true"}
+
+	assert.True(t, scopedFlag(flag, "someOrg", "someRepo"))
+	assert.False(t, scopedFlag(flag, "MyOrg", "someRepo"))
+	assert.True(t, scopedFlag(flag, "myOrg", "Legacy"))
+	assert.False(t, scopedFlag(nil, "myOrg", "myRepo"))
+	assert.False(t, scopedFlag([]string{"myOrg:true"}, "someOrg", "someRepo"))
+
+	assert.True(t, anyFlagSet([]string{"false", "myOrg:true"}))
+	assert.False(t, anyFlagSet([]string{"false", "myOrg:false"}))
+}
+
+func TestExcludesRepo(t *testing.T) {
+	policy := EnforcementPolicy{ExcludeRepos: []string{"myOrg/*", "myOrg/important:false", "otherOrg:true"}}
+
+	assert.True(t, policy.excludesRepo("myOrg", "sandbox"))
+	assert.False(t, policy.excludesRepo("myOrg", "Important"))
+	assert.True(t, policy.excludesRepo("otherOrg", "anything"))
+	assert.False(t, policy.excludesRepo("someOrg", "someRepo"))
+}
+
+func TestSkipReason(t *testing.T) {
+	evalInfo := &types.EvaluationInfo{RepoOwner: "myOrg", RepoName: "myRepo"}
+	policy := EnforcementPolicy{BaseBranches: []string{"main", "release/*"}, ExcludeArchived: []string{"true"}, ExcludePrivate: []string{"true"}}
+
+	for _, test := range []struct {
+		pr     *PullRequestsMock
+		reason string
+	}{
+		{prWithBase("main", false, false), ""},
+		{prWithBase("release/1.x", false, false), ""},
+		{prWithBase("feature", false, false), "not enforced on feature"},
+		{prWithBase("Main", false, false), "not enforced on Main"},
+		{prWithBase("Release/1.x", false, false), "not enforced on Release/1.x"},
+		{prWithBase("main", true, false), "archived repository"},
+		{prWithBase("main", false, true), "private repository"},
+	} {
+		reason, err := policy.skipReason(context.Background(), test.pr, evalInfo)
+		assert.NoError(t, err)
+		assert.Equal(t, test.reason, reason)
+	}
+}
+
+func TestSkipReasonScopedExclusions(t *testing.T) {
+	policy := EnforcementPolicy{ExcludeArchived: []string{"myOrg:true"}, ExcludePrivate: []string{"true", "myOrg/myRepo:false"}}
+
+	reason, err := policy.skipReason(context.Background(), prWithBase("main", true, true), &types.EvaluationInfo{RepoOwner: "myOrg", RepoName: "myRepo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "archived repository", reason)
+
+	reason, err = policy.skipReason(context.Background(), prWithBase("main", false, true), &types.EvaluationInfo{RepoOwner: "myOrg", RepoName: "myRepo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+
+	reason, err = policy.skipReason(context.Background(), prWithBase("main", true, true), &types.EvaluationInfo{RepoOwner: "otherOrg", RepoName: "otherRepo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "private repository", reason)
+
+	// nothing to look up when no flag is set anywhere
+	reason, err = EnforcementPolicy{ExcludePrivate: []string{"false"}}.skipReason(context.Background(), nil, &types.EvaluationInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestSkipReasonExcludedRepo(t *testing.T) {
+	// excluded repositories are skipped without asking GitHub
+	reason, err := EnforcementPolicy{ExcludeRepos: []string{"myOrg/*"}, ExcludePrivate: []string{"true"}}.skipReason(context.Background(), nil,
+		&types.EvaluationInfo{RepoOwner: "MyOrg", RepoName: "myRepo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "excluded repository", reason)
+
+	reason, err = EnforcementPolicy{ExcludeRepos: []string{"otherOrg/*"}}.skipReason(context.Background(), nil,
+		&types.EvaluationInfo{RepoOwner: "myOrg", RepoName: "myRepo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestSkipReasonGetError(t *testing.T) {
+	forcedError := fmt.Errorf("forced Get error")
+	_, err := EnforcementPolicy{ExcludeArchived: []string{"true"}}.skipReason(context.Background(), &PullRequestsMock{mockGetPullRequestError: forcedError},
+		&types.EvaluationInfo{})
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestEvaluatePullRequestNotEnforced(t *testing.T) {
+	setupOverrideEnvironment(t)
+	origEnforcement := Enforcement
+	t.Cleanup(func() {
+		Enforcement = origEnforcement
+	})
+	Enforcement = EnforcementPolicy{BaseBranches: []string{"main"}}
+
+	repositoriesMock := setupMockRepositoriesService(t, []bool{true}, []any{
+		[]context.Context{context.Background()}, // ctx
+		[]string{""},                            // owner
+		[]string{""},                            // repo
+		[]string{""},                            // ref
+		[]*github.RepoStatus{
+			{
+				State:       github.String("success"),
+				Description: github.String("CLA not required: not enforced on develop"),
+				Context:     &MockAppSlug,
+			},
+		},
+	})
+	GHImpl = &GHInterfaceMock{RepositoriesMock: *repositoriesMock, PullRequestsMock: *prWithBase("develop", false, false)}
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.prStatuses = map[int64]*types.PRStatus{}
+
+	assert.NoError(t, EvaluatePullRequest(logger, mockDB, &types.EvaluationInfo{RepoId: 1}, ""))
+	assert.Equal(t, 1, GHImpl.(*GHInterfaceMock).RepositoriesMock.assertParamsCreateStatus.callIndex)
+	assert.Equal(t, "success", mockDB.prStatuses[0].State)
+}
@@ -0,0 +1,357 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// Evaluator evaluates a PR tracked for a provider other than GitHub, see RegisterEvaluator.
+type Evaluator func(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, claVersion string) error
+
+var evaluators = map[string]Evaluator{}
+
+// RegisterEvaluator makes Evaluate hand PRs of provider to evaluator. Providers register at startup, before any
+// evaluation runs.
+func RegisterEvaluator(provider string, evaluator Evaluator) {
+	evaluators[provider] = evaluator
+}
+
+// Evaluate evaluates a tracked PR again, with whichever provider hosts it.
+func Evaluate(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, claVersion string) error {
+	provider := vcs.ProviderOf(evalInfo)
+	if IsGitHub(provider) {
+		return EvaluatePullRequest(logger, postgres, evalInfo, claVersion)
+	}
+	evaluator, ok := evaluators[provider]
+	if !ok {
+		return fmt.Errorf("no evaluator for provider: %s", provider)
+	}
+	return evaluator(logger, postgres, evalInfo, claVersion)
+}
+
+// HeadReader reads the head commit of a PR tracked for a provider other than GitHub, and tells if the PR is still
+// open, see RegisterHeadReader.
+type HeadReader func(logger *zap.Logger, evalInfo *types.EvaluationInfo) (sha string, open bool, err error)
+
+var headReaders = map[string]HeadReader{}
+
+// RegisterHeadReader makes RefreshHead ask reader for the head of PRs of provider. Providers register at startup,
+// along with their Evaluator.
+func RegisterHeadReader(provider string, reader HeadReader) {
+	headReaders[provider] = reader
+}
+
+// RefreshHead points a tracked PR at its current head commit, which may have moved since the PR was stored, and
+// tells if the PR is still open. Closed PRs are left as they are.
+func RefreshHead(logger *zap.Logger, evalInfo *types.EvaluationInfo) (open bool, err error) {
+	provider := vcs.ProviderOf(evalInfo)
+	var sha string
+	if IsGitHub(provider) {
+		sha, open, err = pullRequestHead(evalInfo)
+	} else if reader, ok := headReaders[provider]; ok {
+		sha, open, err = reader(logger, evalInfo)
+	} else {
+		return false, fmt.Errorf("no head reader for provider: %s", provider)
+	}
+	if err != nil || !open {
+		return
+	}
+	if sha != evalInfo.Sha {
+		logger.Debug("PR head moved",
+			zap.String("provider", provider),
+			zap.Int64("pullRequestID", evalInfo.PRNumber),
+			zap.String("storedSha", evalInfo.Sha),
+			zap.String("headSha", sha),
+		)
+		evalInfo.Sha = sha
+	}
+	return
+}
+
+// pullRequestHead is the HeadReader of GitHub PRs.
+func pullRequestHead(evalInfo *types.EvaluationInfo) (sha string, open bool, err error) {
+	client, err := installationClient(evalInfo)
+	if err != nil {
+		return
+	}
+	pr, _, err := client.PullRequests.Get(context.Background(), evalInfo.RepoOwner, evalInfo.RepoName, int(evalInfo.PRNumber))
+	if err != nil {
+		return
+	}
+	return pr.GetHead().GetSHA(), pr.GetState() == "open", nil
+}
+
+// EvaluateChange evaluates a PR of a provider other than GitHub: it reports a pending status, checks the authors
+// of all commits signed the CLA, and reports the outcome. Failed evaluations are retried by the reconciler.
+func EvaluateChange(logger *zap.Logger, postgres db.IClaDB, provider vcs.Provider, evalInfo *types.EvaluationInfo, signURL, claVersion string) (err error) {
+	ctx := context.Background()
+	messages := Messages
+	data := messageData(evalInfo)
+	data.SignURL = SignPageURL(signURL, provider.Name(), claVersion)
+	data.CLAVersion = claVersion
+
+	pendingReported := false
+	defer func() {
+		if err != nil && pendingReported {
+			finalizeChangeWithError(logger, postgres, provider, evalInfo, err)
+		}
+	}()
+
+	if err = reportChangeStatus(ctx, postgres, provider, messages, evalInfo, "pending", "statusPending", data); err != nil {
+		return err
+	}
+	pendingReported = true
+
+	return evaluateCommits(ctx, logger, postgres, provider, messages, evalInfo, data, signURL, claVersion)
+}
+
+// evaluateCommits checks every author of a PR signed the CLA, and reports the outcome with labels, a comment and
+// a status. The pending status must be reported already.
+func evaluateCommits(ctx context.Context, logger *zap.Logger, postgres db.IClaDB, provider vcs.Provider, messages *MessageTemplates,
+	evalInfo *types.EvaluationInfo, data MessageData, signURL, claVersion string) (err error) {
+	commits, err := provider.ListCommits(ctx, evalInfo)
+	if err != nil {
+		return err
+	}
+
+	var usersNeedingToSignCLA []types.UserSignature
+	var usersSigned []types.UserSignature
+	var commitsMissingAuthor []vcs.Commit
+	var commitsMissingVerification []vcs.Commit
+	// authors often have many commits in a PR, only check each of them once
+	authorsChecked := make(map[string]bool)
+	evalInfo.Exemptions = nil
+	evalInfo.SkippedCommits = nil
+
+	for _, v := range commits {
+		if reason := Exemptions.botReason(v); reason != "" {
+			evalInfo.SkippedCommits = append(evalInfo.SkippedCommits, types.SkippedCommit{
+				Sha:    v.SHA,
+				Login:  v.AuthorLogin,
+				Email:  v.AuthorEmail,
+				Reason: reason,
+			})
+			data.SkippedCommits = append(data.SkippedCommits, MessageCommit{SHA: v.SHA, URL: v.URL, Reason: reason})
+			continue
+		}
+
+		commitFailedChecks := false
+
+		if v.AuthorLogin == "" {
+			commitsMissingAuthor = append(commitsMissingAuthor, v)
+			commitFailedChecks = true
+		}
+
+		if !v.Verified {
+			commitsMissingVerification = append(commitsMissingVerification, v)
+			commitFailedChecks = true
+			logger.Debug("Commit failed verification check", zap.Any("Commit", v))
+		}
+
+		if commitFailedChecks {
+			continue
+		}
+
+		if authorsChecked[strings.ToLower(v.AuthorLogin)] {
+			continue
+		}
+		authorsChecked[strings.ToLower(v.AuthorLogin)] = true
+
+		// collaborators (and whoever else the exemption policy covers) need not sign the cla.
+		var exemptionReason string
+		exemptionReason, err = provider.MembershipReason(ctx, evalInfo, v.AuthorLogin)
+		if err != nil {
+			return err
+		}
+		if exemptionReason != "" {
+			logger.Debug("author exempt from signing",
+				zap.String("login", v.AuthorLogin),
+				zap.String("reason", exemptionReason))
+			evalInfo.Exemptions = append(evalInfo.Exemptions, types.Exemption{Login: v.AuthorLogin, Reason: exemptionReason})
+			continue
+		}
+
+		// signers of other providers sign with a qualified login, so they can't be mistaken for a GitHub user
+		signer := vcs.QualifiedLogin(provider.Name(), v.AuthorLogin)
+		var foundUserSigned *types.UserSignature
+		hasAuthorSigned, foundUserSigned, err := postgres.HasAuthorSignedTheCla(signer, claVersion)
+		if err != nil {
+			return err
+		}
+		if !hasAuthorSigned {
+			userMissingSignature := types.UserSignature{
+				User: types.User{
+					Login:     signer,
+					Email:     v.AuthorEmail,
+					GivenName: v.AuthorName,
+				},
+				CLAVersion: claVersion,
+				// do not populate TimeSigned
+			}
+			logger.Debug("missing author signature",
+				zap.Any("UserSignature", userMissingSignature))
+			usersNeedingToSignCLA = append(usersNeedingToSignCLA, userMissingSignature)
+		} else {
+			usersSigned = append(usersSigned, *foundUserSigned)
+		}
+	}
+
+	logger.Info(
+		fmt.Sprintf("Commits Reviewed for PR #%d", evalInfo.PRNumber),
+		zap.String("provider", provider.Name()),
+		zap.Int("Missing Author", len(commitsMissingAuthor)),
+		zap.Int("Missing Verification", len(commitsMissingVerification)),
+		zap.Any("Exemptions", evalInfo.Exemptions),
+		zap.Any("Skipped Commits", evalInfo.SkippedCommits),
+	)
+
+	if len(commitsMissingAuthor) > 0 || len(commitsMissingVerification) > 0 {
+		if len(commitsMissingAuthor) > 0 {
+			err := provider.AddLabel(ctx, evalInfo, messages.LabelMissingAuthor.Name, messages.LabelMissingAuthor.Color, messages.LabelMissingAuthor.Description)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(commitsMissingVerification) > 0 {
+			err := provider.AddLabel(ctx, evalInfo, messages.LabelMissingVerification.Name, messages.LabelMissingVerification.Color, messages.LabelMissingVerification.Description)
+			if err != nil {
+				return err
+			}
+		}
+
+		data.CommitsMissingAuthor = messageCommits(commitsMissingAuthor)
+		data.CommitsMissingVerification = messageCommits(commitsMissingVerification)
+		commentMessage, err := messages.render("commentCommitProblems", data)
+		if err != nil {
+			return err
+		}
+		logger.Debug("Adding Comment to Issue", zap.Int("Issue #", int(evalInfo.PRNumber)), zap.String("Comment", commentMessage))
+		if err = provider.Comment(ctx, evalInfo, commentMessage); err != nil {
+			return err
+		}
+
+		return reportChangeStatus(ctx, postgres, provider, messages, evalInfo, "failure", "statusCommitProblems", data)
+	}
+
+	if len(usersNeedingToSignCLA) > 0 {
+		err := provider.AddLabel(ctx, evalInfo, messages.LabelUnsigned.Name, messages.LabelUnsigned.Color, messages.LabelUnsigned.Description)
+		if err != nil {
+			return err
+		}
+		// handle case where PR was previously open and all authors had signed cla - meaning the old "all signed" label is applied
+		err = provider.RemoveLabel(ctx, evalInfo, messages.LabelSigned.Name)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range usersNeedingToSignCLA {
+			// mention the author by their login at the provider
+			_, login := vcs.ProviderOfLogin(v.User.Login)
+			data.UnsignedUsers = append(data.UnsignedUsers, login)
+			if SignLinks.Enabled() {
+				if data.SignURLs == nil {
+					data.SignURLs = make(map[string]string)
+				}
+				if data.SignURLs[login], err = SignLinks.URL(signURL, provider.ChangeURL(evalInfo), evalInfo, v.User.Login, claVersion); err != nil {
+					return err
+				}
+			}
+		}
+
+		// store failed users in the db, so we can reevaluate their PR's after they sign the CLA
+		evalInfo.UserSignatures = usersNeedingToSignCLA
+		err = postgres.StorePRAuthorsMissingSignature(evalInfo, time.Now())
+		if err != nil {
+			return err
+		}
+
+		// link to sign the cla
+		message, err := messages.render("commentSignCla", data)
+		if err != nil {
+			return err
+		}
+		if err = provider.Comment(ctx, evalInfo, message); err != nil {
+			return err
+		}
+
+		err = reportChangeStatus(ctx, postgres, provider, messages, evalInfo, "failure", "statusUnsigned", data)
+		if err != nil {
+			return err
+		}
+	} else {
+		logger.Debug("create label for signed CLA")
+		err = provider.AddLabel(ctx, evalInfo, messages.LabelSigned.Name, messages.LabelSigned.Color, messages.LabelSigned.Description)
+		if err != nil {
+			return err
+		}
+		// handle case where PR was previously open and some authors had NOT signed cla - meaning the old "not signed" label is applied
+		err = provider.RemoveLabel(ctx, evalInfo, messages.LabelUnsigned.Name)
+		if err != nil {
+			return err
+		}
+
+		err = reportChangeStatus(ctx, postgres, provider, messages, evalInfo, "success", "statusSigned", data)
+		if err != nil {
+			return err
+		}
+
+	}
+	// delete any prior failed user info from the db for this PR
+	// we always do this at this point because a PR can be re-evaluated and have both signed and unsigned authors
+	if err = postgres.RemovePRsForUsers(usersSigned, evalInfo); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// reportChangeStatus remembers a status for the reconciler, and reports it through the provider, with the
+// description rendered from the named message template.
+func reportChangeStatus(ctx context.Context, postgres db.IClaDB, provider vcs.Provider, messages *MessageTemplates, evalInfo *types.EvaluationInfo,
+	state, template string, data MessageData) error {
+	description, err := messages.render(template, data)
+	if err != nil {
+		return err
+	}
+	if err = postgres.StorePRStatus(evalInfo, state, time.Now()); err != nil {
+		return err
+	}
+	return provider.SetStatus(ctx, evalInfo, state, description)
+}
+
+// finalizeChangeWithError is finalizeWithError for PRs of other providers.
+func finalizeChangeWithError(logger *zap.Logger, postgres db.IClaDB, provider vcs.Provider, evalInfo *types.EvaluationInfo, evalErr error) {
+	template := recordFailure(logger, postgres, evalInfo, evalErr)
+	description, err := Messages.render(template, messageData(evalInfo))
+	if err != nil {
+		logger.Error("failed to render error status", zap.Error(err))
+	}
+	if err = provider.SetStatus(context.Background(), evalInfo, "error", description); err != nil {
+		logger.Error("failed to set error status", zap.Error(err))
+	}
+}
@@ -0,0 +1,275 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// providerMock records what an evaluation reports through a vcs.Provider
+type providerMock struct {
+	commits         []vcs.Commit
+	listCommitsErr  error
+	members         map[string]bool
+	statuses        []string
+	labelsAdded     []string
+	labelsRemoved   []string
+	comments        []string
+	membershipCalls []string
+}
+
+var _ vcs.Provider = (*providerMock)(nil)
+
+func (p *providerMock) Name() string {
+	return vcs.ProviderGitLab
+}
+
+func (p *providerMock) ListCommits(context.Context, *types.EvaluationInfo) ([]vcs.Commit, error) {
+	return p.commits, p.listCommitsErr
+}
+
+func (p *providerMock) SetStatus(_ context.Context, _ *types.EvaluationInfo, state, _ string) error {
+	p.statuses = append(p.statuses, state)
+	return nil
+}
+
+func (p *providerMock) AddLabel(_ context.Context, _ *types.EvaluationInfo, name, _, _ string) error {
+	p.labelsAdded = append(p.labelsAdded, name)
+	return nil
+}
+
+func (p *providerMock) RemoveLabel(_ context.Context, _ *types.EvaluationInfo, name string) error {
+	p.labelsRemoved = append(p.labelsRemoved, name)
+	return nil
+}
+
+func (p *providerMock) Comment(_ context.Context, _ *types.EvaluationInfo, body string) error {
+	p.comments = append(p.comments, body)
+	return nil
+}
+
+func (p *providerMock) MembershipReason(_ context.Context, _ *types.EvaluationInfo, login string) (string, error) {
+	p.membershipCalls = append(p.membershipCalls, login)
+	return reasonIf(p.members[login], ExemptionReasonCollaborator), nil
+}
+
+func (p *providerMock) ChangeURL(evalInfo *types.EvaluationInfo) string {
+	return fmt.Sprintf("https://gitlab.example.com/%s/%s/-/merge_requests/%d", evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber)
+}
+
+func gitlabEvalInfo() *types.EvaluationInfo {
+	return &types.EvaluationInfo{Provider: vcs.ProviderGitLab, RepoId: 7, RepoOwner: "group", RepoName: "project", Sha: "headSHA", PRNumber: 3}
+}
+
+func TestEvaluateUnknownProvider(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	assert.EqualError(t, Evaluate(logger, mockDB, &types.EvaluationInfo{Provider: "unknown"}, "1"), "no evaluator for provider: unknown")
+}
+
+func TestEvaluateRegisteredProvider(t *testing.T) {
+	origEvaluators := evaluators
+	defer func() {
+		evaluators = origEvaluators
+	}()
+	evaluators = map[string]Evaluator{}
+
+	var evaluated *types.EvaluationInfo
+	RegisterEvaluator(vcs.ProviderGitLab, func(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, claVersion string) error {
+		assert.Equal(t, "1", claVersion)
+		evaluated = evalInfo
+		return nil
+	})
+
+	mockDB, logger := setupMockDB(t, false)
+	evalInfo := gitlabEvalInfo()
+	assert.NoError(t, Evaluate(logger, mockDB, evalInfo, "1"))
+	assert.Equal(t, evalInfo, evaluated)
+}
+
+func TestRefreshHeadUnknownProvider(t *testing.T) {
+	_, logger := setupMockDB(t, false)
+	_, err := RefreshHead(logger, &types.EvaluationInfo{Provider: "unknown"})
+	assert.EqualError(t, err, "no head reader for provider: unknown")
+}
+
+func TestRefreshHeadRegisteredProvider(t *testing.T) {
+	origHeadReaders := headReaders
+	defer func() {
+		headReaders = origHeadReaders
+	}()
+	headReaders = map[string]HeadReader{}
+
+	open := true
+	RegisterHeadReader(vcs.ProviderGitLab, func(logger *zap.Logger, evalInfo *types.EvaluationInfo) (string, bool, error) {
+		return "newHeadSha", open, nil
+	})
+
+	_, logger := setupMockDB(t, false)
+	evalInfo := gitlabEvalInfo()
+	storedSha := evalInfo.Sha
+	open = false
+	isOpen, err := RefreshHead(logger, evalInfo)
+	assert.NoError(t, err)
+	assert.False(t, isOpen)
+	assert.Equal(t, storedSha, evalInfo.Sha)
+
+	open = true
+	isOpen, err = RefreshHead(logger, evalInfo)
+	assert.NoError(t, err)
+	assert.True(t, isOpen)
+	assert.Equal(t, "newHeadSha", evalInfo.Sha)
+}
+
+func setupPullRequestHead(t *testing.T, pullRequestsMock PullRequestsMock) {
+	resetPemFileImpl := SetupTestPemFile(t)
+	t.Cleanup(resetPemFileImpl)
+	resetGHJWTImpl := SetupMockGHJWT()
+	t.Cleanup(resetGHJWTImpl)
+	origGithubImpl := GHImpl
+	t.Cleanup(func() {
+		GHImpl = origGithubImpl
+	})
+	GHImpl = &GHInterfaceMock{PullRequestsMock: pullRequestsMock}
+}
+
+func TestRefreshHeadGitHub(t *testing.T) {
+	setupPullRequestHead(t, PullRequestsMock{mockPullRequest: &github.PullRequest{
+		State: github.String("open"),
+		Head:  &github.PullRequestBranch{SHA: github.String("newHeadSha")},
+	}})
+
+	_, logger := setupMockDB(t, false)
+	evalInfo := &types.EvaluationInfo{RepoOwner: "myOwner", RepoName: "myRepo", Sha: "storedSha", PRNumber: 5, AppId: 1, InstallId: 2}
+	open, err := RefreshHead(logger, evalInfo)
+	assert.NoError(t, err)
+	assert.True(t, open)
+	assert.Equal(t, "newHeadSha", evalInfo.Sha)
+}
+
+func TestRefreshHeadGitHubClosed(t *testing.T) {
+	setupPullRequestHead(t, PullRequestsMock{mockPullRequest: &github.PullRequest{
+		State: github.String("closed"),
+		Head:  &github.PullRequestBranch{SHA: github.String("newHeadSha")},
+	}})
+
+	_, logger := setupMockDB(t, false)
+	evalInfo := &types.EvaluationInfo{RepoOwner: "myOwner", RepoName: "myRepo", Sha: "storedSha", PRNumber: 5, AppId: 1, InstallId: 2}
+	open, err := RefreshHead(logger, evalInfo)
+	assert.NoError(t, err)
+	assert.False(t, open)
+	assert.Equal(t, "storedSha", evalInfo.Sha)
+}
+
+func TestRefreshHeadGitHubError(t *testing.T) {
+	forcedError := fmt.Errorf("forced get pull request error")
+	setupPullRequestHead(t, PullRequestsMock{mockGetPullRequestError: forcedError})
+
+	_, logger := setupMockDB(t, false)
+	_, err := RefreshHead(logger, &types.EvaluationInfo{RepoOwner: "myOwner", RepoName: "myRepo", PRNumber: 5, AppId: 1, InstallId: 2})
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestEvaluateChangeUnsignedAuthor(t *testing.T) {
+	mockDB, logger := setupMockDB(t, true)
+	evalInfo := gitlabEvalInfo()
+	mockDB.hasAuthorSignedLogin = "gitlab:alice"
+	mockDB.hasAuthorSignedCLAVersion = "1"
+	mockDB.storeUsersNeedingToSignEvalInfo = evalInfo
+	mockDB.removePRsEvalInfo = evalInfo
+	provider := &providerMock{
+		commits: []vcs.Commit{
+			{SHA: "aliceSHA", AuthorLogin: "alice", AuthorEmail: "alice@example.com", Verified: true},
+			{SHA: "aliceSHA2", AuthorLogin: "Alice", AuthorEmail: "alice@example.com", Verified: true},
+			{SHA: "botSHA", URL: "https://gitlab.com/c/botSHA", AuthorLogin: "renovate", AuthorBot: true},
+		},
+	}
+
+	assert.NoError(t, EvaluateChange(logger, mockDB, provider, evalInfo, "https://cla.example.com", "1"))
+
+	assert.Equal(t, []string{"pending", "failure"}, provider.statuses)
+	assert.Equal(t, []string{Messages.LabelUnsigned.Name}, provider.labelsAdded)
+	assert.Equal(t, []string{Messages.LabelSigned.Name}, provider.labelsRemoved)
+	assert.Equal(t, []string{"alice"}, provider.membershipCalls)
+	assert.Equal(t, 1, len(provider.comments))
+	assert.Contains(t, provider.comments[0], "@alice to [sign the Contributor License Agreement](https://cla.example.com?provider=gitlab)")
+	assert.Equal(t, "gitlab:alice", evalInfo.UserSignatures[0].User.Login)
+	assert.Equal(t, "alice@example.com", evalInfo.UserSignatures[0].User.Email)
+	assert.Equal(t, []types.SkippedCommit{{Sha: "botSHA", Login: "renovate", Reason: SkipReasonBotAccount}}, evalInfo.SkippedCommits)
+	assert.Contains(t, provider.comments[0], "- <a href=\"https://gitlab.com/c/botSHA\">botSHA</a> - bot account")
+}
+
+func TestEvaluateChangeMemberExempt(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	evalInfo := gitlabEvalInfo()
+	provider := &providerMock{
+		commits: []vcs.Commit{{SHA: "bobSHA", AuthorLogin: "bob", Verified: true}},
+		members: map[string]bool{"bob": true},
+	}
+
+	assert.NoError(t, EvaluateChange(logger, mockDB, provider, evalInfo, "https://cla.example.com", "1"))
+
+	assert.Equal(t, []string{"pending", "success"}, provider.statuses)
+	assert.Equal(t, []string{Messages.LabelSigned.Name}, provider.labelsAdded)
+	assert.Empty(t, provider.comments)
+	assert.Equal(t, []types.Exemption{{Login: "bob", Reason: ExemptionReasonCollaborator}}, evalInfo.Exemptions)
+}
+
+func TestEvaluateChangeCommitProblems(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	provider := &providerMock{
+		commits: []vcs.Commit{{SHA: "unknownSHA", URL: "https://gitlab.example.com/commit", AuthorEmail: "someone@example.com"}},
+	}
+
+	assert.NoError(t, EvaluateChange(logger, mockDB, provider, gitlabEvalInfo(), "https://cla.example.com", "1"))
+
+	assert.Equal(t, []string{"pending", "failure"}, provider.statuses)
+	assert.Equal(t, []string{Messages.LabelMissingAuthor.Name, Messages.LabelMissingVerification.Name}, provider.labelsAdded)
+	assert.Equal(t, 1, len(provider.comments))
+	assert.Contains(t, provider.comments[0], "unknownSHA")
+}
+
+func TestEvaluateChangeErrorReportsErrorStatus(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced list commits error")
+	provider := &providerMock{listCommitsErr: forcedError}
+
+	assert.EqualError(t, EvaluateChange(logger, mockDB, provider, gitlabEvalInfo(), "https://cla.example.com", "1"), forcedError.Error())
+
+	assert.Equal(t, []string{"pending", "error"}, provider.statuses)
+}
+
+func TestEvaluateChangeStoreStatusError(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced store PR status error")
+	mockDB.storePRStatusError = forcedError
+	provider := &providerMock{}
+
+	assert.EqualError(t, EvaluateChange(logger, mockDB, provider, gitlabEvalInfo(), "https://cla.example.com", "1"), forcedError.Error())
+
+	// a pending status the reconciler can't find would never be finished
+	assert.Nil(t, provider.statuses)
+}
@@ -0,0 +1,188 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v64/github"
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+const (
+	ExemptionReasonCollaborator        = "repository collaborator"
+	ExemptionReasonOrgMember           = "organization member"
+	ExemptionReasonTeamMember          = "team member"
+	ExemptionReasonOutsideCollaborator = "outside collaborator"
+	SkipReasonBotAccount               = "bot account"
+	SkipReasonBotLogin                 = "allowed bot login"
+	SkipReasonBotEmail                 = "allowed bot email"
+)
+
+// ExemptionPolicy decides which authors need not sign the CLA. Organization and team policies apply to the
+// organization owning the repository, and never match on repositories owned by a user.
+type ExemptionPolicy struct {
+	// Collaborators exempts anyone with access to the repository, including outside collaborators
+	Collaborators bool
+	// OrgMembers exempts members of the owning organization, even without access to the repository
+	OrgMembers bool
+	// Teams exempts active members of these teams (by slug) of the owning organization
+	Teams []string
+	// OutsideCollaborators exempts outside collaborators of the owning organization, on any of its repositories
+	OutsideCollaborators bool
+	// BotLogins are automation accounts that are not GitHub Apps, e.g. our own release bots
+	BotLogins []string
+	// BotEmails are commit author email patterns of automation accounts, where "*" matches anything
+	BotEmails []string
+}
+
+// Exemptions is the policy used for all evaluations. By default, only repository collaborators are exempt.
+var Exemptions = ExemptionPolicy{Collaborators: true}
+
+// exemptionReason tells why login need not sign the CLA, or returns an empty reason if it must.
+func (p ExemptionPolicy) exemptionReason(logger *zap.Logger, postgres db.IClaDB, client GHClient, evalInfo *types.EvaluationInfo, login string) (reason string, err error) {
+	var exempt bool
+	if p.Collaborators {
+		if exempt, err = Collaborators.IsCollaborator(logger, postgres, client.Repositories, evalInfo, login); err != nil || exempt {
+			return reasonIf(exempt, ExemptionReasonCollaborator), err
+		}
+	}
+
+	owner := evalInfo.RepoOwner
+	// organizations of different GitHub instances may share a name, their members are told apart by the host
+	cachedLogin := vcs.QualifiedLogin(vcs.ProviderOf(evalInfo), login)
+	if p.OrgMembers {
+		exempt, err = Collaborators.remember("org-member:"+owner, owner, cachedLogin, func() (bool, error) {
+			isMember, _, err := client.Organizations.IsMember(context.Background(), owner, login)
+			return isMember, err
+		})
+		if err != nil || exempt {
+			return reasonIf(exempt, ExemptionReasonOrgMember), err
+		}
+	}
+
+	for _, team := range p.Teams {
+		exempt, err = Collaborators.remember("team-member:"+owner+"/"+team, owner, cachedLogin, func() (bool, error) {
+			return isActiveTeamMember(client.Teams, owner, team, login)
+		})
+		if err != nil || exempt {
+			return reasonIf(exempt, ExemptionReasonTeamMember+" ("+team+")"), err
+		}
+	}
+
+	if p.OutsideCollaborators {
+		// the whole list is cached, rather than listed again for every author
+		scope := "outside-collaborators:" + vcs.QualifiedLogin(vcs.ProviderOf(evalInfo), owner)
+		exempt, err = Collaborators.isListed(scope, owner, login, func() ([]string, error) {
+			return listOutsideCollaborators(client.Organizations, owner)
+		})
+		if err != nil || exempt {
+			return reasonIf(exempt, ExemptionReasonOutsideCollaborator), err
+		}
+	}
+	return "", nil
+}
+
+// botReason tells why a commit was made by automation, and so needs neither a CLA nor a verified signature, or
+// returns an empty reason if it was not. Anyone can put any author email on a commit, so emails are only trusted
+// on verified commits.
+func (p ExemptionPolicy) botReason(commit vcs.Commit) string {
+	if commit.AuthorBot {
+		return SkipReasonBotAccount
+	}
+	for _, login := range p.BotLogins {
+		if commit.AuthorLogin != "" && strings.EqualFold(commit.AuthorLogin, login) {
+			return SkipReasonBotLogin
+		}
+	}
+	for _, pattern := range p.BotEmails {
+		if commit.Verified && commit.AuthorEmail != "" && matchesPattern(pattern, commit.AuthorEmail) {
+			return SkipReasonBotEmail
+		}
+	}
+	return ""
+}
+
+// matchesPattern matches value against a case-insensitive pattern, where only "*" is special, so the brackets
+// in bot names (e.g. "*[bot]@users.noreply.github.com") need no escaping.
+func matchesPattern(pattern, value string) bool {
+	return matchesPatternExpr("(?i)^"+patternExpr(pattern)+"$", value)
+}
+
+// matchesCaseSensitivePattern is matchesPattern for values where case matters, like git branch names.
+func matchesCaseSensitivePattern(pattern, value string) bool {
+	return matchesPatternExpr("^"+patternExpr(pattern)+"$", value)
+}
+
+func patternExpr(pattern string) string {
+	return strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+}
+
+func matchesPatternExpr(expr, value string) bool {
+	matched, _ := regexp.MatchString(expr, value)
+	return matched
+}
+
+func reasonIf(exempt bool, reason string) string {
+	if exempt {
+		return reason
+	}
+	return ""
+}
+
+// isNotFound tells if GitHub answered 404, e.g. because the owner is a user rather than an organization
+func isNotFound(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
+func isActiveTeamMember(teamsService TeamsService, org, team, login string) (bool, error) {
+	membership, _, err := teamsService.GetTeamMembershipBySlug(context.Background(), org, team, login)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	// invitations that were not accepted yet are "pending"
+	return membership.GetState() == "active", nil
+}
+
+// listOutsideCollaborators lists the logins of the outside collaborators of org, none if the owner is a user.
+func listOutsideCollaborators(organizationsService OrganizationsService, org string) (logins []string, err error) {
+	outsideCollaborators, err := listAll(func(opts github.ListOptions) ([]*github.User, *github.Response, error) {
+		return organizationsService.ListOutsideCollaborators(context.Background(), org, &github.ListOutsideCollaboratorsOptions{ListOptions: opts})
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, user := range outsideCollaborators {
+		logins = append(logins, user.GetLogin())
+	}
+	return logins, nil
+}
@@ -0,0 +1,174 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+func setupExemptionClient(t *testing.T) (ghMock *GHInterfaceMock, client GHClient) {
+	Collaborators.Reset()
+	t.Cleanup(Collaborators.Reset)
+	ghMock = &GHInterfaceMock{}
+	return ghMock, ghMock.NewClient(nil)
+}
+
+func TestExemptionReasonNotExempt(t *testing.T) {
+	_, client := setupExemptionClient(t)
+	mockDB, logger := setupMockDB(t, false)
+	policy := ExemptionPolicy{Collaborators: true, OrgMembers: true, Teams: []string{"core"}, OutsideCollaborators: true}
+
+	reason, err := policy.exemptionReason(logger, mockDB, client, &types.EvaluationInfo{RepoOwner: "myOrg"}, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestExemptionReasonCollaborator(t *testing.T) {
+	ghMock, client := setupExemptionClient(t)
+	ghMock.RepositoriesMock.isCollaboratorResult = true
+	mockDB, logger := setupMockDB(t, false)
+
+	reason, err := ExemptionPolicy{Collaborators: true}.exemptionReason(logger, mockDB, client, &types.EvaluationInfo{}, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, ExemptionReasonCollaborator, reason)
+
+	// collaborators need not be exempt
+	reason, err = ExemptionPolicy{}.exemptionReason(logger, mockDB, client, &types.EvaluationInfo{}, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestExemptionReasonOrgMember(t *testing.T) {
+	ghMock, client := setupExemptionClient(t)
+	ghMock.OrganizationsMock.isMemberResult = true
+	mockDB, logger := setupMockDB(t, false)
+	policy := ExemptionPolicy{Collaborators: true, OrgMembers: true}
+
+	for i := 0; i < 2; i++ {
+		reason, err := policy.exemptionReason(logger, mockDB, client, &types.EvaluationInfo{RepoOwner: "myOrg"}, "myLogin")
+		assert.NoError(t, err)
+		assert.Equal(t, ExemptionReasonOrgMember, reason)
+	}
+	assert.Equal(t, 1, ghMock.OrganizationsMock.isMemberCalls)
+}
+
+func TestExemptionReasonOrgMemberError(t *testing.T) {
+	ghMock, client := setupExemptionClient(t)
+	forcedError := fmt.Errorf("forced IsMember error")
+	ghMock.OrganizationsMock.isMemberErr = forcedError
+	mockDB, logger := setupMockDB(t, false)
+
+	reason, err := ExemptionPolicy{OrgMembers: true}.exemptionReason(logger, mockDB, client, &types.EvaluationInfo{}, "myLogin")
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Equal(t, "", reason)
+}
+
+func TestExemptionReasonTeamMember(t *testing.T) {
+	ghMock, client := setupExemptionClient(t)
+	ghMock.TeamsMock.mockMemberships = map[string]*github.Membership{
+		"invited": {State: github.String("pending")},
+		"core":    {State: github.String("active")},
+	}
+	mockDB, logger := setupMockDB(t, false)
+	policy := ExemptionPolicy{Teams: []string{"missing", "invited", "core"}}
+
+	reason, err := policy.exemptionReason(logger, mockDB, client, &types.EvaluationInfo{RepoOwner: "myOrg"}, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, ExemptionReasonTeamMember+" (core)", reason)
+}
+
+func TestExemptionReasonTeamMemberError(t *testing.T) {
+	ghMock, client := setupExemptionClient(t)
+	forcedError := fmt.Errorf("forced GetTeamMembershipBySlug error")
+	ghMock.TeamsMock.mockGetMembershipError = forcedError
+	mockDB, logger := setupMockDB(t, false)
+
+	_, err := ExemptionPolicy{Teams: []string{"core"}}.exemptionReason(logger, mockDB, client, &types.EvaluationInfo{}, "myLogin")
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestExemptionReasonOutsideCollaborator(t *testing.T) {
+	ghMock, client := setupExemptionClient(t)
+	ghMock.OrganizationsMock.mockOutsideCollaborators = []*github.User{{Login: github.String("someoneElse")}, {Login: github.String("MyLogin")}}
+	mockDB, logger := setupMockDB(t, false)
+
+	policy := ExemptionPolicy{OutsideCollaborators: true}
+	reason, err := policy.exemptionReason(logger, mockDB, client, &types.EvaluationInfo{RepoOwner: "myOrg"}, "myLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, ExemptionReasonOutsideCollaborator, reason)
+
+	// other authors are checked against the same list
+	reason, err = policy.exemptionReason(logger, mockDB, client, &types.EvaluationInfo{RepoOwner: "myOrg"}, "otherLogin")
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+	assert.Equal(t, 1, ghMock.OrganizationsMock.listOutsideCollaboratorsCalls)
+}
+
+func TestListOutsideCollaboratorsUserOwner(t *testing.T) {
+	organizationsMock := &OrganizationsMock{mockOutsideCollaboratorsError: &github.ErrorResponse{Response: notFoundResponse()}}
+
+	logins, err := listOutsideCollaborators(organizationsMock, "myUser")
+	assert.NoError(t, err)
+	assert.Empty(t, logins)
+
+	forcedError := fmt.Errorf("forced ListOutsideCollaborators error")
+	organizationsMock.mockOutsideCollaboratorsError = forcedError
+	_, err = listOutsideCollaborators(organizationsMock, "myOrg")
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestBotReason(t *testing.T) {
+	policy := ExemptionPolicy{
+		BotLogins: []string{"release-bot"},
+		BotEmails: []string{"*[bot]@users.noreply.github.com"},
+	}
+	commitBy := func(user *github.User, email string) *github.RepositoryCommit {
+		return &github.RepositoryCommit{
+			Author: user,
+			Commit: &github.Commit{Author: &github.CommitAuthor{Email: github.String(email)},
+				Verification: &github.SignatureVerification{Verified: github.Bool(true)}},
+		}
+	}
+
+	assert.Equal(t, SkipReasonBotAccount, policy.botReason(commitOf(commitBy(&github.User{Login: github.String("dependabot[bot]"), Type: github.String("Bot")}, ""))))
+	assert.Equal(t, SkipReasonBotLogin, policy.botReason(commitOf(commitBy(&github.User{Login: github.String("Release-Bot"), Type: github.String("User")}, ""))))
+	assert.Equal(t, SkipReasonBotEmail, policy.botReason(commitOf(commitBy(nil, "29139614+renovate[bot]@users.noreply.github.com"))))
+	assert.Equal(t, "", policy.botReason(commitOf(commitBy(&github.User{Login: github.String("someone"), Type: github.String("User")}, "someone@example.com"))))
+	assert.Equal(t, "", policy.botReason(commitOf(&github.RepositoryCommit{})))
+	assert.Equal(t, "", ExemptionPolicy{BotEmails: []string{"*"}}.botReason(commitOf(commitBy(nil, ""))))
+
+	// anyone can author a commit with a bot's email
+	unverified := commitOf(commitBy(nil, "29139614+renovate[bot]@users.noreply.github.com"))
+	unverified.Verified = false
+	assert.Equal(t, "", policy.botReason(unverified))
+}
+
+func TestMatchesPattern(t *testing.T) {
+	assert.True(t, matchesPattern("bot@example.com", "BOT@example.com"))
+	assert.False(t, matchesPattern("bot@example.com", "robot@example.com"))
+	assert.True(t, matchesPattern("*[bot]@users.noreply.github.com", "renovate[bot]@users.noreply.github.com"))
+	assert.False(t, matchesPattern("*[bot]@users.noreply.github.com", "renovatebot@users.noreply.github.com"))
+	assert.True(t, matchesPattern("release-*@*.example.com", "release-bot@ci.example.com"))
+	assert.True(t, matchesCaseSensitivePattern("release/*", "release/1.x"))
+	assert.False(t, matchesCaseSensitivePattern("release/*", "Release/1.x"))
+}
@@ -20,31 +20,21 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
-	"strconv"
+	"net/url"
 	"strings"
 	"time"
 
 	"go.uber.org/zap"
 
-	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/google/go-github/v64/github"
 	"github.com/sonatype-nexus-community/the-cla/db"
 	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
 	webhook "gopkg.in/go-playground/webhooks.v5/github"
 )
 
-func getpemlocation() string {
-	fromenv := os.Getenv("CLA_PEM_FILE")
-	if len(fromenv) == 0 {
-		return "the-cla.pem"
-	}
-	return fromenv
-}
-
-var FilenameTheClaPem = getpemlocation()
-
-const EnvGhAppId = "GH_APP_ID"
+// FilenameTheClaPem is the default private key of our app, see AppRegistry.SetKeyFile.
+var FilenameTheClaPem = "the-cla.pem"
 
 // RepositoriesService handles communication with the repository related methods
 // of the GitHub API.
@@ -54,6 +44,26 @@ type RepositoriesService interface {
 	ListStatuses(ctx context.Context, owner, repo, ref string, opts *github.ListOptions) ([]*github.RepoStatus, *github.Response, error)
 	CreateStatus(ctx context.Context, owner, repo, ref string, status *github.RepoStatus) (*github.RepoStatus, *github.Response, error)
 	IsCollaborator(ctx context.Context, owner, repo, user string) (bool, *github.Response, error)
+	GetPermissionLevel(ctx context.Context, owner, repo, user string) (*github.RepositoryPermissionLevel, *github.Response, error)
+	CompareCommits(ctx context.Context, owner, repo string, base, head string, opts *github.ListOptions) (*github.CommitsComparison, *github.Response, error)
+	GetContents(ctx context.Context, owner, repo, path string, opts *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error)
+}
+
+// OrganizationsService handles communication with the organization related
+// methods of the GitHub API.
+//
+// GitHub API docs: https://docs.github.com/en/rest/orgs
+type OrganizationsService interface {
+	IsMember(ctx context.Context, org, user string) (bool, *github.Response, error)
+	ListOutsideCollaborators(ctx context.Context, org string, opts *github.ListOutsideCollaboratorsOptions) ([]*github.User, *github.Response, error)
+}
+
+// TeamsService handles communication with the team related
+// methods of the GitHub API.
+//
+// GitHub API docs: https://docs.github.com/en/rest/teams
+type TeamsService interface {
+	GetTeamMembershipBySlug(ctx context.Context, org, slug, user string) (*github.Membership, *github.Response, error)
 }
 
 // UsersService handles communication with the user related methods
@@ -68,7 +78,9 @@ type UsersService interface {
 //
 // GitHub API docs: https://docs.github.com/en/free-pro-team@latest/rest/reference/pulls/
 type PullRequestsService interface {
+	Get(ctx context.Context, owner string, repo string, number int) (*github.PullRequest, *github.Response, error)
 	ListCommits(ctx context.Context, owner string, repo string, number int, opts *github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error)
+	ListFiles(ctx context.Context, owner string, repo string, number int, opts *github.ListOptions) ([]*github.CommitFile, *github.Response, error)
 }
 
 // IssuesService handles communication with the issue related
@@ -96,11 +108,6 @@ type AppsService interface {
 	GetInstallation(ctx context.Context, id int64) (*github.Installation, *github.Response, error)
 }
 
-func GetAppId() (appId int64, err error) {
-	appId, err = strconv.ParseInt(os.Getenv(EnvGhAppId), 10, 64)
-	return
-}
-
 type IGitHubJWTClient interface {
 	Get() (*github.App, error)
 	GetInstallInfo() (*github.Installation, error)
@@ -114,8 +121,10 @@ type GHJWTClient struct {
 func (ghj *GHJWTClient) Get() (app *github.App, err error) {
 	var resp *github.Response
 	app, resp, err = ghj.apps.Get(context.Background(), "") // empty appSlug here returns current authenticated app
-	// maybe check err instead or also?
-	if resp.StatusCode != http.StatusOK {
+	if err != nil {
+		return
+	}
+	if resp == nil || resp.StatusCode != http.StatusOK {
 		err = fmt.Errorf("it done broke: %+v", resp)
 		return
 	}
@@ -132,6 +141,8 @@ func (ghj *GHJWTClient) GetInstallInfo() (install *github.Installation, err erro
 
 type GHJWTInterface interface {
 	NewJWTClient(httpClient *http.Client, installID int64) IGitHubJWTClient
+	// NewEnterpriseJWTClient talks to a GitHub Enterprise Server instance instead of github.com
+	NewEnterpriseJWTClient(httpClient *http.Client, host *Host, installID int64) (IGitHubJWTClient, error)
 }
 
 type GHJWTCreator struct{}
@@ -141,42 +152,91 @@ func (gj *GHJWTCreator) NewJWTClient(httpClient *http.Client, installID int64) I
 	return &GHJWTClient{apps: client.Apps, installID: installID}
 }
 
+func (gj *GHJWTCreator) NewEnterpriseJWTClient(httpClient *http.Client, host *Host, installID int64) (IGitHubJWTClient, error) {
+	client, err := github.NewClient(httpClient).WithEnterpriseURLs(host.APIURL, host.UploadURL)
+	if err != nil {
+		return nil, err
+	}
+	return &GHJWTClient{apps: client.Apps, installID: installID}, nil
+}
+
 var GHJWTImpl GHJWTInterface = &GHJWTCreator{}
 
 // GHClient manages communication with the GitHub API.
 // https://github.com/google/go-github/issues/113
 type GHClient struct {
-	Repositories RepositoriesService
-	Users        UsersService
-	PullRequests PullRequestsService
-	Issues       IssuesService
+	Repositories  RepositoriesService
+	Users         UsersService
+	PullRequests  PullRequestsService
+	Issues        IssuesService
+	Organizations OrganizationsService
+	Teams         TeamsService
 }
 
 // GHInterface defines all necessary methods.
 // https://godoc.org/github.com/google/go-github/github#NewClient
 type GHInterface interface {
 	NewClient(httpClient *http.Client) GHClient
+	// NewEnterpriseClient talks to a GitHub Enterprise Server instance instead of github.com
+	NewEnterpriseClient(httpClient *http.Client, host *Host) (GHClient, error)
+	// NewUserClient acts as a signer with their OAuth token, of github.com if host is nil. The quota of user tokens is
+	// their own, so it is not tracked with that of our installations.
+	NewUserClient(httpClient *http.Client, host *Host) (GHClient, error)
 }
 
 // GHCreator implements GHInterface.
 type GHCreator struct{}
 
 // NewClient returns a new GHInterface instance.
+// The client keeps track of the rate limits of its installation in RateLimits.
 func (g *GHCreator) NewClient(httpClient *http.Client) GHClient {
+	rateLimitedClient := *httpClient
+	rateLimitedClient.Transport = newRateLimitTransport(httpClient.Transport, RateLimits)
+	return ghClientOf(github.NewClient(&rateLimitedClient))
+}
+
+// NewEnterpriseClient returns a client of the API of host, keeping track of its rate limits in those of the host.
+func (g *GHCreator) NewEnterpriseClient(httpClient *http.Client, host *Host) (GHClient, error) {
+	rateLimitedClient := *httpClient
+	rateLimitedClient.Transport = newRateLimitTransport(httpClient.Transport, host.rateLimits)
+	client, err := github.NewClient(&rateLimitedClient).WithEnterpriseURLs(host.APIURL, host.UploadURL)
+	if err != nil {
+		return GHClient{}, err
+	}
+	return ghClientOf(client), nil
+}
+
+// NewUserClient returns a client acting as a user, without keeping track of its rate limits.
+func (g *GHCreator) NewUserClient(httpClient *http.Client, host *Host) (GHClient, error) {
 	client := github.NewClient(httpClient)
+	if host != nil {
+		var err error
+		if client, err = client.WithEnterpriseURLs(host.APIURL, host.UploadURL); err != nil {
+			return GHClient{}, err
+		}
+	}
+	return ghClientOf(client), nil
+}
+
+func ghClientOf(client *github.Client) GHClient {
 	return GHClient{
-		Repositories: client.Repositories,
-		Users:        client.Users,
-		PullRequests: client.PullRequests,
-		Issues:       client.Issues,
+		Repositories:  client.Repositories,
+		Users:         client.Users,
+		PullRequests:  client.PullRequests,
+		Issues:        client.Issues,
+		Organizations: client.Organizations,
+		Teams:         client.Teams,
 	}
 }
 
 var GHImpl GHInterface = &GHCreator{}
 
-func HandlePullRequest(logger *zap.Logger, postgres db.IClaDB, payload webhook.PullRequestPayload, appId int64, claVersion string) error {
+// HandlePullRequest evaluates the PR of a webhook from host, or from github.com if host is nil.
+func HandlePullRequest(logger *zap.Logger, postgres db.IClaDB, payload webhook.PullRequestPayload, host *Host, appId int64, claVersion string) error {
 
 	evalInfo := types.EvaluationInfo{
+		Provider:  host.Provider(),
+		RepoId:    payload.Repository.ID,
 		RepoOwner: payload.Repository.Owner.Login,
 		RepoName:  payload.Repository.Name,
 		Sha:       payload.PullRequest.Head.Sha,
@@ -186,279 +246,315 @@ func HandlePullRequest(logger *zap.Logger, postgres db.IClaDB, payload webhook.P
 		// UserSignatures/Authors will be populated later
 	}
 
+	if SkipDrafts && payload.PullRequest.Draft {
+		return reportDraft(logger, postgres, &evalInfo)
+	}
 	return EvaluatePullRequest(logger, postgres, &evalInfo, claVersion)
 }
 
-func EvaluatePullRequest(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, claVersion string) error {
-	logger.Debug("start authenticating with GitHub",
-		zap.Any("eval", evalInfo),
-	)
+// SkipDrafts leaves work-in-progress PRs alone until they are ready for review, instead of evaluating them.
+var SkipDrafts bool
+
+// statusDraft is what we remember for a draft PR. GitHub has no neutral commit status, so the PR shows "pending",
+// but the reconciler must not mistake it for a stuck evaluation.
+const statusDraft = "draft"
 
-	// get JWT GH stuff first
-	// Getting a JWT Apps Transport to ask GitHub about stuff that needs a JWT for asking, such as installInfo
-	var atr *ghinstallation.AppsTransport
-	atr, err := ghinstallation.NewAppsTransportKeyFromFile(http.DefaultTransport, evalInfo.AppId, FilenameTheClaPem)
+// reportDraft sets a pending status on a draft PR, without commenting or labeling. The PR is evaluated once it
+// is marked ready for review.
+func reportDraft(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo) error {
+	logger.Debug("skip draft pull request",
+		zap.String("owner", evalInfo.RepoOwner),
+		zap.String("repo", evalInfo.RepoName),
+		zap.Int64("pullRequestID", evalInfo.PRNumber),
+	)
+	app, err := appsFor(evalInfo).Metadata(evalInfo.AppId, evalInfo.InstallId)
 	if err != nil {
-		logger.Error("failed to get JWT key",
-			zap.Int64("appId", evalInfo.AppId),
-			zap.Error(err),
-		)
 		return err
 	}
-	ghJWTClient := GHJWTImpl.NewJWTClient(&http.Client{Transport: atr}, evalInfo.InstallId)
-	installInfo, err := ghJWTClient.GetInstallInfo()
+	client, err := installationClient(evalInfo)
 	if err != nil {
-		logger.Error("failed to get install info",
-			zap.Int64("appId", evalInfo.AppId),
-			zap.Error(err),
-		)
 		return err
 	}
-	botName := *installInfo.AppSlug
-
-	// get regular GH stuff next
-	itr, err := ghinstallation.NewKeyFromFile(http.DefaultTransport, evalInfo.AppId, evalInfo.InstallId, FilenameTheClaPem)
+	description, err := messagesFor(logger, client.Repositories, evalInfo).render("statusDraft", messageData(evalInfo))
 	if err != nil {
 		return err
 	}
-
-	client := GHImpl.NewClient(&http.Client{Transport: itr})
-
-	err = createRepoStatus(client.Repositories, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, "pending", "Paul Botsco, the CLA verifier is running", botName)
+	err = createRepoStatus(client.Repositories, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, "pending", description, app.Slug)
 	if err != nil {
 		return err
 	}
+	return postgres.StorePRStatus(evalInfo, statusDraft, time.Now())
+}
 
-	opts := &github.ListOptions{}
-
-	commits, _, err := client.PullRequests.ListCommits(
-		context.Background(),
-		evalInfo.RepoOwner,
-		evalInfo.RepoName,
-		int(evalInfo.PRNumber), opts)
-	if err != nil {
-		return err
+// HandleRepository keeps tracked PRs pointing at the right repository after it is renamed or transferred.
+// PRs are keyed by provider and repository ID, so only the owner/name display fields need refreshing.
+func HandleRepository(logger *zap.Logger, postgres db.IClaDB, payload webhook.RepositoryPayload, host *Host) error {
+	logger.Info("repository moved",
+		zap.String("action", payload.Action),
+		zap.Int64("repoId", payload.Repository.ID),
+		zap.String("owner", payload.Repository.Owner.Login),
+		zap.String("repo", payload.Repository.Name),
+	)
+	provider := vcs.ProviderGitHub
+	if host != nil {
+		provider = host.Name
 	}
+	return postgres.UpdateRepositoryNames(provider, payload.Repository.ID, payload.Repository.Owner.Login, payload.Repository.Name)
+}
 
-	// TODO: Once we have stuff in a DB, we can iterate over the list of commits,
-	// find the authors, and check if they have signed the CLA (and the version that is most current)
-	// The following loop will change a loop as a result
-	var usersNeedingToSignCLA []types.UserSignature
-	var usersSigned []types.UserSignature
-	var commitsMissingAuthor []github.RepositoryCommit
-	var commitsMissingVerification []github.RepositoryCommit
-
-	for _, v := range commits {
-		// It is important to use GetAuthor() instead of v.Commit.GetCommitter() because the committer can be the GH webflow user, whereas the author is
-		// the canonical author of the commit
-		author := v.GetAuthor()
-		commitFailedChecks := false
-
-		if author == nil {
-			commitsMissingAuthor = append(commitsMissingAuthor, *v)
-			commitFailedChecks = true
-		}
+// RepoIdBackfill reports what BackfillRepoIds did.
+type RepoIdBackfill struct {
+	Repositories int   `json:"repositories"`
+	Adopted      int64 `json:"adopted"`
+	// Missing are repositories GitHub no longer knows (or the app can no longer see), their PRs keep no repository ID
+	Missing []string `json:"missing,omitempty"`
+}
 
-		commitVerified := false
-		commitVerification := v.Commit.GetVerification()
-		if commitVerification != nil {
-			commitVerified = *v.Commit.Verification.Verified
-		}
-		if !commitVerified {
-			commitsMissingVerification = append(commitsMissingVerification, *v)
-			commitFailedChecks = true
-			logger.Debug("Commit failed verification check", zap.Any("Commit", v))
+// BackfillRepoIds looks up the repository ID of PRs stored before PRs were keyed by repository ID, and assigns it.
+// GitHub redirects lookups of renamed or transferred repositories, so their PRs are adopted under the current
+// owner/name.
+func BackfillRepoIds(logger *zap.Logger, postgres db.IClaDB) (backfill RepoIdBackfill, err error) {
+	repos, err := postgres.GetLegacyPRRepositories()
+	if err != nil {
+		return
+	}
+	for i := range repos {
+		legacy := &repos[i]
+		var client GHClient
+		if client, err = installationClient(legacy); err != nil {
+			return
 		}
-
-		if commitFailedChecks {
+		var repo *github.Repository
+		repo, _, err = client.Repositories.Get(context.Background(), legacy.RepoOwner, legacy.RepoName)
+		if isNotFound(err) {
+			logger.Warn("legacy PR repository not found",
+				zap.String("owner", legacy.RepoOwner),
+				zap.String("repo", legacy.RepoName),
+			)
+			backfill.Missing = append(backfill.Missing, legacy.RepoOwner+"/"+legacy.RepoName)
+			err = nil
 			continue
 		}
-
-		// if author is a collaborator, that author need not sign the cla.
-		var isCollaborator bool
-		isCollaborator, _, err = client.Repositories.IsCollaborator(
-			context.Background(),
-			evalInfo.RepoOwner,
-			evalInfo.RepoName,
-			*author.Login,
-		)
 		if err != nil {
-			return err
+			return
 		}
-		if isCollaborator {
-			// nothing to do, we've found a collaborator, move along
-			continue
+		var adopted int64
+		if adopted, err = postgres.AdoptLegacyPRs(repo.GetID(), legacy.RepoOwner, legacy.RepoName, repo.GetOwner().GetLogin(), repo.GetName()); err != nil {
+			return
 		}
+		backfill.Repositories++
+		backfill.Adopted += adopted
+	}
+	logger.Info("backfilled repository IDs",
+		zap.Int("repositories", backfill.Repositories),
+		zap.Int64("adopted", backfill.Adopted),
+		zap.Strings("missing", backfill.Missing),
+	)
+	return
+}
 
-		var foundUserSigned *types.UserSignature
-		hasAuthorSigned, foundUserSigned, err := postgres.HasAuthorSignedTheCla(*author.Login, claVersion)
-		if err != nil {
-			return err
-		}
-		if !hasAuthorSigned {
-			userMissingSignature := types.UserSignature{
-				User: types.User{
-					Login:     author.GetLogin(),
-					Email:     author.GetEmail(),
-					GivenName: author.GetName(),
-				},
-				CLAVersion: claVersion,
-				// do not populate TimeSigned
-			}
-			logger.Debug("missing author signature",
-				zap.Any("UserSignature", userMissingSignature))
-			usersNeedingToSignCLA = append(usersNeedingToSignCLA, userMissingSignature)
-		} else {
-			usersSigned = append(usersSigned, *foundUserSigned)
-		}
+// installationClient talks to the GitHub instance hosting the PR as the installation of the app the evaluation is
+// for.
+func installationClient(evalInfo *types.EvaluationInfo) (client GHClient, err error) {
+	itr, err := appsFor(evalInfo).InstallationTransport(evalInfo.AppId, evalInfo.InstallId)
+	if err != nil {
+		return
 	}
+	if host := HostOf(vcs.ProviderOf(evalInfo)); host != nil {
+		return GHImpl.NewEnterpriseClient(&http.Client{Transport: itr}, host)
+	}
+	return GHImpl.NewClient(&http.Client{Transport: itr}), nil
+}
 
-	logger.Info(
-		fmt.Sprintf("Commits Reviewed for PR #%d", evalInfo.PRNumber),
-		zap.Int("Missing Author", len(commitsMissingAuthor)),
-		zap.Int("Missing Verification", len(commitsMissingVerification)),
+func EvaluatePullRequest(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, claVersion string) (err error) {
+	logger.Debug("start authenticating with GitHub",
+		zap.Any("eval", evalInfo),
 	)
 
-	if len(commitsMissingAuthor) > 0 || len(commitsMissingVerification) > 0 {
-		if len(commitsMissingAuthor) > 0 {
-			err := createRepoLabel(logger, client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, labelNameCommitsNoAuthor, "B60205", "Commits are missing author information - this must be resolved", evalInfo.PRNumber)
-			if err != nil {
-				return err
-			}
-		}
-
-		if len(commitsMissingVerification) > 0 {
-			err := createRepoLabel(
-				logger,
-				client.Issues,
-				evalInfo.RepoOwner,
-				evalInfo.RepoName,
-				labelNameCommitsMissingVerification,
-				"B60205",
-				"Some commits are not signed - this must be resolved",
-				evalInfo.PRNumber,
-			)
-			if err != nil {
-				return err
-			}
-		}
+	// the app and its installation transports are cached across evaluations, see AppRegistry
+	app, err := appsFor(evalInfo).Metadata(evalInfo.AppId, evalInfo.InstallId)
+	if err != nil {
+		logger.Error("failed to get app metadata",
+			zap.Int64("appId", evalInfo.AppId),
+			zap.Error(err),
+		)
+		return err
+	}
+	botName := app.Slug
 
-		commentMessage := buildCommentMessage(commitsMissingAuthor, commitsMissingVerification)
-		logger.Debug("Adding Comment to Issue", zap.Int("Issue #", int(evalInfo.PRNumber)), zap.String("Comment", commentMessage))
-		_, err = addCommentToIssueIfNotExists(
-			client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, int(evalInfo.PRNumber),
-			commentMessage)
-		if err != nil {
-			return err
-		}
+	client, err := installationClient(evalInfo)
+	if err != nil {
+		return err
+	}
 
-		err = createRepoStatus(client.Repositories, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, "failure", "One or more commits haven't met our Quality requirements.", botName)
+	if evalInfo.RepoId == 0 {
+		// PRs tracked before we stored repository IDs only know the owner/name, so look up the ID once
+		var repo *github.Repository
+		repo, _, err = client.Repositories.Get(context.Background(), evalInfo.RepoOwner, evalInfo.RepoName)
 		if err != nil {
 			return err
 		}
-
-		return nil
+		evalInfo.RepoId = repo.GetID()
 	}
 
-	if len(usersNeedingToSignCLA) > 0 {
-		err := createRepoLabel(logger, client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, labelNameCLANotSigned, "ff3333", "The CLA needs to be signed", evalInfo.PRNumber)
-		if err != nil {
-			return err
+	// from here on, a rate limited evaluation is deferred rather than dropped, and the PR is never left stuck
+	// in "pending" if something else goes wrong
+	pendingReported := false
+	defer func() {
+		if err == nil {
+			return
 		}
-		// handle case where PR was previously open and all authors had signed cla - meaning the old "all signed" label is applied
-		err = _removeLabelFromIssueIfApplied(logger, client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, labelNameCLASigned)
-		if err != nil {
-			return err
+		if retryAt, limited := rateLimitedUntil(err, time.Now()); limited {
+			err = deferEvaluation(logger, postgres, evalInfo, retryAt, err)
+		} else if pendingReported {
+			finalizeWithError(logger, postgres, client.Repositories, app.ExternalURL, evalInfo, botName, err)
 		}
+	}()
 
-		var users []string
-		for _, v := range usersNeedingToSignCLA {
-			users = append(users, " @"+v.User.Login)
-		}
+	if skipped, err := applyEnforcement(logger, postgres, client, evalInfo, botName); err != nil || skipped {
+		return err
+	}
 
-		// store failed users in the db, so we can reevaluate their PR's after they sign the CLA
-		evalInfo.UserSignatures = usersNeedingToSignCLA
-		err = postgres.StorePRAuthorsMissingSignature(evalInfo, time.Now())
-		if err != nil {
-			return err
-		}
+	messages := messagesFor(logger, client.Repositories, evalInfo)
+	data := messageData(evalInfo)
+	data.SignURL = SignPageURL(app.ExternalURL, evalInfo.Provider, claVersion)
+	data.CLAVersion = claVersion
 
-		// get info needed to show link to sign the cla
-		app, err := ghJWTClient.Get()
-		if err != nil {
-			return err
-		}
-		// Maybe use app.Name in the remaining hard coded Paul Botsco repo status message above...or not.
-		//appName := *app.Name
-		appExternalUrl := *app.ExternalURL
+	if err = reportMessageStatus(postgres, client.Repositories, messages, evalInfo, "pending", "statusPending", data, botName); err != nil {
+		return err
+	}
+	pendingReported = true
 
-		message := "Thanks for the contribution. Before we can merge this, we need %s to [sign the Contributor License Agreement](%s)"
-		userMsg := strings.Join(users, ",")
+	if overridden, err := applyOverride(logger, postgres, client, evalInfo, botName); err != nil || overridden {
+		return err
+	}
+	if exempt, err := applyTrivialChange(logger, postgres, client, evalInfo, botName); err != nil || exempt {
+		return err
+	}
 
-		_, err = addCommentToIssueIfNotExists(client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, int(evalInfo.PRNumber), fmt.Sprintf(message, userMsg, appExternalUrl))
-		if err != nil {
-			return err
-		}
+	provider := &githubProvider{name: vcs.ProviderOf(evalInfo), logger: logger, postgres: postgres, client: client, botName: botName}
+	return evaluateCommits(context.Background(), logger, postgres, provider, messages, evalInfo, data, app.ExternalURL, claVersion)
+}
 
-		err = createRepoStatus(client.Repositories, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, "failure", "One or more contributors need to sign the CLA", botName)
-		if err != nil {
-			return err
-		}
-	} else {
-		logger.Debug("create label for signed CLA")
-		err = createRepoLabel(logger, client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, labelNameCLASigned, "66CC00", "The CLA is signed", evalInfo.PRNumber)
-		if err != nil {
-			return err
-		}
-		// handle case where PR was previously open and some authors had NOT signed cla - meaning the old "not signed" label is applied
-		err = _removeLabelFromIssueIfApplied(logger, client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, labelNameCLANotSigned)
-		if err != nil {
-			return err
-		}
+// reportRepoStatus remembers the commit status and sets it on GitHub, so the reconciler can find PRs whose
+// evaluation never reached a final state. It is remembered first: a status GitHub shows must never be missing here.
+func reportRepoStatus(postgres db.IClaDB, repositoryService RepositoriesService, evalInfo *types.EvaluationInfo, state, description, botName string) error {
+	if err := postgres.StorePRStatus(evalInfo, state, time.Now()); err != nil {
+		return err
+	}
+	return createRepoStatus(repositoryService, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, state, description, botName)
+}
 
-		err = createRepoStatus(client.Repositories, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, "success", "All contributors have signed the CLA", botName)
-		if err != nil {
-			return err
-		}
+// reportMessageStatus reports a status with the description rendered from the named message template.
+func reportMessageStatus(postgres db.IClaDB, repositoryService RepositoriesService, messages *MessageTemplates, evalInfo *types.EvaluationInfo,
+	state, template string, data MessageData, botName string) error {
+	description, err := messages.render(template, data)
+	if err != nil {
+		return err
+	}
+	return reportRepoStatus(postgres, repositoryService, evalInfo, state, description, botName)
+}
+
+// messageData returns the MessageData describing the PR being evaluated.
+func messageData(evalInfo *types.EvaluationInfo) MessageData {
+	return MessageData{RepoOwner: evalInfo.RepoOwner, RepoName: evalInfo.RepoName, PRNumber: evalInfo.PRNumber}
+}
 
+// deferEvaluation parks a rate limited evaluation until the quota resets, for the reconciler to pick up again.
+func deferEvaluation(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, retryAt time.Time, evalErr error) error {
+	now := time.Now()
+	if retryAt.Before(now) {
+		retryAt = now.Add(defaultDeferral)
 	}
-	// delete any prior failed user info from the db for this PR
-	// we always do this at this point because a PR can be re-evaluated and have both signed and unsigned authors
-	if err = postgres.RemovePRsForUsers(usersSigned, evalInfo); err != nil {
+	logger.Warn("evaluation deferred by GitHub rate limit",
+		zap.String("owner", evalInfo.RepoOwner),
+		zap.String("repo", evalInfo.RepoName),
+		zap.Int64("pullRequestID", evalInfo.PRNumber),
+		zap.Time("retryAt", retryAt),
+		zap.Error(evalErr),
+	)
+	rateLimitsFor(evalInfo).recordDeferred(evalInfo.InstallId)
+
+	if err := postgres.StorePRStatus(evalInfo, "deferred", now); err != nil {
 		return err
 	}
-
-	return nil
+	return postgres.SchedulePRRetry(evalInfo, retryAt)
 }
 
-const buildCommentPrefix = `Thanks for the contribution. Unfortunately some of your commits don't meet our standards. All commits must be signed and have author information set.
-		
-The commits to review are:
-		
-%s%s`
+// PathPRStatusDiagnostics is where the server shows the state of the latest evaluation of a PR, linked from the
+// "error" commit status.
+const PathPRStatusDiagnostics = "/pr-status"
 
-const buildCommentSuffixSignedCommits = `
-See [Signed Commits](https://contribute.sonatype.com/docs/contributing/submitting/#signed-commits).
-`
+// maxEvaluationAttempts is how many evaluations in a row may fail before we stop retrying on our own
+const maxEvaluationAttempts = 5
+const retryBackoffBase = 2 * time.Minute
+const retryBackoffMax = time.Hour
 
-func buildCommentMessage(commitsMissingAuthor []github.RepositoryCommit, commitsMissingVerification []github.RepositoryCommit) string {
+// retryDelay doubles the wait after each failed attempt, up to retryBackoffMax.
+func retryDelay(attempts int) time.Duration {
+	delay := retryBackoffBase
+	for i := 1; i < attempts && delay < retryBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > retryBackoffMax {
+		delay = retryBackoffMax
+	}
+	return delay
+}
 
-	commitsMessage := ""
-	for _, c := range commitsMissingAuthor {
-		commitsMessage += fmt.Sprintf(`- <a href="%s">%s</a> - missing author :cop:
-`, *c.HTMLURL, *c.SHA)
+// finalizeWithError replaces the "pending" commit status after a failed evaluation, records the failure and
+// schedules a retry. Any problems doing so are only logged, so the original evaluation error is not hidden.
+func finalizeWithError(logger *zap.Logger, postgres db.IClaDB, repositoryService RepositoriesService,
+	appExternalUrl string, evalInfo *types.EvaluationInfo, botName string, evalErr error) {
+	template := recordFailure(logger, postgres, evalInfo, evalErr)
+	description, err := messagesFor(logger, repositoryService, evalInfo).render(template, messageData(evalInfo))
+	if err != nil {
+		logger.Error("failed to render error status", zap.Error(err))
 	}
-	for _, c := range commitsMissingVerification {
-		commitsMessage += fmt.Sprintf(`- <a href="%s">%s</a> - unsigned commit :key:
-`, *c.HTMLURL, *c.SHA)
+	state := "error"
+	status := &github.RepoStatus{State: &state, Description: &description, Context: &botName}
+	if targetURL := diagnosticsURL(appExternalUrl, evalInfo); targetURL != "" {
+		status.TargetURL = &targetURL
 	}
+	if _, _, err = repositoryService.CreateStatus(context.Background(), evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, status); err != nil {
+		logger.Error("failed to set error status", zap.Error(err))
+	}
+}
 
-	buildCommentSuffix := ""
-	if len(commitsMissingVerification) > 0 {
-		buildCommentSuffix = buildCommentSuffixSignedCommits
+// recordFailure records a failed evaluation and schedules a retry, unless it failed too often already. It returns
+// the message template of the "error" status telling which.
+func recordFailure(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, evalErr error) (template string) {
+	logger.Error("evaluation failed",
+		zap.String("provider", vcs.ProviderOf(evalInfo)),
+		zap.String("owner", evalInfo.RepoOwner),
+		zap.String("repo", evalInfo.RepoName),
+		zap.Int64("pullRequestID", evalInfo.PRNumber),
+		zap.Error(evalErr),
+	)
+
+	failedAt := time.Now()
+	template = "statusErrorGaveUp"
+	attempts, err := postgres.StorePRFailure(evalInfo, evalErr.Error(), failedAt)
+	if err != nil {
+		logger.Error("failed to record evaluation failure", zap.Error(err))
+	} else if attempts < maxEvaluationAttempts {
+		if err = postgres.SchedulePRRetry(evalInfo, failedAt.Add(retryDelay(attempts))); err != nil {
+			logger.Error("failed to schedule evaluation retry", zap.Error(err))
+		} else {
+			template = "statusErrorRetry"
+		}
 	}
-	commentMessage := fmt.Sprintf(buildCommentPrefix, commitsMessage, buildCommentSuffix)
-	return commentMessage
+	return
+}
+
+// diagnosticsURL links to the PR status page on our server, or is empty if we can't tell where the server lives.
+// The provider is part of the link, as repository IDs of github.com and of Enterprise Server hosts may clash.
+func diagnosticsURL(appExternalUrl string, evalInfo *types.EvaluationInfo) string {
+	if appExternalUrl == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s%s/%s/%d/%d", strings.TrimSuffix(appExternalUrl, "/"), PathPRStatusDiagnostics,
+		url.PathEscape(vcs.ProviderOf(evalInfo)), evalInfo.RepoId, evalInfo.PRNumber)
 }
 
 func createRepoStatus(repositoryService RepositoriesService, owner, repo, sha, state, description, botName string) error {
@@ -469,11 +565,6 @@ func createRepoStatus(repositoryService RepositoriesService, owner, repo, sha, s
 	return nil
 }
 
-const labelNameCLANotSigned string = ":monocle_face: cla not signed"
-const labelNameCLASigned string = ":heart_eyes: cla signed"
-const labelNameCommitsNoAuthor string = ":unamused: commits missing author"
-const labelNameCommitsMissingVerification string = ":anguished: commits missing verification"
-
 func createRepoLabel(logger *zap.Logger,
 	issuesService IssuesService,
 	owner, repo, name, color, description string,
@@ -521,8 +612,7 @@ func _createRepoLabelIfNotExists(logger *zap.Logger,
 }
 
 func addCommentToIssueIfNotExists(issuesService IssuesService, owner, repo string, issueNumber int, message string) (*github.IssueComment, error) {
-	opts := &github.IssueListCommentsOptions{}
-	comments, _, err := issuesService.ListComments(context.Background(), owner, repo, issueNumber, opts)
+	comments, err := listAllIssueComments(context.Background(), issuesService, owner, repo, issueNumber)
 	if err != nil {
 		return nil, err
 	}
@@ -550,8 +640,7 @@ func addCommentToIssueIfNotExists(issuesService IssuesService, owner, repo strin
 
 func _addLabelToIssueIfNotExists(logger *zap.Logger, issuesService IssuesService, owner, repo string, issueNumber int64, labelName string) (desiredLabel *github.Label, err error) {
 	// check if label is already added to issue
-	opts := github.ListOptions{}
-	issueLabels, _, err := issuesService.ListLabelsByIssue(context.Background(), owner, repo, int(issueNumber), &opts)
+	issueLabels, err := listAllLabelsByIssue(context.Background(), issuesService, owner, repo, int(issueNumber))
 	if err != nil {
 		return
 	}
@@ -610,7 +699,7 @@ func ReviewPriorPRs(logger *zap.Logger, postgres db.IClaDB, user *types.UserSign
 	var eval types.EvaluationInfo
 	for _, eval = range evals {
 		// get PR webhook parameter equivalents
-		if err = EvaluatePullRequest(logger, postgres, &eval, user.CLAVersion); err != nil {
+		if err = Evaluate(logger, postgres, &eval, user.CLAVersion); err != nil {
 			return
 		}
 	}
@@ -20,7 +20,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
+	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -28,6 +29,7 @@ import (
 	"github.com/google/go-github/v64/github"
 	"github.com/sonatype-nexus-community/the-cla/db"
 	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 
@@ -56,6 +58,30 @@ type mockCLADb struct {
 	removePRsUsersSigned          []types.UserSignature
 	removePRsEvalInfo             *types.EvaluationInfo
 	removePRsError                error
+	updateRepoNamesProvider       string
+	updateRepoNamesRepoId         int64
+	updateRepoNamesOwner          string
+	updateRepoNamesName           string
+	updateRepoNamesError          error
+	legacyPRRepositories          []types.EvaluationInfo
+	legacyPRRepositoriesError     error
+	adoptedLegacyPRs              *[]string
+	adoptLegacyPRsCount           int64
+	adoptLegacyPRsError           error
+	storePRStatusError            error
+	storePRFailureAttempts        int
+	storePRFailureError           error
+	schedulePRRetryError          error
+	getCachedCollaborator         *types.Collaborator
+	getCachedCollaboratorError    error
+	storeCachedCollaboratorError  error
+	invalidateCollaboratorsError  error
+	insertAuditEvents             *[]types.AuditEvent
+	insertAuditEventError         error
+	getPROverride                 *types.AuditEvent
+	getPROverrideError            error
+	prStatuses                    map[int64]*types.PRStatus
+	getPRStatusError              error
 }
 
 var _ db.IClaDB = (*mockCLADb)(nil)
@@ -112,6 +138,111 @@ func (m mockCLADb) RemovePRsForUsers(usersSigned []types.UserSignature, evalInfo
 	return m.removePRsError
 }
 
+func (m mockCLADb) UpdateRepositoryNames(provider string, repoId int64, repoOwner, repoName string) error {
+	if m.assertParameters {
+		assert.Equal(m.t, m.updateRepoNamesProvider, provider)
+		assert.Equal(m.t, m.updateRepoNamesRepoId, repoId)
+		assert.Equal(m.t, m.updateRepoNamesOwner, repoOwner)
+		assert.Equal(m.t, m.updateRepoNamesName, repoName)
+	}
+	return m.updateRepoNamesError
+}
+
+func (m mockCLADb) GetLegacyPRRepositories() ([]types.EvaluationInfo, error) {
+	return m.legacyPRRepositories, m.legacyPRRepositoriesError
+}
+
+func (m mockCLADb) AdoptLegacyPRs(repoId int64, legacyOwner, legacyName, repoOwner, repoName string) (int64, error) {
+	if m.adoptedLegacyPRs != nil {
+		*m.adoptedLegacyPRs = append(*m.adoptedLegacyPRs, fmt.Sprintf("%s/%s -> %d %s/%s", legacyOwner, legacyName, repoId, repoOwner, repoName))
+	}
+	return m.adoptLegacyPRsCount, m.adoptLegacyPRsError
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) StorePRStatus(evalInfo *types.EvaluationInfo, state string, updatedAt time.Time) error {
+	if m.prStatuses != nil && m.storePRStatusError == nil {
+		m.prStatuses[evalInfo.PRNumber] = &types.PRStatus{
+			RepoId:    evalInfo.RepoId,
+			PRNumber:  evalInfo.PRNumber,
+			Sha:       evalInfo.Sha,
+			State:     state,
+			UpdatedAt: updatedAt,
+		}
+	}
+	return m.storePRStatusError
+}
+
+func (m mockCLADb) StorePRFailure(evalInfo *types.EvaluationInfo, lastError string, failedAt time.Time) (int, error) {
+	return m.storePRFailureAttempts, m.storePRFailureError
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) SchedulePRRetry(evalInfo *types.EvaluationInfo, nextAttemptAt time.Time) error {
+	return m.schedulePRRetryError
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) GetPRStatus(provider string, repoId, prNumber int64) (*types.PRStatus, error) {
+	return m.prStatuses[prNumber], m.getPRStatusError
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) GetPRsDueForRetry(now time.Time) ([]types.EvaluationInfo, error) {
+	panic("implement me")
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) GetStalePRs(state string, updatedBefore, updatedAfter time.Time) ([]types.EvaluationInfo, error) {
+	panic("implement me")
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) GetPRsWithAllAuthorsSigned(activeAfter time.Time) ([]types.EvaluationInfo, error) {
+	panic("implement me")
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) GetCachedCollaborator(repoId int64, login string, checkedAfter time.Time) (*types.Collaborator, error) {
+	return m.getCachedCollaborator, m.getCachedCollaboratorError
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) StoreCachedCollaborator(collaborator *types.Collaborator) error {
+	return m.storeCachedCollaboratorError
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) InvalidateCachedCollaborators(repoOwner string, repoId int64, login string) error {
+	return m.invalidateCollaboratorsError
+}
+
+func (m mockCLADb) InsertAuditEvent(event *types.AuditEvent) error {
+	if m.insertAuditEvents != nil {
+		*m.insertAuditEvents = append(*m.insertAuditEvents, *event)
+	}
+	return m.insertAuditEventError
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) GetPROverride(provider string, repoId, prNumber int64) (*types.AuditEvent, error) {
+	return m.getPROverride, m.getPROverrideError
+}
+
+func (m mockCLADb) GetTenants() ([]types.Tenant, error) {
+	panic("implement me")
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) AcquireLease(name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	panic("implement me")
+}
+
+//goland:noinspection GoUnusedParameter
+func (m mockCLADb) ReleaseLease(name, holder string) error {
+	panic("implement me")
+}
+
 func TestWithJustGHImpl(t *testing.T) {
 	// Setup Code before tests
 	origGithubImpl := GHImpl
@@ -120,7 +251,7 @@ func TestWithJustGHImpl(t *testing.T) {
 	}()
 
 	t.Run("TestCreateLabelIfNotExists", func(t *testing.T) {
-		labelName := labelNameCLANotSigned
+		labelName := Messages.LabelUnsigned.Name
 		labelColor := "fa3a3a"
 		labelDescription := "The CLA is not signed"
 		labelToCreate := &github.Label{Name: &labelName, Color: &labelColor, Description: &labelDescription}
@@ -187,7 +318,7 @@ func TestWithJustGHImpl(t *testing.T) {
 	})
 
 	t.Run("TestAddLabelToIssueIfNotExists", func(t *testing.T) {
-		labelName := labelNameCLANotSigned
+		labelName := Messages.LabelUnsigned.Name
 		labelColor := "fa3a3a"
 		labelDescription := "The CLA is not signed"
 		labelToCreate := &github.Label{Name: &labelName, Color: &labelColor, Description: &labelDescription}
@@ -195,7 +326,7 @@ func TestWithJustGHImpl(t *testing.T) {
 
 		client := GHImpl.NewClient(nil)
 
-		label, err := _addLabelToIssueIfNotExists(zaptest.NewLogger(t), client.Issues, "", "", 0, labelNameCLANotSigned)
+		label, err := _addLabelToIssueIfNotExists(zaptest.NewLogger(t), client.Issues, "", "", 0, Messages.LabelUnsigned.Name)
 		assert.NoError(t, err)
 		// real gitHub API returns different result, but does not matter to us now
 		assert.Nil(t, label)
@@ -226,7 +357,7 @@ func TestWithJustGHImpl(t *testing.T) {
 	})
 
 	t.Run("TestAddLabelToIssueIfNotExists_LabelAlreadyExists", func(t *testing.T) {
-		labelName := labelNameCLANotSigned
+		labelName := Messages.LabelUnsigned.Name
 		existingLabel := &github.Label{Name: &labelName}
 		existingLabelList := []*github.Label{existingLabel}
 		GHImpl = &GHInterfaceMock{
@@ -243,12 +374,6 @@ func TestWithJustGHImpl(t *testing.T) {
 
 func TestWithFullEnvironment(t *testing.T) {
 	// Setup Code before tests
-	origGHAppIDEnvVar := os.Getenv(EnvGhAppId)
-	defer func() {
-		resetEnvVariable(t, EnvGhAppId, origGHAppIDEnvVar)
-	}()
-	assert.NoError(t, os.Setenv(EnvGhAppId, "-1"))
-
 	resetPemFileImpl := SetupTestPemFile(t)
 	defer resetPemFileImpl()
 
@@ -278,7 +403,7 @@ func TestWithFullEnvironment(t *testing.T) {
 		mockDB, logger := setupMockDB(t, true)
 		mockDB.hasAuthorSignedLogin = authors[0]
 
-		err := HandlePullRequest(logger, mockDB, prEvent, 0, "")
+		err := HandlePullRequest(logger, mockDB, prEvent, nil, 0, "")
 		assert.EqualError(t, err, forcedError.Error())
 	})
 
@@ -300,7 +425,7 @@ func TestWithFullEnvironment(t *testing.T) {
 		mockDB, logger := setupMockDB(t, true)
 		mockDB.hasAuthorSignedLogin = authors[0]
 
-		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, 0, "")
+		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, "")
 		assert.EqualError(t, err, forcedError.Error())
 	})
 
@@ -319,7 +444,7 @@ func TestWithFullEnvironment(t *testing.T) {
 		mockDB, logger := setupMockDB(t, true)
 		mockDB.hasAuthorSignedLogin = authors[0]
 
-		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, 0, "")
+		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, "")
 		assert.EqualError(t, err, forcedError.Error())
 	})
 
@@ -340,16 +465,117 @@ func TestWithFullEnvironment(t *testing.T) {
 
 		mockDB, logger := setupMockDB(t, true)
 		mockDB.hasAuthorSignedLogin = authors[0]
-		mockDB.removePRsEvalInfo = &types.EvaluationInfo{}
+		mockDB.removePRsEvalInfo = &types.EvaluationInfo{
+			RepoId:     185409993,
+			Exemptions: []types.Exemption{{Login: "anAuthor4", Reason: ExemptionReasonCollaborator}},
+		}
 
-		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, 0, "")
+		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, "")
 		assert.NoError(t, err)
 	})
 
+	t.Run("TestHandlePullRequestChecksEachAuthorOnce", func(t *testing.T) {
+		authors := []string{"anAuthor5", "AnAuthor5", "anAuthor5"}
+		repositoriesMock := RepositoriesMock{
+			isCollaboratorResult: true,
+		}
+		ghMock := getGHMock(getMockRepositoryCommits(authors, true), nil, &repositoriesMock)
+		GHImpl = ghMock
+
+		mockDB, logger := setupMockDB(t, true)
+		mockDB.removePRsEvalInfo = &types.EvaluationInfo{
+			RepoId:     185409993,
+			Exemptions: []types.Exemption{{Login: "anAuthor5", Reason: ExemptionReasonCollaborator}},
+		}
+
+		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, "")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, ghMock.RepositoriesMock.isCollaboratorCalls)
+	})
+
+	t.Run("TestHandlePullRequestSkipsBotCommits", func(t *testing.T) {
+		// bot commits are neither verified nor need a signature
+		commits := getMockRepositoryCommits([]string{"dependabot[bot]"}, false)
+		commits[0].Author.Type = github.String("Bot")
+		GHImpl = getGHMock(commits, nil, nil)
+
+		mockDB, logger := setupMockDB(t, true)
+		mockDB.removePRsEvalInfo = &types.EvaluationInfo{
+			RepoId: 185409993,
+			SkippedCommits: []types.SkippedCommit{
+				{Sha: "dependabot[bot]SHA", Login: "dependabot[bot]", Reason: SkipReasonBotAccount},
+			},
+		}
+
+		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, "")
+		assert.NoError(t, err)
+	})
+
+	t.Run("TestHandlePullRequestDraftSkipped", func(t *testing.T) {
+		origSkipDrafts := SkipDrafts
+		defer func() {
+			SkipDrafts = origSkipDrafts
+		}()
+		SkipDrafts = true
+
+		// only the pending status is reported, the commits are never looked at
+		GHImpl = &GHInterfaceMock{
+			RepositoriesMock: *setupMockRepositoriesService(t, []bool{true}, []any{
+				[]context.Context{context.Background()}, // ctx
+				[]string{""},                            // owner
+				[]string{""},                            // repo
+				[]string{""},                            // ref
+				[]*github.RepoStatus{
+					{
+						State:       github.String("pending"),
+						Description: github.String(Messages.StatusDraft),
+						Context:     &MockAppSlug,
+					},
+				},
+			}),
+			PullRequestsMock: PullRequestsMock{mockListCommitsError: fmt.Errorf("must not list commits")},
+		}
+		mockDB, logger := setupMockDB(t, true)
+
+		payload := webhook.PullRequestPayload{}
+		payload.PullRequest.Draft = true
+		assert.NoError(t, HandlePullRequest(logger, mockDB, payload, nil, 0, ""))
+		assert.Equal(t, 1, GHImpl.(*GHInterfaceMock).RepositoriesMock.assertParamsCreateStatus.callIndex)
+	})
+
+	t.Run("TestHandlePullRequestDraftStatusError", func(t *testing.T) {
+		origSkipDrafts := SkipDrafts
+		defer func() {
+			SkipDrafts = origSkipDrafts
+		}()
+		SkipDrafts = true
+
+		forcedError := fmt.Errorf("forced CreateStatus error")
+		GHImpl = &GHInterfaceMock{RepositoriesMock: RepositoriesMock{createStatusError: []error{forcedError}}}
+		mockDB, logger := setupMockDB(t, true)
+
+		payload := webhook.PullRequestPayload{}
+		payload.PullRequest.Draft = true
+		assert.EqualError(t, HandlePullRequest(logger, mockDB, payload, nil, 0, ""), forcedError.Error())
+	})
+
 	t.Run("TestHandlePullRequestListCommitsError", func(t *testing.T) {
 		forcedError := fmt.Errorf("forced ListCommits error")
 		GHImpl = &GHInterfaceMock{
-			RepositoriesMock: *setupMockRepositoriesService(t, []bool{false}, nil),
+			RepositoriesMock: *setupMockRepositoriesService(t, []bool{false, true}, []any{
+				[]context.Context{nil, context.Background()}, // ctx
+				[]string{"", ""}, // owner
+				[]string{"", ""}, // repo
+				[]string{"", ""}, // ref
+				[]*github.RepoStatus{
+					nil,
+					{
+						State:       github.String("error"),
+						Description: github.String(Messages.StatusErrorRetry),
+						Context:     &MockAppSlug,
+					},
+				},
+			}),
 			PullRequestsMock: PullRequestsMock{
 				mockListCommitsError: forcedError,
 			},
@@ -358,7 +584,7 @@ func TestWithFullEnvironment(t *testing.T) {
 		// GHImpl = getGHMock(nil, nil, setupMockRepositoriesService(t, false))
 
 		mockDB, logger := setupMockDB(t, true)
-		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, 0, "")
+		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, "")
 		assert.EqualError(t, err, forcedError.Error())
 	})
 
@@ -370,9 +596,10 @@ func TestWithFullEnvironment(t *testing.T) {
 					AppSlug: &MockAppSlug,
 				},
 				mockAppResp: &github.Response{Response: &http.Response{StatusCode: http.StatusOK}},
-				mockApp:     &github.App{ExternalURL: &mockExternalUrl},
+				mockApp:     &github.App{Slug: &MockAppSlug, ExternalURL: &mockExternalUrl},
 			},
 		}
+		Apps.Reset()
 
 		origGithubImpl := GHImpl
 		defer func() {
@@ -381,7 +608,7 @@ func TestWithFullEnvironment(t *testing.T) {
 		authors := []string{"john", "doe"}
 		GHImpl = getGHMock(getMockRepositoryCommits(authors, true), nil, nil)
 		mockDB, logger := setupMockDB(t, false)
-		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, 0, "")
+		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, "")
 		assert.NoError(t, err)
 	})
 
@@ -411,18 +638,12 @@ func TestWithFullEnvironment(t *testing.T) {
 
 		GHImpl = getGHMock(getMockRepositoryCommits(authors, false), nil, &repositoriesMock)
 		mockDB, logger := setupMockDB(t, false)
-		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, 0, "")
+		err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, "")
 		assert.NoError(t, err)
 	})
 }
 
 func TestHandlePullRequestGetAppError(t *testing.T) {
-	origGHAppIDEnvVar := os.Getenv(EnvGhAppId)
-	defer func() {
-		resetEnvVariable(t, EnvGhAppId, origGHAppIDEnvVar)
-	}()
-	assert.NoError(t, os.Setenv(EnvGhAppId, "-1"))
-
 	resetPemFileImpl := SetupTestPemFile(t)
 	defer resetPemFileImpl()
 
@@ -439,108 +660,29 @@ func TestHandlePullRequestGetAppError(t *testing.T) {
 		},
 	}
 
-	origGithubImpl := GHImpl
-	defer func() {
-		GHImpl = origGithubImpl
-	}()
-	authors := []string{"myAuthorLogin"}
-	mockRepositoryCommits := getMockRepositoryCommits(authors, true)
-	GHImpl = &GHInterfaceMock{
-		PullRequestsMock: PullRequestsMock{mockRepositoryCommits: mockRepositoryCommits},
-		IssuesMock: IssuesMock{
-			mockGetLabel: &github.Label{},
-			MockGetLabelResponse: &github.Response{
-				Response: &http.Response{},
-			},
-			MockRemoveLabelResponse: &github.Response{
-				Response: &http.Response{StatusCode: http.StatusNotFound},
-			},
-		},
-	}
-
+	// the app is looked up before anything else, so nothing else needs to be mocked
 	prEvent := webhook.PullRequestPayload{}
 
 	mockDB, logger := setupMockDB(t, true)
-	mockDB.hasAuthorSignedLogin = authors[0]
-	mockDB.storeUsersNeedingToSignEvalInfo = &types.EvaluationInfo{
-		UserSignatures: []types.UserSignature{
-			{
-				User: types.User{
-					Login: authors[0],
-					Email: "myAuthorLogin@somewhere.tld",
-				},
-			},
-		},
-	}
 
-	err := HandlePullRequest(logger, mockDB, prEvent, 0, "")
+	err := HandlePullRequest(logger, mockDB, prEvent, nil, 0, "")
 	//assert.EqualError(t, err, forcedError.Error())
 	assert.True(t, strings.HasPrefix(err.Error(), "it done broke: "))
 }
 
 func TestHandlePullRequestMissingPemFile(t *testing.T) {
-	origGHAppIDEnvVar := os.Getenv(EnvGhAppId)
-	defer func() {
-		resetEnvVariable(t, EnvGhAppId, origGHAppIDEnvVar)
-	}()
-	assert.NoError(t, os.Setenv(EnvGhAppId, "-1"))
-
-	// move pem file if it exists
-	pemBackupFile := FilenameTheClaPem + "_orig"
-	errRename := os.Rename(FilenameTheClaPem, pemBackupFile)
-	defer func() {
-		if errRename == nil {
-			assert.NoError(t, os.Rename(pemBackupFile, FilenameTheClaPem), "error renaming pem file in test")
-		}
-	}()
+	resetPemFileImpl := SetupTestPemFile(t)
+	defer resetPemFileImpl()
+	missingPemFile := filepath.Join(t.TempDir(), FilenameTheClaPem)
+	Apps.SetKeyFile(missingPemFile)
 
 	prEvent := webhook.PullRequestPayload{}
 	mockDB, logger := setupMockDB(t, true)
-	err := HandlePullRequest(logger, mockDB, prEvent, 0, "")
-	assert.EqualError(t, err, "could not read private key: open the-cla.pem: no such file or directory")
-}
-
-func TestBuildCommentMessageEmptyArgs(t *testing.T) {
-	commentMessage := buildCommentMessage([]github.RepositoryCommit{}, []github.RepositoryCommit{})
-	assert.Equal(t, fmt.Sprintf(buildCommentPrefix, "", ""), commentMessage)
-}
-
-func TestBuildCommentMessageMissingAuthor(t *testing.T) {
-	myUrl := "https://github.com"
-	mySha := "sha"
-	commentMessage := buildCommentMessage([]github.RepositoryCommit{
-		{HTMLURL: &myUrl, SHA: &mySha},
-	}, []github.RepositoryCommit{})
-	assert.Equal(t, fmt.Sprintf(buildCommentPrefix, "- <a href=\"https://github.com\">sha</a> - missing author :cop:\n", ""), commentMessage)
-}
-
-func TestBuildCommentMessageMissingVerification(t *testing.T) {
-	myUrl := "https://github.com"
-	mySha := "sha"
-	commentMessage := buildCommentMessage([]github.RepositoryCommit{}, []github.RepositoryCommit{
-		{HTMLURL: &myUrl, SHA: &mySha},
-	})
-	assert.Equal(t, fmt.Sprintf(buildCommentPrefix, "- <a href=\"https://github.com\">sha</a> - unsigned commit :key:\n", buildCommentSuffixSignedCommits), commentMessage)
-}
-
-func TestBuildCommentMessageMissingAuthorAndVerification(t *testing.T) {
-	myUrl := "https://github.com"
-	mySha := "sha"
-	commentMessage := buildCommentMessage([]github.RepositoryCommit{
-		{HTMLURL: &myUrl, SHA: &mySha},
-	}, []github.RepositoryCommit{
-		{HTMLURL: &myUrl, SHA: &mySha},
-	})
-	assert.Equal(t, fmt.Sprintf(buildCommentPrefix, "- <a href=\"https://github.com\">sha</a> - missing author :cop:\n- <a href=\"https://github.com\">sha</a> - unsigned commit :key:\n", buildCommentSuffixSignedCommits), commentMessage)
+	err := HandlePullRequest(logger, mockDB, prEvent, nil, 0, "")
+	assert.EqualError(t, err, "could not read private key: open "+missingPemFile+": no such file or directory")
 }
 
 func TestHandlePullRequestListCommitsNoAuthor(t *testing.T) {
-	origGHAppIDEnvVar := os.Getenv(EnvGhAppId)
-	defer func() {
-		resetEnvVariable(t, EnvGhAppId, origGHAppIDEnvVar)
-	}()
-	assert.NoError(t, os.Setenv(EnvGhAppId, "-1"))
-
 	resetPemFileImpl := SetupTestPemFile(t)
 	defer resetPemFileImpl()
 
@@ -553,7 +695,7 @@ func TestHandlePullRequestListCommitsNoAuthor(t *testing.T) {
 				AppSlug: &MockAppSlug,
 			},
 			mockAppResp: &github.Response{Response: &http.Response{StatusCode: http.StatusOK}},
-			mockApp:     &github.App{ExternalURL: &mockExternalUrl},
+			mockApp:     &github.App{Slug: &MockAppSlug, ExternalURL: &mockExternalUrl},
 		},
 	}
 
@@ -590,13 +732,13 @@ func TestHandlePullRequestListCommitsNoAuthor(t *testing.T) {
 					[]*github.IssueComment{
 						{Body: github.String(
 							`Thanks for the contribution. Unfortunately some of your commits don't meet our standards. All commits must be signed and have author information set.
-		
+
 The commits to review are:
-		
+
 - <a href="https://github.com">johnSHA</a> - missing author :cop:
 - <a href="https://github.com">johnSHA</a> - unsigned commit :key:
 
-See [Signed Commits](https://contribute.sonatype.com/docs/contributing/submitting/#signed-commits).
+See [Signed Commits](https://docs.github.com/en/authentication/managing-commit-signature-verification/signing-commits).
 `,
 						)},
 					}, // comment
@@ -615,10 +757,57 @@ See [Signed Commits](https://contribute.sonatype.com/docs/contributing/submittin
 	prEvent := webhook.PullRequestPayload{}
 
 	mockDB, logger := setupMockDB(t, false)
-	err := HandlePullRequest(logger, mockDB, prEvent, 0, "")
+	err := HandlePullRequest(logger, mockDB, prEvent, nil, 0, "")
 	assert.NoError(t, err)
 }
 
+func TestHandlePullRequestStorePRStatusError(t *testing.T) {
+	resetPemFileImpl := SetupTestPemFile(t)
+	defer resetPemFileImpl()
+
+	resetGHJWTImpl := SetupMockGHJWT()
+	defer resetGHJWTImpl()
+
+	origGithubImpl := GHImpl
+	defer func() {
+		GHImpl = origGithubImpl
+	}()
+	GHImpl = &GHInterfaceMock{}
+
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced store PR status error")
+	mockDB.storePRStatusError = forcedError
+
+	err := HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, "")
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestHandlePullRequestRateLimitedIsDeferred(t *testing.T) {
+	resetPemFileImpl := SetupTestPemFile(t)
+	defer resetPemFileImpl()
+
+	resetGHJWTImpl := SetupMockGHJWT()
+	defer resetGHJWTImpl()
+
+	origGithubImpl := GHImpl
+	defer func() {
+		GHImpl = origGithubImpl
+	}()
+	GHImpl = &GHInterfaceMock{
+		// only the "pending" status is set, the rate limited evaluation does not finalize with an error
+		RepositoriesMock: *setupMockRepositoriesService(t, []bool{false}, nil),
+		PullRequestsMock: PullRequestsMock{
+			mockListCommitsError: &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}}},
+		},
+	}
+
+	mockDB, logger := setupMockDB(t, false)
+	// deferring must not record a failure
+	mockDB.storePRFailureError = fmt.Errorf("unexpected failure record")
+
+	assert.NoError(t, HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, ""))
+}
+
 func Test_removeLabelFromIssueIfExists_Removed(t *testing.T) {
 	issuesMock := &IssuesMock{
 		MockRemoveLabelResponse: &github.Response{
@@ -731,6 +920,7 @@ func TestReviewPriorPRsEvalSuccess(t *testing.T) {
 	mockDB.getPRsForUserUser = &user
 	mockDB.getPRsForUserEvalInfo = []types.EvaluationInfo{
 		{
+			RepoId:         1234,
 			UserSignatures: []types.UserSignature{user},
 		},
 	}
@@ -859,3 +1049,193 @@ func getGHMock(repoCommits []*github.RepositoryCommit, issuesMock *IssuesMock, r
 
 	return mock
 }
+
+func TestHandleRepositoryRenamed(t *testing.T) {
+	mockDB, logger := setupMockDB(t, true)
+
+	payload := webhook.RepositoryPayload{Action: "renamed"}
+	payload.Repository.ID = 1234
+	payload.Repository.Name = "newName"
+	payload.Repository.Owner.Login = "newOwner"
+
+	mockDB.updateRepoNamesProvider = vcs.ProviderGitHub
+	mockDB.updateRepoNamesRepoId = 1234
+	mockDB.updateRepoNamesOwner = "newOwner"
+	mockDB.updateRepoNamesName = "newName"
+
+	assert.NoError(t, HandleRepository(logger, mockDB, payload, nil))
+}
+
+func TestHandleRepositoryUpdateError(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced update repository names error")
+	mockDB.updateRepoNamesError = forcedError
+
+	assert.EqualError(t, HandleRepository(logger, mockDB, webhook.RepositoryPayload{Action: "transferred"}, nil), forcedError.Error())
+}
+
+func setupBackfill(t *testing.T, repositoriesMock RepositoriesMock) (mockDB *mockCLADb, logger *zap.Logger) {
+	resetPemFileImpl := SetupTestPemFile(t)
+	t.Cleanup(resetPemFileImpl)
+	resetGHJWTImpl := SetupMockGHJWT()
+	t.Cleanup(resetGHJWTImpl)
+	origGithubImpl := GHImpl
+	t.Cleanup(func() {
+		GHImpl = origGithubImpl
+	})
+	GHImpl = &GHInterfaceMock{RepositoriesMock: repositoriesMock}
+
+	mockDB, logger = setupMockDB(t, false)
+	mockDB.legacyPRRepositories = []types.EvaluationInfo{{RepoOwner: "oldOwner", RepoName: "oldName", AppId: 1, InstallId: 2}}
+	mockDB.adoptedLegacyPRs = &[]string{}
+	return
+}
+
+func TestBackfillRepoIds(t *testing.T) {
+	mockDB, logger := setupBackfill(t, RepositoriesMock{mockRepository: &github.Repository{
+		ID:    github.Int64(1234),
+		Name:  github.String("newName"),
+		Owner: &github.User{Login: github.String("newOwner")},
+	}})
+	mockDB.adoptLegacyPRsCount = 3
+
+	backfill, err := BackfillRepoIds(logger, mockDB)
+	assert.NoError(t, err)
+	assert.Equal(t, RepoIdBackfill{Repositories: 1, Adopted: 3}, backfill)
+	assert.Equal(t, []string{"oldOwner/oldName -> 1234 newOwner/newName"}, *mockDB.adoptedLegacyPRs)
+}
+
+func TestBackfillRepoIdsRepositoryGone(t *testing.T) {
+	notFound := notFoundResponse()
+	mockDB, logger := setupBackfill(t, RepositoriesMock{mockRepositoryErr: &github.ErrorResponse{Response: notFound}})
+
+	backfill, err := BackfillRepoIds(logger, mockDB)
+	assert.NoError(t, err)
+	assert.Equal(t, RepoIdBackfill{Missing: []string{"oldOwner/oldName"}}, backfill)
+	assert.Empty(t, *mockDB.adoptedLegacyPRs)
+}
+
+func TestBackfillRepoIdsGetRepositoryError(t *testing.T) {
+	forcedError := fmt.Errorf("forced get repository error")
+	mockDB, logger := setupBackfill(t, RepositoriesMock{mockRepositoryErr: forcedError})
+
+	_, err := BackfillRepoIds(logger, mockDB)
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Empty(t, *mockDB.adoptedLegacyPRs)
+}
+
+func TestBackfillRepoIdsAdoptError(t *testing.T) {
+	mockDB, logger := setupBackfill(t, RepositoriesMock{})
+	forcedError := fmt.Errorf("forced adopt error")
+	mockDB.adoptLegacyPRsError = forcedError
+
+	_, err := BackfillRepoIds(logger, mockDB)
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestBackfillRepoIdsListError(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced list legacy repositories error")
+	mockDB.legacyPRRepositoriesError = forcedError
+
+	_, err := BackfillRepoIds(logger, mockDB)
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, retryBackoffBase, retryDelay(0))
+	assert.Equal(t, retryBackoffBase, retryDelay(1))
+	assert.Equal(t, 2*retryBackoffBase, retryDelay(2))
+	assert.Equal(t, 4*retryBackoffBase, retryDelay(3))
+	assert.Equal(t, retryBackoffMax, retryDelay(100))
+}
+
+func setupFinalizeWithError(t *testing.T, expectedStatus *github.RepoStatus) (repositoriesMock *RepositoriesMock) {
+	return setupMockRepositoriesService(t, []bool{true}, []any{
+		[]context.Context{context.Background()}, // ctx
+		[]string{"myOwner"},                     // owner
+		[]string{"myRepo"},                      // repo
+		[]string{"mySha"},                       // ref
+		[]*github.RepoStatus{expectedStatus},
+	})
+}
+
+func TestFinalizeWithErrorRetryScheduled(t *testing.T) {
+	repositoriesMock := setupFinalizeWithError(t, &github.RepoStatus{
+		State:       github.String("error"),
+		Description: github.String(Messages.StatusErrorRetry),
+		Context:     &MockAppSlug,
+		TargetURL:   github.String("https://cla.example.com/pr-status/github/12/34"),
+	})
+
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.storePRFailureAttempts = 1
+
+	evalInfo := &types.EvaluationInfo{RepoId: 12, PRNumber: 34, RepoOwner: "myOwner", RepoName: "myRepo", Sha: "mySha"}
+	finalizeWithError(logger, mockDB, repositoriesMock, "https://cla.example.com/", evalInfo, MockAppSlug, fmt.Errorf("forced evaluation error"))
+	assert.Equal(t, 1, repositoriesMock.assertParamsCreateStatus.callIndex)
+}
+
+func TestDiagnosticsURLEnterprise(t *testing.T) {
+	evalInfo := &types.EvaluationInfo{Provider: "ghe.example.com:8443", RepoId: 12, PRNumber: 34}
+	assert.Equal(t, "https://cla.example.com/pr-status/ghe.example.com:8443/12/34", diagnosticsURL("https://cla.example.com", evalInfo))
+}
+
+func TestFinalizeWithErrorGaveUp(t *testing.T) {
+	repositoriesMock := setupFinalizeWithError(t, &github.RepoStatus{
+		State:       github.String("error"),
+		Description: github.String(Messages.StatusErrorGaveUp),
+		Context:     &MockAppSlug,
+	})
+
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.storePRFailureAttempts = maxEvaluationAttempts
+	// should not be called
+	mockDB.schedulePRRetryError = fmt.Errorf("unexpected retry schedule")
+
+	evalInfo := &types.EvaluationInfo{RepoOwner: "myOwner", RepoName: "myRepo", Sha: "mySha"}
+	finalizeWithError(logger, mockDB, repositoriesMock, "", evalInfo, MockAppSlug, fmt.Errorf("forced evaluation error"))
+	assert.Equal(t, 1, repositoriesMock.assertParamsCreateStatus.callIndex)
+}
+
+func TestFinalizeWithErrorStoreFailureError(t *testing.T) {
+	repositoriesMock := setupFinalizeWithError(t, &github.RepoStatus{
+		State:       github.String("error"),
+		Description: github.String(Messages.StatusErrorGaveUp),
+		Context:     &MockAppSlug,
+	})
+
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.storePRFailureError = fmt.Errorf("forced store failure error")
+
+	evalInfo := &types.EvaluationInfo{RepoOwner: "myOwner", RepoName: "myRepo", Sha: "mySha"}
+	finalizeWithError(logger, mockDB, repositoriesMock, "", evalInfo, MockAppSlug, fmt.Errorf("forced evaluation error"))
+	assert.Equal(t, 1, repositoriesMock.assertParamsCreateStatus.callIndex)
+}
+
+func TestNewUserClientIsNotRateTracked(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headerRateLimit, "5000")
+		w.Header().Set(headerRateRemaining, "4999")
+		w.Header().Set(headerRateReset, "1714525200")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"login":"alice"}`))
+	}))
+	defer ts.Close()
+	host := setupTestHost(t)
+	host.APIURL = ts.URL + "/api/v3/"
+	host.UploadURL = ts.URL + "/api/uploads/"
+
+	client, err := GHImpl.NewUserClient(ts.Client(), host)
+	assert.NoError(t, err)
+	user, _, err := client.Users.Get(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.GetLogin())
+	assert.Empty(t, host.rateLimits.Snapshot())
+
+	client, err = GHImpl.NewEnterpriseClient(ts.Client(), host)
+	assert.NoError(t, err)
+	_, _, err = client.Users.Get(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, host.rateLimits.Snapshot(), 1)
+}
@@ -0,0 +1,185 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// Host is a GitHub Enterprise Server instance whose PRs we evaluate alongside those of github.com. Its name is the
+// provider of its PRs, so its repositories, PRs and signers are never mixed up with github.com ones, see
+// vcs.QualifiedLogin.
+type Host struct {
+	// Name is the host name GitHub Enterprise sends in the X-GitHub-Enterprise-Host header, e.g. "github.example.com"
+	Name string `json:"name"`
+	// WebURL is where users browse and log in, "https://<name>" by default
+	WebURL string `json:"webURL,omitempty"`
+	// APIURL is the REST API, "<webURL>/api/v3/" by default
+	APIURL string `json:"apiURL,omitempty"`
+	// UploadURL is the upload API, "<webURL>/api/uploads/" by default
+	UploadURL string `json:"uploadURL,omitempty"`
+	// AppId and KeyFile are our GitHub App on the instance, and its private keys, comma separated during a rotation
+	AppId   int64  `json:"appId"`
+	KeyFile string `json:"keyFile"`
+	// WebhookSecret is the secret of the app's webhooks, or the comma separated secrets accepted during a rotation
+	WebhookSecret string `json:"webhookSecret"`
+	// ClientID and ClientSecret let signers log in with the instance, either of the app or of an OAuth app
+	ClientID     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+
+	apps       *AppRegistry
+	rateLimits *RateLimitTracker
+}
+
+// Hosts are the GitHub Enterprise Server instances we evaluate PRs of, by name. PRs of github.com need no host.
+var Hosts = map[string]*Host{}
+
+// withTrailingSlash is how go-github wants its base URLs.
+func withTrailingSlash(rawURL string) string {
+	return strings.TrimSuffix(rawURL, "/") + "/"
+}
+
+// init validates the host, applies the default URLs, and sets up its app.
+func (h *Host) init() error {
+	h.Name = strings.ToLower(h.Name)
+	switch h.Name {
+	case "":
+		return fmt.Errorf("github host without name")
+	case vcs.ProviderGitHub, vcs.ProviderGitLab, vcs.ProviderGitea, "github.com":
+		return fmt.Errorf("invalid github host name: %s", h.Name)
+	}
+	if strings.ContainsAny(h.Name, "/?#@") {
+		return fmt.Errorf("invalid github host name: %s", h.Name)
+	}
+	if h.AppId == 0 || h.KeyFile == "" {
+		return fmt.Errorf("github host %s needs an appId and keyFile", h.Name)
+	}
+	// the host of a webhook is told by a header anyone can set, only its secret proves where it comes from
+	if len(WebhookSecrets(h.WebhookSecret)) == 0 {
+		return fmt.Errorf("github host %s needs a webhookSecret", h.Name)
+	}
+	if h.WebURL == "" {
+		h.WebURL = "https://" + h.Name
+	}
+	h.WebURL = strings.TrimSuffix(h.WebURL, "/")
+	if h.APIURL == "" {
+		h.APIURL = h.WebURL + "/api/v3/"
+	}
+	if h.UploadURL == "" {
+		h.UploadURL = h.WebURL + "/api/uploads/"
+	}
+	h.APIURL, h.UploadURL = withTrailingSlash(h.APIURL), withTrailingSlash(h.UploadURL)
+	for _, rawURL := range []string{h.WebURL, h.APIURL, h.UploadURL} {
+		if parsed, err := url.Parse(rawURL); err != nil || parsed.Host == "" {
+			return fmt.Errorf("github host %s has an invalid URL: %s", h.Name, rawURL)
+		}
+	}
+	h.apps = NewAppRegistry(h.KeyFile)
+	h.apps.host = h
+	h.rateLimits = NewRateLimitTracker()
+	h.rateLimits.host = h.Name
+	return nil
+}
+
+// LoadHosts reads the GitHub Enterprise Server instances from a JSON file holding a list of Host.
+func LoadHosts(path string) (map[string]*Host, error) {
+	config, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var listed []*Host
+	if err = json.Unmarshal(config, &listed); err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]*Host, len(listed))
+	for _, host := range listed {
+		if err = host.init(); err != nil {
+			return nil, err
+		}
+		if hosts[host.Name] != nil {
+			return nil, fmt.Errorf("duplicate github host: %s", host.Name)
+		}
+		hosts[host.Name] = host
+	}
+	return hosts, nil
+}
+
+// Provider is the provider of the PRs of a host, see types.EvaluationInfo. It is empty for github.com, which has no
+// host.
+func (h *Host) Provider() string {
+	if h == nil {
+		return ""
+	}
+	return h.Name
+}
+
+// HostOf returns the GitHub Enterprise Server instance of a provider, or nil if it is not one.
+func HostOf(provider string) *Host {
+	return Hosts[provider]
+}
+
+// IsGitHub tells if a provider is github.com, or one of our GitHub Enterprise Server instances.
+func IsGitHub(provider string) bool {
+	return provider == "" || provider == vcs.ProviderGitHub || HostOf(provider) != nil
+}
+
+// appsFor returns the app registry of the GitHub instance hosting the PR of an evaluation.
+func appsFor(evalInfo *types.EvaluationInfo) *AppRegistry {
+	if host := HostOf(vcs.ProviderOf(evalInfo)); host != nil {
+		return host.apps
+	}
+	return Apps
+}
+
+// rateLimitsFor returns the rate limit tracker of the GitHub instance hosting the PR of an evaluation.
+func rateLimitsFor(evalInfo *types.EvaluationInfo) *RateLimitTracker {
+	if host := HostOf(vcs.ProviderOf(evalInfo)); host != nil {
+		return host.rateLimits
+	}
+	return RateLimits
+}
+
+// AllRateLimits is the RateLimits snapshot, followed by those of every host.
+func AllRateLimits() []RateLimitStatus {
+	statuses := RateLimits.Snapshot()
+	names := make([]string, 0, len(Hosts))
+	for name := range Hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		statuses = append(statuses, Hosts[name].rateLimits.Snapshot()...)
+	}
+	return statuses
+}
+
+// pullRequestURL is the web page of a PR on the GitHub instance hosting it.
+func pullRequestURL(provider, owner, repo string, number int64) string {
+	webURL := "https://github.com"
+	if host := HostOf(provider); host != nil {
+		webURL = host.WebURL
+	}
+	return fmt.Sprintf("%s/%s/%s/pull/%d", webURL, url.PathEscape(owner), url.PathEscape(repo), number)
+}
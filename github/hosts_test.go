@@ -0,0 +1,151 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+func loadTestHosts(t *testing.T, hostsJson string) (map[string]*Host, error) {
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	assert.NoError(t, os.WriteFile(path, []byte(hostsJson), 0600))
+	return LoadHosts(path)
+}
+
+// setupTestHost makes a GitHub Enterprise Server instance, using a test key, one of our hosts for the duration of a
+// test.
+func setupTestHost(t *testing.T) *Host {
+	_, keyFile := setupTestRegistry(t)
+	hosts, err := loadTestHosts(t, `[{"name":"GitHub.example.com","appId":5,"keyFile":"`+keyFile+`","webhookSecret":"mySecret"}]`)
+	assert.NoError(t, err)
+	origHosts := Hosts
+	Hosts = hosts
+	t.Cleanup(func() {
+		Hosts = origHosts
+	})
+	return hosts["github.example.com"]
+}
+
+func TestLoadHostsDefaults(t *testing.T) {
+	hosts, err := loadTestHosts(t, `[{"name":"GitHub.example.com","appId":5,"keyFile":"key.pem","webhookSecret":"myHostSecret"}]`)
+	assert.NoError(t, err)
+	host := hosts["github.example.com"]
+	assert.NotNil(t, host)
+	assert.Equal(t, "github.example.com", host.Name)
+	assert.Equal(t, "https://github.example.com", host.WebURL)
+	assert.Equal(t, "https://github.example.com/api/v3/", host.APIURL)
+	assert.Equal(t, "https://github.example.com/api/uploads/", host.UploadURL)
+}
+
+func TestLoadHostsURLs(t *testing.T) {
+	hosts, err := loadTestHosts(t, `[{"name":"ghe.example.org","appId":5,"keyFile":"key.pem","webhookSecret":"myHostSecret",
+		"webURL":"http://ghe.example.org:8080/","apiURL":"https://api.ghe.example.org","uploadURL":"https://uploads.ghe.example.org/"}]`)
+	assert.NoError(t, err)
+	host := hosts["ghe.example.org"]
+	assert.Equal(t, "http://ghe.example.org:8080", host.WebURL)
+	assert.Equal(t, "https://api.ghe.example.org/", host.APIURL)
+	assert.Equal(t, "https://uploads.ghe.example.org/", host.UploadURL)
+}
+
+func TestLoadHostsInvalid(t *testing.T) {
+	for hostsJson, expectedError := range map[string]string{
+		`[{"appId":5,"keyFile":"key.pem"}]`:                                                                               "github host without name",
+		`[{"name":"GitLab","appId":5,"keyFile":"key.pem"}]`:                                                               "invalid github host name: gitlab",
+		`[{"name":"github.com","appId":5,"keyFile":"key.pem"}]`:                                                           "invalid github host name: github.com",
+		`[{"name":"user@github.example.com","appId":5,"keyFile":"key.pem"}]`:                                              "invalid github host name: user@github.example.com",
+		`[{"name":"github.example.com","keyFile":"key.pem"}]`:                                                             "github host github.example.com needs an appId and keyFile",
+		`[{"name":"github.example.com","appId":5,"keyFile":"key.pem","webhookSecret":" , "}]`:                             "github host github.example.com needs a webhookSecret",
+		`[{"name":"github.example.com","appId":5,"keyFile":"key.pem","webhookSecret":"myHostSecret","apiURL":"/api/v3"}]`: "github host github.example.com has an invalid URL: /api/v3/",
+		`[{"name":"github.example.com","appId":5,"keyFile":"key.pem","webhookSecret":"myHostSecret"},{"name":"GITHUB.example.com","appId":6,"keyFile":"key.pem","webhookSecret":"myHostSecret"}]`: "duplicate github host: github.example.com",
+	} {
+		_, err := loadTestHosts(t, hostsJson)
+		assert.EqualError(t, err, expectedError, hostsJson)
+	}
+
+	_, err := loadTestHosts(t, `{"name":"github.example.com"}`)
+	assert.Error(t, err)
+	_, err = LoadHosts(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestHostOf(t *testing.T) {
+	host := setupTestHost(t)
+
+	assert.Same(t, host, HostOf("github.example.com"))
+	assert.Nil(t, HostOf(vcs.ProviderGitHub))
+	assert.Nil(t, HostOf(vcs.ProviderGitLab))
+
+	assert.Equal(t, "github.example.com", host.Provider())
+	assert.Equal(t, "", (*Host)(nil).Provider())
+
+	assert.True(t, IsGitHub(""))
+	assert.True(t, IsGitHub(vcs.ProviderGitHub))
+	assert.True(t, IsGitHub("github.example.com"))
+	assert.False(t, IsGitHub(vcs.ProviderGitLab))
+	assert.False(t, IsGitHub("unknown.example.com"))
+}
+
+func TestHostAppsAndRateLimits(t *testing.T) {
+	host := setupTestHost(t)
+
+	assert.Same(t, Apps, appsFor(&types.EvaluationInfo{}))
+	assert.Same(t, host.apps, appsFor(&types.EvaluationInfo{Provider: host.Name}))
+	assert.Same(t, RateLimits, rateLimitsFor(&types.EvaluationInfo{}))
+	assert.Same(t, host.rateLimits, rateLimitsFor(&types.EvaluationInfo{Provider: host.Name}))
+
+	atr, err := host.apps.AppsTransport(5)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.example.com/api/v3", atr.BaseURL)
+	itr, err := host.apps.InstallationTransport(5, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://github.example.com/api/v3", itr.BaseURL)
+
+	host.rateLimits.recordDeferred(7)
+	statuses := AllRateLimits()
+	assert.Equal(t, "github.example.com", statuses[len(statuses)-1].Host)
+	assert.Equal(t, int64(7), statuses[len(statuses)-1].InstallID)
+	assert.Equal(t, 1, statuses[len(statuses)-1].Deferred)
+}
+
+func TestInstallationClientOfHost(t *testing.T) {
+	host := setupTestHost(t)
+
+	origGHImpl := GHImpl
+	defer func() {
+		GHImpl = origGHImpl
+	}()
+	mock := &GHInterfaceMock{}
+	GHImpl = mock
+
+	_, err := installationClient(&types.EvaluationInfo{Provider: host.Name, AppId: 5, InstallId: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, "github.example.com", mock.enterpriseHost)
+}
+
+func TestPullRequestURL(t *testing.T) {
+	setupTestHost(t)
+
+	assert.Equal(t, "https://github.com/someOwner/someRepo/pull/5", pullRequestURL("", "someOwner", "someRepo", 5))
+	assert.Equal(t, "https://github.example.com/someOwner/someRepo/pull/5", pullRequestURL("github.example.com", "someOwner", "someRepo", 5))
+}
@@ -0,0 +1,233 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// PrivateKeyStatus is what we know about one of the private keys of our apps, see KeyTracker.
+type PrivateKeyStatus struct {
+	// Fingerprint is the SHA256 fingerprint GitHub shows for the key on the settings page of the app
+	Fingerprint string `json:"fingerprint"`
+	File        string `json:"file"`
+	// Signing tells if the key signs the tokens of an app, the other keys are only kept for a rotation
+	Signing  bool       `json:"signing"`
+	Tokens   int        `json:"tokens"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+}
+
+type trackedKey struct {
+	status PrivateKeyStatus
+	key    *rsa.PrivateKey
+}
+
+// KeyTracker knows the private keys of all our apps, and which of them is selected to sign. During a rotation an
+// app has several keys registered with GitHub, the new one is selected once it is deployed everywhere, and the old
+// one removed once it no longer signs any tokens.
+type KeyTracker struct {
+	mu  sync.Mutex
+	now func() time.Time
+	// selected is the fingerprint of the key signing for the apps that have it, the others sign with their first key
+	selected string
+	keys     map[string]*trackedKey
+	// rings are the key rings of our apps, by key file setting or source of their PEM content
+	rings map[string]*keyRing
+}
+
+func NewKeyTracker() *KeyTracker {
+	return &KeyTracker{now: time.Now, keys: make(map[string]*trackedKey), rings: make(map[string]*keyRing)}
+}
+
+// PrivateKeys are the keys of all app registries.
+var PrivateKeys = NewKeyTracker()
+
+// keyFingerprint is the fingerprint GitHub shows for a private key, that of its public key.
+func keyFingerprint(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// keyRing is the private keys of an app, read from a setting listing their files, e.g. "new.pem,old.pem".
+type keyRing struct {
+	tracker      *KeyTracker
+	fingerprints []string
+}
+
+// keySource is the PEM encoded content of a private key, and where it was read from.
+type keySource struct {
+	name string
+	pem  []byte
+}
+
+// LoadKeyRing reads all private key files of a key file setting, so a broken key shows up before it is selected.
+func (k *KeyTracker) LoadKeyRing(setting string) (*keyRing, error) {
+	var sources []keySource
+	for _, keyFile := range strings.Split(setting, settingSeparator) {
+		keyFile = strings.TrimSpace(keyFile)
+		if keyFile == "" {
+			continue
+		}
+		pemBytes, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read private key: %w", err)
+		}
+		sources = append(sources, keySource{name: keyFile, pem: pemBytes})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("could not read private key: no key file in %q", setting)
+	}
+	return k.addKeyRing(setting, sources)
+}
+
+// LoadKeyRingPEM reads the private keys of PEM encoded content, e.g. that of a secret, which holds several keys one
+// after the other while rotating. The keys are named after the source of the content and their position in it.
+func (k *KeyTracker) LoadKeyRingPEM(source, content string) (*keyRing, error) {
+	var sources []keySource
+	rest := []byte(content)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		sources = append(sources, keySource{name: fmt.Sprintf("%s#%d", source, len(sources)+1), pem: pem.EncodeToMemory(block)})
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("could not read private key: no PEM encoded key in %s", source)
+	}
+	return k.addKeyRing(source, sources)
+}
+
+func (k *KeyTracker) addKeyRing(setting string, sources []keySource) (*keyRing, error) {
+	ring := &keyRing{tracker: k}
+	loaded := make(map[string]*trackedKey)
+	for _, source := range sources {
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(source.pem)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse private key %s: %w", source.name, err)
+		}
+		fingerprint, err := keyFingerprint(key)
+		if err != nil {
+			return nil, err
+		}
+		ring.fingerprints = append(ring.fingerprints, fingerprint)
+		loaded[fingerprint] = &trackedKey{status: PrivateKeyStatus{Fingerprint: fingerprint, File: source.name}, key: key}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for fingerprint, tracked := range loaded {
+		if known, ok := k.keys[fingerprint]; ok {
+			known.status.File, known.key = tracked.status.File, tracked.key
+		} else {
+			k.keys[fingerprint] = tracked
+		}
+	}
+	k.rings[setting] = ring
+	return ring, nil
+}
+
+// signing must be called with the lock held
+func (k *KeyTracker) signing(ring *keyRing) *trackedKey {
+	for _, fingerprint := range ring.fingerprints {
+		if fingerprint == k.selected {
+			return k.keys[fingerprint]
+		}
+	}
+	return k.keys[ring.fingerprints[0]]
+}
+
+// Select makes the key with the fingerprint sign for every app that has it. The key must be loaded already, see
+// LoadAllKeyRings. The selection is kept in the memory of this process only, other replicas and restarts sign with
+// the key CLA_PEM_SIGNING_KEY selects.
+func (k *KeyTracker) Select(fingerprint string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys[fingerprint]; !ok {
+		return fmt.Errorf("unknown private key: %s", fingerprint)
+	}
+	k.selected = fingerprint
+	return nil
+}
+
+// Statuses returns the keys of our apps, ordered by file.
+func (k *KeyTracker) Statuses() (statuses []PrivateKeyStatus) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	signing := make(map[string]bool)
+	for _, ring := range k.rings {
+		signing[k.signing(ring).status.Fingerprint] = true
+	}
+	statuses = make([]PrivateKeyStatus, 0, len(k.keys))
+	for fingerprint, tracked := range k.keys {
+		status := tracked.status
+		status.Signing = signing[fingerprint]
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].File < statuses[j].File
+	})
+	return
+}
+
+// SigningKey is the fingerprint of the key that signs for the app.
+func (r *keyRing) SigningKey() string {
+	r.tracker.mu.Lock()
+	defer r.tracker.mu.Unlock()
+	return r.tracker.signing(r).status.Fingerprint
+}
+
+// Sign implements ghinstallation.Signer, with the selected key of the app.
+func (r *keyRing) Sign(claims jwt.Claims) (string, error) {
+	r.tracker.mu.Lock()
+	tracked := r.tracker.signing(r)
+	tracked.status.Tokens++
+	lastUsed := r.tracker.now()
+	tracked.status.LastUsed = &lastUsed
+	key := tracked.key
+	r.tracker.mu.Unlock()
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+}
+
+// LoadAllKeyRings reads the private keys of github.com, our tenants and our hosts, so any of them can be selected.
+func LoadAllKeyRings() error {
+	if err := Apps.loadKeyRings(); err != nil {
+		return err
+	}
+	for _, host := range Hosts {
+		if err := host.apps.loadKeyRings(); err != nil {
+			return fmt.Errorf("github host %s: %w", host.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// EventMergeGroup is not supported by our webhook parser, so we parse it ourselves, see ParseMergeGroupEvent.
+const EventMergeGroup = "merge_group"
+
+// mergeGroupResultTTL is how long a stored evaluation of a PR is trusted when it enters the merge queue
+const mergeGroupResultTTL = 10 * time.Minute
+
+// mergeQueueRefPR finds the PR in the ref of a merge group, e.g. "refs/heads/gh-readonly-queue/main/pr-123-<sha>"
+var mergeQueueRefPR = regexp.MustCompile(`/gh-readonly-queue/.+/pr-(\d+)-[0-9a-f]+$`)
+
+// mergeCommitPR finds the PR in the message of a merge ("Merge pull request #123 from ...") or squash
+// ("Some title (#123)") commit.
+var mergeCommitPR = regexp.MustCompile(`^Merge pull request #(\d+) |\(#(\d+)\)$`)
+
+// ParseMergeGroupEvent parses a merge_group webhook, whose signature was checked by VerifyWebhookSignature.
+func ParseMergeGroupEvent(r *http.Request) (*github.MergeGroupEvent, error) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := github.ValidatePayloadFromBody(contentType, r.Body, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	event, err := github.ParseWebHook(EventMergeGroup, payload)
+	if err != nil {
+		return nil, err
+	}
+	return event.(*github.MergeGroupEvent), nil
+}
+
+// mergeGroupPRs lists the numbers of the PRs in a merge group: the one named in its ref, and those whose merge
+// commits the queue put on top of its base. Only the first parent chain from the head back to the base is the
+// queue's, the commits of the PRs themselves may name any PR.
+func mergeGroupPRs(ctx context.Context, repositoryService RepositoriesService, owner, repo string, mergeGroup *github.MergeGroup) (prNumbers []int64, err error) {
+	found := make(map[int64]bool)
+	if match := mergeQueueRefPR.FindStringSubmatch(mergeGroup.GetHeadRef()); match != nil {
+		number, _ := strconv.ParseInt(match[1], 10, 64)
+		found[number] = true
+	}
+
+	commits, err := listAll(func(opts github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+		comparison, resp, err := repositoryService.CompareCommits(ctx, owner, repo, mergeGroup.GetBaseSHA(), mergeGroup.GetHeadSHA(), &opts)
+		if err != nil {
+			return nil, resp, err
+		}
+		return comparison.Commits, resp, nil
+	})
+	if err != nil {
+		return
+	}
+	bySha := make(map[string]*github.RepositoryCommit, len(commits))
+	for _, commit := range commits {
+		bySha[commit.GetSHA()] = commit
+	}
+	for commit := bySha[mergeGroup.GetHeadSHA()]; commit != nil; {
+		subject, _, _ := strings.Cut(commit.GetCommit().GetMessage(), "\n")
+		if match := mergeCommitPR.FindStringSubmatch(strings.TrimSpace(subject)); match != nil {
+			number, _ := strconv.ParseInt(match[1]+match[2], 10, 64)
+			found[number] = true
+		}
+		if len(commit.Parents) == 0 {
+			break
+		}
+		// the base is not among the compared commits, which ends the chain
+		commit = bySha[commit.Parents[0].GetSHA()]
+	}
+
+	for number := range found {
+		prNumbers = append(prNumbers, number)
+	}
+	sort.Slice(prNumbers, func(i, j int) bool { return prNumbers[i] < prNumbers[j] })
+	return
+}
+
+// prResult returns the CLA status of a PR, evaluating it again unless we have a fresh enough result for its
+// current head.
+func prResult(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, claVersion string) (state string, err error) {
+	stored, err := postgres.GetPRStatus(vcs.ProviderOf(evalInfo), evalInfo.RepoId, evalInfo.PRNumber)
+	if err != nil {
+		return
+	}
+	if stored != nil && stored.Sha == evalInfo.Sha && time.Since(stored.UpdatedAt) < mergeGroupResultTTL &&
+		(stored.State == "success" || stored.State == "failure") {
+		return stored.State, nil
+	}
+
+	if err = EvaluatePullRequest(logger, postgres, evalInfo, claVersion); err != nil {
+		return
+	}
+	if stored, err = postgres.GetPRStatus(vcs.ProviderOf(evalInfo), evalInfo.RepoId, evalInfo.PRNumber); err != nil || stored == nil {
+		return "", err
+	}
+	return stored.State, nil
+}
+
+// HandleMergeGroup reports the combined CLA status of all PRs in a merge group on its head SHA, which the merge
+// queue waits for before merging them.
+func HandleMergeGroup(logger *zap.Logger, postgres db.IClaDB, event *github.MergeGroupEvent, host *Host, appId int64, claVersion string) (err error) {
+	groupInfo := types.EvaluationInfo{
+		Provider:  host.Provider(),
+		RepoId:    event.GetRepo().GetID(),
+		RepoOwner: event.GetRepo().GetOwner().GetLogin(),
+		RepoName:  event.GetRepo().GetName(),
+		Sha:       event.GetMergeGroup().GetHeadSHA(),
+		AppId:     appId,
+		InstallId: event.GetInstallation().GetID(),
+	}
+	app, err := appsFor(&groupInfo).Metadata(groupInfo.AppId, groupInfo.InstallId)
+	if err != nil {
+		return
+	}
+	client, err := installationClient(&groupInfo)
+	if err != nil {
+		return
+	}
+	messages := messagesFor(logger, client.Repositories, &groupInfo)
+	reportGroupStatus := func(state, template string, prNumbers ...int64) error {
+		data := messageData(&groupInfo)
+		data.PullRequests = prNumbers
+		description, err := messages.render(template, data)
+		if err != nil {
+			return err
+		}
+		return createRepoStatus(client.Repositories, groupInfo.RepoOwner, groupInfo.RepoName, groupInfo.Sha, state, description, app.Slug)
+	}
+
+	ctx := context.Background()
+	prNumbers, err := mergeGroupPRs(ctx, client.Repositories, groupInfo.RepoOwner, groupInfo.RepoName, event.GetMergeGroup())
+	if err != nil {
+		return
+	}
+	logger.Info("merge group checks requested",
+		zap.String("owner", groupInfo.RepoOwner),
+		zap.String("repo", groupInfo.RepoName),
+		zap.String("sha", groupInfo.Sha),
+		zap.Int64s("pullRequestIDs", prNumbers),
+	)
+	if len(prNumbers) == 0 {
+		return reportGroupStatus("error", "statusMergeGroupNoPRs")
+	}
+
+	var checked int
+	var unsigned, unfinished []int64
+	for _, number := range prNumbers {
+		var pr *github.PullRequest
+		if pr, _, err = client.PullRequests.Get(ctx, groupInfo.RepoOwner, groupInfo.RepoName, int(number)); err != nil {
+			_ = reportGroupStatus("error", "statusMergeGroupError", number)
+			return
+		}
+		if pr.GetState() != "open" {
+			logger.Debug("skip merge group PR that is not open", zap.Int64("pullRequestID", number), zap.String("state", pr.GetState()))
+			continue
+		}
+		checked++
+		evalInfo := groupInfo
+		evalInfo.PRNumber = number
+		evalInfo.Sha = pr.GetHead().GetSHA()
+
+		var state string
+		if state, err = prResult(logger, postgres, &evalInfo, claVersion); err != nil {
+			_ = reportGroupStatus("error", "statusMergeGroupError", number)
+			return
+		}
+		switch state {
+		case "success":
+		case "failure":
+			unsigned = append(unsigned, number)
+		default:
+			// e.g. deferred until the rate limit resets, or failed to evaluate: the authors may well have signed
+			unfinished = append(unfinished, number)
+		}
+	}
+
+	switch {
+	case checked == 0:
+		return reportGroupStatus("error", "statusMergeGroupNoPRs")
+	case len(unsigned) > 0:
+		return reportGroupStatus("failure", "statusMergeGroupUnsigned", unsigned...)
+	case len(unfinished) > 0:
+		// nothing reports on the group once these are evaluated, so we can't leave it pending
+		return reportGroupStatus("error", "statusMergeGroupError", unfinished...)
+	}
+	return reportGroupStatus("success", "statusMergeGroupSigned")
+}
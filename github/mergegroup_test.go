@@ -0,0 +1,253 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+const (
+	testMergeGroupHeadSha = "0123456789abcdef0123456789abcdef01234567"
+	testPRHeadSha         = "fedcba9876543210fedcba9876543210fedcba98"
+)
+
+func mergeCommit(sha, message string, parents ...string) *github.RepositoryCommit {
+	commit := &github.RepositoryCommit{SHA: github.String(sha), Commit: &github.Commit{Message: github.String(message)}}
+	for _, parent := range parents {
+		commit.Parents = append(commit.Parents, &github.Commit{SHA: github.String(parent)})
+	}
+	return commit
+}
+
+func mergeGroupEvent() *github.MergeGroupEvent {
+	return &github.MergeGroupEvent{
+		Action: github.String("checks_requested"),
+		MergeGroup: &github.MergeGroup{
+			HeadSHA: github.String(testMergeGroupHeadSha),
+			HeadRef: github.String("refs/heads/gh-readonly-queue/main/pr-12-" + testMergeGroupHeadSha),
+			BaseSHA: github.String("base"),
+		},
+		Repo: &github.Repository{
+			ID:    github.Int64(7),
+			Name:  github.String("myRepo"),
+			Owner: &github.User{Login: github.String("myOwner")},
+		},
+		Installation: &github.Installation{ID: github.Int64(3)},
+	}
+}
+
+// setupMergeGroupMock expects a status for each PR that is evaluated again, followed by the combined status
+func setupMergeGroupMock(t *testing.T, evaluatedStatuses int, state, description string) *GHInterfaceMock {
+	assertParameters := make([]bool, evaluatedStatuses+1)
+	assertParameters[evaluatedStatuses] = true
+	groupStatuses := make([]*github.RepoStatus, evaluatedStatuses+1)
+	groupStatuses[evaluatedStatuses] = &github.RepoStatus{
+		State:       github.String(state),
+		Description: github.String(description),
+		Context:     &MockAppSlug,
+	}
+	groupShas := make([]string, evaluatedStatuses+1)
+	groupShas[evaluatedStatuses] = testMergeGroupHeadSha
+	contexts := make([]context.Context, evaluatedStatuses+1)
+	contexts[evaluatedStatuses] = context.Background()
+	owners := make([]string, evaluatedStatuses+1)
+	owners[evaluatedStatuses] = "myOwner"
+	repos := make([]string, evaluatedStatuses+1)
+	repos[evaluatedStatuses] = "myRepo"
+
+	repositoriesMock := setupMockRepositoriesService(t, assertParameters, []any{contexts, owners, repos, groupShas, groupStatuses})
+	// the queue squashed #10 and merged #11 on top of the base, then added the head for #12
+	repositoriesMock.compareCommits = []*github.CommitsComparison{{Commits: []*github.RepositoryCommit{
+		mergeCommit("squashed10", "Fix the frobnicator (#10)\n\nCo-authored-by: someone", "base"),
+		mergeCommit("feature", "Cherry-pick the fix (#99)", "base"),
+		mergeCommit("merged11", "Merge pull request #11 from someone/feature", "squashed10", "feature"),
+		mergeCommit(testMergeGroupHeadSha, "A plain commit", "merged11"),
+	}}}
+	repositoriesMock.compareCommitsResp = []*github.Response{nil}
+	return &GHInterfaceMock{
+		RepositoriesMock: *repositoriesMock,
+		PullRequestsMock: PullRequestsMock{
+			mockPullRequest: &github.PullRequest{State: github.String("open"), Head: &github.PullRequestBranch{SHA: github.String(testPRHeadSha)}},
+		},
+	}
+}
+
+func freshStatus(state string) *types.PRStatus {
+	return &types.PRStatus{Sha: testPRHeadSha, State: state, UpdatedAt: time.Now()}
+}
+
+func TestParseMergeGroupEvent(t *testing.T) {
+	body := []byte(`{"action":"checks_requested","merge_group":{"head_sha":"abc"}}`)
+	mac := hmac.New(sha256.New, []byte("mySecret"))
+	mac.Write(body)
+	req := httptest.NewRequest(http.MethodPost, "/webhook-integration", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(github.SHA256SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	secret, err := VerifyWebhookSignature(req, []string{"mySecret"})
+	assert.NoError(t, err)
+	assert.Equal(t, SecretFingerprint("mySecret"), secret)
+
+	event, err := ParseMergeGroupEvent(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "checks_requested", event.GetAction())
+	assert.Equal(t, "abc", event.GetMergeGroup().GetHeadSHA())
+}
+
+func TestParseMergeGroupEventForm(t *testing.T) {
+	form := url.Values{"payload": {`{"action":"checks_requested"}`}}
+	req := httptest.NewRequest(http.MethodPost, "/webhook-integration", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	event, err := ParseMergeGroupEvent(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "checks_requested", event.GetAction())
+
+	req.Header.Set("Content-Type", "text/plain")
+	_, err = ParseMergeGroupEvent(req)
+	assert.EqualError(t, err, `webhook request has unsupported Content-Type "text/plain"`)
+}
+
+func TestMergeGroupPRs(t *testing.T) {
+	repositoriesMock := setupMergeGroupMock(t, 0, "", "").RepositoriesMock
+	prNumbers, err := mergeGroupPRs(context.Background(), &repositoriesMock, "myOwner", "myRepo", mergeGroupEvent().MergeGroup)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{10, 11, 12}, prNumbers)
+}
+
+func TestMergeGroupPRsCompareError(t *testing.T) {
+	forcedError := fmt.Errorf("forced CompareCommits error")
+	repositoriesMock := &RepositoriesMock{compareCommitsErr: forcedError}
+	_, err := mergeGroupPRs(context.Background(), repositoriesMock, "myOwner", "myRepo", mergeGroupEvent().MergeGroup)
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestHandleMergeGroupStoredResults(t *testing.T) {
+	setupOverrideEnvironment(t)
+	GHImpl = setupMergeGroupMock(t, 0, "failure", "The CLA check failed for PR #11")
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.prStatuses = map[int64]*types.PRStatus{
+		10: freshStatus("success"),
+		11: freshStatus("failure"),
+		12: freshStatus("success"),
+	}
+
+	assert.NoError(t, HandleMergeGroup(logger, mockDB, mergeGroupEvent(), nil, 0, ""))
+	assert.Equal(t, 1, GHImpl.(*GHInterfaceMock).RepositoriesMock.assertParamsCreateStatus.callIndex)
+}
+
+func TestHandleMergeGroupEvaluatesStaleResults(t *testing.T) {
+	setupOverrideEnvironment(t)
+	// stale and outdated results are evaluated again, here ending up overridden, with a pending and final status each
+	GHImpl = setupMergeGroupMock(t, 4, "success", Messages.StatusMergeGroupSigned)
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.getPROverride = &types.AuditEvent{Actor: "maintainer", Action: types.AuditActionOverrideApplied, Sha: testPRHeadSha}
+	stale := freshStatus("success")
+	stale.UpdatedAt = time.Now().Add(-mergeGroupResultTTL)
+	outdated := freshStatus("success")
+	outdated.Sha = "older"
+	mockDB.prStatuses = map[int64]*types.PRStatus{
+		10: stale,
+		11: outdated,
+		12: freshStatus("success"),
+	}
+
+	assert.NoError(t, HandleMergeGroup(logger, mockDB, mergeGroupEvent(), nil, 0, ""))
+	assert.Equal(t, 5, GHImpl.(*GHInterfaceMock).RepositoriesMock.assertParamsCreateStatus.callIndex)
+	assert.Equal(t, "success", mockDB.prStatuses[10].State)
+	assert.Equal(t, testPRHeadSha, mockDB.prStatuses[11].Sha)
+}
+
+func TestHandleMergeGroupUnfinishedResults(t *testing.T) {
+	setupOverrideEnvironment(t)
+	// the stale result of #11 is evaluated again, only to be deferred by the rate limit after its pending status
+	ghMock := setupMergeGroupMock(t, 1, "error", "Could not check the CLA for PR #11")
+	ghMock.PullRequestsMock.mockListCommitsError = &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}}}
+	GHImpl = ghMock
+	mockDB, logger := setupMockDB(t, false)
+	stale := freshStatus("success")
+	stale.UpdatedAt = time.Now().Add(-mergeGroupResultTTL)
+	mockDB.prStatuses = map[int64]*types.PRStatus{
+		10: freshStatus("success"),
+		11: stale,
+		12: freshStatus("success"),
+	}
+
+	assert.NoError(t, HandleMergeGroup(logger, mockDB, mergeGroupEvent(), nil, 0, ""))
+	assert.Equal(t, 2, GHImpl.(*GHInterfaceMock).RepositoriesMock.assertParamsCreateStatus.callIndex)
+	assert.Equal(t, "deferred", mockDB.prStatuses[11].State)
+}
+
+func TestHandleMergeGroupClosedPRs(t *testing.T) {
+	setupOverrideEnvironment(t)
+	ghMock := setupMergeGroupMock(t, 0, "error", Messages.StatusMergeGroupNoPRs)
+	ghMock.PullRequestsMock.mockPullRequest.State = github.String("closed")
+	GHImpl = ghMock
+	mockDB, logger := setupMockDB(t, false)
+
+	assert.NoError(t, HandleMergeGroup(logger, mockDB, mergeGroupEvent(), nil, 0, ""))
+	assert.Equal(t, 1, GHImpl.(*GHInterfaceMock).RepositoriesMock.assertParamsCreateStatus.callIndex)
+}
+
+func TestHandleMergeGroupNoPRs(t *testing.T) {
+	setupOverrideEnvironment(t)
+	ghMock := setupMergeGroupMock(t, 0, "error", Messages.StatusMergeGroupNoPRs)
+	ghMock.RepositoriesMock.compareCommits = []*github.CommitsComparison{{}}
+	GHImpl = ghMock
+	mockDB, logger := setupMockDB(t, false)
+	event := mergeGroupEvent()
+	event.MergeGroup.HeadRef = github.String("refs/heads/somewhere-else")
+
+	assert.NoError(t, HandleMergeGroup(logger, mockDB, event, nil, 0, ""))
+}
+
+func TestHandleMergeGroupStatusError(t *testing.T) {
+	setupOverrideEnvironment(t)
+	GHImpl = setupMergeGroupMock(t, 0, "error", "Could not check the CLA for PR #10")
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced GetPRStatus error")
+	mockDB.getPRStatusError = forcedError
+
+	assert.EqualError(t, HandleMergeGroup(logger, mockDB, mergeGroupEvent(), nil, 0, ""), forcedError.Error())
+}
+
+func TestHandleMergeGroupPullRequestError(t *testing.T) {
+	setupOverrideEnvironment(t)
+	ghMock := setupMergeGroupMock(t, 0, "error", "Could not check the CLA for PR #10")
+	forcedError := fmt.Errorf("forced Get error")
+	ghMock.PullRequestsMock.mockGetPullRequestError = forcedError
+	GHImpl = ghMock
+	mockDB, logger := setupMockDB(t, false)
+
+	assert.EqualError(t, HandleMergeGroup(logger, mockDB, mergeGroupEvent(), nil, 0, ""), forcedError.Error())
+}
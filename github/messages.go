@@ -0,0 +1,360 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// Label is a label we put on PRs.
+type Label struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// MessageCommit is a commit listed in a message.
+type MessageCommit struct {
+	SHA string
+	URL string
+	// Reason tells why a skipped commit was not checked
+	Reason string
+}
+
+// MessageData is everything a message template can refer to. Fields that don't apply to a message are empty.
+type MessageData struct {
+	RepoOwner string
+	RepoName  string
+	PRNumber  int64
+	// UnsignedUsers are the logins of the authors who still need to sign the CLA
+	UnsignedUsers []string
+	// CommitsMissingAuthor and CommitsMissingVerification are the offending commits
+	CommitsMissingAuthor       []MessageCommit
+	CommitsMissingVerification []MessageCommit
+	// SkippedCommits were made by automation, and allowed without any checks
+	SkippedCommits []MessageCommit
+	// SignURL is where the CLA can be signed
+	SignURL string
+	// SignURLs are the signing links for each of the UnsignedUsers, which bring them back to the PR once signed.
+	// They are only set while signing links are enabled, see SignLinks.
+	SignURLs   map[string]string
+	CLAVersion string
+	// SignedCommitsURL explains how to sign commits, see MessageTemplates.SignedCommitsURL
+	SignedCommitsURL string
+	// Reason tells why the CLA is not required, e.g. for trivial changes
+	Reason string
+	// Actor is who overrode the CLA check
+	Actor string
+	// PullRequests are the PRs of a merge group that failed (or could not be checked)
+	PullRequests []int64
+}
+
+// MessageTemplates are the texts of our comments and status descriptions, as text/template templates executed
+// with MessageData, and the labels we use. Any of them can be replaced by a JSON file with the same field names,
+// see LoadMessages.
+type MessageTemplates struct {
+	CommentSignCLA        string `json:"commentSignCla"`
+	CommentCommitProblems string `json:"commentCommitProblems"`
+	CommentTrivialChange  string `json:"commentTrivialChange"`
+
+	StatusPending            string `json:"statusPending"`
+	StatusSigned             string `json:"statusSigned"`
+	StatusUnsigned           string `json:"statusUnsigned"`
+	StatusCommitProblems     string `json:"statusCommitProblems"`
+	StatusDraft              string `json:"statusDraft"`
+	StatusOverridden         string `json:"statusOverridden"`
+	StatusTrivialChange      string `json:"statusTrivialChange"`
+	StatusNotEnforced        string `json:"statusNotEnforced"`
+	StatusErrorRetry         string `json:"statusErrorRetry"`
+	StatusErrorGaveUp        string `json:"statusErrorGaveUp"`
+	StatusMergeGroupSigned   string `json:"statusMergeGroupSigned"`
+	StatusMergeGroupUnsigned string `json:"statusMergeGroupUnsigned"`
+	StatusMergeGroupError    string `json:"statusMergeGroupError"`
+	StatusMergeGroupNoPRs    string `json:"statusMergeGroupNoPRs"`
+
+	LabelSigned              Label `json:"labelSigned"`
+	LabelUnsigned            Label `json:"labelUnsigned"`
+	LabelMissingAuthor       Label `json:"labelMissingAuthor"`
+	LabelMissingVerification Label `json:"labelMissingVerification"`
+
+	// SignedCommitsURL is linked from the comment about unsigned commits
+	SignedCommitsURL string `json:"signedCommitsUrl"`
+
+	parsed map[string]*template.Template
+}
+
+const defaultCommentCommitProblems = `Thanks for the contribution. Unfortunately some of your commits don't meet our standards. All commits must be signed and have author information set.
+
+The commits to review are:
+
+{{range .CommitsMissingAuthor}}- <a href="{{.URL}}">{{.SHA}}</a> - missing author :cop:
+{{end}}{{range .CommitsMissingVerification}}- <a href="{{.URL}}">{{.SHA}}</a> - unsigned commit :key:
+{{end}}{{if and .CommitsMissingVerification .SignedCommitsURL}}
+See [Signed Commits]({{.SignedCommitsURL}}).
+{{end}}` + defaultSkippedCommits
+
+// defaultSkippedCommits lists the commits allowed without checks, so reviewers can see why
+const defaultSkippedCommits = `{{if .SkippedCommits}}
+
+These commits were made by automation, and not checked:
+{{range .SkippedCommits}}
+- <a href="{{.URL}}">{{.SHA}}</a> - {{.Reason}}{{end}}{{end}}`
+
+// DefaultMessages returns the messages used unless configured otherwise.
+func DefaultMessages() *MessageTemplates {
+	return &MessageTemplates{
+		CommentSignCLA:        "Thanks for the contribution. Before we can merge this, we need{{if .SignURLs}}{{range $i, $login := .UnsignedUsers}}{{if $i}},{{end}} @{{$login}} to [sign the Contributor License Agreement]({{index $.SignURLs $login}}){{end}}{{else}}{{range $i, $login := .UnsignedUsers}}{{if $i}},{{end}} @{{$login}}{{end}} to [sign the Contributor License Agreement]({{.SignURL}}){{end}}" + defaultSkippedCommits,
+		CommentCommitProblems: defaultCommentCommitProblems,
+		CommentTrivialChange:  "Thanks for the contribution. This PR does not need a signed Contributor License Agreement: {{.Reason}}.",
+
+		StatusPending:            "Paul Botsco, the CLA verifier is running",
+		StatusSigned:             "All contributors have signed the CLA{{if .SkippedCommits}}, {{len .SkippedCommits}} commit(s) by automation skipped{{end}}",
+		StatusUnsigned:           "One or more contributors need to sign the CLA",
+		StatusCommitProblems:     "One or more commits haven't met our Quality requirements.",
+		StatusDraft:              "Waiting for the PR to be ready for review",
+		StatusOverridden:         "CLA overridden by @{{.Actor}}",
+		StatusTrivialChange:      "CLA not required: {{.Reason}}",
+		StatusNotEnforced:        "CLA not required: {{.Reason}}",
+		StatusErrorRetry:         "The CLA check failed unexpectedly, it will be retried automatically",
+		StatusErrorGaveUp:        "The CLA check failed unexpectedly, please push a new commit to try again",
+		StatusMergeGroupSigned:   "All contributors have signed the CLA",
+		StatusMergeGroupUnsigned: "The CLA check failed for PR {{range $i, $number := .PullRequests}}{{if $i}}, {{end}}#{{$number}}{{end}}",
+		StatusMergeGroupError:    "Could not check the CLA for PR {{range $i, $number := .PullRequests}}{{if $i}}, {{end}}#{{$number}}{{end}}",
+		StatusMergeGroupNoPRs:    "Could not find the PRs in this merge group",
+
+		LabelSigned:              Label{Name: ":heart_eyes: cla signed", Color: "66CC00", Description: "The CLA is signed"},
+		LabelUnsigned:            Label{Name: ":monocle_face: cla not signed", Color: "ff3333", Description: "The CLA needs to be signed"},
+		LabelMissingAuthor:       Label{Name: ":unamused: commits missing author", Color: "B60205", Description: "Commits are missing author information - this must be resolved"},
+		LabelMissingVerification: Label{Name: ":anguished: commits missing verification", Color: "B60205", Description: "Some commits are not signed - this must be resolved"},
+
+		SignedCommitsURL: "https://docs.github.com/en/authentication/managing-commit-signature-verification/signing-commits",
+	}
+}
+
+// Messages are the messages used for all evaluations, unless a repository has its own, see RepoMessagesPath.
+var Messages = mustCompile(DefaultMessages())
+
+func mustCompile(m *MessageTemplates) *MessageTemplates {
+	if err := m.Compile(); err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (m *MessageTemplates) templates() map[string]string {
+	return map[string]string{
+		"commentSignCla":           m.CommentSignCLA,
+		"commentCommitProblems":    m.CommentCommitProblems,
+		"commentTrivialChange":     m.CommentTrivialChange,
+		"statusPending":            m.StatusPending,
+		"statusSigned":             m.StatusSigned,
+		"statusUnsigned":           m.StatusUnsigned,
+		"statusCommitProblems":     m.StatusCommitProblems,
+		"statusDraft":              m.StatusDraft,
+		"statusOverridden":         m.StatusOverridden,
+		"statusTrivialChange":      m.StatusTrivialChange,
+		"statusNotEnforced":        m.StatusNotEnforced,
+		"statusErrorRetry":         m.StatusErrorRetry,
+		"statusErrorGaveUp":        m.StatusErrorGaveUp,
+		"statusMergeGroupSigned":   m.StatusMergeGroupSigned,
+		"statusMergeGroupUnsigned": m.StatusMergeGroupUnsigned,
+		"statusMergeGroupError":    m.StatusMergeGroupError,
+		"statusMergeGroupNoPRs":    m.StatusMergeGroupNoPRs,
+	}
+}
+
+// sampleMessageData fills every field, so validating a template catches references to fields that don't exist
+var sampleMessageData = MessageData{
+	RepoOwner:                  "owner",
+	RepoName:                   "repo",
+	PRNumber:                   1,
+	UnsignedUsers:              []string{"someone"},
+	CommitsMissingAuthor:       []MessageCommit{{SHA: "sha", URL: "https://github.com"}},
+	CommitsMissingVerification: []MessageCommit{{SHA: "sha", URL: "https://github.com"}},
+	SkippedCommits:             []MessageCommit{{SHA: "sha", URL: "https://github.com", Reason: "bot account"}},
+	SignURL:                    "https://cla.example.com",
+	SignURLs:                   map[string]string{"someone": "https://cla.example.com?sign=token"},
+	CLAVersion:                 "1",
+	SignedCommitsURL:           "https://docs.example.com",
+	Reason:                     "reason",
+	Actor:                      "maintainer",
+	PullRequests:               []int64{1, 2},
+}
+
+// Compile parses the templates, and checks they can be executed.
+func (m *MessageTemplates) Compile() error {
+	parsed := make(map[string]*template.Template)
+	for name, text := range m.templates() {
+		tmpl, err := template.New(name).Parse(text)
+		if err != nil {
+			return fmt.Errorf("invalid %s template: %w", name, err)
+		}
+		if err = tmpl.Execute(io.Discard, sampleMessageData); err != nil {
+			return fmt.Errorf("invalid %s template: %w", name, err)
+		}
+		parsed[name] = tmpl
+	}
+	for name, label := range map[string]Label{
+		"labelSigned":              m.LabelSigned,
+		"labelUnsigned":            m.LabelUnsigned,
+		"labelMissingAuthor":       m.LabelMissingAuthor,
+		"labelMissingVerification": m.LabelMissingVerification,
+	} {
+		if label.Name == "" {
+			return fmt.Errorf("invalid %s: missing name", name)
+		}
+	}
+	m.parsed = parsed
+	return nil
+}
+
+// render executes the named template, e.g. "statusSigned".
+func (m *MessageTemplates) render(name string, data MessageData) (string, error) {
+	data.SignedCommitsURL = m.SignedCommitsURL
+	var text strings.Builder
+	if err := m.parsed[name].Execute(&text, data); err != nil {
+		return "", err
+	}
+	return text.String(), nil
+}
+
+// overlay returns a copy of the messages, with the ones in config replaced.
+func (m *MessageTemplates) overlay(config []byte) (*MessageTemplates, error) {
+	overlaid := *m
+	overlaid.parsed = nil
+	if err := json.Unmarshal(config, &overlaid); err != nil {
+		return nil, err
+	}
+	if err := overlaid.Compile(); err != nil {
+		return nil, err
+	}
+	return &overlaid, nil
+}
+
+// LoadMessages reads messages from a JSON file, falling back to the defaults for any it does not have.
+func LoadMessages(path string) (*MessageTemplates, error) {
+	config, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultMessages().overlay(config)
+}
+
+// RepoMessagesPath is where repositories can keep their own messages (e.g. ".github/the-cla.json"), on their
+// default branch, in the format of LoadMessages. Empty disables looking for them.
+var RepoMessagesPath string
+
+// repoMessagesTTL is how long we use the messages of a repository before looking for changes
+const repoMessagesTTL = 10 * time.Minute
+
+type repoMessagesEntry struct {
+	messages *MessageTemplates
+	loadedAt time.Time
+}
+
+// repoMessagesKey identifies a repository, whose ID is only unique on its GitHub instance
+type repoMessagesKey struct {
+	provider string
+	repoId   int64
+}
+
+// RepoMessageCache remembers the messages of each repository, so we don't look them up on every evaluation.
+type RepoMessageCache struct {
+	mu      sync.Mutex
+	entries map[repoMessagesKey]repoMessagesEntry
+}
+
+// RepoMessages is the cache used for all evaluations.
+var RepoMessages = &RepoMessageCache{entries: make(map[repoMessagesKey]repoMessagesEntry)}
+
+// Reset forgets the messages of all repositories.
+func (c *RepoMessageCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[repoMessagesKey]repoMessagesEntry)
+}
+
+// messagesFor returns the messages to use on the repository being evaluated. Repositories without (valid)
+// messages of their own use Messages, problems are logged.
+func messagesFor(logger *zap.Logger, repositoryService RepositoriesService, evalInfo *types.EvaluationInfo) *MessageTemplates {
+	if RepoMessagesPath == "" {
+		return Messages
+	}
+
+	now := time.Now()
+	key := repoMessagesKey{provider: vcs.ProviderOf(evalInfo), repoId: evalInfo.RepoId}
+	RepoMessages.mu.Lock()
+	cached, ok := RepoMessages.entries[key]
+	RepoMessages.mu.Unlock()
+	if ok && now.Sub(cached.loadedAt) < repoMessagesTTL {
+		return cached.messages
+	}
+
+	messages, err := loadRepoMessages(repositoryService, evalInfo)
+	if err != nil {
+		logger.Warn("failed to load repository messages, using the defaults",
+			zap.String("owner", evalInfo.RepoOwner),
+			zap.String("repo", evalInfo.RepoName),
+			zap.String("path", RepoMessagesPath),
+			zap.Error(err),
+		)
+		messages = Messages
+	}
+	RepoMessages.mu.Lock()
+	RepoMessages.entries[key] = repoMessagesEntry{messages: messages, loadedAt: now}
+	RepoMessages.mu.Unlock()
+	return messages
+}
+
+func loadRepoMessages(repositoryService RepositoriesService, evalInfo *types.EvaluationInfo) (*MessageTemplates, error) {
+	file, _, _, err := repositoryService.GetContents(context.Background(), evalInfo.RepoOwner, evalInfo.RepoName, RepoMessagesPath, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return Messages, nil
+		}
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s is not a file", RepoMessagesPath)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return Messages.overlay([]byte(content))
+}
+
+// messageCommits lists commits for MessageData.
+func messageCommits(commits []vcs.Commit) (listed []MessageCommit) {
+	for _, c := range commits {
+		listed = append(listed, MessageCommit{SHA: c.SHA, URL: c.URL})
+	}
+	return
+}
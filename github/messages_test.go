@@ -0,0 +1,180 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+const testCommentCommitProblemsPrefix = `Thanks for the contribution. Unfortunately some of your commits don't meet our standards. All commits must be signed and have author information set.
+
+The commits to review are:
+
+`
+
+func setupRepoMessages(t *testing.T, path string) {
+	origPath := RepoMessagesPath
+	RepoMessagesPath = path
+	RepoMessages.Reset()
+	t.Cleanup(func() {
+		RepoMessagesPath = origPath
+		RepoMessages.Reset()
+	})
+}
+
+func TestRenderCommentCommitProblems(t *testing.T) {
+	missing := []MessageCommit{{SHA: "sha", URL: "https://github.com"}}
+
+	comment, err := Messages.render("commentCommitProblems", MessageData{})
+	assert.NoError(t, err)
+	assert.Equal(t, testCommentCommitProblemsPrefix, comment)
+
+	comment, err = Messages.render("commentCommitProblems", MessageData{CommitsMissingAuthor: missing})
+	assert.NoError(t, err)
+	assert.Equal(t, testCommentCommitProblemsPrefix+"- <a href=\"https://github.com\">sha</a> - missing author :cop:\n", comment)
+
+	comment, err = Messages.render("commentCommitProblems", MessageData{CommitsMissingAuthor: missing, CommitsMissingVerification: missing})
+	assert.NoError(t, err)
+	assert.Equal(t, testCommentCommitProblemsPrefix+
+		"- <a href=\"https://github.com\">sha</a> - missing author :cop:\n- <a href=\"https://github.com\">sha</a> - unsigned commit :key:\n\n"+
+		"See [Signed Commits]("+Messages.SignedCommitsURL+").\n", comment)
+}
+
+func TestRenderCommentSignCLA(t *testing.T) {
+	comment, err := Messages.render("commentSignCla", MessageData{UnsignedUsers: []string{"alice", "bob"}, SignURL: "https://cla.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Thanks for the contribution. Before we can merge this, we need @alice, @bob to [sign the Contributor License Agreement](https://cla.example.com)", comment)
+}
+
+func TestRenderCommentSignCLALinks(t *testing.T) {
+	comment, err := Messages.render("commentSignCla", MessageData{
+		UnsignedUsers: []string{"alice", "bob"},
+		SignURL:       "https://cla.example.com",
+		SignURLs:      map[string]string{"alice": "https://cla.example.com?sign=a", "bob": "https://cla.example.com?sign=b"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Thanks for the contribution. Before we can merge this, we need"+
+		" @alice to [sign the Contributor License Agreement](https://cla.example.com?sign=a),"+
+		" @bob to [sign the Contributor License Agreement](https://cla.example.com?sign=b)", comment)
+}
+
+func TestRenderSkippedCommits(t *testing.T) {
+	data := MessageData{UnsignedUsers: []string{"alice"}, SignURL: "https://cla.example.com",
+		SkippedCommits: []MessageCommit{{SHA: "botSHA", URL: "https://github.com/c/botSHA", Reason: SkipReasonBotAccount}}}
+
+	comment, err := Messages.render("commentSignCla", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Thanks for the contribution. Before we can merge this, we need @alice to [sign the Contributor License Agreement](https://cla.example.com)"+
+		"\n\nThese commits were made by automation, and not checked:\n\n- <a href=\"https://github.com/c/botSHA\">botSHA</a> - bot account", comment)
+
+	description, err := Messages.render("statusSigned", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "All contributors have signed the CLA, 1 commit(s) by automation skipped", description)
+}
+
+func TestRenderStatusMergeGroupUnsigned(t *testing.T) {
+	description, err := Messages.render("statusMergeGroupUnsigned", MessageData{PullRequests: []int64{1, 2}})
+	assert.NoError(t, err)
+	assert.Equal(t, "The CLA check failed for PR #1, #2", description)
+}
+
+func TestCompileInvalid(t *testing.T) {
+	messages := DefaultMessages()
+	messages.StatusSigned = "{{.Missing"
+	assert.ErrorContains(t, messages.Compile(), "invalid statusSigned template")
+
+	// unknown fields are only found executing the template
+	messages = DefaultMessages()
+	messages.CommentSignCLA = "{{.Signers}}"
+	assert.ErrorContains(t, messages.Compile(), "invalid commentSignCla template")
+
+	messages = DefaultMessages()
+	messages.LabelSigned.Name = ""
+	assert.EqualError(t, messages.Compile(), "invalid labelSigned: missing name")
+}
+
+func TestLoadMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{
+		"statusSigned": "CLA signed for PR #{{.PRNumber}}",
+		"labelSigned": {"color": "000000"},
+		"signedCommitsUrl": "https://example.com/signing"
+	}`), 0600))
+
+	messages, err := LoadMessages(path)
+	assert.NoError(t, err)
+	description, err := messages.render("statusSigned", MessageData{PRNumber: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, "CLA signed for PR #5", description)
+	assert.Equal(t, Label{Name: ":heart_eyes: cla signed", Color: "000000", Description: "The CLA is signed"}, messages.LabelSigned)
+	assert.Equal(t, "https://example.com/signing", messages.SignedCommitsURL)
+	assert.Equal(t, DefaultMessages().StatusUnsigned, messages.StatusUnsigned)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"statusSigned": "{{if}}"}`), 0600))
+	_, err = LoadMessages(path)
+	assert.ErrorContains(t, err, "invalid statusSigned template")
+
+	_, err = LoadMessages(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestMessagesForDisabled(t *testing.T) {
+	setupRepoMessages(t, "")
+	repositoriesMock := &RepositoriesMock{}
+
+	assert.Same(t, Messages, messagesFor(zaptest.NewLogger(t), repositoriesMock, &types.EvaluationInfo{}))
+	assert.Equal(t, 0, repositoriesMock.getContentsCalls)
+}
+
+func TestMessagesForRepo(t *testing.T) {
+	setupRepoMessages(t, ".github/the-cla.json")
+	repositoriesMock := &RepositoriesMock{mockContents: &github.RepositoryContent{
+		Content: github.String(`{"statusSigned": "Signed, thanks!"}`),
+	}}
+	evalInfo := &types.EvaluationInfo{RepoId: 1}
+
+	for i := 0; i < 2; i++ {
+		messages := messagesFor(zaptest.NewLogger(t), repositoriesMock, evalInfo)
+		assert.Equal(t, "Signed, thanks!", messages.StatusSigned)
+		assert.Equal(t, Messages.StatusUnsigned, messages.StatusUnsigned)
+	}
+	assert.Equal(t, 1, repositoriesMock.getContentsCalls)
+}
+
+func TestMessagesForRepoFallback(t *testing.T) {
+	setupRepoMessages(t, ".github/the-cla.json")
+	logger := zaptest.NewLogger(t)
+
+	for _, repositoriesMock := range []*RepositoriesMock{
+		{mockContentsErr: &github.ErrorResponse{Response: notFoundResponse()}},
+		{mockContentsErr: fmt.Errorf("forced GetContents error")},
+		{mockContents: &github.RepositoryContent{Content: github.String(`{"statusSigned": "{{.Nope}}"}`)}},
+		{},
+	} {
+		RepoMessages.Reset()
+		assert.Same(t, Messages, messagesFor(logger, repositoriesMock, &types.EvaluationInfo{RepoId: 1}))
+	}
+}
@@ -0,0 +1,179 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	webhook "gopkg.in/go-playground/webhooks.v5/github"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// OverrideLabel lets maintainers accept a PR without a CLA (e.g. a typo fix) by applying it to the PR. Overrides
+// are disabled while it is empty.
+var OverrideLabel string
+
+// IsOverrideLabel tells if a label added to or removed from a PR is the override label.
+func IsOverrideLabel(labelName string) bool {
+	return OverrideLabel != "" && strings.EqualFold(labelName, OverrideLabel)
+}
+
+// hasWriteAccess tells if login may override the CLA check, which takes the same access as merging the PR.
+func hasWriteAccess(repositoryService RepositoriesService, owner, repo, login string) (bool, error) {
+	level, _, err := repositoryService.GetPermissionLevel(context.Background(), owner, repo, login)
+	if err != nil {
+		return false, err
+	}
+	// "maintain" is reported as "write"
+	permission := level.GetPermission()
+	return permission == "admin" || permission == "write", nil
+}
+
+// HandleOverrideLabel records the override label being added to or removed from a PR in the audit log, and
+// evaluates the PR again. An override applied by someone without write access, who is not an admin of the tenant
+// either, is rejected, and the label removed.
+func HandleOverrideLabel(logger *zap.Logger, postgres db.IClaDB, payload webhook.PullRequestPayload, host *Host, appId int64, claVersion string) (err error) {
+	evalInfo := types.EvaluationInfo{
+		Provider:  host.Provider(),
+		RepoId:    payload.Repository.ID,
+		RepoOwner: payload.Repository.Owner.Login,
+		RepoName:  payload.Repository.Name,
+		Sha:       payload.PullRequest.Head.Sha,
+		PRNumber:  payload.Number,
+		AppId:     appId,
+		InstallId: payload.Installation.ID,
+	}
+	event := types.AuditEvent{
+		Provider:  host.Provider(),
+		CreatedAt: time.Now(),
+		Actor:     payload.Sender.Login,
+		RepoId:    evalInfo.RepoId,
+		RepoOwner: evalInfo.RepoOwner,
+		RepoName:  evalInfo.RepoName,
+		PRNumber:  evalInfo.PRNumber,
+		Sha:       evalInfo.Sha,
+		Detail:    payload.Label.Name,
+	}
+
+	switch payload.Action {
+	case "labeled":
+		var client GHClient
+		if client, err = installationClient(&evalInfo); err != nil {
+			return
+		}
+		// admins of the tenant may override any of its PRs
+		canOverride := Tenants.IsAdmin(&evalInfo, event.Actor)
+		if !canOverride {
+			if canOverride, err = hasWriteAccess(client.Repositories, evalInfo.RepoOwner, evalInfo.RepoName, event.Actor); err != nil {
+				return
+			}
+		}
+		if !canOverride {
+			logger.Warn("override rejected, no write access",
+				zap.String("actor", event.Actor),
+				zap.String("owner", evalInfo.RepoOwner),
+				zap.String("repo", evalInfo.RepoName),
+				zap.Int64("pullRequestID", evalInfo.PRNumber),
+			)
+			event.Action = types.AuditActionOverrideRejected
+			if err = postgres.InsertAuditEvent(&event); err != nil {
+				return
+			}
+			_, err = client.Issues.RemoveLabelForIssue(context.Background(), evalInfo.RepoOwner, evalInfo.RepoName, int(evalInfo.PRNumber), payload.Label.Name)
+			return
+		}
+		event.Action = types.AuditActionOverrideApplied
+	case "unlabeled":
+		var ignored bool
+		if ignored, err = ignoreOverrideRemoval(&evalInfo, postgres, payload); err != nil || ignored {
+			return
+		}
+		event.Action = types.AuditActionOverrideRemoved
+	default:
+		return fmt.Errorf("unexpected override label action: %s", payload.Action)
+	}
+
+	logger.Info("CLA override changed",
+		zap.String("action", event.Action),
+		zap.String("actor", event.Actor),
+		zap.String("owner", evalInfo.RepoOwner),
+		zap.String("repo", evalInfo.RepoName),
+		zap.Int64("pullRequestID", evalInfo.PRNumber),
+	)
+	if err = postgres.InsertAuditEvent(&event); err != nil {
+		return
+	}
+	return EvaluatePullRequest(logger, postgres, &evalInfo, claVersion)
+}
+
+// ignoreOverrideRemoval tells if the override label was removed without an override to remove: by our app, rejecting
+// the override, or after an override that never took effect.
+func ignoreOverrideRemoval(evalInfo *types.EvaluationInfo, postgres db.IClaDB, payload webhook.PullRequestPayload) (bool, error) {
+	if payload.Sender.Type == "Bot" {
+		app, err := appsFor(evalInfo).Metadata(evalInfo.AppId, evalInfo.InstallId)
+		if err != nil {
+			return false, err
+		}
+		if payload.Sender.Login == app.Slug+"[bot]" {
+			return true, nil
+		}
+	}
+	override, err := postgres.GetPROverride(vcs.ProviderOf(evalInfo), evalInfo.RepoId, evalInfo.PRNumber)
+	return override == nil, err
+}
+
+// applyOverride reports success for a PR someone overrode the CLA check on, instead of evaluating its commits. An
+// override only accepts the commits it was applied to: once new commits are pushed, the label is removed, and the
+// commits are evaluated.
+func applyOverride(logger *zap.Logger, postgres db.IClaDB, client GHClient, evalInfo *types.EvaluationInfo, botName string) (overridden bool, err error) {
+	if OverrideLabel == "" {
+		return
+	}
+	override, err := postgres.GetPROverride(vcs.ProviderOf(evalInfo), evalInfo.RepoId, evalInfo.PRNumber)
+	if err != nil || override == nil {
+		return
+	}
+	if override.Sha != evalInfo.Sha {
+		logger.Info("CLA override outdated by new commits",
+			zap.String("actor", override.Actor),
+			zap.String("overriddenSha", override.Sha),
+			zap.String("sha", evalInfo.Sha),
+			zap.String("owner", evalInfo.RepoOwner),
+			zap.String("repo", evalInfo.RepoName),
+			zap.Int64("pullRequestID", evalInfo.PRNumber),
+		)
+		err = _removeLabelFromIssueIfApplied(logger, client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, override.Detail)
+		return
+	}
+	logger.Info("CLA check overridden",
+		zap.String("actor", override.Actor),
+		zap.Time("at", override.CreatedAt),
+		zap.String("owner", evalInfo.RepoOwner),
+		zap.String("repo", evalInfo.RepoName),
+		zap.Int64("pullRequestID", evalInfo.PRNumber),
+	)
+	data := messageData(evalInfo)
+	data.Actor = override.Actor
+	return true, reportMessageStatus(postgres, client.Repositories, messagesFor(logger, client.Repositories, evalInfo), evalInfo, "success", "statusOverridden", data, botName)
+}
@@ -0,0 +1,283 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+	webhook "gopkg.in/go-playground/webhooks.v5/github"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+const testOverrideLabel = "cla: override"
+
+func setupOverrideEnvironment(t *testing.T) {
+	origOverrideLabel := OverrideLabel
+	OverrideLabel = testOverrideLabel
+
+	resetPemFileImpl := SetupTestPemFile(t)
+	resetGHJWTImpl := SetupMockGHJWT()
+	origGithubImpl := GHImpl
+	t.Cleanup(func() {
+		OverrideLabel = origOverrideLabel
+		resetPemFileImpl()
+		resetGHJWTImpl()
+		GHImpl = origGithubImpl
+	})
+}
+
+func overrideLabelPayload(action, labelName, sender string) (payload webhook.PullRequestPayload) {
+	payload.Action = action
+	payload.Label.Name = labelName
+	payload.Sender.Login = sender
+	payload.PullRequest.Head.Sha = "headSha"
+	return
+}
+
+// setupOverrideStatusMock expects the "pending" status of sha, followed by the given final status
+func setupOverrideStatusMock(t *testing.T, sha, state, description string) *RepositoriesMock {
+	return setupMockRepositoriesService(t, []bool{false, true}, []any{
+		[]context.Context{nil, context.Background()}, // ctx
+		[]string{"", ""},   // owner
+		[]string{"", ""},   // repo
+		[]string{sha, sha}, // ref
+		[]*github.RepoStatus{
+			nil,
+			{
+				State:       github.String(state),
+				Description: github.String(description),
+				Context:     &MockAppSlug,
+			},
+		},
+	})
+}
+
+func TestIsOverrideLabel(t *testing.T) {
+	origOverrideLabel := OverrideLabel
+	defer func() {
+		OverrideLabel = origOverrideLabel
+	}()
+
+	OverrideLabel = ""
+	assert.False(t, IsOverrideLabel(""))
+
+	OverrideLabel = testOverrideLabel
+	assert.True(t, IsOverrideLabel("CLA: Override"))
+	assert.False(t, IsOverrideLabel("bug"))
+}
+
+func TestHasWriteAccess(t *testing.T) {
+	for permission, expected := range map[string]bool{"admin": true, "write": true, "read": false, "none": false} {
+		repositoriesMock := &RepositoriesMock{mockPermissionLevel: &github.RepositoryPermissionLevel{Permission: github.String(permission)}}
+		canWrite, err := hasWriteAccess(repositoriesMock, "myOwner", "myRepo", "myLogin")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, canWrite, permission)
+	}
+
+	forcedError := fmt.Errorf("forced GetPermissionLevel error")
+	_, err := hasWriteAccess(&RepositoriesMock{mockPermissionLevelErr: forcedError}, "myOwner", "myRepo", "myLogin")
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestHandleOverrideLabelApplied(t *testing.T) {
+	setupOverrideEnvironment(t)
+	repositoriesMock := setupOverrideStatusMock(t, "headSha", "success", "CLA overridden by @maintainer")
+	repositoriesMock.mockPermissionLevel = &github.RepositoryPermissionLevel{Permission: github.String("write")}
+	GHImpl = &GHInterfaceMock{RepositoriesMock: *repositoriesMock}
+
+	mockDB, logger := setupMockDB(t, false)
+	var auditEvents []types.AuditEvent
+	mockDB.insertAuditEvents = &auditEvents
+	mockDB.getPROverride = &types.AuditEvent{Actor: "maintainer", Action: types.AuditActionOverrideApplied, Sha: "headSha"}
+
+	assert.NoError(t, HandleOverrideLabel(logger, mockDB, overrideLabelPayload("labeled", testOverrideLabel, "maintainer"), nil, 0, ""))
+	assert.Equal(t, 1, len(auditEvents))
+	assert.Equal(t, types.AuditActionOverrideApplied, auditEvents[0].Action)
+	assert.Equal(t, "maintainer", auditEvents[0].Actor)
+	assert.Equal(t, testOverrideLabel, auditEvents[0].Detail)
+	assert.Equal(t, "headSha", auditEvents[0].Sha)
+}
+
+func TestHandleOverrideLabelRejected(t *testing.T) {
+	setupOverrideEnvironment(t)
+	GHImpl = &GHInterfaceMock{RepositoriesMock: RepositoriesMock{
+		mockPermissionLevel: &github.RepositoryPermissionLevel{Permission: github.String("read")},
+	}}
+
+	mockDB, logger := setupMockDB(t, false)
+	var auditEvents []types.AuditEvent
+	mockDB.insertAuditEvents = &auditEvents
+
+	assert.NoError(t, HandleOverrideLabel(logger, mockDB, overrideLabelPayload("labeled", testOverrideLabel, "drive-by"), nil, 0, ""))
+	assert.Equal(t, 1, len(auditEvents))
+	assert.Equal(t, types.AuditActionOverrideRejected, auditEvents[0].Action)
+	assert.Equal(t, "drive-by", auditEvents[0].Actor)
+	// no evaluation happened
+	assert.Equal(t, 0, GHImpl.(*GHInterfaceMock).RepositoriesMock.assertParamsCreateStatus.callIndex)
+}
+
+func TestHandleOverrideLabelTenantAdmin(t *testing.T) {
+	setupOverrideEnvironment(t)
+	keyFile := filepath.Join(t.TempDir(), "apache.pem")
+	WriteTestKeyFile(t, keyFile)
+	setupTestTenants(t, types.Tenant{Name: "apache", AppId: 7, KeyFile: keyFile, WebhookSecret: "apacheSecret", CLAVersion: "2",
+		CLATextUrl: "https://example.com/cla.txt", Admins: []string{"Legal"}})
+	repositoriesMock := setupOverrideStatusMock(t, "headSha", "success", "CLA overridden by @legal")
+	// not a maintainer of the repository
+	repositoriesMock.mockPermissionLevel = &github.RepositoryPermissionLevel{Permission: github.String("read")}
+	GHImpl = &GHInterfaceMock{RepositoriesMock: *repositoriesMock}
+
+	mockDB, logger := setupMockDB(t, false)
+	var auditEvents []types.AuditEvent
+	mockDB.insertAuditEvents = &auditEvents
+	mockDB.getPROverride = &types.AuditEvent{Actor: "legal", Action: types.AuditActionOverrideApplied, Sha: "headSha"}
+
+	assert.NoError(t, HandleOverrideLabel(logger, mockDB, overrideLabelPayload("labeled", testOverrideLabel, "legal"), nil, 7, "apache:2"))
+	assert.Equal(t, 1, len(auditEvents))
+	assert.Equal(t, types.AuditActionOverrideApplied, auditEvents[0].Action)
+	assert.Equal(t, "legal", auditEvents[0].Actor)
+}
+
+func TestHandleOverrideLabelPermissionError(t *testing.T) {
+	setupOverrideEnvironment(t)
+	forcedError := fmt.Errorf("forced GetPermissionLevel error")
+	GHImpl = &GHInterfaceMock{RepositoriesMock: RepositoriesMock{mockPermissionLevelErr: forcedError}}
+	mockDB, logger := setupMockDB(t, false)
+
+	err := HandleOverrideLabel(logger, mockDB, overrideLabelPayload("labeled", testOverrideLabel, "maintainer"), nil, 0, "")
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestHandleOverrideLabelRemoved(t *testing.T) {
+	setupOverrideEnvironment(t)
+	GHImpl = getGHMock(getMockRepositoryCommits([]string{"myAuthor"}, true), nil, &RepositoriesMock{isCollaboratorResult: true})
+
+	mockDB, logger := setupMockDB(t, false)
+	var auditEvents []types.AuditEvent
+	mockDB.insertAuditEvents = &auditEvents
+	mockDB.getPROverride = &types.AuditEvent{Actor: "maintainer", Action: types.AuditActionOverrideApplied, Sha: "headSha"}
+
+	assert.NoError(t, HandleOverrideLabel(logger, mockDB, overrideLabelPayload("unlabeled", testOverrideLabel, "maintainer"), nil, 0, ""))
+	assert.Equal(t, 1, len(auditEvents))
+	assert.Equal(t, types.AuditActionOverrideRemoved, auditEvents[0].Action)
+}
+
+func TestHandleOverrideLabelRemovedNeverApplied(t *testing.T) {
+	setupOverrideEnvironment(t)
+	// neither evaluates the PR again
+	GHImpl = &GHInterfaceMock{}
+
+	mockDB, logger := setupMockDB(t, false)
+	var auditEvents []types.AuditEvent
+	mockDB.insertAuditEvents = &auditEvents
+
+	assert.NoError(t, HandleOverrideLabel(logger, mockDB, overrideLabelPayload("unlabeled", testOverrideLabel, "maintainer"), nil, 0, ""))
+	assert.Empty(t, auditEvents)
+}
+
+func TestHandleOverrideLabelRemovedByUs(t *testing.T) {
+	setupOverrideEnvironment(t)
+	GHImpl = &GHInterfaceMock{}
+
+	mockDB, logger := setupMockDB(t, false)
+	var auditEvents []types.AuditEvent
+	mockDB.insertAuditEvents = &auditEvents
+	// an override of someone else, which we don't remove
+	mockDB.getPROverride = &types.AuditEvent{Actor: "maintainer", Action: types.AuditActionOverrideApplied, Sha: "headSha"}
+
+	payload := overrideLabelPayload("unlabeled", testOverrideLabel, MockAppSlug+"[bot]")
+	payload.Sender.Type = "Bot"
+	assert.NoError(t, HandleOverrideLabel(logger, mockDB, payload, nil, 0, ""))
+	assert.Empty(t, auditEvents)
+}
+
+func TestHandleOverrideLabelAuditError(t *testing.T) {
+	setupOverrideEnvironment(t)
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.getPROverride = &types.AuditEvent{Actor: "maintainer", Action: types.AuditActionOverrideApplied, Sha: "headSha"}
+	forcedError := fmt.Errorf("forced insert audit event error")
+	mockDB.insertAuditEventError = forcedError
+
+	err := HandleOverrideLabel(logger, mockDB, overrideLabelPayload("unlabeled", testOverrideLabel, "maintainer"), nil, 0, "")
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestHandleOverrideLabelUnexpectedAction(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+
+	err := HandleOverrideLabel(logger, mockDB, overrideLabelPayload("opened", testOverrideLabel, "maintainer"), nil, 0, "")
+	assert.EqualError(t, err, "unexpected override label action: opened")
+}
+
+func TestApplyOverrideDisabled(t *testing.T) {
+	origOverrideLabel := OverrideLabel
+	defer func() {
+		OverrideLabel = origOverrideLabel
+	}()
+	OverrideLabel = ""
+	mockDB, logger := setupMockDB(t, false)
+	// an override recorded while overrides were enabled no longer counts
+	mockDB.getPROverride = &types.AuditEvent{Actor: "maintainer", Action: types.AuditActionOverrideApplied, CreatedAt: time.Now()}
+
+	overridden, err := applyOverride(logger, mockDB, GHClient{Repositories: &RepositoriesMock{}}, &types.EvaluationInfo{}, MockAppSlug)
+	assert.NoError(t, err)
+	assert.False(t, overridden)
+}
+
+func TestApplyOverrideError(t *testing.T) {
+	origOverrideLabel := OverrideLabel
+	defer func() {
+		OverrideLabel = origOverrideLabel
+	}()
+	OverrideLabel = testOverrideLabel
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced get override error")
+	mockDB.getPROverrideError = forcedError
+
+	overridden, err := applyOverride(logger, mockDB, GHClient{Repositories: &RepositoriesMock{}}, &types.EvaluationInfo{}, MockAppSlug)
+	assert.EqualError(t, err, forcedError.Error())
+	assert.False(t, overridden)
+}
+
+func TestApplyOverrideOutdated(t *testing.T) {
+	origOverrideLabel := OverrideLabel
+	defer func() {
+		OverrideLabel = origOverrideLabel
+	}()
+	OverrideLabel = testOverrideLabel
+	mockDB, logger := setupMockDB(t, false)
+	mockDB.getPROverride = &types.AuditEvent{Actor: "maintainer", Action: types.AuditActionOverrideApplied, Sha: "typoFixSha", Detail: testOverrideLabel}
+	issuesMock := &IssuesMock{MockRemoveLabelResponse: &github.Response{Response: &http.Response{StatusCode: http.StatusOK}}}
+
+	// pushed after the override, so no status is reported for the override
+	overridden, err := applyOverride(logger, mockDB, GHClient{Repositories: &RepositoriesMock{}, Issues: issuesMock}, &types.EvaluationInfo{Sha: "newSha"}, MockAppSlug)
+	assert.NoError(t, err)
+	assert.False(t, overridden)
+
+	forcedError := fmt.Errorf("forced remove label error")
+	issuesMock.mockRemoveLabelError = forcedError
+	_, err = applyOverride(logger, mockDB, GHClient{Repositories: &RepositoriesMock{}, Issues: issuesMock}, &types.EvaluationInfo{Sha: "newSha"}, MockAppSlug)
+	assert.EqualError(t, err, forcedError.Error())
+}
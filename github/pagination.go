@@ -0,0 +1,83 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+
+	"github.com/google/go-github/v64/github"
+)
+
+// listPerPage is the largest page size GitHub allows for list calls
+const listPerPage = 100
+
+// maxPRCommitsListed is the most commits the PR commits endpoint will ever return, no matter how many pages
+// we ask for. Larger PRs need the compare API.
+// https://docs.github.com/en/rest/pulls/pulls#list-commits-on-a-pull-request
+const maxPRCommitsListed = 250
+
+// listAll calls list for every page of results, following the next page link GitHub returns.
+func listAll[T any](list func(opts github.ListOptions) ([]T, *github.Response, error)) (all []T, err error) {
+	opts := github.ListOptions{PerPage: listPerPage}
+	for {
+		var page []T
+		var resp *github.Response
+		if page, resp, err = list(opts); err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if resp == nil || resp.NextPage == 0 {
+			return
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listAllPRCommits returns every commit on a PR, using the compare API when the PR is too large for the
+// PR commits endpoint.
+func listAllPRCommits(ctx context.Context, client GHClient, owner, repo string, number int) (commits []*github.RepositoryCommit, err error) {
+	commits, err = listAll(func(opts github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+		return client.PullRequests.ListCommits(ctx, owner, repo, number, &opts)
+	})
+	if err != nil || len(commits) < maxPRCommitsListed {
+		return
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	return listAll(func(opts github.ListOptions) ([]*github.RepositoryCommit, *github.Response, error) {
+		comparison, resp, err := client.Repositories.CompareCommits(ctx, owner, repo, pr.GetBase().GetSHA(), pr.GetHead().GetSHA(), &opts)
+		if err != nil {
+			return nil, resp, err
+		}
+		return comparison.Commits, resp, nil
+	})
+}
+
+func listAllIssueComments(ctx context.Context, issuesService IssuesService, owner, repo string, number int) ([]*github.IssueComment, error) {
+	return listAll(func(opts github.ListOptions) ([]*github.IssueComment, *github.Response, error) {
+		return issuesService.ListComments(ctx, owner, repo, number, &github.IssueListCommentsOptions{ListOptions: opts})
+	})
+}
+
+func listAllLabelsByIssue(ctx context.Context, issuesService IssuesService, owner, repo string, number int) ([]*github.Label, error) {
+	return listAll(func(opts github.ListOptions) ([]*github.Label, *github.Response, error) {
+		return issuesService.ListLabelsByIssue(ctx, owner, repo, number, &opts)
+	})
+}
@@ -0,0 +1,147 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func getMockCommitPage(prefix string, count int) (commits []*github.RepositoryCommit) {
+	for i := 0; i < count; i++ {
+		commits = append(commits, &github.RepositoryCommit{SHA: github.String(fmt.Sprintf("%s%d", prefix, i))})
+	}
+	return
+}
+
+func TestListAllFollowsNextPage(t *testing.T) {
+	var requested []github.ListOptions
+	all, err := listAll(func(opts github.ListOptions) ([]int, *github.Response, error) {
+		requested = append(requested, opts)
+		if opts.Page == 0 {
+			return []int{1, 2}, &github.Response{NextPage: 2}, nil
+		}
+		return []int{3}, &github.Response{}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, all)
+	assert.Equal(t, []github.ListOptions{{PerPage: listPerPage}, {Page: 2, PerPage: listPerPage}}, requested)
+}
+
+func TestListAllError(t *testing.T) {
+	forcedError := fmt.Errorf("forced list error")
+	all, err := listAll(func(opts github.ListOptions) ([]int, *github.Response, error) {
+		if opts.Page == 0 {
+			return []int{1, 2}, &github.Response{NextPage: 2}, nil
+		}
+		return nil, nil, forcedError
+	})
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, all)
+}
+
+func TestListAllPRCommitsMultiplePages(t *testing.T) {
+	client := GHClient{
+		PullRequests: &PullRequestsMock{
+			mockListCommitsPages:    [][]*github.RepositoryCommit{getMockCommitPage("a", listPerPage), getMockCommitPage("b", 30)},
+			mockGetPullRequestError: fmt.Errorf("should not look up the PR"),
+		},
+	}
+
+	commits, err := listAllPRCommits(context.Background(), client, "myOwner", "myRepo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, listPerPage+30, len(commits))
+}
+
+func TestListAllPRCommitsFallsBackToCompare(t *testing.T) {
+	compareCommits := getMockCommitPage("c", 300)
+	client := GHClient{
+		PullRequests: &PullRequestsMock{
+			mockListCommitsPages: [][]*github.RepositoryCommit{
+				getMockCommitPage("a", listPerPage),
+				getMockCommitPage("b", listPerPage),
+				getMockCommitPage("c", maxPRCommitsListed-2*listPerPage),
+			},
+			mockPullRequest: &github.PullRequest{
+				Base: &github.PullRequestBranch{SHA: github.String("baseSha")},
+				Head: &github.PullRequestBranch{SHA: github.String("headSha")},
+			},
+		},
+		Repositories: &RepositoriesMock{
+			compareCommits: []*github.CommitsComparison{
+				{Commits: compareCommits[:250]},
+				{Commits: compareCommits[250:]},
+			},
+			compareCommitsResp: []*github.Response{{NextPage: 2}, {}},
+		},
+	}
+
+	commits, err := listAllPRCommits(context.Background(), client, "myOwner", "myRepo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, compareCommits, commits)
+}
+
+func TestListAllPRCommitsGetPullRequestError(t *testing.T) {
+	forcedError := fmt.Errorf("forced get PR error")
+	client := GHClient{
+		PullRequests: &PullRequestsMock{
+			mockListCommitsPages:    [][]*github.RepositoryCommit{getMockCommitPage("a", maxPRCommitsListed)},
+			mockGetPullRequestError: forcedError,
+		},
+	}
+
+	commits, err := listAllPRCommits(context.Background(), client, "myOwner", "myRepo", 1)
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, commits)
+}
+
+func TestListAllPRCommitsCompareError(t *testing.T) {
+	forcedError := fmt.Errorf("forced compare error")
+	client := GHClient{
+		PullRequests: &PullRequestsMock{
+			mockListCommitsPages: [][]*github.RepositoryCommit{getMockCommitPage("a", maxPRCommitsListed)},
+			mockPullRequest:      &github.PullRequest{},
+		},
+		Repositories: &RepositoriesMock{compareCommitsErr: forcedError},
+	}
+
+	commits, err := listAllPRCommits(context.Background(), client, "myOwner", "myRepo", 1)
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, commits)
+}
+
+func TestListAllIssueComments(t *testing.T) {
+	comments := []*github.IssueComment{{Body: github.String("myComment")}}
+	issuesMock := &IssuesMock{mockListComments: comments}
+
+	allComments, err := listAllIssueComments(context.Background(), issuesMock, "myOwner", "myRepo", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, comments, allComments)
+}
+
+func TestListAllLabelsByIssueError(t *testing.T) {
+	forcedError := fmt.Errorf("forced list labels error")
+	issuesMock := &IssuesMock{mockListLabelsByIssueError: forcedError}
+
+	labels, err := listAllLabelsByIssue(context.Background(), issuesMock, "myOwner", "myRepo", 1)
+	assert.EqualError(t, err, forcedError.Error())
+	assert.Nil(t, labels)
+}
@@ -0,0 +1,96 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+
+	"github.com/google/go-github/v64/github"
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// githubProvider is the vcs.Provider for GitHub pull requests, talking to GitHub as an installation of our app.
+type githubProvider struct {
+	// name is vcs.ProviderGitHub, or the name of the Host of the PR
+	name     string
+	logger   *zap.Logger
+	postgres db.IClaDB
+	client   GHClient
+	// botName is the context of our commit statuses
+	botName string
+}
+
+var _ vcs.Provider = (*githubProvider)(nil)
+
+func (p *githubProvider) Name() string {
+	return p.name
+}
+
+func (p *githubProvider) ListCommits(ctx context.Context, evalInfo *types.EvaluationInfo) (commits []vcs.Commit, err error) {
+	prCommits, err := listAllPRCommits(ctx, p.client, evalInfo.RepoOwner, evalInfo.RepoName, int(evalInfo.PRNumber))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range prCommits {
+		commits = append(commits, commitOf(c))
+	}
+	return
+}
+
+// commitOf maps a commit of a PR. It is important to use the author instead of the committer, because the
+// committer can be the GH webflow user, whereas the author is the canonical author of the commit.
+func commitOf(c *github.RepositoryCommit) vcs.Commit {
+	author := c.GetAuthor()
+	return vcs.Commit{
+		SHA:         c.GetSHA(),
+		URL:         c.GetHTMLURL(),
+		AuthorLogin: author.GetLogin(),
+		AuthorEmail: c.GetCommit().GetAuthor().GetEmail(),
+		AuthorName:  c.GetCommit().GetAuthor().GetName(),
+		AuthorBot:   author.GetType() == "Bot",
+		Verified:    c.GetCommit().GetVerification().GetVerified(),
+	}
+}
+
+func (p *githubProvider) SetStatus(_ context.Context, evalInfo *types.EvaluationInfo, state, description string) error {
+	return createRepoStatus(p.client.Repositories, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.Sha, state, description, p.botName)
+}
+
+func (p *githubProvider) AddLabel(_ context.Context, evalInfo *types.EvaluationInfo, name, color, description string) error {
+	return createRepoLabel(p.logger, p.client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, name, color, description, evalInfo.PRNumber)
+}
+
+func (p *githubProvider) RemoveLabel(_ context.Context, evalInfo *types.EvaluationInfo, name string) error {
+	return _removeLabelFromIssueIfApplied(p.logger, p.client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber, name)
+}
+
+func (p *githubProvider) Comment(_ context.Context, evalInfo *types.EvaluationInfo, body string) error {
+	_, err := addCommentToIssueIfNotExists(p.client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, int(evalInfo.PRNumber), body)
+	return err
+}
+
+func (p *githubProvider) MembershipReason(_ context.Context, evalInfo *types.EvaluationInfo, login string) (string, error) {
+	return Exemptions.exemptionReason(p.logger, p.postgres, p.client, evalInfo, login)
+}
+
+func (p *githubProvider) ChangeURL(evalInfo *types.EvaluationInfo) string {
+	return pullRequestURL(p.name, evalInfo.RepoOwner, evalInfo.RepoName, evalInfo.PRNumber)
+}
@@ -0,0 +1,291 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+)
+
+const headerRateLimit = "X-RateLimit-Limit"
+const headerRateRemaining = "X-RateLimit-Remaining"
+const headerRateReset = "X-RateLimit-Reset"
+const headerRetryAfter = "Retry-After"
+
+// maxSecondaryLimitRetries is how many times a request is retried after hitting a secondary rate limit
+const maxSecondaryLimitRetries = 3
+
+// secondaryLimitBackoff is the first wait after a secondary rate limit without a Retry-After header, doubled on
+// each retry
+const secondaryLimitBackoff = time.Second
+
+// maxSecondaryLimitWait is the longest we will block a request waiting out a secondary rate limit. Anything
+// longer is returned to the caller, so the evaluation can be deferred instead.
+const maxSecondaryLimitWait = time.Minute
+
+// defaultDeferral is used when GitHub does not tell us when to come back
+const defaultDeferral = time.Minute
+
+// RateLimitStatus is what we know about the GitHub API quota of one installation.
+type RateLimitStatus struct {
+	// Host is the GitHub Enterprise Server instance of the installation, empty for github.com
+	Host               string    `json:"host,omitempty"`
+	InstallID          int64     `json:"installId"`
+	Limit              int       `json:"limit"`
+	Remaining          int       `json:"remaining"`
+	Reset              time.Time `json:"reset"`
+	SecondaryLimitHits int       `json:"secondaryLimitHits"`
+	Retries            int       `json:"retries"`
+	// Refused counts requests we did not send, because the quota was already used up
+	Refused  int `json:"refused"`
+	Deferred int `json:"deferred"`
+}
+
+// RateLimitTracker keeps the latest rate limit status per installation, shared by all clients.
+type RateLimitTracker struct {
+	mu sync.Mutex
+	// host is the GitHub Enterprise Server instance of the installations, see Host
+	host     string
+	statuses map[int64]*RateLimitStatus
+}
+
+func NewRateLimitTracker() *RateLimitTracker {
+	return &RateLimitTracker{statuses: make(map[int64]*RateLimitStatus)}
+}
+
+// RateLimits tracks quota for every github.com client created by GHCreator.NewClient, each Host has its own.
+var RateLimits = NewRateLimitTracker()
+
+// status must be called with the lock held
+func (r *RateLimitTracker) status(installID int64) *RateLimitStatus {
+	status, ok := r.statuses[installID]
+	if !ok {
+		status = &RateLimitStatus{Host: r.host, InstallID: installID}
+		r.statuses[installID] = status
+	}
+	return status
+}
+
+func (r *RateLimitTracker) update(installID int64, header http.Header) {
+	limit, errLimit := strconv.Atoi(header.Get(headerRateLimit))
+	remaining, errRemaining := strconv.Atoi(header.Get(headerRateRemaining))
+	reset, errReset := strconv.ParseInt(header.Get(headerRateReset), 10, 64)
+	if errLimit != nil || errRemaining != nil || errReset != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.status(installID)
+	status.Limit = limit
+	status.Remaining = remaining
+	status.Reset = time.Unix(reset, 0)
+}
+
+// exhaustedUntil returns when the quota resets, if the installation has no requests left right now.
+func (r *RateLimitTracker) exhaustedUntil(installID int64, now time.Time) (reset time.Time, exhausted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status, ok := r.statuses[installID]
+	if !ok || status.Limit == 0 || status.Remaining > 0 || !now.Before(status.Reset) {
+		return
+	}
+	status.Refused++
+	return status.Reset, true
+}
+
+func (r *RateLimitTracker) recordSecondaryLimit(installID int64, retried bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := r.status(installID)
+	status.SecondaryLimitHits++
+	if retried {
+		status.Retries++
+	}
+}
+
+func (r *RateLimitTracker) recordDeferred(installID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status(installID).Deferred++
+}
+
+// Snapshot returns a copy of the status of every installation we have talked to, ordered by installation.
+func (r *RateLimitTracker) Snapshot() (statuses []RateLimitStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses = make([]RateLimitStatus, 0, len(r.statuses))
+	for _, status := range r.statuses {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].InstallID < statuses[j].InstallID
+	})
+	return
+}
+
+// QuotaExhaustedError is returned instead of sending a request we already know GitHub would refuse.
+type QuotaExhaustedError struct {
+	InstallID int64
+	Reset     time.Time
+}
+
+func (e *QuotaExhaustedError) Error() string {
+	return fmt.Sprintf("GitHub API quota exhausted for installation %d until %s", e.InstallID, e.Reset.Format(time.RFC3339))
+}
+
+// rateLimitTransport watches the rate limit headers of every response, refuses requests while the quota is
+// used up, and waits out short secondary rate limits.
+type rateLimitTransport struct {
+	base      http.RoundTripper
+	installID int64
+	tracker   *RateLimitTracker
+	now       func() time.Time
+	// sleep waits for the given duration, or returns early with an error if the request is cancelled
+	sleep func(req *http.Request, d time.Duration) error
+}
+
+// installationIDer is implemented by ghinstallation.Transport
+type installationIDer interface {
+	InstallationID() int64
+}
+
+func newRateLimitTransport(base http.RoundTripper, tracker *RateLimitTracker) *rateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	var installID int64
+	if itr, ok := base.(installationIDer); ok {
+		installID = itr.InstallationID()
+	}
+	return &rateLimitTransport{
+		base:      base,
+		installID: installID,
+		tracker:   tracker,
+		now:       time.Now,
+		sleep:     sleepForRequest,
+	}
+}
+
+func sleepForRequest(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if reset, exhausted := t.tracker.exhaustedUntil(t.installID, t.now()); exhausted {
+		return nil, &QuotaExhaustedError{InstallID: t.installID, Reset: reset}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if resp, err = t.base.RoundTrip(req); err != nil {
+			return
+		}
+		t.tracker.update(t.installID, resp.Header)
+
+		wait, secondary := t.secondaryLimitWait(resp, attempt)
+		if !secondary {
+			return
+		}
+		retry := attempt < maxSecondaryLimitRetries && wait <= maxSecondaryLimitWait && canReplay(req)
+		t.tracker.recordSecondaryLimit(t.installID, retry)
+		if !retry {
+			return
+		}
+		_ = resp.Body.Close()
+		if err = t.sleep(req, wait); err != nil {
+			return nil, err
+		}
+		if req, err = replay(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// secondaryLimitWait tells if the response is a secondary rate limit, and how long to wait before retrying.
+// A primary rate limit (no requests remaining) is not retried here, it is left for the caller to defer.
+func (t *rateLimitTransport) secondaryLimitWait(resp *http.Response, attempt int) (wait time.Duration, secondary bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	if retryAfter, err := strconv.Atoi(resp.Header.Get(headerRetryAfter)); err == nil {
+		return time.Duration(retryAfter) * time.Second, true
+	}
+	if resp.Header.Get(headerRateRemaining) == "0" {
+		return
+	}
+
+	// the body tells us about secondary limits without a Retry-After header, so read it and put it back
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || !strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+		return
+	}
+	return secondaryLimitBackoff << attempt, true
+}
+
+func canReplay(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func replay(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
+
+// rateLimitedUntil tells if err means GitHub (or our own tracking) refused a request due to rate limits, and
+// when it makes sense to try again.
+func rateLimitedUntil(err error, now time.Time) (retryAt time.Time, limited bool) {
+	var quotaErr *QuotaExhaustedError
+	var rateErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	switch {
+	case errors.As(err, &quotaErr):
+		return quotaErr.Reset, true
+	case errors.As(err, &rateErr):
+		return rateErr.Rate.Reset.Time, true
+	case errors.As(err, &abuseErr):
+		if abuseErr.RetryAfter != nil {
+			return now.Add(*abuseErr.RetryAfter), true
+		}
+		return now.Add(defaultDeferral), true
+	}
+	return
+}
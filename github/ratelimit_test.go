@@ -0,0 +1,279 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+// roundTripperMock returns the given responses in order, and counts the requests it sees
+type roundTripperMock struct {
+	responses []*http.Response
+	requests  []*http.Request
+}
+
+func (r *roundTripperMock) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.requests = append(r.requests, req)
+	return r.responses[len(r.requests)-1], nil
+}
+
+func (r *roundTripperMock) InstallationID() int64 {
+	return 42
+}
+
+func mockResponse(statusCode int, headers map[string]string, body string) *http.Response {
+	resp := &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	for k, v := range headers {
+		resp.Header.Set(k, v)
+	}
+	return resp
+}
+
+func rateHeaders(limit, remaining int, reset time.Time) map[string]string {
+	return map[string]string{
+		headerRateLimit:     strconv.Itoa(limit),
+		headerRateRemaining: strconv.Itoa(remaining),
+		headerRateReset:     strconv.FormatInt(reset.Unix(), 10),
+	}
+}
+
+func setupRateLimitTransport(responses ...*http.Response) (transport *rateLimitTransport, base *roundTripperMock, waits *[]time.Duration) {
+	base = &roundTripperMock{responses: responses}
+	transport = newRateLimitTransport(base, NewRateLimitTracker())
+	waits = &[]time.Duration{}
+	transport.sleep = func(req *http.Request, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+	return
+}
+
+func TestNewRateLimitTransportUsesInstallationID(t *testing.T) {
+	transport, _, _ := setupRateLimitTransport()
+	assert.Equal(t, int64(42), transport.installID)
+
+	assert.Equal(t, int64(0), newRateLimitTransport(nil, NewRateLimitTracker()).installID)
+}
+
+func TestRateLimitTransportTracksQuota(t *testing.T) {
+	reset := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	transport, _, _ := setupRateLimitTransport(mockResponse(http.StatusOK, rateHeaders(5000, 4999, reset), ""))
+
+	resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []RateLimitStatus{{InstallID: 42, Limit: 5000, Remaining: 4999, Reset: reset}}, transport.tracker.Snapshot())
+}
+
+func TestRateLimitTransportRefusesWhenExhausted(t *testing.T) {
+	reset := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	transport, base, _ := setupRateLimitTransport(mockResponse(http.StatusOK, rateHeaders(5000, 0, reset), ""))
+
+	_, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+
+	resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Nil(t, resp)
+	assert.Equal(t, &QuotaExhaustedError{InstallID: 42, Reset: reset}, err)
+	assert.Equal(t, 1, len(base.requests))
+	assert.Equal(t, 1, transport.tracker.Snapshot()[0].Refused)
+}
+
+func TestRateLimitTransportSendsAfterReset(t *testing.T) {
+	reset := time.Now().Add(-time.Minute)
+	transport, base, _ := setupRateLimitTransport(
+		mockResponse(http.StatusOK, rateHeaders(5000, 0, reset), ""),
+		mockResponse(http.StatusOK, rateHeaders(5000, 4999, time.Now().Add(time.Hour)), ""),
+	)
+
+	_, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	_, err = transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(base.requests))
+}
+
+func TestRateLimitTransportRetriesSecondaryLimitRetryAfter(t *testing.T) {
+	transport, base, waits := setupRateLimitTransport(
+		mockResponse(http.StatusForbidden, map[string]string{headerRetryAfter: "3"}, ""),
+		mockResponse(http.StatusOK, nil, ""),
+	)
+
+	// unlike httptest.NewRequest, http.NewRequest lets the body be read again
+	req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader("myBody"))
+	assert.NoError(t, err)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []time.Duration{3 * time.Second}, *waits)
+
+	assert.Equal(t, 2, len(base.requests))
+	body, err := io.ReadAll(base.requests[1].Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "myBody", string(body))
+
+	status := transport.tracker.Snapshot()[0]
+	assert.Equal(t, 1, status.SecondaryLimitHits)
+	assert.Equal(t, 1, status.Retries)
+}
+
+func TestRateLimitTransportRetriesSecondaryLimitWithBackoff(t *testing.T) {
+	secondaryLimitBody := `{"message": "You have exceeded a secondary rate limit."}`
+	transport, base, waits := setupRateLimitTransport(
+		mockResponse(http.StatusForbidden, nil, secondaryLimitBody),
+		mockResponse(http.StatusForbidden, nil, secondaryLimitBody),
+		mockResponse(http.StatusForbidden, nil, secondaryLimitBody),
+		mockResponse(http.StatusForbidden, nil, secondaryLimitBody),
+	)
+
+	resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, []time.Duration{secondaryLimitBackoff, 2 * secondaryLimitBackoff, 4 * secondaryLimitBackoff}, *waits)
+	assert.Equal(t, maxSecondaryLimitRetries+1, len(base.requests))
+
+	// the caller still gets to read the body of the final response
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, secondaryLimitBody, string(body))
+
+	status := transport.tracker.Snapshot()[0]
+	assert.Equal(t, maxSecondaryLimitRetries+1, status.SecondaryLimitHits)
+	assert.Equal(t, maxSecondaryLimitRetries, status.Retries)
+}
+
+func TestRateLimitTransportDoesNotRetryPrimaryLimit(t *testing.T) {
+	transport, base, waits := setupRateLimitTransport(
+		mockResponse(http.StatusForbidden, rateHeaders(5000, 0, time.Now().Add(time.Hour)), `{"message": "API rate limit exceeded"}`),
+	)
+
+	resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Empty(t, *waits)
+	assert.Equal(t, 1, len(base.requests))
+}
+
+func TestRateLimitTransportDoesNotWaitTooLong(t *testing.T) {
+	transport, base, waits := setupRateLimitTransport(
+		mockResponse(http.StatusTooManyRequests, map[string]string{headerRetryAfter: "3600"}, ""),
+	)
+
+	resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Empty(t, *waits)
+	assert.Equal(t, 1, len(base.requests))
+	assert.Equal(t, 0, transport.tracker.Snapshot()[0].Retries)
+}
+
+func TestRateLimitTransportDoesNotRetryUnreplayableBody(t *testing.T) {
+	transport, base, waits := setupRateLimitTransport(
+		mockResponse(http.StatusForbidden, map[string]string{headerRetryAfter: "1"}, ""),
+	)
+
+	_, err := transport.RoundTrip(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("myBody")))
+	assert.NoError(t, err)
+	assert.Empty(t, *waits)
+	assert.Equal(t, 1, len(base.requests))
+}
+
+func TestRateLimitTransportSleepCancelled(t *testing.T) {
+	forcedError := fmt.Errorf("forced sleep error")
+	transport, _, _ := setupRateLimitTransport(
+		mockResponse(http.StatusForbidden, map[string]string{headerRetryAfter: "1"}, ""),
+	)
+	transport.sleep = func(req *http.Request, d time.Duration) error {
+		return forcedError
+	}
+
+	resp, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Nil(t, resp)
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestRateLimitedUntil(t *testing.T) {
+	now := time.Now()
+	reset := now.Add(time.Hour)
+	retryAfter := 5 * time.Minute
+
+	retryAt, limited := rateLimitedUntil(&QuotaExhaustedError{Reset: reset}, now)
+	assert.True(t, limited)
+	assert.Equal(t, reset, retryAt)
+
+	retryAt, limited = rateLimitedUntil(fmt.Errorf("wrapped: %w", &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: reset}}}), now)
+	assert.True(t, limited)
+	assert.Equal(t, reset, retryAt)
+
+	retryAt, limited = rateLimitedUntil(&github.AbuseRateLimitError{RetryAfter: &retryAfter}, now)
+	assert.True(t, limited)
+	assert.Equal(t, now.Add(retryAfter), retryAt)
+
+	retryAt, limited = rateLimitedUntil(&github.AbuseRateLimitError{}, now)
+	assert.True(t, limited)
+	assert.Equal(t, now.Add(defaultDeferral), retryAt)
+
+	_, limited = rateLimitedUntil(fmt.Errorf("some other error"), now)
+	assert.False(t, limited)
+}
+
+func TestDeferEvaluation(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	evalInfo := &types.EvaluationInfo{InstallId: -77}
+
+	assert.NoError(t, deferEvaluation(logger, mockDB, evalInfo, time.Now().Add(time.Hour), fmt.Errorf("rate limited")))
+
+	var deferred int
+	for _, status := range RateLimits.Snapshot() {
+		if status.InstallID == evalInfo.InstallId {
+			deferred = status.Deferred
+		}
+	}
+	assert.Equal(t, 1, deferred)
+}
+
+func TestDeferEvaluationStoreError(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced store PR status error")
+	mockDB.storePRStatusError = forcedError
+
+	assert.EqualError(t, deferEvaluation(logger, mockDB, &types.EvaluationInfo{}, time.Now(), fmt.Errorf("rate limited")), forcedError.Error())
+}
+
+func TestDeferEvaluationScheduleError(t *testing.T) {
+	mockDB, logger := setupMockDB(t, false)
+	forcedError := fmt.Errorf("forced schedule retry error")
+	mockDB.schedulePRRetryError = forcedError
+
+	assert.EqualError(t, deferEvaluation(logger, mockDB, &types.EvaluationInfo{}, time.Now(), fmt.Errorf("rate limited")), forcedError.Error())
+}
@@ -0,0 +1,297 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+)
+
+// appMetadataTTL is how long we trust cached app metadata before asking GitHub again
+const appMetadataTTL = time.Hour
+
+// AppMetadata is what we need to know about our GitHub App itself. It rarely changes.
+type AppMetadata struct {
+	Slug        string
+	ExternalURL string
+}
+
+type cachedAppMetadata struct {
+	metadata  AppMetadata
+	fetchedAt time.Time
+}
+
+type installationKey struct {
+	appId     int64
+	installId int64
+}
+
+// AppRegistry keeps long-lived GitHub App transports and metadata, so an evaluation does not re-read the private
+// key, mint a new installation token, or look up the app on every webhook. Installation tokens are refreshed by
+// ghinstallation when they expire, and app metadata is fetched again after appMetadataTTL.
+type AppRegistry struct {
+	mu      sync.Mutex
+	keyFile string
+	// privateKey is the PEM content of the keys of the apps without their own, used rather than keyFile when set, see
+	// SetPrivateKey
+	privateKey       string
+	privateKeySource string
+	// appKeyFiles are the private keys of apps not using keyFile, i.e. those of tenants, see SetAppKeyFile
+	appKeyFiles map[int64]string
+	// host is the GitHub Enterprise Server instance of the app, nil for github.com
+	host *Host
+	now  func() time.Time
+	// rings are the private keys of the apps, by key file setting
+	rings             map[string]*keyRing
+	appTransports     map[int64]*ghinstallation.AppsTransport
+	installTransports map[installationKey]*ghinstallation.Transport
+	metadata          map[int64]*cachedAppMetadata
+}
+
+func NewAppRegistry(keyFile string) *AppRegistry {
+	registry := &AppRegistry{keyFile: keyFile, appKeyFiles: make(map[int64]string), now: time.Now}
+	registry.Reset()
+	return registry
+}
+
+// Apps is the registry used for all evaluations.
+var Apps = NewAppRegistry(FilenameTheClaPem)
+
+// Reset forgets all cached keys, transports and metadata, e.g. after a private key file changed.
+func (r *AppRegistry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rings = make(map[string]*keyRing)
+	r.appTransports = make(map[int64]*ghinstallation.AppsTransport)
+	r.installTransports = make(map[installationKey]*ghinstallation.Transport)
+	r.metadata = make(map[int64]*cachedAppMetadata)
+}
+
+// appsTransport must be called with the lock held
+func (r *AppRegistry) appsTransport(appId int64) (atr *ghinstallation.AppsTransport, err error) {
+	if atr = r.appTransports[appId]; atr != nil {
+		return
+	}
+	ring, err := r.keyRing(appId)
+	if err != nil {
+		return
+	}
+	if atr, err = ghinstallation.NewAppsTransportWithOptions(http.DefaultTransport, appId, ghinstallation.WithSigner(ring)); err != nil {
+		return nil, err
+	}
+	if r.host != nil {
+		// installation transports inherit it, to get their tokens from the same instance
+		atr.BaseURL = strings.TrimSuffix(r.host.APIURL, "/")
+	}
+	r.appTransports[appId] = atr
+	return
+}
+
+// keyRing must be called with the lock held
+func (r *AppRegistry) keyRing(appId int64) (ring *keyRing, err error) {
+	keyFile := r.keyFile
+	if appKeyFile, ok := r.appKeyFiles[appId]; ok {
+		keyFile = appKeyFile
+	} else if r.privateKey != "" {
+		if ring = r.rings[r.privateKeySource]; ring == nil {
+			if ring, err = PrivateKeys.LoadKeyRingPEM(r.privateKeySource, r.privateKey); err != nil {
+				return
+			}
+			r.rings[r.privateKeySource] = ring
+		}
+		return
+	}
+	if ring = r.rings[keyFile]; ring != nil {
+		return
+	}
+	if ring, err = PrivateKeys.LoadKeyRing(keyFile); err != nil {
+		return
+	}
+	r.rings[keyFile] = ring
+	return
+}
+
+// SigningKey is the fingerprint of the private key that signs the tokens of the app.
+func (r *AppRegistry) SigningKey(appId int64) (fingerprint string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ring, err := r.keyRing(appId)
+	if err != nil {
+		return
+	}
+	return ring.SigningKey(), nil
+}
+
+// loadKeyRings reads the private keys of the registry and of all apps with their own.
+func (r *AppRegistry) loadKeyRings() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err = r.keyRing(0); err != nil {
+		return
+	}
+	for appId := range r.appKeyFiles {
+		if _, err = r.keyRing(appId); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// SetKeyFile changes the private key of the apps without one of their own, dropping their transports.
+func (r *AppRegistry) SetKeyFile(keyFile string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if keyFile == r.keyFile {
+		return
+	}
+	r.keyFile = keyFile
+	r.forgetDefaultApps()
+}
+
+// SetPrivateKey makes the apps without a key file of their own use the keys of PEM encoded content rather than the
+// key file of the registry, e.g. those of a secret, until it is set to "" again. The source names the content in the
+// key statuses. Keys that don't parse are refused, and the current ones kept.
+func (r *AppRegistry) SetPrivateKey(source, content string) error {
+	var ring *keyRing
+	if content != "" {
+		var err error
+		if ring, err = PrivateKeys.LoadKeyRingPEM(source, content); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if source == r.privateKeySource && content == r.privateKey {
+		return nil
+	}
+	delete(r.rings, r.privateKeySource)
+	r.privateKey, r.privateKeySource = content, source
+	if ring != nil {
+		r.rings[source] = ring
+	}
+	r.forgetDefaultApps()
+	return nil
+}
+
+// forgetDefaultApps must be called with the lock held
+func (r *AppRegistry) forgetDefaultApps() {
+	// installation transports are made from those of their app
+	for appId := range r.appTransports {
+		if _, ok := r.appKeyFiles[appId]; !ok {
+			r.forgetApp(appId)
+		}
+	}
+}
+
+// SetAppKeyFile makes an app use its own private key, rather than the one of the registry. Transports of the app
+// made with another key are dropped.
+func (r *AppRegistry) SetAppKeyFile(appId int64, keyFile string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current, ok := r.appKeyFiles[appId]; ok && current == keyFile {
+		return
+	}
+	r.appKeyFiles[appId] = keyFile
+	r.forgetApp(appId)
+}
+
+// RemoveAppKeyFile makes an app use the private key of the registry again.
+func (r *AppRegistry) RemoveAppKeyFile(appId int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.appKeyFiles[appId]; !ok {
+		return
+	}
+	delete(r.appKeyFiles, appId)
+	r.forgetApp(appId)
+}
+
+// forgetApp must be called with the lock held
+func (r *AppRegistry) forgetApp(appId int64) {
+	delete(r.appTransports, appId)
+	for key := range r.installTransports {
+		if key.appId == appId {
+			delete(r.installTransports, key)
+		}
+	}
+	delete(r.metadata, appId)
+}
+
+// AppsTransport authenticates as the app itself (with a JWT), e.g. to ask GitHub about the app.
+func (r *AppRegistry) AppsTransport(appId int64) (*ghinstallation.AppsTransport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.appsTransport(appId)
+}
+
+// InstallationTransport authenticates as an installation of the app, reusing its token until it expires.
+func (r *AppRegistry) InstallationTransport(appId, installId int64) (itr *ghinstallation.Transport, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := installationKey{appId: appId, installId: installId}
+	if itr = r.installTransports[key]; itr != nil {
+		return
+	}
+	var atr *ghinstallation.AppsTransport
+	if atr, err = r.appsTransport(appId); err != nil {
+		return
+	}
+	itr = ghinstallation.NewFromAppsTransport(atr, installId)
+	r.installTransports[key] = itr
+	return
+}
+
+// Metadata returns the slug and external URL of the app, from cache if it is fresh enough.
+func (r *AppRegistry) Metadata(appId, installId int64) (metadata *AppMetadata, err error) {
+	r.mu.Lock()
+	cached := r.metadata[appId]
+	r.mu.Unlock()
+	if cached != nil && r.now().Sub(cached.fetchedAt) < appMetadataTTL {
+		return &cached.metadata, nil
+	}
+
+	atr, err := r.AppsTransport(appId)
+	if err != nil {
+		return
+	}
+	var jwtClient IGitHubJWTClient
+	if r.host == nil {
+		jwtClient = GHJWTImpl.NewJWTClient(&http.Client{Transport: atr}, installId)
+	} else if jwtClient, err = GHJWTImpl.NewEnterpriseJWTClient(&http.Client{Transport: atr}, r.host, installId); err != nil {
+		return
+	}
+	app, err := jwtClient.Get()
+	if err != nil {
+		return
+	}
+	fetched := &cachedAppMetadata{
+		metadata: AppMetadata{
+			Slug:        app.GetSlug(),
+			ExternalURL: app.GetExternalURL(),
+		},
+		fetchedAt: r.now(),
+	}
+
+	r.mu.Lock()
+	r.metadata[appId] = fetched
+	r.mu.Unlock()
+	return &fetched.metadata, nil
+}
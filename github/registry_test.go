@@ -0,0 +1,191 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingGHJWTMock counts how often we ask GitHub about the app
+type countingGHJWTMock struct {
+	GHJWTMock
+	getCalls int
+}
+
+func (c *countingGHJWTMock) NewJWTClient(httpClient *http.Client, installID int64) IGitHubJWTClient {
+	c.getCalls++
+	return c.GHJWTMock.NewJWTClient(httpClient, installID)
+}
+
+func setupTestRegistry(t *testing.T) (registry *AppRegistry, keyFile string) {
+	keyFile = filepath.Join(t.TempDir(), "test.pem")
+	WriteTestKeyFile(t, keyFile)
+	registry = NewAppRegistry(keyFile)
+	return
+}
+
+func TestAppRegistryInstallationTransportCached(t *testing.T) {
+	registry, keyFile := setupTestRegistry(t)
+
+	itr, err := registry.InstallationTransport(1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), itr.AppID())
+	assert.Equal(t, int64(2), itr.InstallationID())
+
+	// the key is only read once
+	assert.NoError(t, os.Remove(keyFile))
+
+	itrAgain, err := registry.InstallationTransport(1, 2)
+	assert.NoError(t, err)
+	assert.Same(t, itr, itrAgain)
+
+	otherItr, err := registry.InstallationTransport(1, 3)
+	assert.NoError(t, err)
+	assert.NotSame(t, itr, otherItr)
+	assert.Equal(t, int64(3), otherItr.InstallationID())
+}
+
+func TestAppRegistryResetRereadsKey(t *testing.T) {
+	registry, keyFile := setupTestRegistry(t)
+
+	_, err := registry.AppsTransport(1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Remove(keyFile))
+	registry.Reset()
+
+	_, err = registry.AppsTransport(1)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestAppRegistryAppKeyFile(t *testing.T) {
+	registry := NewAppRegistry(filepath.Join(t.TempDir(), "missing.pem"))
+	_, appKeyFile := setupTestRegistry(t)
+
+	_, err := registry.AppsTransport(1)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	registry.SetAppKeyFile(1, appKeyFile)
+	itr, err := registry.InstallationTransport(1, 2)
+	assert.NoError(t, err)
+	// other apps keep using the key of the registry
+	_, err = registry.AppsTransport(3)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// setting the same key again keeps the transports
+	registry.SetAppKeyFile(1, appKeyFile)
+	itrAgain, err := registry.InstallationTransport(1, 2)
+	assert.NoError(t, err)
+	assert.Same(t, itr, itrAgain)
+
+	registry.RemoveAppKeyFile(1)
+	_, err = registry.InstallationTransport(1, 2)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestAppRegistrySetKeyFile(t *testing.T) {
+	registry := NewAppRegistry(filepath.Join(t.TempDir(), "missing.pem"))
+	_, keyFile := setupTestRegistry(t)
+
+	_, err := registry.AppsTransport(1)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	registry.SetKeyFile(keyFile)
+	itr, err := registry.InstallationTransport(1, 2)
+	assert.NoError(t, err)
+
+	// setting the same key again keeps the transports
+	registry.SetKeyFile(keyFile)
+	itrAgain, err := registry.InstallationTransport(1, 2)
+	assert.NoError(t, err)
+	assert.Same(t, itr, itrAgain)
+}
+
+func TestAppRegistryMissingKey(t *testing.T) {
+	registry := NewAppRegistry(filepath.Join(t.TempDir(), "missing.pem"))
+
+	itr, err := registry.InstallationTransport(1, 2)
+	assert.Nil(t, itr)
+	assert.ErrorContains(t, err, "could not read private key: ")
+}
+
+func TestAppRegistryInvalidKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "invalid.pem")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+	registry := NewAppRegistry(keyFile)
+
+	atr, err := registry.AppsTransport(1)
+	assert.Nil(t, atr)
+	assert.Error(t, err)
+}
+
+func TestAppRegistryMetadataCached(t *testing.T) {
+	registry, _ := setupTestRegistry(t)
+	now := time.Now()
+	registry.now = func() time.Time { return now }
+
+	origGHJWT := GHJWTImpl
+	defer func() {
+		GHJWTImpl = origGHJWT
+	}()
+	jwtMock := &countingGHJWTMock{GHJWTMock: GHJWTMock{AppsMock: AppsMock{
+		mockApp:     &github.App{Slug: github.String("mySlug"), ExternalURL: github.String("https://cla.example.com")},
+		mockAppResp: &github.Response{Response: &http.Response{StatusCode: http.StatusOK}},
+	}}}
+	GHJWTImpl = jwtMock
+
+	metadata, err := registry.Metadata(1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, &AppMetadata{Slug: "mySlug", ExternalURL: "https://cla.example.com"}, metadata)
+
+	_, err = registry.Metadata(1, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, jwtMock.getCalls)
+
+	now = now.Add(appMetadataTTL)
+	_, err = registry.Metadata(1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, jwtMock.getCalls)
+}
+
+func TestAppRegistryMetadataErrorNotCached(t *testing.T) {
+	registry, _ := setupTestRegistry(t)
+
+	origGHJWT := GHJWTImpl
+	defer func() {
+		GHJWTImpl = origGHJWT
+	}()
+	jwtMock := &countingGHJWTMock{GHJWTMock: GHJWTMock{AppsMock: AppsMock{
+		mockAppResp: &github.Response{Response: &http.Response{StatusCode: http.StatusNotFound}},
+	}}}
+	GHJWTImpl = jwtMock
+
+	metadata, err := registry.Metadata(1, 2)
+	assert.Nil(t, metadata)
+	assert.Error(t, err)
+
+	_, err = registry.Metadata(1, 2)
+	assert.Error(t, err)
+	assert.Equal(t, 2, jwtMock.getCalls)
+}
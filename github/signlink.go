@@ -0,0 +1,189 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+const DefaultSignLinkTTL = 30 * 24 * time.Hour
+
+// QueryParameterSignLink is the query parameter of the signing page carrying a SignLink token
+const QueryParameterSignLink = "sign"
+
+// QueryParameterProvider is the query parameter of the signing page telling where signers log in, see package vcs
+const QueryParameterProvider = "provider"
+
+var (
+	ErrSignLinkInvalid = errors.New("invalid signing link")
+	ErrSignLinkExpired = errors.New("this signing link has expired, please use the link in the latest comment on your pull request")
+)
+
+// SignLink takes a contributor from the comment on their PR to the signing page, and back to the PR once signed.
+type SignLink struct {
+	// Provider hosts the PR, empty for GitHub
+	Provider   string `json:"provider,omitempty"`
+	RepoId     int64  `json:"repoId"`
+	RepoOwner  string `json:"repoOwner"`
+	RepoName   string `json:"repoName"`
+	PRNumber   int64  `json:"prNumber"`
+	CLAVersion string `json:"claVersion"`
+	// Login is who the link is for, nobody else can sign with it
+	Login string `json:"login"`
+	// URL is the PR page, links issued before other providers were supported lack it
+	URL       string `json:"url,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// PullRequestURL is where the signer goes back to.
+func (l *SignLink) PullRequestURL() string {
+	if l.URL != "" {
+		return l.URL
+	}
+	return fmt.Sprintf("https://github.com/%s/%s/pull/%d", url.PathEscape(l.RepoOwner), url.PathEscape(l.RepoName), l.PRNumber)
+}
+
+// SignLinkSigner signs and verifies SignLink tokens, which are the base64 encoded link and its HMAC.
+type SignLinkSigner struct {
+	now func() time.Time
+	// secret signs the links, deep links are disabled while it is empty
+	secret atomic.Pointer[[]byte]
+	// TTL is how long links are valid for at most
+	TTL time.Duration
+}
+
+func NewSignLinkSigner(secret []byte, ttl time.Duration) *SignLinkSigner {
+	signer := &SignLinkSigner{now: time.Now, TTL: ttl}
+	signer.SetSecret(secret)
+	return signer
+}
+
+// SetSecret replaces the secret, which may be rotated while we run. Links signed with the old secret are no longer
+// valid.
+func (s *SignLinkSigner) SetSecret(secret []byte) {
+	s.secret.Store(&secret)
+}
+
+// SignLinks is the signer used for all links, disabled by default.
+var SignLinks = NewSignLinkSigner(nil, DefaultSignLinkTTL)
+
+func (s *SignLinkSigner) Enabled() bool {
+	return len(*s.secret.Load()) > 0
+}
+
+func (s *SignLinkSigner) mac(payload string) string {
+	mac := hmac.New(sha256.New, *s.secret.Load())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the token for a link. Links are issued in fixed windows of half the TTL, so evaluating a PR again
+// soon after yields the same link (and so the same comment), while every link stays valid for at least half the TTL.
+func (s *SignLinkSigner) Sign(link SignLink) (string, error) {
+	window := s.TTL / 2
+	if window <= 0 {
+		return "", fmt.Errorf("invalid signing link TTL: %s", s.TTL)
+	}
+	link.ExpiresAt = s.now().Truncate(window).Add(s.TTL).Unix()
+	encoded, err := json.Marshal(link)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(encoded)
+	return payload + "." + s.mac(payload), nil
+}
+
+// IsSignLinkToken tells if an OAuth state is a SignLink token rather than a URL to go back to.
+func IsSignLinkToken(state string) bool {
+	return state != "" && !strings.ContainsAny(state, "/:")
+}
+
+// Verify checks a token was signed by us and has not expired.
+func (s *SignLinkSigner) Verify(token string) (*SignLink, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !s.Enabled() || !hmac.Equal([]byte(signature), []byte(s.mac(payload))) {
+		return nil, ErrSignLinkInvalid
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrSignLinkInvalid
+	}
+	var link SignLink
+	if err = json.Unmarshal(decoded, &link); err != nil {
+		return nil, ErrSignLinkInvalid
+	}
+	if !s.now().Before(time.Unix(link.ExpiresAt, 0)) {
+		return nil, ErrSignLinkExpired
+	}
+	return &link, nil
+}
+
+// SignPageURL is the signing page for contributors to PRs hosted by provider, who must sign claVersion, which may
+// be the CLA of a tenant.
+func SignPageURL(signPageURL, provider, claVersion string) string {
+	if tenant := Tenants.OfCLAVersion(claVersion); tenant != nil {
+		signPageURL = withQuery(signPageURL, QueryParameterTenant, tenant.Name)
+	}
+	if provider == "" || provider == vcs.ProviderGitHub {
+		return signPageURL
+	}
+	return withQuery(signPageURL, QueryParameterProvider, provider)
+}
+
+// withQuery adds a query parameter to a URL, which may have a query already.
+func withQuery(rawURL, key, value string) string {
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator + url.Values{key: {value}}.Encode()
+}
+
+// URL returns the signing page link for login on the PR being evaluated, which lives at changeURL, or just the
+// signing page while deep links are disabled.
+func (s *SignLinkSigner) URL(signPageURL, changeURL string, evalInfo *types.EvaluationInfo, login, claVersion string) (string, error) {
+	signPageURL = SignPageURL(signPageURL, evalInfo.Provider, claVersion)
+	if !s.Enabled() {
+		return signPageURL, nil
+	}
+	token, err := s.Sign(SignLink{
+		Provider:   evalInfo.Provider,
+		RepoId:     evalInfo.RepoId,
+		RepoOwner:  evalInfo.RepoOwner,
+		RepoName:   evalInfo.RepoName,
+		PRNumber:   evalInfo.PRNumber,
+		CLAVersion: claVersion,
+		Login:      login,
+		URL:        changeURL,
+	})
+	if err != nil {
+		return "", err
+	}
+	return withQuery(signPageURL, QueryParameterSignLink, token), nil
+}
@@ -0,0 +1,151 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+func testSignLinkSigner(now time.Time) *SignLinkSigner {
+	signer := NewSignLinkSigner([]byte("linkSecret"), 4*time.Hour)
+	signer.now = func() time.Time { return now }
+	return signer
+}
+
+func testSignLink() SignLink {
+	return SignLink{RepoId: 7, RepoOwner: "myOwner", RepoName: "myRepo", PRNumber: 5, CLAVersion: "2", Login: "alice"}
+}
+
+func TestSignLinkRoundTrip(t *testing.T) {
+	now := time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC)
+	signer := testSignLinkSigner(now)
+
+	token, err := signer.Sign(testSignLink())
+	assert.NoError(t, err)
+	assert.True(t, IsSignLinkToken(token))
+
+	link, err := signer.Verify(token)
+	assert.NoError(t, err)
+	expected := testSignLink()
+	expected.ExpiresAt = time.Date(2024, 5, 1, 4, 0, 0, 0, time.UTC).Unix()
+	assert.Equal(t, &expected, link)
+	assert.Equal(t, "https://github.com/myOwner/myRepo/pull/5", link.PullRequestURL())
+}
+
+func TestSignLinkSameWithinWindow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 10, 0, 0, time.UTC)
+	first, err := testSignLinkSigner(now).Sign(testSignLink())
+	assert.NoError(t, err)
+	second, err := testSignLinkSigner(now.Add(time.Hour)).Sign(testSignLink())
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	third, err := testSignLinkSigner(now.Add(2 * time.Hour)).Sign(testSignLink())
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, third)
+}
+
+func TestSignLinkExpired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC)
+	token, err := testSignLinkSigner(now).Sign(testSignLink())
+	assert.NoError(t, err)
+
+	_, err = testSignLinkSigner(now.Add(3 * time.Hour)).Verify(token)
+	assert.Equal(t, ErrSignLinkExpired, err)
+}
+
+func TestSignLinkInvalid(t *testing.T) {
+	now := time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC)
+	signer := testSignLinkSigner(now)
+	token, err := signer.Sign(testSignLink())
+	assert.NoError(t, err)
+	payload, signature, _ := strings.Cut(token, ".")
+
+	otherSigner := testSignLinkSigner(now)
+	otherSigner.SetSecret([]byte("otherSecret"))
+	forged, err := otherSigner.Sign(SignLink{Login: "mallory"})
+	assert.NoError(t, err)
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	for _, invalid := range []string{"", "nodot", payload + ".", forgedPayload + "." + signature, "!!." + signature} {
+		_, err = signer.Verify(invalid)
+		assert.Equal(t, ErrSignLinkInvalid, err, invalid)
+	}
+
+	_, err = NewSignLinkSigner(nil, time.Hour).Verify(token)
+	assert.Equal(t, ErrSignLinkInvalid, err)
+}
+
+func TestSignLinkInvalidTTL(t *testing.T) {
+	_, err := NewSignLinkSigner([]byte("linkSecret"), 0).Sign(testSignLink())
+	assert.EqualError(t, err, "invalid signing link TTL: 0s")
+}
+
+func TestIsSignLinkToken(t *testing.T) {
+	assert.False(t, IsSignLinkToken(""))
+	assert.False(t, IsSignLinkToken("https://example.com/somewhere"))
+	assert.True(t, IsSignLinkToken("abc.def"))
+}
+
+func TestSignLinkURL(t *testing.T) {
+	evalInfo := &types.EvaluationInfo{RepoId: 7, RepoOwner: "myOwner", RepoName: "myRepo", PRNumber: 5}
+
+	link, err := NewSignLinkSigner(nil, time.Hour).URL("https://cla.example.com", "https://github.com/myOwner/myRepo/pull/5", evalInfo, "alice", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cla.example.com", link)
+
+	signer := testSignLinkSigner(time.Now())
+	link, err = signer.URL("https://cla.example.com", "https://github.com/myOwner/myRepo/pull/5", evalInfo, "alice", "2")
+	assert.NoError(t, err)
+	parsed, err := url.Parse(link)
+	assert.NoError(t, err)
+	signLink, err := signer.Verify(parsed.Query().Get(QueryParameterSignLink))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", signLink.Login)
+	assert.Equal(t, int64(5), signLink.PRNumber)
+	assert.Equal(t, "2", signLink.CLAVersion)
+	assert.Equal(t, "https://github.com/myOwner/myRepo/pull/5", signLink.PullRequestURL())
+}
+
+func TestSignLinkURLOtherProvider(t *testing.T) {
+	evalInfo := &types.EvaluationInfo{Provider: vcs.ProviderGitLab, RepoId: 7, RepoOwner: "group/sub", RepoName: "myRepo", PRNumber: 5}
+	mrURL := "https://gitlab.com/group/sub/myRepo/-/merge_requests/5"
+
+	link, err := NewSignLinkSigner(nil, time.Hour).URL("https://cla.example.com", mrURL, evalInfo, "gitlab:alice", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cla.example.com?provider=gitlab", link)
+
+	signer := testSignLinkSigner(time.Now())
+	link, err = signer.URL("https://cla.example.com", mrURL, evalInfo, "gitlab:alice", "2")
+	assert.NoError(t, err)
+	parsed, err := url.Parse(link)
+	assert.NoError(t, err)
+	assert.Equal(t, vcs.ProviderGitLab, parsed.Query().Get(QueryParameterProvider))
+	signLink, err := signer.Verify(parsed.Query().Get(QueryParameterSignLink))
+	assert.NoError(t, err)
+	assert.Equal(t, vcs.ProviderGitLab, signLink.Provider)
+	assert.Equal(t, "gitlab:alice", signLink.Login)
+	assert.Equal(t, mrURL, signLink.PullRequestURL())
+}
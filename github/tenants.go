@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// QueryParameterTenant tells the signing page which tenant's CLA to show
+const QueryParameterTenant = "tenant"
+
+var validTenantName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// TenantRegistry holds the tenants of a deployment serving several organizations, each with a GitHub App of its
+// own, by name and by app. PRs of other apps belong to the default tenant, configured by the environment.
+type TenantRegistry struct {
+	mu     sync.RWMutex
+	byName map[string]*types.Tenant
+	byApp  map[int64]*types.Tenant
+}
+
+// Tenants are the tenants we serve, loaded from the db.
+var Tenants = &TenantRegistry{}
+
+// QualifiedCLAVersion is the CLA version signers of a tenant's PRs sign, so signatures of different tenants' CLAs
+// are told apart like logins of different providers, see vcs.QualifiedLogin. The default tenant's versions stay as
+// they are.
+func QualifiedCLAVersion(tenant, claVersion string) string {
+	if tenant == "" {
+		return claVersion
+	}
+	return tenant + ":" + claVersion
+}
+
+// Set replaces the tenants, after checking them, and makes their apps use their private keys.
+func (r *TenantRegistry) Set(tenants []types.Tenant) error {
+	byName := make(map[string]*types.Tenant, len(tenants))
+	byApp := make(map[int64]*types.Tenant, len(tenants))
+	for i := range tenants {
+		tenant := tenants[i]
+		if !validTenantName.MatchString(tenant.Name) {
+			return fmt.Errorf("invalid tenant name: %q", tenant.Name)
+		}
+		if tenant.AppId == 0 || tenant.KeyFile == "" {
+			return fmt.Errorf("tenant %s needs an app id and key file", tenant.Name)
+		}
+		// the tenant of a webhook is told by a header anyone can set, only its secret proves where it comes from
+		if len(WebhookSecrets(tenant.WebhookSecret)) == 0 {
+			return fmt.Errorf("tenant %s needs a webhook secret", tenant.Name)
+		}
+		if tenant.CLAVersion == "" || tenant.CLATextUrl == "" {
+			return fmt.Errorf("tenant %s needs a CLA version and text url", tenant.Name)
+		}
+		if other := byApp[tenant.AppId]; other != nil {
+			return fmt.Errorf("tenants %s and %s share app %d", other.Name, tenant.Name, tenant.AppId)
+		}
+		byName[tenant.Name] = &tenant
+		byApp[tenant.AppId] = &tenant
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for appId := range r.byApp {
+		if byApp[appId] == nil {
+			Apps.RemoveAppKeyFile(appId)
+		}
+	}
+	for appId, tenant := range byApp {
+		Apps.SetAppKeyFile(appId, tenant.KeyFile)
+	}
+	r.byName, r.byApp = byName, byApp
+	return nil
+}
+
+// ByName returns a tenant, or nil if there is none of that name.
+func (r *TenantRegistry) ByName(name string) *types.Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.byName[name]
+}
+
+// ByAppId returns the tenant of an app, or nil for apps of the default tenant.
+func (r *TenantRegistry) ByAppId(appId int64) *types.Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.byApp[appId]
+}
+
+// All returns the tenants by name.
+func (r *TenantRegistry) All() (tenants []types.Tenant) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, tenant := range r.byName {
+		tenants = append(tenants, *tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].Name < tenants[j].Name
+	})
+	return
+}
+
+// Of returns the tenant of a PR, or nil for PRs of the default tenant. Tenants are github.com apps, PRs of other
+// providers always belong to the default tenant.
+func (r *TenantRegistry) Of(evalInfo *types.EvaluationInfo) *types.Tenant {
+	if vcs.ProviderOf(evalInfo) != vcs.ProviderGitHub {
+		return nil
+	}
+	return r.ByAppId(evalInfo.AppId)
+}
+
+// CLAVersion returns the CLA version authors of a PR must have signed, the qualified one of its tenant, or
+// defaultVersion for PRs of the default tenant.
+func (r *TenantRegistry) CLAVersion(evalInfo *types.EvaluationInfo, defaultVersion string) string {
+	if tenant := r.Of(evalInfo); tenant != nil {
+		return QualifiedCLAVersion(tenant.Name, tenant.CLAVersion)
+	}
+	return defaultVersion
+}
+
+// OfCLAVersion returns the tenant whose CLA a (qualified) CLA version is of, or nil for CLAs of the default tenant.
+func (r *TenantRegistry) OfCLAVersion(claVersion string) *types.Tenant {
+	if name, _, found := strings.Cut(claVersion, ":"); found {
+		return r.ByName(name)
+	}
+	return nil
+}
+
+// IsAdmin tells if login is an admin of the tenant of a PR.
+func (r *TenantRegistry) IsAdmin(evalInfo *types.EvaluationInfo, login string) bool {
+	tenant := r.Of(evalInfo)
+	if tenant == nil {
+		return false
+	}
+	for _, admin := range tenant.Admins {
+		if strings.EqualFold(admin, login) {
+			return true
+		}
+	}
+	return false
+}
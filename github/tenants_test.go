@@ -0,0 +1,104 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// setupTestTenants serves the given tenants for the duration of a test.
+func setupTestTenants(t *testing.T, tenants ...types.Tenant) {
+	assert.NoError(t, Tenants.Set(tenants))
+	t.Cleanup(func() {
+		assert.NoError(t, Tenants.Set(nil))
+	})
+}
+
+func testTenant(name string, appId int64) types.Tenant {
+	return types.Tenant{Name: name, AppId: appId, KeyFile: name + ".pem", WebhookSecret: name + "Secret", CLAVersion: "1",
+		CLATextUrl: "https://example.com/" + name + ".txt", Admins: []string{"Alice"}}
+}
+
+func TestQualifiedCLAVersion(t *testing.T) {
+	assert.Equal(t, "1.0", QualifiedCLAVersion("", "1.0"))
+	assert.Equal(t, "apache:1.0", QualifiedCLAVersion("apache", "1.0"))
+}
+
+func TestTenantsSetInvalid(t *testing.T) {
+	for expectedError, tenants := range map[string][]types.Tenant{
+		`invalid tenant name: ""`:                        {{AppId: 1, KeyFile: "a.pem"}},
+		`invalid tenant name: "Apache"`:                  {{Name: "Apache", AppId: 1}},
+		`invalid tenant name: "a:b"`:                     {{Name: "a:b", AppId: 1}},
+		"tenant apache needs an app id and key file":     {{Name: "apache", KeyFile: "a.pem"}},
+		"tenant apache needs a webhook secret":           {{Name: "apache", AppId: 1, KeyFile: "a.pem", WebhookSecret: " , "}},
+		"tenant apache needs a CLA version and text url": {{Name: "apache", AppId: 1, KeyFile: "a.pem", WebhookSecret: "s", CLAVersion: "1"}},
+		"tenants apache and eclipse share app 1":         {testTenant("apache", 1), testTenant("eclipse", 1)},
+	} {
+		assert.EqualError(t, Tenants.Set(tenants), expectedError)
+	}
+	// the tenants did not change
+	assert.Nil(t, Tenants.All())
+}
+
+func TestTenantsLookup(t *testing.T) {
+	setupTestTenants(t, testTenant("eclipse", 12), testTenant("apache", 11))
+
+	assert.Equal(t, []string{"apache", "eclipse"}, []string{Tenants.All()[0].Name, Tenants.All()[1].Name})
+	assert.Equal(t, int64(11), Tenants.ByName("apache").AppId)
+	assert.Nil(t, Tenants.ByName("unknown"))
+	assert.Equal(t, "eclipse", Tenants.ByAppId(12).Name)
+	assert.Nil(t, Tenants.ByAppId(13))
+
+	assert.Equal(t, "apache", Tenants.Of(&types.EvaluationInfo{AppId: 11}).Name)
+	assert.Equal(t, "apache", Tenants.Of(&types.EvaluationInfo{Provider: vcs.ProviderGitHub, AppId: 11}).Name)
+	// tenants are github.com apps
+	assert.Nil(t, Tenants.Of(&types.EvaluationInfo{Provider: vcs.ProviderGitLab, AppId: 11}))
+	assert.Nil(t, Tenants.Of(&types.EvaluationInfo{AppId: 13}))
+
+	assert.Equal(t, "apache:1", Tenants.CLAVersion(&types.EvaluationInfo{AppId: 11}, "2.0"))
+	assert.Equal(t, "2.0", Tenants.CLAVersion(&types.EvaluationInfo{AppId: 13}, "2.0"))
+
+	assert.Equal(t, "eclipse", Tenants.OfCLAVersion("eclipse:1").Name)
+	assert.Nil(t, Tenants.OfCLAVersion("unknown:1"))
+	assert.Nil(t, Tenants.OfCLAVersion("2.0"))
+
+	assert.True(t, Tenants.IsAdmin(&types.EvaluationInfo{AppId: 11}, "alice"))
+	assert.False(t, Tenants.IsAdmin(&types.EvaluationInfo{AppId: 11}, "bob"))
+	assert.False(t, Tenants.IsAdmin(&types.EvaluationInfo{AppId: 13}, "alice"))
+}
+
+func TestTenantsSetKeyFiles(t *testing.T) {
+	setupTestTenants(t, testTenant("apache", 11))
+	assert.Equal(t, "apache.pem", Apps.appKeyFiles[11])
+
+	assert.NoError(t, Tenants.Set([]types.Tenant{testTenant("eclipse", 12)}))
+	_, found := Apps.appKeyFiles[11]
+	assert.False(t, found)
+	assert.Equal(t, "eclipse.pem", Apps.appKeyFiles[12])
+}
+
+func TestSignPageURLOfTenant(t *testing.T) {
+	setupTestTenants(t, testTenant("apache", 11))
+
+	assert.Equal(t, "https://cla.example.com?tenant=apache", SignPageURL("https://cla.example.com", "", "apache:1"))
+	assert.Equal(t, "https://cla.example.com", SignPageURL("https://cla.example.com", "", "1"))
+}
@@ -0,0 +1,160 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v64/github"
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+// TrivialChangePolicy lets PRs that are too small to be copyrightable, or only touch e.g. documentation, through
+// without a CLA. Repositories have to opt in.
+type TrivialChangePolicy struct {
+	// Repos are the "owner/name" patterns of the repositories that opted in, where "*" matches anything
+	Repos []string
+	// MaxLines exempts PRs adding and removing at most this many lines in total, zero or less disables the check
+	MaxLines int
+	// Paths exempts PRs only changing files matching these globs, e.g. "docs/**" or "*.md". A glob without a "/"
+	// matches the file name in any directory.
+	Paths []string
+}
+
+// TrivialChanges is the policy used for all evaluations. No repository opted in by default.
+var TrivialChanges TrivialChangePolicy
+
+func (p TrivialChangePolicy) appliesTo(owner, repo string) bool {
+	for _, pattern := range p.Repos {
+		if matchesPattern(pattern, owner+"/"+repo) {
+			return true
+		}
+	}
+	return false
+}
+
+// exemptionReason tells why the changes of a PR need no CLA, or returns an empty reason if they do.
+func (p TrivialChangePolicy) exemptionReason(ctx context.Context, pullRequestsService PullRequestsService, evalInfo *types.EvaluationInfo) (reason string, err error) {
+	if !p.appliesTo(evalInfo.RepoOwner, evalInfo.RepoName) || (p.MaxLines <= 0 && len(p.Paths) == 0) {
+		return
+	}
+
+	files, err := listAll(func(opts github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+		return pullRequestsService.ListFiles(ctx, evalInfo.RepoOwner, evalInfo.RepoName, int(evalInfo.PRNumber), &opts)
+	})
+	if err != nil || len(files) == 0 {
+		return
+	}
+
+	if p.MaxLines > 0 {
+		if changedLines, counted := countChangedLines(files); counted && changedLines <= p.MaxLines {
+			return fmt.Sprintf("trivial change (%d lines changed)", changedLines), nil
+		}
+	}
+
+	if len(p.Paths) > 0 {
+		for _, file := range files {
+			// a file moved out of a protected path changes that path too
+			if !p.allowedPath(file.GetFilename()) || (file.GetPreviousFilename() != "" && !p.allowedPath(file.GetPreviousFilename())) {
+				return "", nil
+			}
+		}
+		return fmt.Sprintf("only changes %s", strings.Join(p.Paths, ", ")), nil
+	}
+	return "", nil
+}
+
+// countChangedLines adds up the lines changed in the files. They can't be counted if a file has no patch: binary
+// files, and files whose diff is too large for GitHub to show, change any amount without changing a line.
+func countChangedLines(files []*github.CommitFile) (changedLines int, counted bool) {
+	for _, file := range files {
+		if file.GetPatch() == "" {
+			return 0, false
+		}
+		changedLines += file.GetAdditions() + file.GetDeletions()
+	}
+	return changedLines, true
+}
+
+func (p TrivialChangePolicy) allowedPath(path string) bool {
+	for _, glob := range p.Paths {
+		if matchesPathGlob(glob, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesPathGlob matches a path against a glob, where "**" matches any number of directories, "*" and "?" match
+// within a single directory.
+func matchesPathGlob(glob, path string) bool {
+	if !strings.Contains(glob, "/") {
+		path = path[strings.LastIndex(path, "/")+1:]
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	matched, _ := regexp.MatchString(expr.String(), path)
+	return matched
+}
+
+// applyTrivialChange reports success for a PR whose changes need no CLA, instead of evaluating its commits.
+func applyTrivialChange(logger *zap.Logger, postgres db.IClaDB, client GHClient, evalInfo *types.EvaluationInfo, botName string) (exempt bool, err error) {
+	reason, err := TrivialChanges.exemptionReason(context.Background(), client.PullRequests, evalInfo)
+	if err != nil || reason == "" {
+		return
+	}
+	logger.Info("trivial change, CLA not required",
+		zap.String("owner", evalInfo.RepoOwner),
+		zap.String("repo", evalInfo.RepoName),
+		zap.Int64("pullRequestID", evalInfo.PRNumber),
+		zap.String("reason", reason),
+	)
+	messages := messagesFor(logger, client.Repositories, evalInfo)
+	data := messageData(evalInfo)
+	data.Reason = reason
+	comment, err := messages.render("commentTrivialChange", data)
+	if err != nil {
+		return
+	}
+	if _, err = addCommentToIssueIfNotExists(client.Issues, evalInfo.RepoOwner, evalInfo.RepoName, int(evalInfo.PRNumber), comment); err != nil {
+		return
+	}
+	return true, reportMessageStatus(postgres, client.Repositories, messages, evalInfo, "success", "statusTrivialChange", data, botName)
+}
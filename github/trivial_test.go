@@ -0,0 +1,155 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-github/v64/github"
+	"github.com/stretchr/testify/assert"
+	webhook "gopkg.in/go-playground/webhooks.v5/github"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+// changedFile is a text file, which has a patch unless no line changed.
+func changedFile(name string, additions, deletions int) *github.CommitFile {
+	file := &github.CommitFile{Filename: github.String(name), Additions: github.Int(additions), Deletions: github.Int(deletions)}
+	if additions+deletions > 0 {
+		file.Patch = github.String(fmt.Sprintf("@@ -1,%d +1,%d @@", deletions, additions))
+	}
+	return file
+}
+
+var trivialEvalInfo = &types.EvaluationInfo{RepoOwner: "myOrg", RepoName: "myRepo", PRNumber: 1}
+
+func TestTrivialChangeNotOptedIn(t *testing.T) {
+	pullRequestsMock := &PullRequestsMock{mockListFilesError: fmt.Errorf("must not list files")}
+	policy := TrivialChangePolicy{Repos: []string{"otherOrg/*"}, MaxLines: 10}
+
+	reason, err := policy.exemptionReason(context.Background(), pullRequestsMock, trivialEvalInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+
+	reason, err = TrivialChangePolicy{Repos: []string{"myOrg/myRepo"}}.exemptionReason(context.Background(), pullRequestsMock, trivialEvalInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestTrivialChangeMaxLines(t *testing.T) {
+	pullRequestsMock := &PullRequestsMock{mockFiles: []*github.CommitFile{changedFile("main.go", 2, 1), changedFile("README.md", 1, 1)}}
+
+	reason, err := TrivialChangePolicy{Repos: []string{"myorg/*"}, MaxLines: 5}.exemptionReason(context.Background(), pullRequestsMock, trivialEvalInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "trivial change (5 lines changed)", reason)
+
+	reason, err = TrivialChangePolicy{Repos: []string{"myorg/*"}, MaxLines: 4}.exemptionReason(context.Background(), pullRequestsMock, trivialEvalInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestTrivialChangeMaxLinesWithoutPatch(t *testing.T) {
+	policy := TrivialChangePolicy{Repos: []string{"myorg/*"}, MaxLines: 5}
+	for _, file := range []*github.CommitFile{
+		// a binary file changes no lines
+		changedFile("lib/vendored.jar", 0, 0),
+		// nor does a diff too large to show
+		{Filename: github.String("generated.go"), Additions: github.Int(2), Deletions: github.Int(0)},
+	} {
+		pullRequestsMock := &PullRequestsMock{mockFiles: []*github.CommitFile{changedFile("README.md", 1, 1), file}}
+		reason, err := policy.exemptionReason(context.Background(), pullRequestsMock, trivialEvalInfo)
+		assert.NoError(t, err)
+		assert.Equal(t, "", reason, file.GetFilename())
+	}
+}
+
+func TestTrivialChangePaths(t *testing.T) {
+	policy := TrivialChangePolicy{Repos: []string{"myOrg/myRepo"}, Paths: []string{"docs/**", "*.md"}}
+
+	pullRequestsMock := &PullRequestsMock{mockFiles: []*github.CommitFile{changedFile("docs/guide/intro.html", 200, 0), changedFile("src/README.md", 1, 1)}}
+	reason, err := policy.exemptionReason(context.Background(), pullRequestsMock, trivialEvalInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "only changes docs/**, *.md", reason)
+
+	pullRequestsMock.mockFiles = append(pullRequestsMock.mockFiles, changedFile("main.go", 1, 0))
+	reason, err = policy.exemptionReason(context.Background(), pullRequestsMock, trivialEvalInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+
+	// moving code into the docs is no trivial change
+	moved := changedFile("docs/main.go", 0, 0)
+	moved.PreviousFilename = github.String("main.go")
+	pullRequestsMock.mockFiles = []*github.CommitFile{moved}
+	reason, err = policy.exemptionReason(context.Background(), pullRequestsMock, trivialEvalInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestTrivialChangeListFilesError(t *testing.T) {
+	forcedError := fmt.Errorf("forced ListFiles error")
+	pullRequestsMock := &PullRequestsMock{mockListFilesError: forcedError}
+
+	_, err := TrivialChangePolicy{Repos: []string{"*"}, MaxLines: 1}.exemptionReason(context.Background(), pullRequestsMock, trivialEvalInfo)
+	assert.EqualError(t, err, forcedError.Error())
+}
+
+func TestMatchesPathGlob(t *testing.T) {
+	assert.True(t, matchesPathGlob("docs/**", "docs/a/b/c.md"))
+	assert.False(t, matchesPathGlob("docs/**", "src/docs/a.md"))
+	assert.True(t, matchesPathGlob("**/docs/*", "src/docs/a.md"))
+	assert.True(t, matchesPathGlob("**/docs/*", "docs/a.md"))
+	assert.True(t, matchesPathGlob("*.md", "a/b/README.md"))
+	assert.False(t, matchesPathGlob("*.md", "README.mdx"))
+	assert.True(t, matchesPathGlob("src/*.txt", "src/a.txt"))
+	assert.False(t, matchesPathGlob("src/*.txt", "src/a/b.txt"))
+	assert.True(t, matchesPathGlob("CHANGELOG.?", "CHANGELOG.1"))
+	assert.False(t, matchesPathGlob("a+b.md", "aab.md"))
+}
+
+func TestHandlePullRequestTrivialChange(t *testing.T) {
+	setupOverrideEnvironment(t)
+	origTrivialChanges := TrivialChanges
+	defer func() {
+		TrivialChanges = origTrivialChanges
+	}()
+	TrivialChanges = TrivialChangePolicy{Repos: []string{"*"}, Paths: []string{"*.md"}}
+
+	reason := "only changes *.md"
+	ghMock := &GHInterfaceMock{
+		RepositoriesMock: *setupOverrideStatusMock(t, "", "success", "CLA not required: "+reason),
+		PullRequestsMock: PullRequestsMock{mockFiles: []*github.CommitFile{changedFile("README.md", 1, 1)}},
+		IssuesMock: IssuesMock{
+			t: t,
+			assertParamsCreateComment: assertParams{
+				assertParameters: []bool{true},
+				expectedParameters: []any{
+					[]context.Context{context.Background()},
+					[]string{""},
+					[]string{""},
+					[]int{0},
+					[]*github.IssueComment{{Body: github.String("Thanks for the contribution. This PR does not need a signed Contributor License Agreement: " + reason + ".")}},
+				},
+			},
+		},
+	}
+	GHImpl = ghMock
+	mockDB, logger := setupMockDB(t, false)
+
+	assert.NoError(t, HandlePullRequest(logger, mockDB, webhook.PullRequestPayload{}, nil, 0, ""))
+}
@@ -0,0 +1,127 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// perPage is the largest page size the GitLab API allows
+const perPage = "100"
+
+// Client is a minimal client of the GitLab REST API (v4), covering what evaluating merge requests needs.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient talks to the GitLab instance at baseURL (e.g. "https://gitlab.com"), authenticated by a personal,
+// group or project access token.
+func NewClient(baseURL, token string) *Client {
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), token: token, httpClient: http.DefaultClient}
+}
+
+// Error is a request the GitLab API refused.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gitlab: %d %s", e.StatusCode, e.Message)
+}
+
+// isStatus tells if err is a response of the GitLab API with the given status code.
+func isStatus(err error, statusCode int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+func projectPath(projectId int64) string {
+	return "/projects/" + strconv.FormatInt(projectId, 10)
+}
+
+// do sends a request to the API, with body encoded as JSON, and decodes the response into result unless it is nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result any) (*http.Response, error) {
+	endpoint := c.baseURL + "/api/v4" + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+	}
+	return resp, err
+}
+
+// listAll gets every page of a list, following the X-Next-Page header.
+func listAll[T any](ctx context.Context, c *Client, path string, query url.Values) (all []T, err error) {
+	pageQuery := url.Values{}
+	for key, values := range query {
+		pageQuery[key] = values
+	}
+	pageQuery.Set("per_page", perPage)
+	for page := "1"; page != ""; {
+		pageQuery.Set("page", page)
+		var items []T
+		var resp *http.Response
+		if resp, err = c.do(ctx, http.MethodGet, path, pageQuery, nil, &items); err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return
+}
@@ -0,0 +1,76 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoSendsToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/user", r.URL.Path)
+		assert.Equal(t, "myToken", r.Header.Get("PRIVATE-TOKEN"))
+		_, _ = fmt.Fprint(w, `{"id": 5, "username": "alice"}`)
+	}))
+	defer server.Close()
+
+	var found user
+	_, err := NewClient(server.URL+"/", "myToken").do(context.Background(), http.MethodGet, "/user", nil, nil, &found)
+	assert.NoError(t, err)
+	assert.Equal(t, user{ID: 5, Username: "alice"}, found)
+}
+
+func TestDoError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"message":"404 Not found"}`)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(server.URL, "myToken").do(context.Background(), http.MethodGet, "/user", nil, nil, nil)
+	assert.EqualError(t, err, `gitlab: 404 {"message":"404 Not found"}`)
+	assert.True(t, isStatus(err, http.StatusNotFound))
+	assert.False(t, isStatus(err, http.StatusConflict))
+	assert.False(t, isStatus(nil, http.StatusNotFound))
+}
+
+func TestListAllFollowsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, perPage, r.URL.Query().Get("per_page"))
+		assert.Equal(t, "x", r.URL.Query().Get("other"))
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			_, _ = fmt.Fprint(w, `[{"body": "first"}]`)
+		case "2":
+			_, _ = fmt.Fprint(w, `[{"body": "second"}]`)
+		default:
+			t.Errorf("unexpected page: %s", r.URL.Query().Get("page"))
+		}
+	}))
+	defer server.Close()
+
+	notes, err := listAll[note](context.Background(), NewClient(server.URL, "myToken"), "/notes", map[string][]string{"other": {"x"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []note{{Body: "first"}, {Body: "second"}}, notes)
+}
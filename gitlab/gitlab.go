@@ -0,0 +1,400 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package gitlab evaluates the CLA on GitLab merge requests, see vcs.Provider.
+package gitlab
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+const DefaultBaseURL = "https://gitlab.com"
+
+// BaseURL is the GitLab instance hosting merge requests
+var BaseURL = DefaultBaseURL
+
+// token authenticates the user commenting, labeling and setting statuses on merge requests. It needs the "api"
+// scope, and at least the Reporter role on the projects. GitLab merge requests are not evaluated while it is empty.
+var token atomic.Pointer[string]
+
+// Token is the token of SetToken.
+func Token() string {
+	if t := token.Load(); t != nil {
+		return *t
+	}
+	return ""
+}
+
+// SetToken sets the token, which may be rotated while we run.
+func SetToken(t string) {
+	token.Store(&t)
+}
+
+// SignURL is the signing page linked from our comments
+var SignURL string
+
+// StatusName is the name of our commit status, which a pipeline or merge check can depend on
+var StatusName = "the-cla"
+
+// Enabled tells if GitLab merge requests are evaluated.
+func Enabled() bool {
+	return Token() != ""
+}
+
+// accessLevelDeveloper is the lowest role allowed to push to a project
+const accessLevelDeveloper = 30
+
+type user struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Bot      bool   `json:"bot"`
+}
+
+type commit struct {
+	ID          string `json:"id"`
+	AuthorName  string `json:"author_name"`
+	AuthorEmail string `json:"author_email"`
+	WebURL      string `json:"web_url"`
+}
+
+type signature struct {
+	VerificationStatus string `json:"verification_status"`
+}
+
+type note struct {
+	Body string `json:"body"`
+}
+
+type member struct {
+	AccessLevel int `json:"access_level"`
+}
+
+type mergeRequest struct {
+	State string `json:"state"`
+	SHA   string `json:"sha"`
+}
+
+// Provider is the vcs.Provider for GitLab merge requests. EvaluationInfo.RepoId is the project ID, and
+// EvaluationInfo.PRNumber is the IID of the merge request in its project.
+type Provider struct {
+	logger *zap.Logger
+	client *Client
+	// usersByEmail caches the user of each commit author for the evaluation the provider is created for
+	usersByEmail map[string]*user
+}
+
+var _ vcs.Provider = (*Provider)(nil)
+
+func NewProvider(logger *zap.Logger, client *Client) *Provider {
+	return &Provider{logger: logger, client: client, usersByEmail: make(map[string]*user)}
+}
+
+func (p *Provider) Name() string {
+	return vcs.ProviderGitLab
+}
+
+func mergeRequestPath(evalInfo *types.EvaluationInfo) string {
+	return projectPath(evalInfo.RepoId) + "/merge_requests/" + strconv.FormatInt(evalInfo.PRNumber, 10)
+}
+
+func (p *Provider) ListCommits(ctx context.Context, evalInfo *types.EvaluationInfo) (commits []vcs.Commit, err error) {
+	mrCommits, err := listAll[commit](ctx, p.client, mergeRequestPath(evalInfo)+"/commits", nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range mrCommits {
+		author, err := p.userByEmail(ctx, c.AuthorEmail)
+		if err != nil {
+			return nil, err
+		}
+		verified, err := p.isVerified(ctx, evalInfo.RepoId, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		listed := vcs.Commit{
+			SHA:         c.ID,
+			URL:         c.WebURL,
+			AuthorEmail: c.AuthorEmail,
+			AuthorName:  c.AuthorName,
+			Verified:    verified,
+		}
+		if author != nil {
+			listed.AuthorLogin = author.Username
+			listed.AuthorBot = author.Bot
+		}
+		commits = append(commits, listed)
+	}
+	return
+}
+
+// userByEmail finds the user a commit author email belongs to, or returns nil if there is none. Only public
+// emails can be found, unless the token belongs to an administrator.
+func (p *Provider) userByEmail(ctx context.Context, email string) (*user, error) {
+	if email == "" {
+		return nil, nil
+	}
+	if found, cached := p.usersByEmail[email]; cached {
+		return found, nil
+	}
+	var users []*user
+	if _, err := p.client.do(ctx, http.MethodGet, "/users", url.Values{"search": {email}}, nil, &users); err != nil {
+		return nil, err
+	}
+	var found *user
+	// the search matches names too, so anything but a single match is ambiguous
+	if len(users) == 1 {
+		found = users[0]
+	}
+	p.usersByEmail[email] = found
+	return found, nil
+}
+
+// isVerified tells if a commit has a verified signature, GitLab knows no signature for unsigned commits.
+func (p *Provider) isVerified(ctx context.Context, projectId int64, sha string) (bool, error) {
+	var commitSignature signature
+	_, err := p.client.do(ctx, http.MethodGet, projectPath(projectId)+"/repository/commits/"+url.PathEscape(sha)+"/signature", nil, nil, &commitSignature)
+	if isStatus(err, http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return commitSignature.VerificationStatus == "verified", nil
+}
+
+// statusStates maps our states to those of GitLab commit statuses
+var statusStates = map[string]string{
+	"pending": "pending",
+	"success": "success",
+	"failure": "failed",
+	"error":   "failed",
+}
+
+func (p *Provider) SetStatus(ctx context.Context, evalInfo *types.EvaluationInfo, state, description string) error {
+	gitlabState, ok := statusStates[state]
+	if !ok {
+		return fmt.Errorf("unknown status state: %s", state)
+	}
+	status := map[string]string{
+		"state":       gitlabState,
+		"name":        StatusName,
+		"description": description,
+	}
+	_, err := p.client.do(ctx, http.MethodPost, projectPath(evalInfo.RepoId)+"/statuses/"+url.PathEscape(evalInfo.Sha), nil, status, nil)
+	// GitLab refuses to set a status to the state it already has
+	if isStatus(err, http.StatusBadRequest) && strings.Contains(err.Error(), "Cannot transition status") {
+		p.logger.Debug("status unchanged", zap.String("state", gitlabState))
+		return nil
+	}
+	return err
+}
+
+func (p *Provider) AddLabel(ctx context.Context, evalInfo *types.EvaluationInfo, name, color, description string) error {
+	label := map[string]string{
+		"name":        name,
+		"color":       "#" + strings.TrimPrefix(color, "#"),
+		"description": description,
+	}
+	_, err := p.client.do(ctx, http.MethodPost, projectPath(evalInfo.RepoId)+"/labels", nil, label, nil)
+	if err != nil && !isStatus(err, http.StatusConflict) {
+		return err
+	}
+	// adding a label the merge request has already changes nothing
+	_, err = p.client.do(ctx, http.MethodPut, mergeRequestPath(evalInfo), nil, map[string]string{"add_labels": name}, nil)
+	return err
+}
+
+func (p *Provider) RemoveLabel(ctx context.Context, evalInfo *types.EvaluationInfo, name string) error {
+	_, err := p.client.do(ctx, http.MethodPut, mergeRequestPath(evalInfo), nil, map[string]string{"remove_labels": name}, nil)
+	return err
+}
+
+func (p *Provider) Comment(ctx context.Context, evalInfo *types.EvaluationInfo, body string) error {
+	notes, err := listAll[note](ctx, p.client, mergeRequestPath(evalInfo)+"/notes", nil)
+	if err != nil {
+		return err
+	}
+	for _, existing := range notes {
+		if existing.Body == body {
+			return nil
+		}
+	}
+	_, err = p.client.do(ctx, http.MethodPost, mergeRequestPath(evalInfo)+"/notes", nil, map[string]string{"body": body}, nil)
+	return err
+}
+
+// MembershipReason exempts project members allowed to push (Developer and above, including inherited group
+// memberships), if the exemption policy exempts collaborators. Other policies only apply to GitHub.
+func (p *Provider) MembershipReason(ctx context.Context, evalInfo *types.EvaluationInfo, login string) (string, error) {
+	if !ourGithub.Exemptions.Collaborators {
+		return "", nil
+	}
+	var users []*user
+	if _, err := p.client.do(ctx, http.MethodGet, "/users", url.Values{"username": {login}}, nil, &users); err != nil || len(users) == 0 {
+		return "", err
+	}
+	var projectMember member
+	_, err := p.client.do(ctx, http.MethodGet, projectPath(evalInfo.RepoId)+"/members/all/"+strconv.FormatInt(users[0].ID, 10), nil, nil, &projectMember)
+	if isStatus(err, http.StatusNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if projectMember.AccessLevel >= accessLevelDeveloper {
+		return ourGithub.ExemptionReasonCollaborator, nil
+	}
+	return "", nil
+}
+
+// ChangeURL is the page of the merge request. RepoOwner is the full path of the namespace of the project.
+func (p *Provider) ChangeURL(evalInfo *types.EvaluationInfo) string {
+	return fmt.Sprintf("%s/%s/%s/-/merge_requests/%d", p.client.baseURL, evalInfo.RepoOwner, url.PathEscape(evalInfo.RepoName), evalInfo.PRNumber)
+}
+
+// EvaluateMergeRequest evaluates a merge request, and is the evaluator of tracked GitLab merge requests, see
+// github.RegisterEvaluator.
+func EvaluateMergeRequest(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, claVersion string) error {
+	if !Enabled() {
+		return errors.New("gitlab is not configured")
+	}
+	provider := NewProvider(logger, NewClient(BaseURL, Token()))
+	return ourGithub.EvaluateChange(logger, postgres, provider, evalInfo, SignURL, claVersion)
+}
+
+// Head reads the head commit of the merge request, and tells if it is still open.
+func (p *Provider) Head(ctx context.Context, evalInfo *types.EvaluationInfo) (sha string, open bool, err error) {
+	var mr mergeRequest
+	if _, err = p.client.do(ctx, http.MethodGet, mergeRequestPath(evalInfo), nil, nil, &mr); err != nil {
+		return
+	}
+	return mr.SHA, mr.State == "opened", nil
+}
+
+// MergeRequestHead reads the head of a tracked merge request, and is the head reader of GitLab merge requests, see
+// github.RegisterHeadReader.
+func MergeRequestHead(logger *zap.Logger, evalInfo *types.EvaluationInfo) (string, bool, error) {
+	if !Enabled() {
+		return "", false, errors.New("gitlab is not configured")
+	}
+	return NewProvider(logger, NewClient(BaseURL, Token())).Head(context.Background(), evalInfo)
+}
+
+// EventMergeRequest is the X-Gitlab-Event of merge request webhooks
+const EventMergeRequest = "Merge Request Hook"
+
+var (
+	ErrInvalidToken     = errors.New("invalid gitlab webhook token")
+	ErrUnsupportedEvent = errors.New("unsupported gitlab event")
+)
+
+// MergeRequestPayload is the part of a merge request webhook we need.
+type MergeRequestPayload struct {
+	Project struct {
+		ID                int64  `json:"id"`
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID    int64  `json:"iid"`
+		Action string `json:"action"`
+		// OldRev is set on updates which pushed new commits
+		OldRev     string `json:"oldrev"`
+		Draft      bool   `json:"draft"`
+		LastCommit struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+	Changes struct {
+		Draft *struct {
+			Previous bool `json:"previous"`
+			Current  bool `json:"current"`
+		} `json:"draft"`
+	} `json:"changes"`
+}
+
+// ParseMergeRequestEvent checks the secret token of a merge request webhook and parses it.
+func ParseMergeRequestEvent(r *http.Request, secret string) (*MergeRequestPayload, error) {
+	token := r.Header.Get("X-Gitlab-Token")
+	if secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	if r.Header.Get("X-Gitlab-Event") != EventMergeRequest {
+		return nil, ErrUnsupportedEvent
+	}
+	var payload MergeRequestPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	return &payload, nil
+}
+
+// NeedsEvaluation tells if the merge request is new, or got new commits, or is no longer a draft.
+func (p *MergeRequestPayload) NeedsEvaluation() bool {
+	switch p.ObjectAttributes.Action {
+	case "open", "reopen":
+		return true
+	case "update":
+		return p.ObjectAttributes.OldRev != "" || (p.Changes.Draft != nil && !p.Changes.Draft.Current)
+	}
+	return false
+}
+
+// evaluationInfo returns the evaluation of the merge request of a webhook.
+func (p *MergeRequestPayload) evaluationInfo() *types.EvaluationInfo {
+	namespace, name := "", p.Project.PathWithNamespace
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		namespace, name = name[:i], name[i+1:]
+	}
+	return &types.EvaluationInfo{
+		Provider:  vcs.ProviderGitLab,
+		RepoId:    p.Project.ID,
+		RepoOwner: namespace,
+		RepoName:  name,
+		Sha:       p.ObjectAttributes.LastCommit.ID,
+		PRNumber:  p.ObjectAttributes.IID,
+	}
+}
+
+// HandleMergeRequest evaluates the merge request of a webhook. Drafts are left alone while drafts are skipped, see
+// github.SkipDrafts.
+func HandleMergeRequest(logger *zap.Logger, postgres db.IClaDB, payload *MergeRequestPayload, claVersion string) error {
+	evalInfo := payload.evaluationInfo()
+	if ourGithub.SkipDrafts && payload.ObjectAttributes.Draft {
+		logger.Debug("skip draft merge request",
+			zap.Int64("projectId", evalInfo.RepoId),
+			zap.Int64("mergeRequestIID", evalInfo.PRNumber),
+		)
+		return nil
+	}
+	return EvaluateMergeRequest(logger, postgres, evalInfo, claVersion)
+}
@@ -0,0 +1,347 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+
+	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+func testEvalInfo() *types.EvaluationInfo {
+	return &types.EvaluationInfo{Provider: vcs.ProviderGitLab, RepoId: 7, RepoOwner: "group/sub", RepoName: "project", Sha: "headSHA", PRNumber: 3}
+}
+
+// setupGitLab serves the endpoints of a fake GitLab instance, and returns a provider talking to it.
+func setupGitLab(t *testing.T, routes map[string]http.HandlerFunc) (provider *Provider, closeServer func()) {
+	mux := http.NewServeMux()
+	for pattern, handler := range routes {
+		mux.HandleFunc(pattern, handler)
+	}
+	server := httptest.NewServer(mux)
+	return NewProvider(zaptest.NewLogger(t), NewClient(server.URL, "myToken")), server.Close
+}
+
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, body)
+	}
+}
+
+func respondStatus(statusCode int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		_, _ = fmt.Fprint(w, body)
+	}
+}
+
+// decodeInto records the JSON body of a request
+func decodeInto(t *testing.T, body *map[string]string, statusCode int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(body))
+		w.WriteHeader(statusCode)
+		_, _ = fmt.Fprint(w, `{}`)
+	}
+}
+
+func TestListCommits(t *testing.T) {
+	userSearches := 0
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/7/merge_requests/3/commits": respond(`[
+			{"id": "sha1", "author_name": "Alice", "author_email": "alice@example.com", "web_url": "https://gitlab.example.com/sha1"},
+			{"id": "sha2", "author_name": "Alice", "author_email": "alice@example.com", "web_url": "https://gitlab.example.com/sha2"},
+			{"id": "sha3", "author_name": "Nobody", "author_email": "nobody@example.com", "web_url": "https://gitlab.example.com/sha3"}
+		]`),
+		"GET /api/v4/users": func(w http.ResponseWriter, r *http.Request) {
+			userSearches++
+			if r.URL.Query().Get("search") == "alice@example.com" {
+				_, _ = fmt.Fprint(w, `[{"id": 5, "username": "alice", "bot": false}]`)
+				return
+			}
+			_, _ = fmt.Fprint(w, `[]`)
+		},
+		"GET /api/v4/projects/7/repository/commits/sha1/signature": respond(`{"verification_status": "verified"}`),
+		"GET /api/v4/projects/7/repository/commits/sha2/signature": respond(`{"verification_status": "unverified"}`),
+		"GET /api/v4/projects/7/repository/commits/sha3/signature": respondStatus(http.StatusNotFound, `{"message":"404 Not found"}`),
+	})
+	defer closeServer()
+
+	commits, err := provider.ListCommits(context.Background(), testEvalInfo())
+	assert.NoError(t, err)
+	assert.Equal(t, []vcs.Commit{
+		{SHA: "sha1", URL: "https://gitlab.example.com/sha1", AuthorLogin: "alice", AuthorEmail: "alice@example.com", AuthorName: "Alice", Verified: true},
+		{SHA: "sha2", URL: "https://gitlab.example.com/sha2", AuthorLogin: "alice", AuthorEmail: "alice@example.com", AuthorName: "Alice"},
+		{SHA: "sha3", URL: "https://gitlab.example.com/sha3", AuthorEmail: "nobody@example.com", AuthorName: "Nobody"},
+	}, commits)
+	// authors are only looked up once
+	assert.Equal(t, 2, userSearches)
+}
+
+func TestListCommitsError(t *testing.T) {
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/7/merge_requests/3/commits": respondStatus(http.StatusForbidden, "forbidden"),
+	})
+	defer closeServer()
+
+	_, err := provider.ListCommits(context.Background(), testEvalInfo())
+	assert.EqualError(t, err, "gitlab: 403 forbidden")
+}
+
+func TestSetStatus(t *testing.T) {
+	var status map[string]string
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"POST /api/v4/projects/7/statuses/headSHA": decodeInto(t, &status, http.StatusCreated),
+	})
+	defer closeServer()
+
+	assert.NoError(t, provider.SetStatus(context.Background(), testEvalInfo(), "failure", "sign please"))
+	assert.Equal(t, map[string]string{"state": "failed", "name": StatusName, "description": "sign please"}, status)
+
+	assert.EqualError(t, provider.SetStatus(context.Background(), testEvalInfo(), "weird", ""), "unknown status state: weird")
+}
+
+func TestSetStatusUnchanged(t *testing.T) {
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"POST /api/v4/projects/7/statuses/headSHA": respondStatus(http.StatusBadRequest, `{"message":"Cannot transition status via :enqueue from :pending"}`),
+	})
+	defer closeServer()
+
+	assert.NoError(t, provider.SetStatus(context.Background(), testEvalInfo(), "pending", "running"))
+}
+
+func TestAddLabel(t *testing.T) {
+	var label, update map[string]string
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"POST /api/v4/projects/7/labels":          decodeInto(t, &label, http.StatusConflict),
+		"PUT /api/v4/projects/7/merge_requests/3": decodeInto(t, &update, http.StatusOK),
+	})
+	defer closeServer()
+
+	assert.NoError(t, provider.AddLabel(context.Background(), testEvalInfo(), "cla:signed", "0e8a16", "signed"))
+	assert.Equal(t, map[string]string{"name": "cla:signed", "color": "#0e8a16", "description": "signed"}, label)
+	assert.Equal(t, map[string]string{"add_labels": "cla:signed"}, update)
+}
+
+func TestAddLabelError(t *testing.T) {
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"POST /api/v4/projects/7/labels": respondStatus(http.StatusForbidden, "forbidden"),
+	})
+	defer closeServer()
+
+	assert.EqualError(t, provider.AddLabel(context.Background(), testEvalInfo(), "cla:signed", "0e8a16", "signed"), "gitlab: 403 forbidden")
+}
+
+func TestRemoveLabel(t *testing.T) {
+	var update map[string]string
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"PUT /api/v4/projects/7/merge_requests/3": decodeInto(t, &update, http.StatusOK),
+	})
+	defer closeServer()
+
+	assert.NoError(t, provider.RemoveLabel(context.Background(), testEvalInfo(), "cla:missing"))
+	assert.Equal(t, map[string]string{"remove_labels": "cla:missing"}, update)
+}
+
+func TestComment(t *testing.T) {
+	var created map[string]string
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/7/merge_requests/3/notes":  respond(`[{"body": "already said"}]`),
+		"POST /api/v4/projects/7/merge_requests/3/notes": decodeInto(t, &created, http.StatusCreated),
+	})
+	defer closeServer()
+
+	assert.NoError(t, provider.Comment(context.Background(), testEvalInfo(), "already said"))
+	assert.Nil(t, created)
+
+	assert.NoError(t, provider.Comment(context.Background(), testEvalInfo(), "please sign"))
+	assert.Equal(t, map[string]string{"body": "please sign"}, created)
+}
+
+func TestMembershipReason(t *testing.T) {
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"GET /api/v4/users": func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Query().Get("username") {
+			case "developer":
+				_, _ = fmt.Fprint(w, `[{"id": 1, "username": "developer"}]`)
+			case "reporter":
+				_, _ = fmt.Fprint(w, `[{"id": 2, "username": "reporter"}]`)
+			case "outsider":
+				_, _ = fmt.Fprint(w, `[{"id": 3, "username": "outsider"}]`)
+			default:
+				_, _ = fmt.Fprint(w, `[]`)
+			}
+		},
+		"GET /api/v4/projects/7/members/all/1": respond(`{"access_level": 30}`),
+		"GET /api/v4/projects/7/members/all/2": respond(`{"access_level": 20}`),
+		"GET /api/v4/projects/7/members/all/3": respondStatus(http.StatusNotFound, "not found"),
+	})
+	defer closeServer()
+
+	for login, expected := range map[string]string{
+		"developer": ourGithub.ExemptionReasonCollaborator,
+		"reporter":  "",
+		"outsider":  "",
+		"unknown":   "",
+	} {
+		reason, err := provider.MembershipReason(context.Background(), testEvalInfo(), login)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, reason, login)
+	}
+}
+
+func TestMembershipReasonPolicyOff(t *testing.T) {
+	origExemptions := ourGithub.Exemptions
+	defer func() {
+		ourGithub.Exemptions = origExemptions
+	}()
+	ourGithub.Exemptions = ourGithub.ExemptionPolicy{}
+
+	provider, closeServer := setupGitLab(t, nil)
+	defer closeServer()
+
+	reason, err := provider.MembershipReason(context.Background(), testEvalInfo(), "developer")
+	assert.NoError(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestChangeURL(t *testing.T) {
+	provider := NewProvider(zaptest.NewLogger(t), NewClient("https://gitlab.example.com/", "myToken"))
+	assert.Equal(t, "https://gitlab.example.com/group/sub/project/-/merge_requests/3", provider.ChangeURL(testEvalInfo()))
+}
+
+func TestEvaluateMergeRequestNotConfigured(t *testing.T) {
+	origToken := Token()
+	defer func() {
+		SetToken(origToken)
+	}()
+	SetToken("")
+
+	assert.EqualError(t, EvaluateMergeRequest(zaptest.NewLogger(t), nil, testEvalInfo(), "1"), "gitlab is not configured")
+}
+
+func TestHead(t *testing.T) {
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/7/merge_requests/3": respond(`{"iid": 3, "state": "opened", "sha": "newHeadSHA"}`),
+	})
+	defer closeServer()
+
+	sha, open, err := provider.Head(context.Background(), testEvalInfo())
+	assert.NoError(t, err)
+	assert.True(t, open)
+	assert.Equal(t, "newHeadSHA", sha)
+}
+
+func TestHeadMerged(t *testing.T) {
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/7/merge_requests/3": respond(`{"iid": 3, "state": "merged", "sha": "headSHA"}`),
+	})
+	defer closeServer()
+
+	_, open, err := provider.Head(context.Background(), testEvalInfo())
+	assert.NoError(t, err)
+	assert.False(t, open)
+}
+
+func TestHeadError(t *testing.T) {
+	provider, closeServer := setupGitLab(t, map[string]http.HandlerFunc{
+		"GET /api/v4/projects/7/merge_requests/3": respondStatus(http.StatusNotFound, "not found"),
+	})
+	defer closeServer()
+
+	_, _, err := provider.Head(context.Background(), testEvalInfo())
+	assert.EqualError(t, err, "gitlab: 404 not found")
+}
+
+func TestMergeRequestHeadNotConfigured(t *testing.T) {
+	origToken := Token()
+	defer func() {
+		SetToken(origToken)
+	}()
+	SetToken("")
+
+	_, _, err := MergeRequestHead(zaptest.NewLogger(t), testEvalInfo())
+	assert.EqualError(t, err, "gitlab is not configured")
+}
+
+const testMergeRequestPayload = `{
+	"object_kind": "merge_request",
+	"project": {"id": 7, "path_with_namespace": "group/sub/project"},
+	"object_attributes": {"iid": 3, "action": "update", "oldrev": "oldSHA", "draft": false, "last_commit": {"id": "headSHA"}}
+}`
+
+func mergeRequestHook(token, event string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhook-gitlab", strings.NewReader(testMergeRequestPayload))
+	req.Header.Set("X-Gitlab-Token", token)
+	req.Header.Set("X-Gitlab-Event", event)
+	return req
+}
+
+func TestParseMergeRequestEvent(t *testing.T) {
+	payload, err := ParseMergeRequestEvent(mergeRequestHook("mySecret", EventMergeRequest), "mySecret")
+	assert.NoError(t, err)
+	assert.True(t, payload.NeedsEvaluation())
+	assert.Equal(t, testEvalInfo(), payload.evaluationInfo())
+}
+
+func TestParseMergeRequestEventInvalid(t *testing.T) {
+	_, err := ParseMergeRequestEvent(mergeRequestHook("wrong", EventMergeRequest), "mySecret")
+	assert.Equal(t, ErrInvalidToken, err)
+
+	_, err = ParseMergeRequestEvent(mergeRequestHook("", EventMergeRequest), "")
+	assert.Equal(t, ErrInvalidToken, err)
+
+	_, err = ParseMergeRequestEvent(mergeRequestHook("mySecret", "Push Hook"), "mySecret")
+	assert.Equal(t, ErrUnsupportedEvent, err)
+}
+
+func TestNeedsEvaluation(t *testing.T) {
+	payload := MergeRequestPayload{}
+	for action, expected := range map[string]bool{"open": true, "reopen": true, "update": false, "close": false, "merge": false} {
+		payload.ObjectAttributes.Action = action
+		assert.Equal(t, expected, payload.NeedsEvaluation(), action)
+	}
+
+	payload.ObjectAttributes.Action = "update"
+	payload.Changes.Draft = &struct {
+		Previous bool `json:"previous"`
+		Current  bool `json:"current"`
+	}{Previous: true, Current: false}
+	assert.True(t, payload.NeedsEvaluation())
+}
+
+func TestHandleMergeRequestSkipsDrafts(t *testing.T) {
+	origSkipDrafts := ourGithub.SkipDrafts
+	defer func() {
+		ourGithub.SkipDrafts = origSkipDrafts
+	}()
+	ourGithub.SkipDrafts = true
+
+	payload := &MergeRequestPayload{}
+	payload.ObjectAttributes.Draft = true
+	assert.NoError(t, HandleMergeRequest(zaptest.NewLogger(t), nil, payload, "1"))
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"golang.org/x/oauth2"
+)
+
+var ErrInvalidState = errors.New("invalid OAuth state, please log in again")
+
+// LoginAttempt is what we remember about a login while the user is away authorizing us on GitHub. It is kept in a
+// cookie, so the callback only accepts the state we sent this very browser to GitHub with.
+type LoginAttempt struct {
+	State string `json:"state"`
+	// Verifier is the PKCE code verifier, GitHub only gets its challenge until we exchange the code
+	Verifier    string `json:"verifier"`
+	RedirectURI string `json:"redirectUri,omitempty"`
+	// ReturnTo is what the frontend asked to come back to, i.e. a signing link or where to go once signed
+	ReturnTo string `json:"returnTo,omitempty"`
+	// Provider is where the user logs in, see package vcs. Empty means GitHub.
+	Provider string `json:"provider,omitempty"`
+}
+
+func NewLoginAttempt(redirectURI, returnTo string) (attempt *LoginAttempt, err error) {
+	state := make([]byte, 32)
+	if _, err = rand.Read(state); err != nil {
+		return
+	}
+	return &LoginAttempt{
+		State:       base64.RawURLEncoding.EncodeToString(state),
+		Verifier:    oauth2.GenerateVerifier(),
+		RedirectURI: redirectURI,
+		ReturnTo:    returnTo,
+	}, nil
+}
+
+// Encode returns the attempt as a cookie value.
+func (a *LoginAttempt) Encode() (string, error) {
+	encoded, err := json.Marshal(a)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+// DecodeLoginAttempt reads an attempt from its cookie value, and checks the state GitHub sent back is ours.
+func DecodeLoginAttempt(value, state string) (*LoginAttempt, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	var attempt LoginAttempt
+	if err = json.Unmarshal(decoded, &attempt); err != nil || attempt.State == "" || attempt.Verifier == "" {
+		return nil, ErrInvalidState
+	}
+	if subtle.ConstantTimeCompare([]byte(attempt.State), []byte(state)) != 1 {
+		return nil, ErrInvalidState
+	}
+	return &attempt, nil
+}
+
+func (a *LoginAttempt) options() (opts []oauth2.AuthCodeOption) {
+	if a.RedirectURI != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("redirect_uri", a.RedirectURI))
+	}
+	return
+}
@@ -0,0 +1,67 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package oauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLoginAttempt(t *testing.T) {
+	attempt, err := NewLoginAttempt("https://cla.example.com/", "https://example.com")
+	assert.NoError(t, err)
+	assert.Len(t, attempt.State, 43)
+	assert.NotEmpty(t, attempt.Verifier)
+	assert.Equal(t, "https://cla.example.com/", attempt.RedirectURI)
+	assert.Equal(t, "https://example.com", attempt.ReturnTo)
+
+	other, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+	assert.NotEqual(t, attempt.State, other.State)
+	assert.NotEqual(t, attempt.Verifier, other.Verifier)
+}
+
+func TestDecodeLoginAttempt(t *testing.T) {
+	attempt, err := NewLoginAttempt("https://cla.example.com/", "https://example.com")
+	assert.NoError(t, err)
+	value, err := attempt.Encode()
+	assert.NoError(t, err)
+
+	decoded, err := DecodeLoginAttempt(value, attempt.State)
+	assert.NoError(t, err)
+	assert.Equal(t, attempt, decoded)
+}
+
+func TestDecodeLoginAttemptInvalid(t *testing.T) {
+	attempt, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+	value, err := attempt.Encode()
+	assert.NoError(t, err)
+
+	_, err = DecodeLoginAttempt(value, "otherState")
+	assert.Equal(t, ErrInvalidState, err)
+	_, err = DecodeLoginAttempt(value, "")
+	assert.Equal(t, ErrInvalidState, err)
+
+	withoutVerifier, err := (&LoginAttempt{State: attempt.State}).Encode()
+	assert.NoError(t, err)
+	for _, invalid := range []string{"", "!!", "bm90IGpzb24", withoutVerifier} {
+		_, err = DecodeLoginAttempt(invalid, attempt.State)
+		assert.Equal(t, ErrInvalidState, err, invalid)
+	}
+}
@@ -20,12 +20,16 @@ package oauth
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"go.uber.org/zap"
 
 	"github.com/google/go-github/v64/github"
 	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
 	"golang.org/x/oauth2"
 	githuboauth "golang.org/x/oauth2/github"
 )
@@ -35,18 +39,22 @@ var githubImpl ourGithub.GHInterface = &ourGithub.GHCreator{}
 type OAuthInterface interface {
 	Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error)
 	Client(ctx context.Context, t *oauth2.Token) *http.Client
-	GetOAuthUser(logger *zap.Logger, code string) (user *github.User, err error)
+	// AuthCodeURL is where to send the user to authorize us for a login attempt
+	AuthCodeURL(attempt *LoginAttempt) string
+	GetOAuthUser(logger *zap.Logger, code string, attempt *LoginAttempt) (user *github.User, err error)
 	// for testing only
 	getConf() *oauth2.Config
 }
 
 type OAuthImpl struct {
 	oauthConf *oauth2.Config
+	// getUser gets the logged in user with an authorized client, GitHub users by default
+	getUser func(ctx context.Context, client *http.Client) (*github.User, error)
 }
 
 //goland:noinspection GoUnusedParameter
 func (oa *OAuthImpl) Exchange(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, error) {
-	return oa.oauthConf.Exchange(ctx, code)
+	return oa.oauthConf.Exchange(ctx, code, opts...)
 }
 func (oa *OAuthImpl) Client(ctx context.Context, t *oauth2.Token) *http.Client {
 	return oa.oauthConf.Client(ctx, t)
@@ -55,18 +63,25 @@ func (oa *OAuthImpl) getConf() *oauth2.Config {
 	return oa.oauthConf
 }
 
-func (oa *OAuthImpl) GetOAuthUser(logger *zap.Logger, code string) (user *github.User, err error) {
-	token, err := oa.Exchange(context.Background(), code)
+func (oa *OAuthImpl) AuthCodeURL(attempt *LoginAttempt) string {
+	return oa.oauthConf.AuthCodeURL(attempt.State, append(attempt.options(), oauth2.S256ChallengeOption(attempt.Verifier))...)
+}
+
+func (oa *OAuthImpl) GetOAuthUser(logger *zap.Logger, code string, attempt *LoginAttempt) (user *github.User, err error) {
+	token, err := oa.Exchange(context.Background(), code, append(attempt.options(), oauth2.VerifierOption(attempt.Verifier))...)
 	if err != nil {
 		logger.Error("failed to get oauth user", zap.Error(err))
 		return
 	}
 
+	// the token is only used to read the user once, and never stored
 	oauthClient := oa.Client(context.Background(), token)
 
-	client := githubImpl.NewClient(oauthClient)
-
-	user, _, err = client.Users.Get(context.Background(), "")
+	getUser := oa.getUser
+	if getUser == nil {
+		getUser = getGitHubUser
+	}
+	user, err = getUser(context.Background(), oauthClient)
 	if err != nil {
 		logger.Error("failed to get oauth client user", zap.Error(err))
 		return
@@ -75,14 +90,32 @@ func (oa *OAuthImpl) GetOAuthUser(logger *zap.Logger, code string) (user *github
 	return
 }
 
-const envReactAppGithubClientId = "REACT_APP_GITHUB_CLIENT_ID"
-const envGithubClientSecret = "GITHUB_CLIENT_SECRET"
+func getGitHubUser(ctx context.Context, oauthClient *http.Client) (user *github.User, err error) {
+	client, err := githubImpl.NewUserClient(oauthClient, nil)
+	if err != nil {
+		return nil, err
+	}
+	user, _, err = client.Users.Get(ctx, "")
+	return
+}
 
+// CreateOAuth authenticates signers with a separate OAuth app.
 func CreateOAuth(clientID, clientSecret string) OAuthInterface {
+	return createOAuth(clientID, clientSecret, []string{"user:email"})
+}
+
+// CreateGitHubAppOAuth authenticates signers with the user authorization flow of our GitHub App, so no separate OAuth
+// app is needed. GitHub Apps have no scopes, reading email addresses needs the app's "Email addresses" permission
+// instead. Their user tokens, like those of OAuth apps, are used once to read the signer and then discarded.
+func CreateGitHubAppOAuth(clientID, clientSecret string) OAuthInterface {
+	return createOAuth(clientID, clientSecret, nil)
+}
+
+func createOAuth(clientID, clientSecret string, scopes []string) OAuthInterface {
 	oauthConf := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
-		Scopes:       []string{"user:email"},
+		Scopes:       scopes,
 		Endpoint:     githuboauth.Endpoint,
 	}
 	oAuthImpl := OAuthImpl{
@@ -90,3 +123,136 @@ func CreateOAuth(clientID, clientSecret string) OAuthInterface {
 	}
 	return &oAuthImpl
 }
+
+// CreateEnterpriseOAuth authenticates signers of PRs of a GitHub Enterprise Server instance with an app of the
+// instance. Like for GitLab, the login of the returned user is qualified by the provider, the name of the host.
+func CreateEnterpriseOAuth(host *ourGithub.Host) OAuthInterface {
+	return &OAuthImpl{
+		oauthConf: &oauth2.Config{
+			ClientID:     host.ClientID,
+			ClientSecret: host.ClientSecret,
+			Scopes:       []string{"user:email"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  host.WebURL + "/login/oauth/authorize",
+				TokenURL: host.WebURL + "/login/oauth/access_token",
+			},
+		},
+		getUser: func(ctx context.Context, oauthClient *http.Client) (*github.User, error) {
+			return getEnterpriseUser(ctx, oauthClient, host)
+		},
+	}
+}
+
+func getEnterpriseUser(ctx context.Context, oauthClient *http.Client, host *ourGithub.Host) (*github.User, error) {
+	client, err := githubImpl.NewUserClient(oauthClient, host)
+	if err != nil {
+		return nil, err
+	}
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	if user.GetLogin() == "" {
+		return nil, fmt.Errorf("%s user without login", host.Name)
+	}
+	user.Login = github.String(vcs.QualifiedLogin(host.Name, user.GetLogin()))
+	return user, nil
+}
+
+// CreateGitLabOAuth authenticates signers of GitLab merge requests with an OAuth application of the GitLab instance
+// at baseURL. The user is returned as a GitHub user, whose login is qualified by the provider, see
+// vcs.QualifiedLogin.
+func CreateGitLabOAuth(baseURL, clientID, clientSecret string) OAuthInterface {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &OAuthImpl{
+		oauthConf: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Scopes:       []string{"read_user"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  baseURL + "/oauth/authorize",
+				TokenURL: baseURL + "/oauth/token",
+			},
+		},
+		getUser: func(ctx context.Context, oauthClient *http.Client) (*github.User, error) {
+			return getGitLabUser(ctx, oauthClient, baseURL)
+		},
+	}
+}
+
+// getProviderUser decodes the logged in user of a provider other than GitHub from its API.
+func getProviderUser(ctx context.Context, oauthClient *http.Client, provider, userURL string, providerUser any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, userURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected %s user response code: %d", provider, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(providerUser)
+}
+
+func getGitLabUser(ctx context.Context, oauthClient *http.Client, baseURL string) (*github.User, error) {
+	var gitlabUser struct {
+		Username string `json:"username"`
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+	}
+	if err := getProviderUser(ctx, oauthClient, vcs.ProviderGitLab, baseURL+"/api/v4/user", &gitlabUser); err != nil {
+		return nil, err
+	}
+	if gitlabUser.Username == "" {
+		return nil, fmt.Errorf("gitlab user without username")
+	}
+	return &github.User{
+		Login: github.String(vcs.QualifiedLogin(vcs.ProviderGitLab, gitlabUser.Username)),
+		Name:  github.String(gitlabUser.Name),
+		Email: github.String(gitlabUser.Email),
+	}, nil
+}
+
+// CreateGiteaOAuth authenticates signers of Gitea (or Forgejo) pull requests with an OAuth2 application of the
+// instance at baseURL. Like for GitLab, the login of the returned user is qualified by the provider.
+func CreateGiteaOAuth(baseURL, clientID, clientSecret string) OAuthInterface {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &OAuthImpl{
+		oauthConf: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Scopes:       []string{"read:user"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  baseURL + "/login/oauth/authorize",
+				TokenURL: baseURL + "/login/oauth/access_token",
+			},
+		},
+		getUser: func(ctx context.Context, oauthClient *http.Client) (*github.User, error) {
+			return getGiteaUser(ctx, oauthClient, baseURL)
+		},
+	}
+}
+
+func getGiteaUser(ctx context.Context, oauthClient *http.Client, baseURL string) (*github.User, error) {
+	var giteaUser struct {
+		Login    string `json:"login"`
+		FullName string `json:"full_name"`
+		Email    string `json:"email"`
+	}
+	if err := getProviderUser(ctx, oauthClient, vcs.ProviderGitea, baseURL+"/api/v1/user", &giteaUser); err != nil {
+		return nil, err
+	}
+	if giteaUser.Login == "" {
+		return nil, fmt.Errorf("gitea user without login")
+	}
+	return &github.User{
+		Login: github.String(vcs.QualifiedLogin(vcs.ProviderGitea, giteaUser.Login)),
+		Name:  github.String(giteaUser.FullName),
+		Email: github.String(giteaUser.Email),
+	}, nil
+}
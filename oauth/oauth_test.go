@@ -20,7 +20,10 @@ package oauth
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
 
@@ -29,31 +32,14 @@ import (
 	"go.uber.org/zap/zaptest"
 	"golang.org/x/oauth2"
 
+	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+
 	"github.com/stretchr/testify/assert"
 )
 
-func resetEnvVariable(t *testing.T, variableName, originalValue string) {
-	if originalValue == "" {
-		assert.NoError(t, os.Unsetenv(variableName))
-	} else {
-		assert.NoError(t, os.Setenv(variableName, originalValue))
-	}
-}
-
 func TestCreateOAuth(t *testing.T) {
-	origGHClientId := os.Getenv(envReactAppGithubClientId)
-	defer func() {
-		resetEnvVariable(t, envReactAppGithubClientId, origGHClientId)
-	}()
 	forcedClientId := "myGHClientId"
-	assert.NoError(t, os.Setenv(envReactAppGithubClientId, forcedClientId))
-
-	origGHClientSecret := os.Getenv(envGithubClientSecret)
-	defer func() {
-		resetEnvVariable(t, envGithubClientSecret, origGHClientSecret)
-	}()
 	forcedGHClientSecret := "myGHClientSecret"
-	assert.NoError(t, os.Setenv(envGithubClientSecret, forcedGHClientSecret))
 
 	oauth := CreateOAuth(forcedClientId, forcedGHClientSecret)
 
@@ -92,7 +78,11 @@ func (o *OAuthMock) getConf() *oauth2.Config {
 	return nil
 }
 
-func (o *OAuthMock) GetOAuthUser(logger *zap.Logger, code string) (user *github.User, err error) {
+func (o *OAuthMock) AuthCodeURL(attempt *LoginAttempt) string {
+	return "https://github.com/login/oauth/authorize?state=" + attempt.State
+}
+
+func (o *OAuthMock) GetOAuthUser(logger *zap.Logger, code string, attempt *LoginAttempt) (user *github.User, err error) {
 	if o.assertParameters {
 		assert.Equal(o.t, o.getUserLogger, logger)
 		assert.Equal(o.t, o.getUserCode, code)
@@ -114,7 +104,7 @@ func TestGetOAuthUserMock(t *testing.T) {
 	oauth, logger := setupMockOAuth(t, true)
 	oauth.getUserLogger = logger
 
-	user, err := oauth.GetOAuthUser(logger, "")
+	user, err := oauth.GetOAuthUser(logger, "", &LoginAttempt{})
 	assert.Equal(t, (*github.User)(nil), user)
 	assert.Equal(t, nil, err)
 }
@@ -123,7 +113,316 @@ func TestGetOAuthUserFail(t *testing.T) {
 	logger := zaptest.NewLogger(t)
 	oauth := CreateOAuth("myClientId", "myClientSecret")
 
-	user, err := oauth.GetOAuthUser(logger, "myOAuthCode")
+	attempt, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+	user, err := oauth.GetOAuthUser(logger, "myOAuthCode", attempt)
 	assert.Nil(t, user)
 	assert.True(t, err != nil)
 }
+
+func TestAuthCodeURL(t *testing.T) {
+	attempt, err := NewLoginAttempt("https://cla.example.com/", "https://example.com")
+	assert.NoError(t, err)
+
+	authURL, err := url.Parse(CreateOAuth("myClientId", "myClientSecret").AuthCodeURL(attempt))
+	assert.NoError(t, err)
+	query := authURL.Query()
+	assert.Equal(t, "myClientId", query.Get("client_id"))
+	assert.Equal(t, attempt.State, query.Get("state"))
+	assert.Equal(t, "https://cla.example.com/", query.Get("redirect_uri"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, oauth2.S256ChallengeFromVerifier(attempt.Verifier), query.Get("code_challenge"))
+	assert.Equal(t, "user:email", query.Get("scope"))
+}
+
+func TestGetOAuthUserSendsVerifier(t *testing.T) {
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		form = r.PostForm
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	oauth := CreateOAuth("myClientId", "myClientSecret")
+	oauth.getConf().Endpoint.TokenURL = ts.URL
+	attempt, err := NewLoginAttempt("https://cla.example.com/", "")
+	assert.NoError(t, err)
+
+	_, err = oauth.GetOAuthUser(zaptest.NewLogger(t), "myOAuthCode", attempt)
+	assert.Error(t, err)
+	assert.Equal(t, "myOAuthCode", form.Get("code"))
+	assert.Equal(t, attempt.Verifier, form.Get("code_verifier"))
+	assert.Equal(t, "https://cla.example.com/", form.Get("redirect_uri"))
+}
+
+func TestCreateGitHubAppOAuth(t *testing.T) {
+	oauth := CreateGitHubAppOAuth("myAppClientId", "myAppClientSecret")
+
+	assert.Equal(t, "myAppClientId", oauth.getConf().ClientID)
+	assert.Equal(t, "myAppClientSecret", oauth.getConf().ClientSecret)
+	assert.Empty(t, oauth.getConf().Scopes)
+}
+
+// usersStub gets the user from a test server, with the authenticated client it was created with
+type usersStub struct {
+	httpClient *http.Client
+	url        string
+}
+
+func (u *usersStub) Get(ctx context.Context, _ string) (*github.User, *github.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	user := new(github.User)
+	return user, &github.Response{Response: resp}, json.NewDecoder(resp.Body).Decode(user)
+}
+
+type ghStub struct {
+	url string
+}
+
+func (g *ghStub) NewClient(httpClient *http.Client) ourGithub.GHClient {
+	return ourGithub.GHClient{Users: &usersStub{httpClient: httpClient, url: g.url}}
+}
+
+func (g *ghStub) NewEnterpriseClient(httpClient *http.Client, host *ourGithub.Host) (ourGithub.GHClient, error) {
+	return ourGithub.GHClient{Users: &usersStub{httpClient: httpClient, url: host.APIURL + "user"}}, nil
+}
+
+func (g *ghStub) NewUserClient(httpClient *http.Client, host *ourGithub.Host) (ourGithub.GHClient, error) {
+	if host != nil {
+		return g.NewEnterpriseClient(httpClient, host)
+	}
+	return g.NewClient(httpClient), nil
+}
+
+func TestGetOAuthUserRefreshesExpiredToken(t *testing.T) {
+	var grants []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/token":
+			assert.NoError(t, r.ParseForm())
+			grants = append(grants, r.PostForm.Get("grant_type"))
+			if r.PostForm.Get("grant_type") == "refresh_token" {
+				assert.Equal(t, "myRefreshToken", r.PostForm.Get("refresh_token"))
+				_, _ = w.Write([]byte(`{"access_token":"freshToken","token_type":"bearer","expires_in":28800,"refresh_token":"nextRefreshToken","refresh_token_expires_in":15811200}`))
+				return
+			}
+			// already expired by the time it is used
+			_, _ = w.Write([]byte(`{"access_token":"expiredToken","token_type":"bearer","expires_in":1,"refresh_token":"myRefreshToken","refresh_token_expires_in":15811200}`))
+		case "/user":
+			assert.Equal(t, "Bearer freshToken", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"login":"alice"}`))
+		}
+	}))
+	defer ts.Close()
+
+	origGithubImpl := githubImpl
+	githubImpl = &ghStub{url: ts.URL + "/user"}
+	defer func() {
+		githubImpl = origGithubImpl
+	}()
+
+	oauth := CreateGitHubAppOAuth("myAppClientId", "myAppClientSecret")
+	oauth.getConf().Endpoint.TokenURL = ts.URL + "/token"
+	attempt, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+
+	user, err := oauth.GetOAuthUser(zaptest.NewLogger(t), "myOAuthCode", attempt)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.GetLogin())
+	assert.Equal(t, []string{"authorization_code", "refresh_token"}, grants)
+}
+
+func TestCreateGitLabOAuth(t *testing.T) {
+	oauth := CreateGitLabOAuth("https://gitlab.example.com/", "myGitLabClientId", "myGitLabClientSecret")
+
+	assert.Equal(t, "myGitLabClientId", oauth.getConf().ClientID)
+	assert.Equal(t, "myGitLabClientSecret", oauth.getConf().ClientSecret)
+	assert.Equal(t, []string{"read_user"}, oauth.getConf().Scopes)
+	assert.Equal(t, "https://gitlab.example.com/oauth/authorize", oauth.getConf().Endpoint.AuthURL)
+	assert.Equal(t, "https://gitlab.example.com/oauth/token", oauth.getConf().Endpoint.TokenURL)
+}
+
+func TestGetOAuthUserGitLab(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/oauth/token":
+			_, _ = w.Write([]byte(`{"access_token":"gitlabToken","token_type":"bearer","expires_in":7200}`))
+		case "/api/v4/user":
+			assert.Equal(t, "Bearer gitlabToken", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"id":5,"username":"alice","name":"Alice Example","email":"alice@example.com"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	oauth := CreateGitLabOAuth(ts.URL, "myGitLabClientId", "myGitLabClientSecret")
+	attempt, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+
+	user, err := oauth.GetOAuthUser(zaptest.NewLogger(t), "myOAuthCode", attempt)
+	assert.NoError(t, err)
+	assert.Equal(t, "gitlab:alice", user.GetLogin())
+	assert.Equal(t, "Alice Example", user.GetName())
+	assert.Equal(t, "alice@example.com", user.GetEmail())
+}
+
+func TestGetOAuthUserGitLabFail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/oauth/token" {
+			_, _ = w.Write([]byte(`{"access_token":"gitlabToken","token_type":"bearer"}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	oauth := CreateGitLabOAuth(ts.URL, "myGitLabClientId", "myGitLabClientSecret")
+	attempt, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+
+	_, err = oauth.GetOAuthUser(zaptest.NewLogger(t), "myOAuthCode", attempt)
+	assert.EqualError(t, err, "unexpected gitlab user response code: 401")
+}
+
+func TestCreateGiteaOAuth(t *testing.T) {
+	oauth := CreateGiteaOAuth("https://gitea.example.com/", "myGiteaClientId", "myGiteaClientSecret")
+
+	assert.Equal(t, "myGiteaClientId", oauth.getConf().ClientID)
+	assert.Equal(t, "myGiteaClientSecret", oauth.getConf().ClientSecret)
+	assert.Equal(t, []string{"read:user"}, oauth.getConf().Scopes)
+	assert.Equal(t, "https://gitea.example.com/login/oauth/authorize", oauth.getConf().Endpoint.AuthURL)
+	assert.Equal(t, "https://gitea.example.com/login/oauth/access_token", oauth.getConf().Endpoint.TokenURL)
+}
+
+func TestGetOAuthUserGitea(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			_, _ = w.Write([]byte(`{"access_token":"giteaToken","token_type":"bearer","expires_in":3600}`))
+		case "/api/v1/user":
+			assert.Equal(t, "Bearer giteaToken", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"id":5,"login":"alice","full_name":"Alice Example","email":"alice@example.com"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	oauth := CreateGiteaOAuth(ts.URL, "myGiteaClientId", "myGiteaClientSecret")
+	attempt, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+
+	user, err := oauth.GetOAuthUser(zaptest.NewLogger(t), "myOAuthCode", attempt)
+	assert.NoError(t, err)
+	assert.Equal(t, "gitea:alice", user.GetLogin())
+	assert.Equal(t, "Alice Example", user.GetName())
+	assert.Equal(t, "alice@example.com", user.GetEmail())
+}
+
+func TestGetOAuthUserGiteaWithoutLogin(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/login/oauth/access_token" {
+			_, _ = w.Write([]byte(`{"access_token":"giteaToken","token_type":"bearer"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":5}`))
+	}))
+	defer ts.Close()
+
+	oauth := CreateGiteaOAuth(ts.URL, "myGiteaClientId", "myGiteaClientSecret")
+	attempt, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+
+	_, err = oauth.GetOAuthUser(zaptest.NewLogger(t), "myOAuthCode", attempt)
+	assert.EqualError(t, err, "gitea user without login")
+}
+
+func loadTestHost(t *testing.T, webURL string) *ourGithub.Host {
+	hostsFile := t.TempDir() + "/hosts.json"
+	assert.NoError(t, os.WriteFile(hostsFile, []byte(`[{"name":"github.example.com","webURL":"`+webURL+`","appId":5,"keyFile":"key.pem","webhookSecret":"myHostSecret","clientId":"myHostClientId","clientSecret":"myHostClientSecret"}]`), 0600))
+	hosts, err := ourGithub.LoadHosts(hostsFile)
+	assert.NoError(t, err)
+	return hosts["github.example.com"]
+}
+
+func TestCreateEnterpriseOAuth(t *testing.T) {
+	oauth := CreateEnterpriseOAuth(loadTestHost(t, "https://github.example.com/"))
+
+	assert.Equal(t, "myHostClientId", oauth.getConf().ClientID)
+	assert.Equal(t, "myHostClientSecret", oauth.getConf().ClientSecret)
+	assert.Equal(t, []string{"user:email"}, oauth.getConf().Scopes)
+	assert.Equal(t, "https://github.example.com/login/oauth/authorize", oauth.getConf().Endpoint.AuthURL)
+	assert.Equal(t, "https://github.example.com/login/oauth/access_token", oauth.getConf().Endpoint.TokenURL)
+}
+
+func TestGetOAuthUserEnterprise(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			_, _ = w.Write([]byte(`{"access_token":"hostToken","token_type":"bearer"}`))
+		case "/api/v3/user":
+			assert.Equal(t, "Bearer hostToken", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"login":"alice","name":"Alice Example","email":"alice@example.com"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	origGithubImpl := githubImpl
+	githubImpl = &ghStub{}
+	defer func() {
+		githubImpl = origGithubImpl
+	}()
+
+	oauth := CreateEnterpriseOAuth(loadTestHost(t, ts.URL))
+	attempt, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+
+	user, err := oauth.GetOAuthUser(zaptest.NewLogger(t), "myOAuthCode", attempt)
+	assert.NoError(t, err)
+	assert.Equal(t, "github.example.com:alice", user.GetLogin())
+	assert.Equal(t, "Alice Example", user.GetName())
+	assert.Equal(t, "alice@example.com", user.GetEmail())
+}
+
+func TestGetOAuthUserEnterpriseWithoutLogin(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/login/oauth/access_token" {
+			_, _ = w.Write([]byte(`{"access_token":"hostToken","token_type":"bearer"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":5}`))
+	}))
+	defer ts.Close()
+
+	origGithubImpl := githubImpl
+	githubImpl = &ghStub{}
+	defer func() {
+		githubImpl = origGithubImpl
+	}()
+
+	oauth := CreateEnterpriseOAuth(loadTestHost(t, ts.URL))
+	attempt, err := NewLoginAttempt("", "")
+	assert.NoError(t, err)
+
+	_, err = oauth.GetOAuthUser(zaptest.NewLogger(t), "myOAuthCode", attempt)
+	assert.EqualError(t, err, "github.example.com user without login")
+}
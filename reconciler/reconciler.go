@@ -0,0 +1,192 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
+)
+
+// LeaseName is the db lease that makes sure only one replica reconciles at a time.
+const LeaseName = "pr-reconciler"
+
+const DefaultInterval = 10 * time.Minute
+const DefaultPendingAge = 15 * time.Minute
+const DefaultActiveWindow = 7 * 24 * time.Hour
+
+// evaluatePullRequest and refreshHead are swapped out in tests
+var evaluatePullRequest = ourGithub.Evaluate
+var refreshHead = ourGithub.RefreshHead
+
+// Reconciler periodically re-evaluates PRs whose commit status was left behind, e.g. due to a dropped
+// webhook, an evaluation that died after setting the "pending" status, or a failed evaluation due for a retry.
+type Reconciler struct {
+	logger   *zap.Logger
+	postgres db.IClaDB
+	// claVersion returns the CLA version a PR should be evaluated against, which depends on its tenant
+	claVersion func(evalInfo *types.EvaluationInfo) string
+	holder     string
+	// Interval is how often a reconcile pass runs
+	Interval time.Duration
+	// PendingAge is how long a PR may stay "pending" before we consider it stuck
+	PendingAge time.Duration
+	// ActiveWindow limits reconciliation to PRs with a status reported within this window
+	ActiveWindow time.Duration
+}
+
+func New(logger *zap.Logger, postgres db.IClaDB, claVersion func(evalInfo *types.EvaluationInfo) string) *Reconciler {
+	hostname, _ := os.Hostname()
+	return &Reconciler{
+		logger:       logger,
+		postgres:     postgres,
+		claVersion:   claVersion,
+		holder:       fmt.Sprintf("%s-%s", hostname, uuid.New()),
+		Interval:     DefaultInterval,
+		PendingAge:   DefaultPendingAge,
+		ActiveWindow: DefaultActiveWindow,
+	}
+}
+
+// Run reconciles every Interval until the context is cancelled.
+func (r *Reconciler) Run(ctx context.Context) {
+	r.logger.Info("reconciler started",
+		zap.String("holder", r.holder),
+		zap.Duration("interval", r.Interval),
+	)
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	defer func() {
+		if err := r.postgres.ReleaseLease(LeaseName, r.holder); err != nil {
+			r.logger.Error("failed to release reconciler lease", zap.Error(err))
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("reconciler stopped")
+			return
+		case now := <-ticker.C:
+			if err := r.ReconcileOnce(now); err != nil {
+				r.logger.Error("reconcile failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// ReconcileOnce runs a single reconcile pass, if this replica holds (or can take) the lease.
+func (r *Reconciler) ReconcileOnce(now time.Time) (err error) {
+	// hold the lease a bit longer than the interval, so a slow pass does not let another replica jump in
+	acquired, err := r.postgres.AcquireLease(LeaseName, r.holder, now, 2*r.Interval)
+	if err != nil {
+		return
+	}
+	if !acquired {
+		r.logger.Debug("reconciler lease held by another replica")
+		return
+	}
+
+	var stuckPending []types.EvaluationInfo
+	if stuckPending, err = r.postgres.GetStalePRs("pending", now.Add(-r.PendingAge), now.Add(-r.ActiveWindow)); err != nil {
+		return
+	}
+	var dueForRetry []types.EvaluationInfo
+	if dueForRetry, err = r.postgres.GetPRsDueForRetry(now); err != nil {
+		return
+	}
+	var allSigned []types.EvaluationInfo
+	if allSigned, err = r.postgres.GetPRsWithAllAuthorsSigned(now.Add(-r.ActiveWindow)); err != nil {
+		return
+	}
+
+	evals := dedupe(append(append(allSigned, stuckPending...), dueForRetry...))
+	r.logger.Info("reconciling PRs",
+		zap.Int("stuckPending", len(stuckPending)),
+		zap.Int("dueForRetry", len(dueForRetry)),
+		zap.Int("allAuthorsSigned", len(allSigned)),
+		zap.Int("total", len(evals)),
+	)
+
+	for i := range evals {
+		eval := evals[i]
+		// the stored head may be outdated by commits pushed since, and the PR may be closed
+		open, headErr := refreshHead(r.logger, &eval)
+		if headErr != nil {
+			r.logger.Error("failed to read PR head",
+				zap.String("owner", eval.RepoOwner),
+				zap.String("repo", eval.RepoName),
+				zap.Int64("pullRequestID", eval.PRNumber),
+				zap.Error(headErr),
+			)
+			continue
+		}
+		if !open {
+			r.logger.Debug("skipping closed PR",
+				zap.String("owner", eval.RepoOwner),
+				zap.String("repo", eval.RepoName),
+				zap.Int64("pullRequestID", eval.PRNumber),
+			)
+			continue
+		}
+		// a failure on one PR should not stop us from fixing the others
+		if evalErr := evaluatePullRequest(r.logger, r.postgres, &eval, r.claVersion(&eval)); evalErr != nil {
+			r.logger.Error("failed to reconcile PR",
+				zap.String("owner", eval.RepoOwner),
+				zap.String("repo", eval.RepoName),
+				zap.Int64("pullRequestID", eval.PRNumber),
+				zap.Error(evalErr),
+			)
+		}
+	}
+	return
+}
+
+// dedupe keeps the first evaluation for each PR. Earlier entries win, so tracked PRs (which carry their
+// UnsignedPRID) should come first.
+func dedupe(evals []types.EvaluationInfo) (unique []types.EvaluationInfo) {
+	type prKey struct {
+		provider  string
+		repoId    int64
+		repoOwner string
+		repoName  string
+		prNumber  int64
+	}
+	seen := make(map[prKey]bool)
+	for _, eval := range evals {
+		key := prKey{provider: vcs.ProviderOf(&eval), repoId: eval.RepoId, prNumber: eval.PRNumber}
+		if eval.RepoId == 0 {
+			// legacy rows without a repository ID are only unique by name
+			key.repoOwner, key.repoName = eval.RepoOwner, eval.RepoName
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, eval)
+	}
+	return
+}
@@ -0,0 +1,172 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package reconciler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+var stalePRColumns = []string{"RepoID", "RepoOwner", "RepoName", "sha", "PRNumber", "AppID", "InstallID", "Provider"}
+var trackedPRColumns = []string{"Id", "RepoID", "RepoOwner", "RepoName", "sha", "PRNumber", "AppID", "InstallID", "Provider"}
+
+// heads are the head commits of open PRs by PR number, other PRs are closed. A head of "error" fails to be read.
+func setupReconciler(t *testing.T, heads map[int64]string) (mock sqlmock.Sqlmock, r *Reconciler, evaluated *[]types.EvaluationInfo, reset func()) {
+	mock, claDB, closeDbFunc := db.SetupMockDB(t)
+	r = New(zaptest.NewLogger(t), claDB, func(*types.EvaluationInfo) string { return "myCLAVersion" })
+
+	evaluated = &[]types.EvaluationInfo{}
+	origEvaluate := evaluatePullRequest
+	evaluatePullRequest = func(logger *zap.Logger, postgres db.IClaDB, evalInfo *types.EvaluationInfo, claVersion string) error {
+		assert.Equal(t, "myCLAVersion", claVersion)
+		*evaluated = append(*evaluated, *evalInfo)
+		return fmt.Errorf("forced evaluation error")
+	}
+	origRefreshHead := refreshHead
+	refreshHead = func(logger *zap.Logger, evalInfo *types.EvaluationInfo) (bool, error) {
+		head, open := heads[evalInfo.PRNumber]
+		if head == "error" {
+			return false, fmt.Errorf("forced head error")
+		}
+		if open {
+			evalInfo.Sha = head
+		}
+		return open, nil
+	}
+	reset = func() {
+		evaluatePullRequest = origEvaluate
+		refreshHead = origRefreshHead
+		closeDbFunc()
+	}
+	return
+}
+
+func TestReconcileOnceLeaseError(t *testing.T) {
+	mock, r, evaluated, reset := setupReconciler(t, nil)
+	defer reset()
+
+	forcedError := fmt.Errorf("forced lease error")
+	mock.ExpectQuery("INSERT INTO lease").WillReturnError(forcedError)
+
+	assert.EqualError(t, r.ReconcileOnce(time.Now()), forcedError.Error())
+	assert.Empty(t, *evaluated)
+}
+
+func TestReconcileOnceLeaseHeldElsewhere(t *testing.T) {
+	mock, r, evaluated, reset := setupReconciler(t, nil)
+	defer reset()
+
+	mock.ExpectQuery("INSERT INTO lease").WillReturnRows(sqlmock.NewRows([]string{"Holder"}))
+
+	assert.NoError(t, r.ReconcileOnce(time.Now()))
+	assert.Empty(t, *evaluated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReconcileOnceStalePRsError(t *testing.T) {
+	mock, r, evaluated, reset := setupReconciler(t, nil)
+	defer reset()
+
+	mock.ExpectQuery("INSERT INTO lease").WillReturnRows(sqlmock.NewRows([]string{"Holder"}).AddRow(r.holder))
+	forcedError := fmt.Errorf("forced stale PRs error")
+	mock.ExpectQuery("FROM pr_status").WillReturnError(forcedError)
+
+	assert.EqualError(t, r.ReconcileOnce(time.Now()), forcedError.Error())
+	assert.Empty(t, *evaluated)
+}
+
+func TestReconcileOnceEvaluatesEachPROnce(t *testing.T) {
+	// PR 5 got new commits since it was tracked
+	mock, r, evaluated, reset := setupReconciler(t, map[int64]string{5: "sha3", 6: "sha1", 8: "sha2"})
+	defer reset()
+
+	now := time.Now()
+	mock.ExpectQuery("INSERT INTO lease").
+		WithArgs(LeaseName, r.holder, now.Add(2*r.Interval), now).
+		WillReturnRows(sqlmock.NewRows([]string{"Holder"}).AddRow(r.holder))
+	mock.ExpectQuery("FROM pr_status").
+		WithArgs("pending", now.Add(-r.PendingAge), now.Add(-r.ActiveWindow)).
+		WillReturnRows(sqlmock.NewRows(stalePRColumns).
+			AddRow(1, "owner", "repo", "sha1", 5, 2, 3, "github").
+			AddRow(1, "owner", "repo", "sha1", 6, 2, 3, "github"))
+	mock.ExpectQuery("FROM pr_status").
+		WithArgs(now).
+		WillReturnRows(sqlmock.NewRows(stalePRColumns).
+			AddRow(1, "owner", "repo", "sha1", 6, 2, 3, "github").
+			AddRow(7, "owner", "other", "sha2", 8, 2, 3, "github"))
+	mock.ExpectQuery("FROM unsigned_pr").
+		WithArgs(now.Add(-r.ActiveWindow)).
+		WillReturnRows(sqlmock.NewRows(trackedPRColumns).
+			AddRow("prUUID", 1, "owner", "repo", "sha1", 5, 2, 3, "github"))
+
+	// evaluation errors are logged, not returned, so one bad PR does not block the rest
+	assert.NoError(t, r.ReconcileOnce(now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []types.EvaluationInfo{
+		{Provider: "github", UnsignedPRID: "prUUID", RepoId: 1, RepoOwner: "owner", RepoName: "repo", Sha: "sha3", PRNumber: 5, AppId: 2, InstallId: 3},
+		{Provider: "github", RepoId: 1, RepoOwner: "owner", RepoName: "repo", Sha: "sha1", PRNumber: 6, AppId: 2, InstallId: 3},
+		{Provider: "github", RepoId: 7, RepoOwner: "owner", RepoName: "other", Sha: "sha2", PRNumber: 8, AppId: 2, InstallId: 3},
+	}, *evaluated)
+}
+
+func TestReconcileOnceSkipsClosedAndUnreadablePRs(t *testing.T) {
+	mock, r, evaluated, reset := setupReconciler(t, map[int64]string{6: "error", 8: "sha2"})
+	defer reset()
+
+	now := time.Now()
+	mock.ExpectQuery("INSERT INTO lease").WillReturnRows(sqlmock.NewRows([]string{"Holder"}).AddRow(r.holder))
+	mock.ExpectQuery("FROM pr_status").
+		WillReturnRows(sqlmock.NewRows(stalePRColumns).
+			AddRow(1, "owner", "repo", "sha1", 5, 2, 3, "github").
+			AddRow(1, "owner", "repo", "sha1", 6, 2, 3, "github").
+			AddRow(7, "owner", "other", "sha2", 8, 2, 3, "github"))
+	mock.ExpectQuery("FROM pr_status").WillReturnRows(sqlmock.NewRows(stalePRColumns))
+	mock.ExpectQuery("FROM unsigned_pr").WillReturnRows(sqlmock.NewRows(trackedPRColumns))
+
+	assert.NoError(t, r.ReconcileOnce(now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []types.EvaluationInfo{
+		{Provider: "github", RepoId: 7, RepoOwner: "owner", RepoName: "other", Sha: "sha2", PRNumber: 8, AppId: 2, InstallId: 3},
+	}, *evaluated)
+}
+
+func TestDedupeLegacyRowsByName(t *testing.T) {
+	evals := dedupe([]types.EvaluationInfo{
+		{RepoOwner: "org-a", RepoName: "tools", PRNumber: 5},
+		{RepoOwner: "org-b", RepoName: "tools", PRNumber: 5},
+		{RepoOwner: "org-a", RepoName: "tools", PRNumber: 5},
+	})
+	assert.Equal(t, 2, len(evals))
+}
+
+func TestDedupeByProvider(t *testing.T) {
+	evals := dedupe([]types.EvaluationInfo{
+		{RepoId: 1, PRNumber: 5},
+		{Provider: "github", RepoId: 1, PRNumber: 5},
+		{Provider: "gitlab", RepoId: 1, PRNumber: 5},
+	})
+	assert.Equal(t, 2, len(evals))
+}
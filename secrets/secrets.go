@@ -0,0 +1,108 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package secrets finds the secret settings of the server outside the environment, e.g. in the files of Docker and
+// Kubernetes secrets or in HashiCorp Vault. Secrets are named after the environment variable they stand in for.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// FileSuffix makes the name of the environment variable holding the path of a secret file, e.g. PG_PASSWORD_FILE.
+const FileSuffix = "_FILE"
+
+// Provider finds secrets by the name of the environment variable they stand in for.
+type Provider interface {
+	// Secrets looks up the secrets of names, leaving out those the provider does not have.
+	Secrets(ctx context.Context, names []string) (map[string]string, error)
+}
+
+// FileProvider reads secrets from the files named by their *_FILE environment variable, as Docker and Kubernetes
+// mount them.
+type FileProvider struct {
+	Getenv func(string) string
+}
+
+func (p FileProvider) Secrets(_ context.Context, names []string) (map[string]string, error) {
+	found := make(map[string]string)
+	for _, name := range names {
+		path := p.Getenv(name + FileSuffix)
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read secret %s: %w", name+FileSuffix, err)
+		}
+		// editors and echo leave a line break at the end of the file, which is never part of the secret
+		found[name] = strings.TrimRight(string(content), "\r\n")
+	}
+	return found, nil
+}
+
+// Chain looks up secrets in each of its providers in turn, the first one having a secret wins.
+type Chain []Provider
+
+func (c Chain) Secrets(ctx context.Context, names []string) (map[string]string, error) {
+	found := make(map[string]string)
+	for _, provider := range c {
+		var missing []string
+		for _, name := range names {
+			if _, ok := found[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+		secrets, err := provider.Secrets(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range secrets {
+			found[name] = value
+		}
+	}
+	return found, nil
+}
+
+// FromEnv is the provider configured by the environment: files of *_FILE variables first, then Vault when VAULT_ADDR
+// is set, see VaultFromEnv.
+func FromEnv(getenv func(string) string) (Provider, error) {
+	chain := Chain{FileProvider{Getenv: getenv}}
+	vault, err := VaultFromEnv(getenv)
+	if err != nil {
+		return nil, err
+	}
+	if vault != nil {
+		chain = append(chain, vault)
+	}
+	return chain, nil
+}
+
+// Getenv looks up environment variables with getenv, falling back to the secrets found for those that are not set.
+func Getenv(found map[string]string, getenv func(string) string) func(string) string {
+	return func(name string) string {
+		if value := getenv(name); value != "" {
+			return value
+		}
+		return found[name]
+	}
+}
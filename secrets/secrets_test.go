@@ -0,0 +1,118 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getenvOf(env map[string]string) func(string) string {
+	return func(name string) string {
+		return env[name]
+	}
+}
+
+// staticProvider has fixed secrets, and remembers what it was asked for
+type staticProvider struct {
+	secrets map[string]string
+	asked   []string
+	err     error
+}
+
+func (p *staticProvider) Secrets(_ context.Context, names []string) (map[string]string, error) {
+	p.asked = names
+	found := make(map[string]string)
+	for _, name := range names {
+		if value, ok := p.secrets[name]; ok {
+			found[name] = value
+		}
+	}
+	return found, p.err
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pg_password")
+	assert.NoError(t, os.WriteFile(path, []byte("myPGPassword\n"), 0600))
+	provider := FileProvider{Getenv: getenvOf(map[string]string{"PG_PASSWORD_FILE": path})}
+
+	found, err := provider.Secrets(context.Background(), []string{"PG_PASSWORD", "SMTP_PASSWORD"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"PG_PASSWORD": "myPGPassword"}, found)
+}
+
+func TestFileProviderMissingFile(t *testing.T) {
+	provider := FileProvider{Getenv: getenvOf(map[string]string{"PG_PASSWORD_FILE": filepath.Join(t.TempDir(), "missing")})}
+
+	_, err := provider.Secrets(context.Background(), []string{"PG_PASSWORD"})
+	assert.ErrorContains(t, err, "could not read secret PG_PASSWORD_FILE: ")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestChain(t *testing.T) {
+	first := &staticProvider{secrets: map[string]string{"PG_PASSWORD": "first"}}
+	second := &staticProvider{secrets: map[string]string{"PG_PASSWORD": "second", "SMTP_PASSWORD": "second"}}
+
+	found, err := Chain{first, second}.Secrets(context.Background(), []string{"PG_PASSWORD", "SMTP_PASSWORD", "GITLAB_TOKEN"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"PG_PASSWORD": "first", "SMTP_PASSWORD": "second"}, found)
+	// later providers are only asked for what is still missing
+	assert.Equal(t, []string{"SMTP_PASSWORD", "GITLAB_TOKEN"}, second.asked)
+}
+
+func TestChainError(t *testing.T) {
+	failing := &staticProvider{err: errors.New("forced error")}
+
+	_, err := Chain{failing}.Secrets(context.Background(), []string{"PG_PASSWORD"})
+	assert.EqualError(t, err, "forced error")
+}
+
+func TestFromEnv(t *testing.T) {
+	provider, err := FromEnv(getenvOf(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(provider.(Chain)))
+
+	provider, err = FromEnv(getenvOf(map[string]string{
+		EnvVaultAddr:       "https://vault.example.com/",
+		EnvVaultToken:      "myVaultToken",
+		EnvVaultSecretPath: "/secret/data/the-cla",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(provider.(Chain)))
+	vault := provider.(Chain)[1].(*VaultProvider)
+	assert.Equal(t, "https://vault.example.com", vault.Address)
+	assert.Equal(t, "secret/data/the-cla", vault.SecretPath)
+	assert.Equal(t, vaultTimeout, vault.HTTPClient.Timeout)
+
+	_, err = FromEnv(getenvOf(map[string]string{EnvVaultAddr: "https://vault.example.com"}))
+	assert.EqualError(t, err, "VAULT_SECRET_PATH is required with VAULT_ADDR")
+}
+
+func TestGetenv(t *testing.T) {
+	getenv := Getenv(map[string]string{"PG_PASSWORD": "fromFile", "SMTP_PASSWORD": "fromFile"},
+		getenvOf(map[string]string{"PG_PASSWORD": "fromEnv"}))
+
+	// a variable that is set wins
+	assert.Equal(t, "fromEnv", getenv("PG_PASSWORD"))
+	assert.Equal(t, "fromFile", getenv("SMTP_PASSWORD"))
+	assert.Equal(t, "", getenv("GITLAB_TOKEN"))
+}
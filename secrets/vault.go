@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	EnvVaultAddr      = "VAULT_ADDR"
+	EnvVaultToken     = "VAULT_TOKEN"
+	EnvVaultNamespace = "VAULT_NAMESPACE"
+	// EnvVaultSecretPath is the API path of our secret, e.g. "secret/data/the-cla" for the KV v2 engine at "secret"
+	EnvVaultSecretPath = "VAULT_SECRET_PATH"
+)
+
+// vaultTimeout is how long reading our secret may take, so an unresponsive Vault does not hold up startup or the
+// secret refresh for ever
+const vaultTimeout = 30 * time.Second
+
+// VaultProvider reads secrets from the fields of a secret of the key/value engine (version 1 or 2) of HashiCorp
+// Vault, or of a server speaking its API. The fields are named after the environment variables they stand in for.
+type VaultProvider struct {
+	// Address is that of the server, e.g. "https://vault.example.com:8200"
+	Address string
+	// Token authenticates us, unless TokenFile is set
+	Token string
+	// TokenFile holds the token, e.g. written by a Vault agent, and is read again for each request as tokens expire
+	TokenFile string
+	// Namespace is that of Vault Enterprise, if any
+	Namespace  string
+	SecretPath string
+	HTTPClient *http.Client
+}
+
+// VaultFromEnv is the Vault provider of VAULT_ADDR, VAULT_TOKEN (or VAULT_TOKEN_FILE), VAULT_NAMESPACE and
+// VAULT_SECRET_PATH, or nil when VAULT_ADDR is not set.
+func VaultFromEnv(getenv func(string) string) (*VaultProvider, error) {
+	address := getenv(EnvVaultAddr)
+	if address == "" {
+		return nil, nil
+	}
+	vault := &VaultProvider{
+		Address:    strings.TrimSuffix(address, "/"),
+		Token:      getenv(EnvVaultToken),
+		TokenFile:  getenv(EnvVaultToken + FileSuffix),
+		Namespace:  getenv(EnvVaultNamespace),
+		SecretPath: strings.Trim(getenv(EnvVaultSecretPath), "/"),
+		HTTPClient: &http.Client{Timeout: vaultTimeout},
+	}
+	if vault.SecretPath == "" {
+		return nil, fmt.Errorf("%s is required with %s", EnvVaultSecretPath, EnvVaultAddr)
+	}
+	if vault.Token == "" && vault.TokenFile == "" {
+		return nil, fmt.Errorf("%s or %s is required with %s", EnvVaultToken, EnvVaultToken+FileSuffix, EnvVaultAddr)
+	}
+	return vault, nil
+}
+
+func (v *VaultProvider) token() (string, error) {
+	if v.TokenFile == "" {
+		return v.Token, nil
+	}
+	token, err := os.ReadFile(v.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read vault token: %w", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// vaultResponse is a secret read from Vault. The fields are in data for the KV v1 engine, and in data.data for v2,
+// which adds data.metadata.
+type vaultResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []string                   `json:"errors"`
+}
+
+// Secrets reads the secret once, and returns those of its string fields named in names.
+func (v *VaultProvider) Secrets(ctx context.Context, names []string) (map[string]string, error) {
+	fields, err := v.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]string)
+	for _, name := range names {
+		if raw, ok := fields[name]; ok {
+			var value string
+			if err = json.Unmarshal(raw, &value); err != nil {
+				return nil, fmt.Errorf("vault secret %s: field %s is not a string", v.SecretPath, name)
+			}
+			found[name] = value
+		}
+	}
+	return found, nil
+}
+
+func (v *VaultProvider) read(ctx context.Context) (map[string]json.RawMessage, error) {
+	token, err := v.token()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.Address+"/v1/"+v.SecretPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	resp, err := v.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not read vault secret %s: %w", v.SecretPath, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	var secret vaultResponse
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		message := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &secret) == nil && len(secret.Errors) > 0 {
+			message = strings.Join(secret.Errors, ", ")
+		}
+		return nil, fmt.Errorf("could not read vault secret %s: %d %s", v.SecretPath, resp.StatusCode, message)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, fmt.Errorf("could not read vault secret %s: %w", v.SecretPath, err)
+	}
+
+	if _, ok := secret.Data["metadata"]; ok {
+		var fields map[string]json.RawMessage
+		if err = json.Unmarshal(secret.Data["data"], &fields); err != nil {
+			return nil, fmt.Errorf("could not read vault secret %s: %w", v.SecretPath, err)
+		}
+		return fields, nil
+	}
+	return secret.Data, nil
+}
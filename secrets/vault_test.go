@@ -0,0 +1,100 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupTestVault stands in for a Vault server having a secret at path, answering with the body for valid tokens
+func setupTestVault(t *testing.T, path, body string) (vault *VaultProvider) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "myVaultToken" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/"+path {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return &VaultProvider{Address: server.URL, Token: "myVaultToken", SecretPath: path, HTTPClient: server.Client()}
+}
+
+func TestVaultProviderKV2(t *testing.T) {
+	vault := setupTestVault(t, "secret/data/the-cla", `{"data":{
+		"data":{"PG_PASSWORD":"myPGPassword","GH_WEBHOOK_SECRET":"myWebhookSecret"},
+		"metadata":{"version":3}
+	}}`)
+
+	found, err := vault.Secrets(context.Background(), []string{"PG_PASSWORD", "SMTP_PASSWORD"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"PG_PASSWORD": "myPGPassword"}, found)
+}
+
+func TestVaultProviderKV1(t *testing.T) {
+	vault := setupTestVault(t, "kv/the-cla", `{"data":{"PG_PASSWORD":"myPGPassword"}}`)
+
+	found, err := vault.Secrets(context.Background(), []string{"PG_PASSWORD"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"PG_PASSWORD": "myPGPassword"}, found)
+}
+
+func TestVaultProviderNotAString(t *testing.T) {
+	vault := setupTestVault(t, "kv/the-cla", `{"data":{"PG_PORT":5432}}`)
+
+	_, err := vault.Secrets(context.Background(), []string{"PG_PORT"})
+	assert.EqualError(t, err, "vault secret kv/the-cla: field PG_PORT is not a string")
+}
+
+func TestVaultProviderErrors(t *testing.T) {
+	vault := setupTestVault(t, "kv/the-cla", `{"data":{}}`)
+	vault.Token = "wrongToken"
+	_, err := vault.Secrets(context.Background(), []string{"PG_PASSWORD"})
+	assert.EqualError(t, err, "could not read vault secret kv/the-cla: 403 permission denied")
+
+	vault.Token = "myVaultToken"
+	vault.SecretPath = "kv/missing"
+	_, err = vault.Secrets(context.Background(), []string{"PG_PASSWORD"})
+	assert.EqualError(t, err, `could not read vault secret kv/missing: 404 {"errors":[]}`)
+}
+
+func TestVaultProviderTokenFile(t *testing.T) {
+	vault := setupTestVault(t, "kv/the-cla", `{"data":{"PG_PASSWORD":"myPGPassword"}}`)
+	vault.Token = ""
+	vault.TokenFile = filepath.Join(t.TempDir(), "token")
+
+	_, err := vault.Secrets(context.Background(), []string{"PG_PASSWORD"})
+	assert.ErrorContains(t, err, "could not read vault token: ")
+
+	// the token is read for each request, as an agent renews it
+	assert.NoError(t, os.WriteFile(vault.TokenFile, []byte("myVaultToken\n"), 0600))
+	found, err := vault.Secrets(context.Background(), []string{"PG_PASSWORD"})
+	assert.NoError(t, err)
+	assert.Equal(t, "myPGPassword", found["PG_PASSWORD"])
+}
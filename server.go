@@ -19,27 +19,38 @@
 package main
 
 import (
+	"context"
 	"crypto/subtle"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/smtp"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/go-github/v64/github"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
 	"github.com/sonatype-nexus-community/the-cla/buildversion"
+	"github.com/sonatype-nexus-community/the-cla/config"
 	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/gitea"
 	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+	"github.com/sonatype-nexus-community/the-cla/gitlab"
 	"github.com/sonatype-nexus-community/the-cla/oauth"
+	"github.com/sonatype-nexus-community/the-cla/reconciler"
+	"github.com/sonatype-nexus-community/the-cla/secrets"
 	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
@@ -50,34 +61,49 @@ import (
 const defaultServicePort = ":4200"
 
 const pathClaText string = "/cla-text"
+const pathOAuthLogin string = "/oauth-login"
 const pathOAuthCallback string = "/oauth-callback"
 const pathSignCla string = "/sign-cla"
 const pathWebhook string = "/webhook-integration"
+const pathWebhookGitLab string = "/webhook-gitlab"
+const pathWebhookGitea string = "/webhook-gitea"
 const pathInfo = "/info"
 const pathSignature = "/signature"
 const pathTestEmail = "/test-email"
+const pathRateLimits = "/rate-limits"
+const pathTenants = "/tenants"
+const pathTenant = "/tenant"
+const pathRotation = "/rotation"
+const pathSigningKey = "/signing-key"
+const pathConfig = "/config"
+const pathBackfillRepoIds = "/backfill-repo-ids"
 const buildLocation string = "build"
 
-const envReactAppClaVersion string = "REACT_APP_CLA_VERSION"
-const envGhWebhookSecret string = "GH_WEBHOOK_SECRET"
-const envReactAppGithubClientId string = "REACT_APP_GITHUB_CLIENT_ID"
-const envGithubClientSecret string = "GITHUB_CLIENT_SECRET"
-
 const msgUnhandledGitHubEventType = "I do not handle this type of event, sorry!"
+const msgTemplateUnknownGitHubHost = "unknown github host: %s"
+const headerGitHubEnterpriseHost = "X-GitHub-Enterprise-Host"
+const msgTemplateUnknownTenant = "unknown tenant: %s"
+const msgTenantOfGitHubHost = "tenants are github.com apps, not of github hosts"
+
+// headerHookTargetType and headerHookTargetID tell which GitHub App a webhook is for
+const headerHookTargetType = "X-GitHub-Hook-Installation-Target-Type"
+const headerHookTargetID = "X-GitHub-Hook-Installation-Target-ID"
 
 var postgresDB db.IClaDB
 
-var claCache = make(map[string]string)
+// appConfig is loaded and validated at startup, see config.Load, and gets the new secrets when they are rotated, see
+// refreshSecrets
+var appConfig atomic.Pointer[config.Config]
+
+// currentConfig is the configuration we run with, the default one until it is loaded.
+func currentConfig() *config.Config {
+	if cfg := appConfig.Load(); cfg != nil {
+		return cfg
+	}
+	return config.Default()
+}
 
-const envPGHost = "PG_HOST"
-const envPGPort = "PG_PORT"
-const envPGUsername = "PG_USERNAME"
-const envPGPassword = "PG_PASSWORD"
-const envPGDBName = "PG_DB_NAME"
-const envSSLMode = "SSL_MODE"
-const envInfoUsername = "INFO_USERNAME"
-const envInfoPassword = "INFO_PASSWORD"
-const envLogFilterIncludeHostname = "LOG_FILTER_INCLUDE_HOSTNAME"
+var claCache = make(map[string]string)
 
 var errRecovered error
 var logger *zap.Logger
@@ -86,9 +112,9 @@ func main() {
 	e := echo.New()
 
 	var err error
-	config := zap.NewProductionConfig()
-	config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
-	logger, err = config.Build()
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	logger, err = zapConfig.Build()
 	if err != nil {
 		e.Logger.Fatal("can not initialize zap logger: %+v", err)
 	}
@@ -125,7 +151,25 @@ func main() {
 		logger.Error("env load", zap.Error(err))
 	}
 
-	pg, host, port, dbname, _, err := openDB()
+	secretProvider, err := secrets.FromEnv(os.Getenv)
+	if err != nil {
+		logger.Error("secrets", zap.Error(err))
+		panic(fmt.Errorf("failed to configure secrets. err: %+v", err))
+	}
+	cfg, err := loadConfig(context.Background(), secretProvider)
+	if err != nil {
+		logger.Error("config", zap.Error(err))
+		panic(fmt.Errorf("failed to load configuration. err: %+v", err))
+	}
+	appConfig.Store(cfg)
+	logger.Info("config", zap.Any("config", cfg.Redacted()))
+	ourGithub.Apps.SetKeyFile(cfg.GitHub.KeyFile)
+	if err = configurePrivateKey(cfg.GitHub); err != nil {
+		logger.Error("private key", zap.Error(err))
+		panic(fmt.Errorf("failed to load private key. err: %+v", err))
+	}
+
+	pg, host, port, dbname, _, err := openDB(cfg.Database)
 	if err != nil {
 		logger.Error("db open", zap.Error(err))
 		panic(fmt.Errorf("failed to load database driver. host: %s, port: %d, dbname: %s, err: %+v", host, port, dbname, err))
@@ -152,6 +196,39 @@ func main() {
 		logger.Info("db migration complete")
 	}
 
+	if err = configureTenants(); err != nil {
+		logger.Error("tenants", zap.Error(err))
+		panic(fmt.Errorf("failed to load tenants. err: %+v", err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	startTenantRefresh(ctx, cfg.GitHub.TenantRefreshInterval)
+	startReconciler(ctx, cfg.Reconciler)
+	startSecretRefresh(ctx, cfg.Server.SecretRefreshInterval, secretProvider)
+	configureCollaboratorCache(cfg.Evaluation)
+	configureExemptions(cfg.Evaluation)
+	ourGithub.OverrideLabel = cfg.CLA.OverrideLabel
+	configureTrivialChanges(cfg.Evaluation)
+	ourGithub.SkipDrafts = cfg.Evaluation.SkipDraftPRs
+	configureEnforcement(cfg.Evaluation)
+	if err = configureMessages(cfg.CLA); err != nil {
+		logger.Error("messages", zap.Error(err))
+		panic(fmt.Errorf("failed to load messages. err: %+v", err))
+	}
+	if err = configureGitHubHosts(cfg.GitHub); err != nil {
+		logger.Error("github hosts", zap.Error(err))
+		panic(fmt.Errorf("failed to load github hosts. err: %+v", err))
+	}
+	if err = configureSigningKey(cfg.GitHub); err != nil {
+		logger.Error("signing key", zap.Error(err))
+		panic(fmt.Errorf("failed to select signing key. err: %+v", err))
+	}
+	configureSignLinks(cfg.CLA)
+	configureOAuth(cfg.GitHub)
+	configureGitLab(cfg.GitLab)
+	configureGitea(cfg.Gitea)
+
 	e.Use(middleware.CORS())
 
 	e.GET("/build-info", func(c echo.Context) error {
@@ -160,15 +237,33 @@ func main() {
 
 	e.GET(pathClaText, handleRetrieveCLAText)
 
+	e.GET(pathTenant+"/:"+pathParamTenant, handleTenant)
+
+	e.GET(pathOAuthLogin, handleGitHubOAuthLogin)
+
 	e.GET(pathOAuthCallback, handleProcessGitHubOAuth)
 
 	e.POST(pathWebhook, handleProcessWebhook)
 
+	e.POST(pathWebhook+"/:"+pathParamTenant, handleProcessWebhook)
+
+	e.POST(pathWebhookGitLab, handleProcessGitLabWebhook)
+
+	e.POST(pathWebhookGitea, handleProcessGiteaWebhook)
+
 	e.PUT(pathSignCla, handleProcessSignCla)
 
+	e.GET(ourGithub.PathPRStatusDiagnostics+"/:"+pathParamProvider+"/:"+pathParamRepoId+"/:"+pathParamPRNumber, handlePRStatus)
+
 	g := e.Group(pathInfo, middleware.BasicAuth(infoBasicValidator))
 	g.GET(pathSignature, handleSignature)
 	g.GET(pathTestEmail, handleTestEmail)
+	g.GET(pathRateLimits, handleRateLimits)
+	g.GET(pathTenants, handleTenants)
+	g.GET(pathRotation, handleRotation)
+	g.GET(pathConfig, handleConfig)
+	g.PUT(pathRotation+pathSigningKey, handleSelectSigningKey)
+	g.POST(pathBackfillRepoIds, handleBackfillRepoIds)
 
 	e.Static("/", buildLocation)
 
@@ -181,6 +276,292 @@ func main() {
 	logger.Fatal("application end", zap.Error(e.Start(defaultServicePort)))
 }
 
+// startReconciler launches the background PR reconciler, unless it is disabled via RECONCILE_INTERVAL=0.
+func startReconciler(ctx context.Context, cfg config.Reconciler) {
+	r := reconciler.New(logger, postgresDB, claVersionFor)
+	r.Interval = cfg.Interval
+	r.PendingAge = cfg.PendingAge
+	r.ActiveWindow = cfg.ActiveWindow
+	if r.Interval <= 0 {
+		logger.Info("reconciler disabled")
+		return
+	}
+	go r.Run(ctx)
+}
+
+// configureCollaboratorCache applies the collaborator cache settings, COLLABORATOR_CACHE_TTL=0 disables caching.
+func configureCollaboratorCache(cfg config.Evaluation) {
+	ourGithub.Collaborators.TTL = cfg.CollaboratorCacheTTL
+	ourGithub.Collaborators.Shared = cfg.CollaboratorCacheShared
+}
+
+// configureExemptions applies the policy deciding which authors need not sign the CLA.
+func configureExemptions(cfg config.Evaluation) {
+	ourGithub.Exemptions = ourGithub.ExemptionPolicy{
+		Collaborators:        cfg.ExemptCollaborators,
+		OrgMembers:           cfg.ExemptOrgMembers,
+		OutsideCollaborators: cfg.ExemptOutsideCollaborators,
+		Teams:                cfg.ExemptTeams,
+		BotLogins:            cfg.ExemptBotLogins,
+		BotEmails:            cfg.ExemptBotEmails,
+	}
+	logger.Info("exemption policy", zap.Any("exemptions", ourGithub.Exemptions))
+}
+
+// configureTrivialChanges applies the policy exempting small or documentation only PRs, for the repositories
+// that opted in.
+func configureTrivialChanges(cfg config.Evaluation) {
+	ourGithub.TrivialChanges = ourGithub.TrivialChangePolicy{
+		Repos:    cfg.TrivialChangeRepos,
+		MaxLines: cfg.TrivialChangeMaxLines,
+		Paths:    cfg.TrivialChangePaths,
+	}
+	logger.Info("trivial change policy", zap.Any("trivialChanges", ourGithub.TrivialChanges))
+}
+
+// configureEnforcement applies the rules deciding which repositories and base branches need the CLA.
+func configureEnforcement(cfg config.Evaluation) {
+	ourGithub.Enforcement = ourGithub.EnforcementPolicy{
+		BaseBranches:    cfg.EnforcedBaseBranches,
+		ExcludeRepos:    cfg.ExcludedRepos,
+		ExcludeArchived: cfg.ExcludeArchivedRepos,
+		ExcludePrivate:  cfg.ExcludePrivateRepos,
+	}
+	logger.Info("enforcement policy", zap.Any("enforcement", ourGithub.Enforcement))
+}
+
+// configureMessages loads our comments, status descriptions and labels, failing on invalid templates so they are
+// caught at startup rather than on some PR.
+func configureMessages(cfg config.CLA) error {
+	if path := cfg.MessagesFile; path != "" {
+		messages, err := ourGithub.LoadMessages(path)
+		if err != nil {
+			return err
+		}
+		ourGithub.Messages = messages
+	}
+	ourGithub.RepoMessagesPath = cfg.RepoMessagesPath
+	return nil
+}
+
+// configureGitHubHosts loads the GitHub Enterprise Server instances we evaluate PRs of alongside those of github.com.
+func configureGitHubHosts(cfg config.GitHub) error {
+	if path := cfg.HostsFile; path != "" {
+		hosts, err := ourGithub.LoadHosts(path)
+		if err != nil {
+			return err
+		}
+		ourGithub.Hosts = hosts
+	}
+	for name, host := range ourGithub.Hosts {
+		logger.Info("github host", zap.String("name", name), zap.String("apiURL", host.APIURL), zap.Bool("signIn", host.ClientID != ""))
+	}
+	return nil
+}
+
+// loadConfig loads the configuration, taking the secrets not set in the environment from the provider.
+func loadConfig(ctx context.Context, provider secrets.Provider) (*config.Config, error) {
+	found, err := provider.Secrets(ctx, config.SecretNames())
+	if err != nil {
+		return nil, err
+	}
+	return config.Load(os.Getenv(config.EnvConfigFile), secrets.Getenv(found, os.Getenv))
+}
+
+// configurePrivateKey has our app sign with the keys of GH_APP_PRIVATE_KEY rather than those of its key file, when set.
+func configurePrivateKey(cfg config.GitHub) error {
+	return ourGithub.Apps.SetPrivateKey(config.EnvPrivateKey, cfg.PrivateKey)
+}
+
+// startSecretRefresh reads the secrets again every SECRET_REFRESH_INTERVAL, so secrets rotated in their files or in
+// Vault are used without a restart. Setting it to 0 disables it.
+func startSecretRefresh(ctx context.Context, interval time.Duration, provider secrets.Provider) {
+	if interval <= 0 {
+		logger.Info("secret refresh disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := refreshSecrets(ctx, provider); err != nil {
+					// keep using the secrets we have
+					logger.Error("failed to refresh secrets", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// refreshSecrets loads the configuration again, and uses its secrets if they changed. Other settings are only read
+// at startup.
+func refreshSecrets(ctx context.Context, provider secrets.Provider) error {
+	loaded, err := loadConfig(ctx, provider)
+	if err != nil {
+		return err
+	}
+	updated, changed := currentConfig().WithSecrets(loaded)
+	if len(changed) == 0 {
+		return nil
+	}
+	if err = configurePrivateKey(updated.GitHub); err != nil {
+		return err
+	}
+	// the other secrets are read from the configuration when used, but for these
+	if gitlab.Enabled() {
+		gitlab.SetToken(updated.GitLab.Token)
+	}
+	if gitea.Enabled() {
+		gitea.SetToken(updated.Gitea.Token)
+	}
+	ourGithub.SignLinks.SetSecret([]byte(updated.CLA.SignLinkSecret))
+	appConfig.Store(updated)
+	logger.Info("secrets refreshed", zap.Strings("changed", changed))
+	return nil
+}
+
+// configureSigningKey selects the private key our apps sign with, among those listed in their key file settings, by
+// its CLA_PEM_SIGNING_KEY fingerprint. Without it each app signs with its first key.
+func configureSigningKey(cfg config.GitHub) error {
+	fingerprint := cfg.SigningKey
+	if fingerprint == "" {
+		return nil
+	}
+	if err := ourGithub.LoadAllKeyRings(); err != nil {
+		return err
+	}
+	if err := ourGithub.PrivateKeys.Select(fingerprint); err != nil {
+		return err
+	}
+	logger.Info("signing key", zap.String("fingerprint", fingerprint))
+	return nil
+}
+
+// configureTenants loads the tenants from the db, each served by its own GitHub App.
+func configureTenants() error {
+	tenants, err := postgresDB.GetTenants()
+	if err != nil {
+		return err
+	}
+	if err = ourGithub.Tenants.Set(tenants); err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		logger.Info("tenant", zap.String("name", tenant.Name), zap.Int64("appId", tenant.AppId), zap.String("claVersion", tenant.CLAVersion))
+	}
+	return nil
+}
+
+// startTenantRefresh reloads the tenants every TENANT_REFRESH_INTERVAL, so tenants added to the db are served
+// without a restart. Setting it to 0 disables it.
+func startTenantRefresh(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		logger.Info("tenant refresh disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := configureTenants(); err != nil {
+					// keep serving the tenants we have
+					logger.Error("failed to refresh tenants", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// configureSignLinks enables the signing links from PR comments, which take signers back to their PR, while
+// SIGN_LINK_SECRET is set.
+func configureSignLinks(cfg config.CLA) {
+	ourGithub.SignLinks = ourGithub.NewSignLinkSigner([]byte(cfg.SignLinkSecret), cfg.SignLinkTTL)
+	logger.Info("signing links", zap.Bool("enabled", ourGithub.SignLinks.Enabled()), zap.Duration("ttl", ourGithub.SignLinks.TTL))
+}
+
+// configureOAuth has signers log in with the user authorization flow of our GitHub App when GH_APP_CLIENT_ID is set,
+// or else with the separate OAuth app.
+func configureOAuth(cfg config.GitHub) {
+	if cfg.AppClientId == "" {
+		logger.Info("signers log in with the OAuth app")
+		return
+	}
+	createOAuth = func() oauthLogin {
+		// the client secret may be rotated while we run
+		githubConfig := currentConfig().GitHub
+		return oauth.CreateGitHubAppOAuth(githubConfig.AppClientId, githubConfig.AppClientSecret)
+	}
+	logger.Info("signers log in with the GitHub App")
+}
+
+// configureGitLab evaluates GitLab merge requests when GITLAB_TOKEN is set, and lets their authors sign in with
+// GitLab when GITLAB_CLIENT_ID is set too.
+func configureGitLab(cfg config.GitLab) {
+	gitlab.SetToken(cfg.Token)
+	if !gitlab.Enabled() {
+		logger.Info("gitlab merge requests are not evaluated")
+		return
+	}
+	if cfg.URL != "" {
+		gitlab.BaseURL = cfg.URL
+	}
+	gitlab.SignURL = cfg.SignURL
+	if gitlab.SignURL == "" {
+		logger.Warn("gitlab comments will not link to the signing page", zap.String("envName", "GITLAB_SIGN_URL"))
+	}
+	ourGithub.RegisterEvaluator(vcs.ProviderGitLab, gitlab.EvaluateMergeRequest)
+	ourGithub.RegisterHeadReader(vcs.ProviderGitLab, gitlab.MergeRequestHead)
+
+	if clientId := cfg.ClientId; clientId != "" {
+		baseURL := gitlab.BaseURL
+		createGitLabOAuth = func() oauthLogin {
+			// the client secret may be rotated while we run
+			return oauth.CreateGitLabOAuth(baseURL, clientId, currentConfig().GitLab.ClientSecret)
+		}
+	}
+	logger.Info("gitlab merge requests are evaluated",
+		zap.String("baseURL", gitlab.BaseURL),
+		zap.Bool("signIn", createGitLabOAuth != nil),
+	)
+}
+
+// configureGitea evaluates pull requests of the Gitea (or Forgejo) instance at GITEA_URL when GITEA_TOKEN is set,
+// and lets their authors sign in with it when GITEA_CLIENT_ID is set too.
+func configureGitea(cfg config.Gitea) {
+	gitea.BaseURL = cfg.URL
+	gitea.SetToken(cfg.Token)
+	if !gitea.Enabled() {
+		logger.Info("gitea pull requests are not evaluated")
+		return
+	}
+	gitea.SignURL = cfg.SignURL
+	if gitea.SignURL == "" {
+		logger.Warn("gitea comments will not link to the signing page", zap.String("envName", "GITEA_SIGN_URL"))
+	}
+	ourGithub.RegisterEvaluator(vcs.ProviderGitea, gitea.EvaluatePullRequest)
+	ourGithub.RegisterHeadReader(vcs.ProviderGitea, gitea.PullRequestHead)
+
+	if clientId := cfg.ClientId; clientId != "" {
+		baseURL := gitea.BaseURL
+		createGiteaOAuth = func() oauthLogin {
+			// the client secret may be rotated while we run
+			return oauth.CreateGiteaOAuth(baseURL, clientId, currentConfig().Gitea.ClientSecret)
+		}
+	}
+	logger.Info("gitea pull requests are evaluated",
+		zap.String("baseURL", gitea.BaseURL),
+		zap.Bool("signIn", createGiteaOAuth != nil),
+	)
+}
+
 const queryParameterLogin = "login"
 const queryParameterCLAVersion = "claversion"
 const msgTemplateMissingQueryParam = "missing required query parameter: %s"
@@ -188,9 +569,10 @@ const hiddenFieldValue = "hidden"
 
 //goland:noinspection GoUnusedParameter
 func infoBasicValidator(username, password string, c echo.Context) (isValidLogin bool, err error) {
+	serverConfig := currentConfig().Server
 	// Be careful to use constant time comparison to prevent timing attacks
-	if subtle.ConstantTimeCompare([]byte(username), []byte(os.Getenv(envInfoUsername))) == 1 &&
-		subtle.ConstantTimeCompare([]byte(password), []byte(os.Getenv(envInfoPassword))) == 1 {
+	if subtle.ConstantTimeCompare([]byte(username), []byte(serverConfig.InfoUsername)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(serverConfig.InfoPassword)) == 1 {
 		isValidLogin = true
 	} else {
 		logger.Info("failed info endpoint login",
@@ -229,6 +611,57 @@ func handleSignature(c echo.Context) (err error) {
 	return c.JSON(http.StatusOK, foundUserSignature)
 }
 
+// handleRateLimits reports the GitHub API quota we have seen for each installation, of github.com and of our hosts.
+func handleRateLimits(c echo.Context) (err error) {
+	return c.JSON(http.StatusOK, ourGithub.AllRateLimits())
+}
+
+const pathParamProvider = "provider"
+const pathParamRepoId = "repoId"
+const pathParamPRNumber = "prNumber"
+const msgTemplateInvalidPathParam = "invalid path parameter: %s"
+const msgPRStatusError = "could not read PR status"
+
+// prStatusResponse is what anyone following the link of a commit status may see of a PR status: the error
+// text and repository identity stay in our logs and database.
+type prStatusResponse struct {
+	State         string     `json:"state"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+}
+
+// handlePRStatus is the diagnostics page linked from an "error" commit status, showing when the last
+// evaluation of a PR happened and when it will be retried. It needs no authentication, so it shows no more.
+func handlePRStatus(c echo.Context) (err error) {
+	repoId, err := strconv.ParseInt(c.Param(pathParamRepoId), 10, 64)
+	if err != nil {
+		return c.String(http.StatusUnprocessableEntity, fmt.Sprintf(msgTemplateInvalidPathParam, pathParamRepoId))
+	}
+	prNumber, err := strconv.ParseInt(c.Param(pathParamPRNumber), 10, 64)
+	if err != nil {
+		return c.String(http.StatusUnprocessableEntity, fmt.Sprintf(msgTemplateInvalidPathParam, pathParamPRNumber))
+	}
+
+	provider, err := url.PathUnescape(c.Param(pathParamProvider))
+	if err != nil || provider == "" {
+		return c.String(http.StatusUnprocessableEntity, fmt.Sprintf(msgTemplateInvalidPathParam, pathParamProvider))
+	}
+
+	prStatus, err := postgresDB.GetPRStatus(provider, repoId, prNumber)
+	if err != nil {
+		logger.Error("error reading PR status", zap.Error(err))
+		return c.String(http.StatusInternalServerError, msgPRStatusError)
+	}
+	if prStatus == nil {
+		return c.String(http.StatusNotFound, fmt.Sprintf("no status found for PR %d in repository %d", prNumber, repoId))
+	}
+	return c.JSON(http.StatusOK, prStatusResponse{
+		State:         prStatus.State,
+		UpdatedAt:     prStatus.UpdatedAt,
+		NextAttemptAt: prStatus.NextAttemptAt,
+	})
+}
+
 func getRequiredQueryParameter(c echo.Context, parameterName string) (parameterValue string, err error) {
 	parameterValue = c.QueryParam(parameterName)
 	if parameterValue == "" {
@@ -271,7 +704,7 @@ func ZapLoggerFilterAwsElb(log *zap.Logger) echo.MiddlewareFunc {
 				return nil
 			}
 
-			logIncludeHostname := os.Getenv(envLogFilterIncludeHostname)
+			logIncludeHostname := currentConfig().Server.LogFilterIncludeHostname
 			if logIncludeHostname != "" && req.Host != "" {
 				// only log legit stuff from expected host
 				if logIncludeHostname != req.Host {
@@ -302,21 +735,40 @@ func ZapLoggerFilterAwsElb(log *zap.Logger) echo.MiddlewareFunc {
 	}
 }
 
-func openDB() (db *sql.DB, host string, port int, dbname, sslMode string, err error) {
-	host = os.Getenv(envPGHost)
-	port, _ = strconv.Atoi(os.Getenv(envPGPort))
-	user := os.Getenv(envPGUsername)
-	password := os.Getenv(envPGPassword)
-	dbname = os.Getenv(envPGDBName)
-	sslMode = os.Getenv(envSSLMode)
+// openDB opens the database of cfg. Connections are opened with the database settings current at the time, so
+// those opened after PG_PASSWORD is rotated use the new password, see refreshSecrets.
+func openDB(cfg config.Database) (db *sql.DB, host string, port int, dbname, sslMode string, err error) {
+	host, port, dbname, sslMode = cfg.Host, cfg.Port, cfg.Name, cfg.SSLMode
 
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=%s",
-		host, port, user, password, dbname, sslMode)
-	db, err = sql.Open("postgres", psqlInfo)
+	// only to find the driver registered as "postgres", nothing is connected yet
+	registered, err := sql.Open("postgres", psqlInfo(cfg))
+	if err != nil {
+		return
+	}
+	db = sql.OpenDB(pgConnector{driver: registered.Driver()})
+	err = registered.Close()
 	return
 }
 
+func psqlInfo(cfg config.Database) string {
+	return fmt.Sprintf("host=%s port=%d user=%s "+
+		"password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.Name, cfg.SSLMode)
+}
+
+// pgConnector connects to the database with the current configuration.
+type pgConnector struct {
+	driver driver.Driver
+}
+
+func (c pgConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(psqlInfo(currentConfig().Database))
+}
+
+func (c pgConnector) Driver() driver.Driver {
+	return c.driver
+}
+
 func handleProcessWebhook(c echo.Context) (err error) {
 	callId := uuid.New()
 	logger.Info("handleProcessWebhook-start",
@@ -328,11 +780,42 @@ func handleProcessWebhook(c echo.Context) (err error) {
 		)
 	}()
 
-	ghSecret := os.Getenv(envGhWebhookSecret)
+	ghSecrets := currentConfig().GitHub.WebhookSecret
+	// GitHub Enterprise Server tells which instance a webhook comes from, github.com does not
+	var host *ourGithub.Host
+	if hostName := c.Request().Header.Get(headerGitHubEnterpriseHost); hostName != "" {
+		if host = ourGithub.HostOf(strings.ToLower(hostName)); host == nil {
+			logger.Debug("webhook of unknown github host", zap.String("host", hostName))
+			return c.String(http.StatusBadRequest, fmt.Sprintf(msgTemplateUnknownGitHubHost, hostName))
+		}
+		ghSecrets = host.WebhookSecret
+	}
+	tenant, err := webhookTenant(c, host)
+	if err != nil {
+		logger.Debug("webhook of invalid tenant", zap.Error(err))
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	var tenantName string
+	if tenant != nil {
+		ghSecrets, tenantName = tenant.WebhookSecret, tenant.Name
+	}
 
-	hook, _ := webhook.New(webhook.Options.Secret(ghSecret))
+	// during a rotation any of the listed secrets is accepted, so we verify the signature ourselves
+	secret, err := ourGithub.VerifyWebhookSignature(c.Request(), ourGithub.WebhookSecrets(ghSecrets))
+	if err != nil {
+		logger.Debug("invalid webhook signature", zap.Error(err))
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	ourGithub.RecordDelivery(c.Request(), host, tenantName, appIdOf(host, tenant), secret)
 
-	payload, err := hook.Parse(c.Request(), webhook.PullRequestEvent)
+	if c.Request().Header.Get("X-GitHub-Event") == ourGithub.EventMergeGroup {
+		return handleMergeGroupWebhook(c, host, tenant)
+	}
+
+	hook, _ := webhook.New()
+
+	payload, err := hook.Parse(c.Request(), webhook.PullRequestEvent, webhook.RepositoryEvent,
+		webhook.MemberEvent, webhook.MembershipEvent, webhook.OrganizationEvent)
 
 	if err != nil {
 		if err == webhook.ErrEventNotFound {
@@ -344,22 +827,31 @@ func handleProcessWebhook(c echo.Context) (err error) {
 		return c.String(http.StatusBadRequest, err.Error())
 	}
 
-	appId, err := ourGithub.GetAppId()
-	if err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
-	}
+	appId := appIdOf(host, tenant)
+	claVersion := claVersionOf(tenant)
 
 	switch payload := payload.(type) {
 	case webhook.PullRequestPayload:
 		switch payload.Action {
-		case "opened", "reopened", "synchronize":
-			err := ourGithub.HandlePullRequest(logger, postgresDB, payload, appId, getCurrentCLAVersion())
+		case "opened", "reopened", "synchronize", "ready_for_review":
+			err := ourGithub.HandlePullRequest(logger, postgresDB, payload, host, appId, claVersion)
 			if err != nil {
 				logger.Error("failed to handle pull request", zap.Error(err))
 				return c.String(http.StatusBadRequest, err.Error())
 			}
 
 			return c.String(http.StatusAccepted, "accepted pull request for processing")
+		case "labeled", "unlabeled":
+			if !ourGithub.IsOverrideLabel(payload.Label.Name) {
+				return c.String(http.StatusAccepted, fmt.Sprintf("No action taken for: %s %s", payload.Action, payload.Label.Name))
+			}
+			err := ourGithub.HandleOverrideLabel(logger, postgresDB, payload, host, appId, claVersion)
+			if err != nil {
+				logger.Error("failed to handle override label", zap.Error(err))
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+
+			return c.String(http.StatusAccepted, "accepted override label change")
 		default:
 			logger.Debug("ignore pull request payload",
 				zap.String("action", payload.Action),
@@ -369,6 +861,56 @@ func handleProcessWebhook(c echo.Context) (err error) {
 			)
 			return c.String(http.StatusAccepted, fmt.Sprintf("No action taken for: %s", payload.Action))
 		}
+	case webhook.RepositoryPayload:
+		switch payload.Action {
+		case "renamed", "transferred":
+			err := ourGithub.HandleRepository(logger, postgresDB, payload, host)
+			if err != nil {
+				logger.Error("failed to handle repository", zap.Error(err))
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+
+			return c.String(http.StatusAccepted, "accepted repository change")
+		default:
+			logger.Debug("ignore repository payload",
+				zap.String("action", payload.Action),
+				zap.Int64("repoId", payload.Repository.ID),
+			)
+			return c.String(http.StatusAccepted, fmt.Sprintf("No action taken for: %s", payload.Action))
+		}
+	case webhook.MemberPayload:
+		err := ourGithub.HandleMember(logger, postgresDB, payload, host)
+		if err != nil {
+			logger.Error("failed to handle member", zap.Error(err))
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+
+		return c.String(http.StatusAccepted, "accepted collaborator change")
+	case webhook.MembershipPayload:
+		err := ourGithub.HandleMembership(logger, postgresDB, payload, host)
+		if err != nil {
+			logger.Error("failed to handle membership", zap.Error(err))
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+
+		return c.String(http.StatusAccepted, "accepted membership change")
+	case webhook.OrganizationPayload:
+		switch payload.Action {
+		case "member_added", "member_removed":
+			err := ourGithub.HandleOrganization(logger, postgresDB, payload, host)
+			if err != nil {
+				logger.Error("failed to handle organization", zap.Error(err))
+				return c.String(http.StatusBadRequest, err.Error())
+			}
+
+			return c.String(http.StatusAccepted, "accepted organization membership change")
+		default:
+			logger.Debug("ignore organization payload",
+				zap.String("action", payload.Action),
+				zap.String("org", payload.Organization.Login),
+			)
+			return c.String(http.StatusAccepted, fmt.Sprintf("No action taken for: %s", payload.Action))
+		}
 	default:
 		// theoretically can't get here due to hook.Parse() call above (events param), but better safe than sorry
 		logger.Debug("Unhandled payload type encountered", zap.Any("payload", payload))
@@ -377,17 +919,180 @@ func handleProcessWebhook(c echo.Context) (err error) {
 	}
 }
 
+// handleMergeGroupWebhook handles merge queue events, which our webhook parser does not know about.
+func handleMergeGroupWebhook(c echo.Context, host *ourGithub.Host, tenant *types.Tenant) (err error) {
+	event, err := ourGithub.ParseMergeGroupEvent(c.Request())
+	if err != nil {
+		logger.Debug("error parsing merge group event", zap.Error(err))
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	appId := appIdOf(host, tenant)
+
+	switch event.GetAction() {
+	case "checks_requested":
+		err := ourGithub.HandleMergeGroup(logger, postgresDB, event, host, appId, claVersionOf(tenant))
+		if err != nil {
+			logger.Error("failed to handle merge group", zap.Error(err))
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+
+		return c.String(http.StatusAccepted, "accepted merge group for processing")
+	default:
+		logger.Debug("ignore merge group payload",
+			zap.String("action", event.GetAction()),
+			zap.Int64("repoId", event.GetRepo().GetID()),
+		)
+		return c.String(http.StatusAccepted, fmt.Sprintf("No action taken for: %s", event.GetAction()))
+	}
+}
+
+// webhookTenant returns the tenant a webhook is for, by the tenant in its path, or else by the app it is for. It
+// returns nil for webhooks of the default tenant.
+func webhookTenant(c echo.Context, host *ourGithub.Host) (tenant *types.Tenant, err error) {
+	if name := c.Param(pathParamTenant); name != "" {
+		if tenant = ourGithub.Tenants.ByName(name); tenant == nil {
+			return nil, fmt.Errorf(msgTemplateUnknownTenant, name)
+		}
+		if host != nil {
+			return nil, errors.New(msgTenantOfGitHubHost)
+		}
+		return
+	}
+	if host != nil || c.Request().Header.Get(headerHookTargetType) != "integration" {
+		return
+	}
+	if appId, parseErr := strconv.ParseInt(c.Request().Header.Get(headerHookTargetID), 10, 64); parseErr == nil {
+		tenant = ourGithub.Tenants.ByAppId(appId)
+	}
+	return
+}
+
+// appIdOf is the id of our GitHub App on a host, or of a tenant, or the default one on github.com.
+func appIdOf(host *ourGithub.Host, tenant *types.Tenant) int64 {
+	if host != nil {
+		return host.AppId
+	}
+	if tenant != nil {
+		return tenant.AppId
+	}
+	return currentConfig().GitHub.AppId
+}
+
+// claVersionOf is the (qualified) CLA version contributors of a tenant must sign, the current one without a tenant.
+func claVersionOf(tenant *types.Tenant) string {
+	if tenant != nil {
+		return ourGithub.QualifiedCLAVersion(tenant.Name, tenant.CLAVersion)
+	}
+	return getCurrentCLAVersion()
+}
+
+// claVersionFor is the CLA version the authors of a PR must have signed, which depends on the tenant of its app.
+func claVersionFor(evalInfo *types.EvaluationInfo) string {
+	return ourGithub.Tenants.CLAVersion(evalInfo, getCurrentCLAVersion())
+}
+
+// handleProcessGitLabWebhook evaluates GitLab merge requests when they are opened or get new commits.
+func handleProcessGitLabWebhook(c echo.Context) (err error) {
+	payload, err := gitlab.ParseMergeRequestEvent(c.Request(), currentConfig().GitLab.WebhookSecret)
+	if err != nil {
+		logger.Debug("error parsing gitlab event", zap.Error(err))
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if !payload.NeedsEvaluation() {
+		logger.Debug("ignore merge request payload",
+			zap.String("action", payload.ObjectAttributes.Action),
+			zap.Int64("projectId", payload.Project.ID),
+			zap.Int64("mergeRequestIID", payload.ObjectAttributes.IID),
+		)
+		return c.String(http.StatusAccepted, fmt.Sprintf("No action taken for: %s", payload.ObjectAttributes.Action))
+	}
+
+	if err = gitlab.HandleMergeRequest(logger, postgresDB, payload, getCurrentCLAVersion()); err != nil {
+		logger.Error("failed to handle merge request", zap.Error(err))
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	return c.String(http.StatusAccepted, "accepted merge request for processing")
+}
+
+// handleProcessGiteaWebhook evaluates Gitea pull requests when they are opened or get new commits.
+func handleProcessGiteaWebhook(c echo.Context) (err error) {
+	payload, err := gitea.ParsePullRequestEvent(c.Request(), currentConfig().Gitea.WebhookSecret)
+	if err != nil {
+		logger.Debug("error parsing gitea event", zap.Error(err))
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if !payload.NeedsEvaluation() {
+		logger.Debug("ignore pull request payload",
+			zap.String("action", payload.Action),
+			zap.Int64("repoId", payload.Repository.ID),
+			zap.Int64("pullRequestID", payload.Number),
+		)
+		return c.String(http.StatusAccepted, fmt.Sprintf("No action taken for: %s", payload.Action))
+	}
+
+	if err = gitea.HandlePullRequest(logger, postgresDB, payload, getCurrentCLAVersion()); err != nil {
+		logger.Error("failed to handle pull request", zap.Error(err))
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	return c.String(http.StatusAccepted, "accepted pull request for processing")
+}
+
 func getCurrentCLAVersion() (requiredClaVersion string) {
-	return os.Getenv(envReactAppClaVersion)
+	return currentConfig().CLA.Version
+}
+
+// signClaRequest is the signature, along with the signing link the signer followed, if any
+type signClaRequest struct {
+	types.UserSignature
+	SignLink string `json:"signLink,omitempty"`
+}
+
+// signClaResponse tells the signer where to go next, i.e. back to the PR of their signing link
+type signClaResponse struct {
+	types.UserSignature
+	RedirectURL string `json:"redirectUrl,omitempty"`
+}
+
+// verifySignLink checks a signing link is valid and meant for login, or responds why it is not.
+func verifySignLink(c echo.Context, token, login string) (link *ourGithub.SignLink, err error) {
+	link, err = ourGithub.SignLinks.Verify(token)
+	if err != nil {
+		logger.Debug("invalid signing link", zap.String("login", login), zap.Error(err))
+		return nil, c.String(http.StatusBadRequest, err.Error())
+	}
+	if !strings.EqualFold(link.Login, login) {
+		logger.Debug("signing link used by another login", zap.String("login", login), zap.String("linkLogin", link.Login))
+		return nil, c.String(http.StatusForbidden, fmt.Sprintf(msgTemplateSignLinkWrongLogin, link.Login, login))
+	}
+	return
 }
 
+const msgTemplateSignLinkWrongLogin = "this signing link is for @%s, not @%s"
+const msgTemplateSignLinkWrongCLAVersion = "this signing link is for CLA version %s, not %s"
+
 func handleProcessSignCla(c echo.Context) (err error) {
 	logger.Debug("Attempting to sign the CLA")
-	user := new(types.UserSignature)
+	request := new(signClaRequest)
 
-	if err := c.Bind(user); err != nil {
+	if err := c.Bind(request); err != nil {
 		return err
 	}
+	user := &request.UserSignature
+
+	var link *ourGithub.SignLink
+	if request.SignLink != "" {
+		if link, err = verifySignLink(c, request.SignLink, user.User.Login); link == nil {
+			return
+		}
+		if link.CLAVersion != user.CLAVersion {
+			return c.String(http.StatusBadRequest, fmt.Sprintf(msgTemplateSignLinkWrongCLAVersion, link.CLAVersion, user.CLAVersion))
+		}
+	}
 
 	user.TimeSigned = time.Now()
 	user.CLAText, err = getClaText(user.CLATextUrl)
@@ -416,36 +1121,181 @@ func handleProcessSignCla(c echo.Context) (err error) {
 		logger.Error("Failed to send CLA signature notification", zap.Error(err))
 	}
 
-	return c.JSON(http.StatusCreated, user)
+	response := signClaResponse{UserSignature: *user}
+	if link != nil {
+		// prior PRs were reviewed above, so the PR already shows the signed CLA when the signer gets back to it
+		response.RedirectURL = link.PullRequestURL()
+	}
+	return c.JSON(http.StatusCreated, response)
+}
+
+// oauthUserResponse is the GitHub user, along with the PR they are signing for when they followed a signing link
+type oauthUserResponse struct {
+	*github.User
+	SignLink *ourGithub.SignLink `json:"signLink,omitempty"`
+	// ReturnTo is what the login was started with, i.e. the signing link or where to go once signed
+	ReturnTo string `json:"returnTo,omitempty"`
+}
+
+// oauthLoginCookie keeps the login attempt while the user is on GitHub, see oauth.LoginAttempt
+const oauthLoginCookie = "cla_oauth_login"
+const oauthLoginMaxAge = 10 * time.Minute
+
+const queryParameterRedirectURI = "redirect_uri"
+const queryParameterReturnTo = "return"
+const msgTemplateUnsupportedLoginProvider = "unsupported login provider: %s"
+const msgOAuthLoginMissing = "no GitHub login in progress, please log in again"
+const msgOAuthLoginFailed = "GitHub login failed, please log in again"
+
+// oauthLogin is what logging in needs of oauth.OAuthInterface
+type oauthLogin interface {
+	AuthCodeURL(attempt *oauth.LoginAttempt) string
+	GetOAuthUser(logger *zap.Logger, code string, attempt *oauth.LoginAttempt) (user *github.User, err error)
+}
+
+// createOAuth creates the OAuth app login, unless configureOAuth picks the GitHub App
+var createOAuth = func() oauthLogin {
+	githubConfig := currentConfig().GitHub
+	return oauth.CreateOAuth(githubConfig.OAuthClientId, githubConfig.OAuthClientSecret)
+}
+
+// createGitLabOAuth creates the GitLab login, configureGitLab sets it when signing in with GitLab is enabled
+var createGitLabOAuth func() oauthLogin
+
+// createGiteaOAuth creates the Gitea login, configureGitea sets it when signing in with Gitea is enabled
+var createGiteaOAuth func() oauthLogin
+
+// createEnterpriseOAuth creates the login of a GitHub Enterprise Server instance
+var createEnterpriseOAuth = func(host *ourGithub.Host) oauthLogin {
+	return oauth.CreateEnterpriseOAuth(host)
+}
+
+// oauthFor returns the login of a provider (see oauth.LoginAttempt.Provider), or nil if signers can't log in there.
+func oauthFor(provider string) oauthLogin {
+	switch provider {
+	case "", vcs.ProviderGitHub:
+		return createOAuth()
+	case vcs.ProviderGitLab:
+		if createGitLabOAuth != nil {
+			return createGitLabOAuth()
+		}
+	case vcs.ProviderGitea:
+		if createGiteaOAuth != nil {
+			return createGiteaOAuth()
+		}
+	default:
+		if host := ourGithub.HostOf(provider); host != nil && host.ClientID != "" {
+			return createEnterpriseOAuth(host)
+		}
+	}
+	return nil
+}
+
+func oauthCookie(c echo.Context, value string, maxAge time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     oauthLoginCookie,
+		Value:    value,
+		Path:     pathOAuthCallback,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// handleGitHubOAuthLogin starts a login, sending the user to GitHub with a fresh state and PKCE challenge that the
+// callback checks against the cookie set here.
+func handleGitHubOAuthLogin(c echo.Context) (err error) {
+	logger.Debug("Starting GitHub login")
+
+	provider := c.QueryParam(ourGithub.QueryParameterProvider)
+	login := oauthFor(provider)
+	if login == nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf(msgTemplateUnsupportedLoginProvider, provider))
+	}
+
+	attempt, err := oauth.NewLoginAttempt(c.QueryParam(queryParameterRedirectURI), c.QueryParam(queryParameterReturnTo))
+	if err != nil {
+		logger.Error("failed to create oauth login", zap.Error(err))
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	attempt.Provider = provider
+	value, err := attempt.Encode()
+	if err != nil {
+		logger.Error("failed to encode oauth login", zap.Error(err))
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	c.SetCookie(oauthCookie(c, value, oauthLoginMaxAge))
+
+	return c.Redirect(http.StatusFound, login.AuthCodeURL(attempt))
 }
 
 func handleProcessGitHubOAuth(c echo.Context) (err error) {
 	logger.Debug("Attempting to fetch GitHub crud")
 
 	code := c.QueryParam("code")
+	if code == "" {
+		return c.String(http.StatusBadRequest, fmt.Sprintf(msgTemplateMissingQueryParam, "code"))
+	}
 
 	state := c.QueryParam("state")
 	if state == "" {
-		return
+		return c.String(http.StatusBadRequest, fmt.Sprintf(msgTemplateMissingQueryParam, "state"))
 	}
 
-	oauthImpl := oauth.CreateOAuth(os.Getenv(envReactAppGithubClientId), os.Getenv(envGithubClientSecret))
+	cookie, err := c.Cookie(oauthLoginCookie)
+	if err != nil {
+		logger.Debug("missing oauth login cookie", zap.Error(err))
+		return c.String(http.StatusBadRequest, msgOAuthLoginMissing)
+	}
+	// the state can only be used once
+	c.SetCookie(oauthCookie(c, "", -time.Second))
 
-	user, err := oauthImpl.GetOAuthUser(logger, code)
+	attempt, err := oauth.DecodeLoginAttempt(cookie.Value, state)
+	if err != nil {
+		logger.Debug("invalid oauth state", zap.Error(err))
+		return c.String(http.StatusForbidden, err.Error())
+	}
+
+	// a signing link is passed through the login, anything else is where to go back to
+	var link *ourGithub.SignLink
+	if ourGithub.IsSignLinkToken(attempt.ReturnTo) {
+		if link, err = ourGithub.SignLinks.Verify(attempt.ReturnTo); err != nil {
+			logger.Debug("invalid signing link", zap.Error(err))
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	login := oauthFor(attempt.Provider)
+	if login == nil {
+		return c.String(http.StatusBadRequest, fmt.Sprintf(msgTemplateUnsupportedLoginProvider, attempt.Provider))
+	}
+	user, err := login.GetOAuthUser(logger, code, attempt)
 	if err != nil {
 		logger.Error("failed to get oauth user", zap.Error(err))
-		return
+		return c.String(http.StatusUnauthorized, msgOAuthLoginFailed)
 	}
 
-	return c.JSON(http.StatusOK, user)
+	if link != nil {
+		if link, err = verifySignLink(c, attempt.ReturnTo, user.GetLogin()); link == nil {
+			return
+		}
+	}
+	return c.JSON(http.StatusOK, oauthUserResponse{User: user, SignLink: link, ReturnTo: attempt.ReturnTo})
 }
 
-const envClaUrl = "REACT_APP_CLA_URL"
-const msgMissingClaUrl = "missing " + envClaUrl + " environment variable"
+const msgMissingClaUrl = "missing CLA text url"
 
 func handleRetrieveCLAText(c echo.Context) (err error) {
 	logger.Debug("Attempting to fetch CLA text")
-	claURL := os.Getenv(envClaUrl)
+	claURL := currentConfig().CLA.TextURL
+	if name := c.QueryParam(ourGithub.QueryParameterTenant); name != "" {
+		tenant := ourGithub.Tenants.ByName(name)
+		if tenant == nil {
+			return c.String(http.StatusNotFound, fmt.Sprintf(msgTemplateUnknownTenant, name))
+		}
+		claURL = tenant.CLATextUrl
+	}
 	claText, err := getClaText(claURL)
 
 	if err != nil {
@@ -456,6 +1306,109 @@ func handleRetrieveCLAText(c echo.Context) (err error) {
 	return c.String(http.StatusOK, claText)
 }
 
+const pathParamTenant = "tenant"
+
+// tenantCLA is the CLA contributors of a tenant sign
+type tenantCLA struct {
+	Name string `json:"name"`
+	// CLAVersion is the qualified version signers sign, see ourGithub.QualifiedCLAVersion
+	CLAVersion string `json:"claVersion"`
+	CLATextUrl string `json:"claTextUrl"`
+}
+
+// handleTenant tells the signing page which CLA to show contributors of a tenant.
+func handleTenant(c echo.Context) (err error) {
+	name := c.Param(pathParamTenant)
+	tenant := ourGithub.Tenants.ByName(name)
+	if tenant == nil {
+		return c.String(http.StatusNotFound, fmt.Sprintf(msgTemplateUnknownTenant, name))
+	}
+	return c.JSON(http.StatusOK, tenantCLA{
+		Name:       tenant.Name,
+		CLAVersion: ourGithub.QualifiedCLAVersion(tenant.Name, tenant.CLAVersion),
+		CLATextUrl: tenant.CLATextUrl,
+	})
+}
+
+// tenantInfo is what admins see of a tenant, without its secrets
+type tenantInfo struct {
+	tenantCLA
+	AppId       int64    `json:"appId"`
+	NotifyEmail string   `json:"notifyEmail,omitempty"`
+	Admins      []string `json:"admins"`
+}
+
+// handleTenants lists the tenants we serve.
+func handleTenants(c echo.Context) (err error) {
+	tenants := make([]tenantInfo, 0)
+	for _, tenant := range ourGithub.Tenants.All() {
+		tenants = append(tenants, tenantInfo{
+			tenantCLA: tenantCLA{
+				Name:       tenant.Name,
+				CLAVersion: ourGithub.QualifiedCLAVersion(tenant.Name, tenant.CLAVersion),
+				CLATextUrl: tenant.CLATextUrl,
+			},
+			AppId:       tenant.AppId,
+			NotifyEmail: tenant.NotifyEmail,
+			Admins:      tenant.Admins,
+		})
+	}
+	return c.JSON(http.StatusOK, tenants)
+}
+
+// rotationStatus tells which webhook secrets and private keys are still in use, so old ones can be retired.
+type rotationStatus struct {
+	Secrets    []ourGithub.SecretUsage      `json:"secrets"`
+	Keys       []ourGithub.PrivateKeyStatus `json:"keys"`
+	Deliveries []ourGithub.Delivery         `json:"deliveries"`
+}
+
+// handleConfig shows the configuration we run with, without its secrets.
+func handleConfig(c echo.Context) (err error) {
+	return c.JSON(http.StatusOK, currentConfig().Redacted())
+}
+
+// handleRotation reports the webhook secrets and private keys in use, and those each recent webhook delivery used.
+func handleRotation(c echo.Context) (err error) {
+	return c.JSON(http.StatusOK, rotationStatus{
+		Secrets:    ourGithub.Deliveries.Secrets(),
+		Keys:       ourGithub.PrivateKeys.Statuses(),
+		Deliveries: ourGithub.Deliveries.Recent(),
+	})
+}
+
+type signingKeySelection struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+// handleSelectSigningKey switches the private key our apps sign with, without a restart. Only the replica serving the
+// request switches, and only until it restarts, see KeyTracker.Select.
+func handleSelectSigningKey(c echo.Context) (err error) {
+	var selection signingKeySelection
+	if err = c.Bind(&selection); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err = ourGithub.LoadAllKeyRings(); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	if err = ourGithub.PrivateKeys.Select(selection.Fingerprint); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	logger.Info("signing key selected", zap.String("fingerprint", selection.Fingerprint))
+	return c.JSON(http.StatusOK, ourGithub.PrivateKeys.Statuses())
+}
+
+// handleBackfillRepoIds assigns repository IDs to PRs tracked before PRs were keyed by repository ID. It is safe to
+// run more than once, PRs already adopted are left alone.
+func handleBackfillRepoIds(c echo.Context) (err error) {
+	backfill, err := ourGithub.BackfillRepoIds(logger, postgresDB)
+	if err != nil {
+		logger.Error("failed to backfill repository IDs", zap.Error(err))
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, backfill)
+}
+
 func getClaText(claTextUrl string) (claText string, err error) {
 	logger.Debug("Attempting to fetch CLA text")
 
@@ -498,12 +1451,6 @@ func getClaText(claTextUrl string) (claText string, err error) {
 	return claCache[claTextUrl], nil
 }
 
-const envSmtpHost = "SMTP_HOST"
-const envSmtpPort = "SMTP_PORT"
-const envSmtpUsername = "SMTP_USERNAME"
-const envSmtpPassword = "SMTP_PASSWORD"
-const envNotificationAddress = "NOTIFY_EMAIL"
-
 func handleTestEmail(c echo.Context) (err error) {
 	testSignature := new(types.UserSignature)
 	testSignature.User.Login = "LOGIN-ID"
@@ -511,18 +1458,30 @@ func handleTestEmail(c echo.Context) (err error) {
 	testSignature.User.GivenName = "A Person"
 	testSignature.CLAVersion = getCurrentCLAVersion()
 	testSignature.TimeSigned = time.Now()
-	testSignature.CLATextUrl = os.Getenv(envClaUrl)
+	testSignature.CLATextUrl = currentConfig().CLA.TextURL
+	if name := c.QueryParam(ourGithub.QueryParameterTenant); name != "" {
+		tenant := ourGithub.Tenants.ByName(name)
+		if tenant == nil {
+			return c.String(http.StatusNotFound, fmt.Sprintf(msgTemplateUnknownTenant, name))
+		}
+		testSignature.CLAVersion = ourGithub.QualifiedCLAVersion(tenant.Name, tenant.CLAVersion)
+		testSignature.CLATextUrl = tenant.CLATextUrl
+	}
 	testSignature.CLAText, _ = getClaText(testSignature.CLATextUrl)
 
 	return notifySignatureComplete(testSignature)
 }
 
 func notifySignatureComplete(signature *types.UserSignature) (err error) {
-	smtpHost := os.Getenv(envSmtpHost)
-	smtpPort := os.Getenv(envSmtpPort)
-	smtpUsername := os.Getenv(envSmtpUsername)
-	smtpPassword := os.Getenv(envSmtpPassword)
-	notificationAddress := os.Getenv(envNotificationAddress)
+	smtpConfig := currentConfig().SMTP
+	smtpHost := smtpConfig.Host
+	smtpPort := smtpConfig.Port
+	smtpUsername := smtpConfig.Username
+	smtpPassword := smtpConfig.Password
+	notificationAddress := smtpConfig.NotifyEmail
+	if tenant := ourGithub.Tenants.OfCLAVersion(signature.CLAVersion); tenant != nil && tenant.NotifyEmail != "" {
+		notificationAddress = tenant.NotifyEmail
+	}
 
 	logger.Info("Preparing SMTP...")
 	auth := smtp.PlainAuth("", smtpUsername, smtpPassword, smtpHost)
@@ -537,13 +1496,13 @@ func notifySignatureComplete(signature *types.UserSignature) (err error) {
 		"	Email Address : " + signature.User.Email + "\r\n\r\n" +
 		"CLA Text below was as signed (obtained from " + signature.CLATextUrl + "):\r\n\r\n" + signature.CLAText)
 
-	if smtpHost == "" || smtpPort == "" || notificationAddress == "" {
+	if smtpHost == "" || smtpPort == 0 || notificationAddress == "" {
 		logger.Error("SMTP Host, SMTP Port or Notification Address are empty - cannot send notification")
 		return errors.New("SMTP Host, SMTP Port or Notification Address are empty - cannot send notification")
 	}
 
 	logger.Debug("Calling SMTP Send...")
-	err = smtp.SendMail(fmt.Sprintf("%s:%s", smtpHost, smtpPort), auth, "cla-legal@sonatype.com", to, msg)
+	err = smtp.SendMail(fmt.Sprintf("%s:%d", smtpHost, smtpPort), auth, "cla-legal@sonatype.com", to, msg)
 	logger.Debug("SMTP Send Complete", zap.Error(err))
 
 	if err != nil {
@@ -19,11 +19,15 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -31,24 +35,66 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/go-github/v64/github"
 	"github.com/labstack/echo/v4"
+	"github.com/sonatype-nexus-community/the-cla/config"
 	"github.com/sonatype-nexus-community/the-cla/db"
+	"github.com/sonatype-nexus-community/the-cla/gitea"
 	ourGithub "github.com/sonatype-nexus-community/the-cla/github"
+	"github.com/sonatype-nexus-community/the-cla/gitlab"
+	"github.com/sonatype-nexus-community/the-cla/oauth"
+	"github.com/sonatype-nexus-community/the-cla/secrets"
 	"github.com/sonatype-nexus-community/the-cla/types"
+	"github.com/sonatype-nexus-community/the-cla/vcs"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 	webhook "gopkg.in/go-playground/webhooks.v5/github"
 )
 
-func resetEnvVariable(t *testing.T, variableName, originalValue string) {
-	if originalValue == "" {
-		assert.NoError(t, os.Unsetenv(variableName))
-	} else {
-		assert.NoError(t, os.Setenv(variableName, originalValue))
-	}
+// testWebhookSecret signs the webhooks of setupMockContextWebhook.
+const testWebhookSecret = "myWebhookSecret"
+
+// setupTestConfig runs a test with the default configuration, accepting webhooks signed with testWebhookSecret,
+// which the test may change.
+func setupTestConfig(t *testing.T) *config.Config {
+	origConfig := appConfig.Load()
+	testConfig := config.Default()
+	testConfig.GitHub.WebhookSecret = testWebhookSecret
+	appConfig.Store(testConfig)
+	t.Cleanup(func() {
+		appConfig.Store(origConfig)
+	})
+	return testConfig
 }
 
-func resetEnvVarPGHost(t *testing.T, origEnvPGHost string) {
-	resetEnvVariable(t, envPGHost, origEnvPGHost)
+// setupTestEnv sets the environment of a valid configuration for the duration of a test.
+func setupTestEnv(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "the-cla.pem")
+	ourGithub.WriteTestKeyFile(t, keyFile)
+	for envName, value := range map[string]string{
+		"INFO_USERNAME":              "myInfoUser",
+		"INFO_PASSWORD":              "myInfoPassword",
+		"PG_HOST":                    "bogus-db-hostname",
+		"PG_PORT":                    "5432",
+		"PG_USERNAME":                "myPGUser",
+		"PG_DB_NAME":                 "db",
+		"GH_APP_ID":                  "1",
+		"CLA_PEM_FILE":               keyFile,
+		"GH_WEBHOOK_SECRET":          "myWebhookSecret",
+		"REACT_APP_GITHUB_CLIENT_ID": "myClientId",
+		"GITHUB_CLIENT_SECRET":       "myClientSecret",
+		"REACT_APP_CLA_VERSION":      "1.0",
+		"REACT_APP_CLA_URL":          "https://example.com/cla.txt",
+		"SMTP_HOST":                  "smtp.example.com",
+		"SMTP_PORT":                  "25",
+		"NOTIFY_EMAIL":               "legal@example.com",
+	} {
+		t.Setenv(envName, value)
+	}
+	setupTestConfig(t)
+	t.Cleanup(func() {
+		ourGithub.Apps.SetKeyFile(ourGithub.FilenameTheClaPem)
+		assert.NoError(t, ourGithub.Apps.SetPrivateKey(config.EnvPrivateKey, ""))
+	})
 }
 
 func TestZapLoggerFilterSkipsELB(t *testing.T) {
@@ -67,13 +113,38 @@ func TestZapLoggerFilterSkipsELB(t *testing.T) {
 	result(nil)
 }
 
-func TestMainDBOpenPanic(t *testing.T) {
+func TestMainInvalidConfigPanic(t *testing.T) {
+	errRecovered = nil
+	setupTestEnv(t)
+	t.Setenv("PG_HOST", "")
+	t.Setenv("NOTIFY_EMAIL", "legal")
+	defer func() {
+		errRecovered = nil
+	}()
+
+	main()
+
+	assert.True(t, strings.HasPrefix(errRecovered.Error(), "failed to load configuration. err: "))
+	assert.ErrorContains(t, errRecovered, "PG_HOST is required")
+	assert.ErrorContains(t, errRecovered, "NOTIFY_EMAIL")
+}
+
+func TestMainSecretsPanic(t *testing.T) {
 	errRecovered = nil
-	origEnvPGHost := os.Getenv(envPGHost)
+	setupTestEnv(t)
+	t.Setenv("VAULT_ADDR", "https://vault.example.com")
 	defer func() {
-		resetEnvVarPGHost(t, origEnvPGHost)
+		errRecovered = nil
 	}()
-	assert.NoError(t, os.Setenv(envPGHost, "bogus-db-hostname"))
+
+	main()
+
+	assert.EqualError(t, errRecovered, "failed to configure secrets. err: VAULT_SECRET_PATH is required with VAULT_ADDR")
+}
+
+func TestMainDBOpenPanic(t *testing.T) {
+	errRecovered = nil
+	setupTestEnv(t)
 
 	defer func() {
 		errRecovered = nil
@@ -99,11 +170,7 @@ func setupMockContextCLA(t *testing.T) echo.Context {
 }
 
 func TestHandleRetrieveCLAText_MissingClaURL(t *testing.T) {
-	origClaUrl := os.Getenv(envClaUrl)
-	defer func() {
-		resetEnvVariable(t, envClaUrl, origClaUrl)
-	}()
-	resetEnvVariable(t, envClaUrl, "")
+	setupTestConfig(t)
 
 	err := handleRetrieveCLAText(setupMockContextCLA(t))
 
@@ -111,10 +178,7 @@ func TestHandleRetrieveCLAText_MissingClaURL(t *testing.T) {
 }
 
 func TestHandleRetrieveCLAText_BadResponseCode(t *testing.T) {
-	origClaUrl := os.Getenv(envClaUrl)
-	defer func() {
-		resetEnvVariable(t, envClaUrl, origClaUrl)
-	}()
+	testConfig := setupTestConfig(t)
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, http.MethodGet, r.Method)
@@ -124,17 +188,14 @@ func TestHandleRetrieveCLAText_BadResponseCode(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	assert.NoError(t, os.Setenv(envClaUrl, ts.URL+pathClaText))
+	testConfig.CLA.TextURL = ts.URL + pathClaText
 	assert.EqualError(t, handleRetrieveCLAText(setupMockContextCLA(t)), "unexpected cla text response code: 403")
 }
 
 func TestHandleRetrieveCLAText(t *testing.T) {
 	callCount := 0
 
-	origClaUrl := os.Getenv(envClaUrl)
-	defer func() {
-		resetEnvVariable(t, envClaUrl, origClaUrl)
-	}()
+	testConfig := setupTestConfig(t)
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, http.MethodGet, r.Method)
@@ -146,7 +207,7 @@ func TestHandleRetrieveCLAText(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	assert.NoError(t, os.Setenv(envClaUrl, ts.URL+pathClaText))
+	testConfig.CLA.TextURL = ts.URL + pathClaText
 	assert.NoError(t, handleRetrieveCLAText(setupMockContextCLA(t)))
 	assert.Equal(t, callCount, 1)
 
@@ -159,10 +220,7 @@ func TestHandleRetrieveCLAText(t *testing.T) {
 func TestHandleRetrieveCLATextWithBadURL(t *testing.T) {
 	callCount := 0
 
-	origClaUrl := os.Getenv(envClaUrl)
-	defer func() {
-		resetEnvVariable(t, envClaUrl, origClaUrl)
-	}()
+	testConfig := setupTestConfig(t)
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, http.MethodGet, r.Method)
@@ -174,12 +232,12 @@ func TestHandleRetrieveCLATextWithBadURL(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	assert.NoError(t, os.Setenv(envClaUrl, "badURLProtocol"+ts.URL+pathClaText))
+	testConfig.CLA.TextURL = "badURLProtocol" + ts.URL + pathClaText
 	assert.Error(t, handleRetrieveCLAText(setupMockContextCLA(t)), `unsupported protocol scheme "badurlprotocolhttp"`)
 	assert.Equal(t, callCount, 0)
 }
 
-func setupMockContextOAuth(t *testing.T, queryParams map[string]string) (c echo.Context, rec *httptest.ResponseRecorder) {
+func setupMockContextOAuth(t *testing.T, queryParams map[string]string, cookies ...*http.Cookie) (c echo.Context, rec *httptest.ResponseRecorder) {
 	logger = zaptest.NewLogger(t)
 
 	// Setup
@@ -191,30 +249,359 @@ func setupMockContextOAuth(t *testing.T, queryParams map[string]string) (c echo.
 		q.Add(k, v)
 	}
 	req.URL.RawQuery = q.Encode()
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
 
 	rec = httptest.NewRecorder()
 	c = e.NewContext(req, rec)
 	return
 }
 
-func TestHandleProcessGitHubOAuthMissingQueryParamState(t *testing.T) {
+type oauthLoginMock struct {
+	t            *testing.T
+	expectedCode string
+	user         *github.User
+	err          error
+}
+
+func (o *oauthLoginMock) AuthCodeURL(attempt *oauth.LoginAttempt) string {
+	return "https://github.com/login/oauth/authorize?state=" + attempt.State
+}
+
+func (o *oauthLoginMock) GetOAuthUser(_ *zap.Logger, code string, attempt *oauth.LoginAttempt) (*github.User, error) {
+	assert.Equal(o.t, o.expectedCode, code)
+	assert.NotEmpty(o.t, attempt.Verifier)
+	return o.user, o.err
+}
+
+func setupOAuthLoginMock(t *testing.T, mock *oauthLoginMock) {
+	origCreateOAuth := createOAuth
+	mock.t = t
+	createOAuth = func() oauthLogin { return mock }
+	t.Cleanup(func() {
+		createOAuth = origCreateOAuth
+	})
+}
+
+// setupOAuthLogin returns the cookie of a login started to come back to returnTo
+func setupOAuthLogin(t *testing.T, returnTo string) (attempt *oauth.LoginAttempt, cookie *http.Cookie) {
+	attempt, err := oauth.NewLoginAttempt("", returnTo)
+	assert.NoError(t, err)
+	value, err := attempt.Encode()
+	assert.NoError(t, err)
+	return attempt, &http.Cookie{Name: oauthLoginCookie, Value: value}
+}
+
+func TestHandleGitHubOAuthLogin(t *testing.T) {
+	setupOAuthLoginMock(t, &oauthLoginMock{})
+	logger = zaptest.NewLogger(t)
+	req := httptest.NewRequest(http.MethodGet, pathOAuthLogin+"?return=https%3A%2F%2Fexample.com", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	assert.NoError(t, handleGitHubOAuthLogin(c))
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	cookies := rec.Result().Cookies()
+	assert.Equal(t, 1, len(cookies))
+	assert.Equal(t, oauthLoginCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.Equal(t, pathOAuthCallback, cookies[0].Path)
+
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	assert.NoError(t, err)
+	attempt, err := oauth.DecodeLoginAttempt(cookies[0].Value, location.Query().Get("state"))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", attempt.ReturnTo)
+}
+
+func TestHandleProcessGitHubOAuthMissingQueryParamCode(t *testing.T) {
 	c, rec := setupMockContextOAuth(t, map[string]string{})
 	assert.NoError(t, handleProcessGitHubOAuth(c))
-	assert.Equal(t, 0, c.Response().Status)
-	assert.Equal(t, "", rec.Body.String())
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, fmt.Sprintf(msgTemplateMissingQueryParam, "code"), rec.Body.String())
+}
+
+func TestHandleProcessGitHubOAuthMissingQueryParamState(t *testing.T) {
+	c, rec := setupMockContextOAuth(t, map[string]string{"code": "myCode"})
+	assert.NoError(t, handleProcessGitHubOAuth(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, fmt.Sprintf(msgTemplateMissingQueryParam, "state"), rec.Body.String())
+}
+
+func TestHandleProcessGitHubOAuthMissingCookie(t *testing.T) {
+	c, rec := setupMockContextOAuth(t, map[string]string{"code": "myCode", "state": "myState"})
+	assert.NoError(t, handleProcessGitHubOAuth(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, msgOAuthLoginMissing, rec.Body.String())
+}
+
+func TestHandleProcessGitHubOAuthStateMismatch(t *testing.T) {
+	setupOAuthLoginMock(t, &oauthLoginMock{})
+	_, cookie := setupOAuthLogin(t, "")
+	c, rec := setupMockContextOAuth(t, map[string]string{"code": "myCode", "state": "forgedState"}, cookie)
+
+	assert.NoError(t, handleProcessGitHubOAuth(c))
+	assert.Equal(t, http.StatusForbidden, c.Response().Status)
+	assert.Equal(t, oauth.ErrInvalidState.Error(), rec.Body.String())
+	// the login attempt is cleared either way
+	assert.Equal(t, -1, rec.Result().Cookies()[0].MaxAge)
+}
+
+func TestHandleProcessGitHubOAuthGetUserError(t *testing.T) {
+	setupOAuthLoginMock(t, &oauthLoginMock{expectedCode: "myCode", err: fmt.Errorf("forced exchange error")})
+	attempt, cookie := setupOAuthLogin(t, "")
+	c, rec := setupMockContextOAuth(t, map[string]string{"code": "myCode", "state": attempt.State}, cookie)
+
+	assert.NoError(t, handleProcessGitHubOAuth(c))
+	assert.Equal(t, http.StatusUnauthorized, c.Response().Status)
+	assert.Equal(t, msgOAuthLoginFailed, rec.Body.String())
+}
+
+func TestHandleProcessGitHubOAuth(t *testing.T) {
+	setupOAuthLoginMock(t, &oauthLoginMock{expectedCode: "myCode", user: &github.User{Login: github.String("alice")}})
+	attempt, cookie := setupOAuthLogin(t, "https://example.com")
+	c, rec := setupMockContextOAuth(t, map[string]string{"code": "myCode", "state": attempt.State}, cookie)
+
+	assert.NoError(t, handleProcessGitHubOAuth(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	var response oauthUserResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "alice", response.GetLogin())
+	assert.Equal(t, "https://example.com", response.ReturnTo)
+	assert.Nil(t, response.SignLink)
+}
+
+func setupGitLabOAuthMock(t *testing.T, mock *oauthLoginMock) {
+	origCreateGitLabOAuth := createGitLabOAuth
+	mock.t = t
+	createGitLabOAuth = func() oauthLogin { return mock }
+	t.Cleanup(func() {
+		createGitLabOAuth = origCreateGitLabOAuth
+	})
+}
+
+func TestHandleGitHubOAuthLoginUnsupportedProvider(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	req := httptest.NewRequest(http.MethodGet, pathOAuthLogin+"?provider=gitlab", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	assert.NoError(t, handleGitHubOAuthLogin(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, fmt.Sprintf(msgTemplateUnsupportedLoginProvider, "gitlab"), rec.Body.String())
+	assert.Empty(t, rec.Result().Cookies())
+}
+
+func TestHandleGitHubOAuthLoginGitLab(t *testing.T) {
+	setupGitLabOAuthMock(t, &oauthLoginMock{})
+	logger = zaptest.NewLogger(t)
+	req := httptest.NewRequest(http.MethodGet, pathOAuthLogin+"?provider=gitlab", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	assert.NoError(t, handleGitHubOAuthLogin(c))
+	assert.Equal(t, http.StatusFound, rec.Code)
+	cookies := rec.Result().Cookies()
+	assert.Equal(t, 1, len(cookies))
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	assert.NoError(t, err)
+	attempt, err := oauth.DecodeLoginAttempt(cookies[0].Value, location.Query().Get("state"))
+	assert.NoError(t, err)
+	assert.Equal(t, vcs.ProviderGitLab, attempt.Provider)
+}
+
+func TestHandleProcessGitHubOAuthGitLab(t *testing.T) {
+	setupOAuthLoginMock(t, &oauthLoginMock{})
+	setupGitLabOAuthMock(t, &oauthLoginMock{expectedCode: "myCode", user: &github.User{Login: github.String("gitlab:alice")}})
+	attempt, err := oauth.NewLoginAttempt("", "")
+	assert.NoError(t, err)
+	attempt.Provider = vcs.ProviderGitLab
+	value, err := attempt.Encode()
+	assert.NoError(t, err)
+	c, rec := setupMockContextOAuth(t, map[string]string{"code": "myCode", "state": attempt.State}, &http.Cookie{Name: oauthLoginCookie, Value: value})
+
+	assert.NoError(t, handleProcessGitHubOAuth(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	var response oauthUserResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "gitlab:alice", response.GetLogin())
+}
+
+func TestConfigureGitLab(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	origBaseURL, origToken, origSignURL := gitlab.BaseURL, gitlab.Token(), gitlab.SignURL
+	origCreateGitLabOAuth := createGitLabOAuth
+	t.Cleanup(func() {
+		gitlab.BaseURL, gitlab.SignURL = origBaseURL, origSignURL
+		gitlab.SetToken(origToken)
+		createGitLabOAuth = origCreateGitLabOAuth
+	})
+
+	configureGitLab(config.GitLab{URL: "https://gitlab.example.com"})
+	assert.False(t, gitlab.Enabled())
+	assert.Nil(t, oauthFor(vcs.ProviderGitLab))
+
+	configureGitLab(config.GitLab{
+		URL:           "https://gitlab.example.com",
+		Token:         "myGitLabToken",
+		WebhookSecret: "myGitLabSecret",
+		SignURL:       "https://cla.example.com",
+		ClientId:      "myGitLabClientId",
+		ClientSecret:  "myGitLabClientSecret",
+	})
+	assert.True(t, gitlab.Enabled())
+	assert.Equal(t, "https://gitlab.example.com", gitlab.BaseURL)
+	assert.Equal(t, "https://cla.example.com", gitlab.SignURL)
+
+	attempt, err := oauth.NewLoginAttempt("", "")
+	assert.NoError(t, err)
+	authURL, err := url.Parse(oauthFor(vcs.ProviderGitLab).AuthCodeURL(attempt))
+	assert.NoError(t, err)
+	assert.Equal(t, "gitlab.example.com", authURL.Host)
+	assert.Equal(t, "myGitLabClientId", authURL.Query().Get("client_id"))
+}
+
+func setupMockContextGitLabWebhook(t *testing.T, token, body string) (c echo.Context, rec *httptest.ResponseRecorder) {
+	logger = zaptest.NewLogger(t)
+	setupTestConfig(t).GitLab.WebhookSecret = "myGitLabSecret"
+
+	req := httptest.NewRequest(http.MethodPost, pathWebhookGitLab, strings.NewReader(body))
+	req.Header.Set("X-Gitlab-Token", token)
+	req.Header.Set("X-Gitlab-Event", gitlab.EventMergeRequest)
+	rec = httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func TestHandleProcessGitLabWebhookInvalidToken(t *testing.T) {
+	c, rec := setupMockContextGitLabWebhook(t, "wrong", `{}`)
+
+	assert.NoError(t, handleProcessGitLabWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, gitlab.ErrInvalidToken.Error(), rec.Body.String())
+}
+
+func TestHandleProcessGitLabWebhookIgnoredAction(t *testing.T) {
+	c, rec := setupMockContextGitLabWebhook(t, "myGitLabSecret", `{"object_attributes": {"iid": 3, "action": "close"}}`)
+
+	assert.NoError(t, handleProcessGitLabWebhook(c))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "No action taken for: close", rec.Body.String())
+}
+
+func TestHandleProcessGitLabWebhookNotConfigured(t *testing.T) {
+	origToken := gitlab.Token()
+	gitlab.SetToken("")
+	t.Cleanup(func() {
+		gitlab.SetToken(origToken)
+	})
+	c, rec := setupMockContextGitLabWebhook(t, "myGitLabSecret", `{"object_attributes": {"iid": 3, "action": "open"}}`)
+
+	assert.NoError(t, handleProcessGitLabWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "gitlab is not configured", rec.Body.String())
+}
+
+func TestConfigureGitea(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	origBaseURL, origToken, origSignURL := gitea.BaseURL, gitea.Token(), gitea.SignURL
+	origCreateGiteaOAuth := createGiteaOAuth
+	t.Cleanup(func() {
+		gitea.BaseURL, gitea.SignURL = origBaseURL, origSignURL
+		gitea.SetToken(origToken)
+		createGiteaOAuth = origCreateGiteaOAuth
+	})
+
+	configureGitea(config.Gitea{URL: "https://gitea.example.com"})
+	assert.False(t, gitea.Enabled())
+	assert.Nil(t, oauthFor(vcs.ProviderGitea))
+
+	configureGitea(config.Gitea{
+		URL:           "https://gitea.example.com",
+		Token:         "myGiteaToken",
+		WebhookSecret: "myGiteaSecret",
+		SignURL:       "https://cla.example.com",
+		ClientId:      "myGiteaClientId",
+		ClientSecret:  "myGiteaClientSecret",
+	})
+	assert.True(t, gitea.Enabled())
+	assert.Equal(t, "https://gitea.example.com", gitea.BaseURL)
+	assert.Equal(t, "https://cla.example.com", gitea.SignURL)
+
+	attempt, err := oauth.NewLoginAttempt("", "")
+	assert.NoError(t, err)
+	authURL, err := url.Parse(oauthFor(vcs.ProviderGitea).AuthCodeURL(attempt))
+	assert.NoError(t, err)
+	assert.Equal(t, "gitea.example.com", authURL.Host)
+	assert.Equal(t, "/login/oauth/authorize", authURL.Path)
+	assert.Equal(t, "myGiteaClientId", authURL.Query().Get("client_id"))
+}
+
+func setupMockContextGiteaWebhook(t *testing.T, secret, body string) (c echo.Context, rec *httptest.ResponseRecorder) {
+	logger = zaptest.NewLogger(t)
+	setupTestConfig(t).Gitea.WebhookSecret = "myGiteaSecret"
+
+	req := httptest.NewRequest(http.MethodPost, pathWebhookGitea, strings.NewReader(body))
+	req.Header.Set("X-Gitea-Signature", gitea.SignFakePayload(secret, []byte(body)))
+	req.Header.Set("X-Gitea-Event", gitea.EventPullRequest)
+	rec = httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func TestHandleProcessGiteaWebhookInvalidSignature(t *testing.T) {
+	c, rec := setupMockContextGiteaWebhook(t, "wrong", `{}`)
+
+	assert.NoError(t, handleProcessGiteaWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, gitea.ErrInvalidSignature.Error(), rec.Body.String())
+}
+
+func TestHandleProcessGiteaWebhookIgnoredAction(t *testing.T) {
+	c, rec := setupMockContextGiteaWebhook(t, "myGiteaSecret", `{"action": "closed", "number": 3}`)
+
+	assert.NoError(t, handleProcessGiteaWebhook(c))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "No action taken for: closed", rec.Body.String())
+}
+
+func TestHandleProcessGiteaWebhookNotConfigured(t *testing.T) {
+	origToken := gitea.Token()
+	gitea.SetToken("")
+	t.Cleanup(func() {
+		gitea.SetToken(origToken)
+	})
+	c, rec := setupMockContextGiteaWebhook(t, "myGiteaSecret", `{"action": "opened", "number": 3}`)
+
+	assert.NoError(t, handleProcessGiteaWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "gitea is not configured", rec.Body.String())
+}
+
+// setupMockContextWebhook is a webhook of github.com, signed with testWebhookSecret unless the headers hold a
+// signature.
+func setupMockContextWebhook(t *testing.T, headers map[string]string, event any) (c echo.Context, rec *httptest.ResponseRecorder) {
+	if appConfig.Load() == nil {
+		setupTestConfig(t)
+	}
+	return setupMockContextSignedWebhook(t, testWebhookSecret, headers, event)
 }
 
-func setupMockContextWebhook(t *testing.T, headers map[string]string, prEvent github.PullRequestEvent) (c echo.Context, rec *httptest.ResponseRecorder) {
+// setupMockContextSignedWebhook is a webhook signed with secret, or unsigned when secret is empty.
+func setupMockContextSignedWebhook(t *testing.T, secret string, headers map[string]string, event any) (c echo.Context, rec *httptest.ResponseRecorder) {
 	logger = zaptest.NewLogger(t)
 
 	// Setup
 	e := echo.New()
 
-	reqBody, err := json.Marshal(prEvent)
+	reqBody, err := json.Marshal(event)
 	assert.NoError(t, err)
 
 	req := httptest.NewRequest(http.MethodPost, pathWebhook, strings.NewReader(string(reqBody)))
 
+	if secret != "" {
+		req.Header.Set(github.SHA256SignatureHeader, ourGithub.SignFakeWebhook(secret, reqBody))
+	}
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
@@ -243,14 +630,6 @@ func TestHandleProcessWebhookUnhandledGitHubEvent(t *testing.T) {
 	assert.Equal(t, msgUnhandledGitHubEventType, rec.Body.String())
 }
 
-// Deal with side effect if local machine has a .env file setup, so we clear the webhook secret for sanity's sake,
-// env variable value should be restored in defer() call.
-func clearEnvGHWebhookSecretMadness(t *testing.T) (origGHWebhookSecret string) {
-	origGHWebhookSecret = os.Getenv(envGhWebhookSecret)
-	resetEnvVariable(t, envGhWebhookSecret, "") // clear it
-	return origGHWebhookSecret
-}
-
 func TestHandleProcessWebhookGitHubEventPullRequestPayloadActionIgnored(t *testing.T) {
 	actionText := "someIgnoredAction"
 	c, rec := setupMockContextWebhook(t,
@@ -258,43 +637,67 @@ func TestHandleProcessWebhookGitHubEventPullRequestPayloadActionIgnored(t *testi
 			"X-GitHub-Event": string(webhook.PullRequestEvent),
 		}, github.PullRequestEvent{Action: &actionText})
 
-	origGHAppIDEnvVar := os.Getenv(ourGithub.EnvGhAppId)
-	defer func() {
-		resetEnvVariable(t, ourGithub.EnvGhAppId, origGHAppIDEnvVar)
-	}()
-	assert.NoError(t, os.Setenv(ourGithub.EnvGhAppId, "-1"))
-
-	origGHWebhookSecret := clearEnvGHWebhookSecretMadness(t)
-	defer func() {
-		resetEnvVariable(t, envGhWebhookSecret, origGHWebhookSecret)
-	}()
+	setupTestConfig(t).GitHub.AppId = -1
 
 	assert.NoError(t, handleProcessWebhook(c))
 	assert.Equal(t, http.StatusAccepted, c.Response().Status)
 	assert.Equal(t, "No action taken for: someIgnoredAction", rec.Body.String())
 }
 
-func TestHandleProcessWebhookGitHubEventPullRequestOpenedBadGH_APP_ID(t *testing.T) {
-	actionText := "opened"
+func TestHandleProcessWebhookGitHubEventPullRequestOtherLabelIgnored(t *testing.T) {
+	actionText := "labeled"
 	c, rec := setupMockContextWebhook(t,
 		map[string]string{
 			"X-GitHub-Event": string(webhook.PullRequestEvent),
-		}, github.PullRequestEvent{Action: &actionText})
+		}, github.PullRequestEvent{Action: &actionText, Label: &github.Label{Name: github.String("bug")}})
 
-	origGHAppIDEnvVar := os.Getenv(ourGithub.EnvGhAppId)
+	origOverrideLabel := ourGithub.OverrideLabel
 	defer func() {
-		resetEnvVariable(t, ourGithub.EnvGhAppId, origGHAppIDEnvVar)
+		ourGithub.OverrideLabel = origOverrideLabel
 	}()
-	assert.NoError(t, os.Setenv(ourGithub.EnvGhAppId, "nonNumericGHAppID"))
+	ourGithub.OverrideLabel = "cla: override"
+
+	setupTestConfig(t).GitHub.AppId = -1
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	assert.Equal(t, "No action taken for: labeled bug", rec.Body.String())
+}
+
+func TestHandleProcessWebhookGitHubEventPullRequestOverrideLabelRemovedError(t *testing.T) {
+	actionText := "unlabeled"
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event": string(webhook.PullRequestEvent),
+		}, github.PullRequestEvent{
+			Action: &actionText,
+			Label:  &github.Label{Name: github.String("cla: override")},
+			Sender: &github.User{Login: github.String("maintainer")},
+		})
 
-	origGHWebhookSecret := clearEnvGHWebhookSecretMadness(t)
+	origOverrideLabel := ourGithub.OverrideLabel
 	defer func() {
-		resetEnvVariable(t, envGhWebhookSecret, origGHWebhookSecret)
+		ourGithub.OverrideLabel = origOverrideLabel
 	}()
+	ourGithub.OverrideLabel = "cla: override"
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	forcedError := fmt.Errorf("forced insert audit event error")
+	mock.ExpectQuery("SELECT CreatedAt, Actor, Action").
+		WillReturnRows(sqlmock.NewRows([]string{"CreatedAt", "Actor", "Action", "RepoID", "RepoOwner", "RepoName", "PRNumber", "Detail", "Provider", "Sha"}).
+			AddRow(time.Now(), "maintainer", "override_applied", 0, "", "", 0, "cla: override", "github", ""))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WillReturnError(forcedError)
+
+	setupTestConfig(t).GitHub.AppId = -1
 
 	assert.NoError(t, handleProcessWebhook(c))
 	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
-	assert.Equal(t, `strconv.ParseInt: parsing "nonNumericGHAppID": invalid syntax`, rec.Body.String())
+	assert.Equal(t, forcedError.Error(), rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestHandleProcessWebhookGitHubEventPullRequestOpenedMissingPemFile(t *testing.T) {
@@ -304,35 +707,23 @@ func TestHandleProcessWebhookGitHubEventPullRequestOpenedMissingPemFile(t *testi
 			"X-GitHub-Event": string(webhook.PullRequestEvent),
 		}, github.PullRequestEvent{Action: &actionText})
 
-	origGHAppIDEnvVar := os.Getenv(ourGithub.EnvGhAppId)
-	defer func() {
-		resetEnvVariable(t, ourGithub.EnvGhAppId, origGHAppIDEnvVar)
-	}()
-	assert.NoError(t, os.Setenv(ourGithub.EnvGhAppId, "-1"))
-
-	// move pem file if it exists
-	pemBackupFile := ourGithub.FilenameTheClaPem + "_orig"
-	errRename := os.Rename(ourGithub.FilenameTheClaPem, pemBackupFile)
-	defer func() {
-		if errRename == nil {
-			assert.NoError(t, os.Rename(pemBackupFile, ourGithub.FilenameTheClaPem), "error renaming pem file in test")
-		}
-	}()
+	setupTestConfig(t).GitHub.AppId = -1
 
-	origGHWebhookSecret := clearEnvGHWebhookSecretMadness(t)
-	defer func() {
-		resetEnvVariable(t, envGhWebhookSecret, origGHWebhookSecret)
-	}()
+	resetPemFileImpl := ourGithub.SetupTestPemFile(t)
+	defer resetPemFileImpl()
+	missingPemFile := filepath.Join(t.TempDir(), ourGithub.FilenameTheClaPem)
+	ourGithub.Apps.SetKeyFile(missingPemFile)
 
 	assert.NoError(t, handleProcessWebhook(c))
 	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
-	assert.Equal(t, "could not read private key: open the-cla.pem: no such file or directory", rec.Body.String())
+	assert.Equal(t, "could not read private key: open "+missingPemFile+": no such file or directory", rec.Body.String())
 }
 
 func TestHandleProcessWebhookGitHubEventPullRequestPayloadActionHandled(t *testing.T) {
 	verifyActionHandled(t, "opened")
 	verifyActionHandled(t, "reopened")
 	verifyActionHandled(t, "synchronize")
+	verifyActionHandled(t, "ready_for_review")
 }
 
 func verifyActionHandled(t *testing.T, actionText string) {
@@ -345,14 +736,13 @@ func verifyActionHandled(t *testing.T, actionText string) {
 	defer closeDbFunc()
 	postgresDB = dbIF
 
-	mock.ExpectQuery(db.ConvertSqlToDbMockExpect(db.SqlSelectUnsignedUsersForPR)).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	// pending, then success status
+	mock.ExpectExec(db.ConvertSqlToDbMockExpect(db.SqlUpsertPRStatus)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(db.ConvertSqlToDbMockExpect(db.SqlUpsertPRStatus)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	origGHAppIDEnvVar := os.Getenv(ourGithub.EnvGhAppId)
-	defer func() {
-		resetEnvVariable(t, ourGithub.EnvGhAppId, origGHAppIDEnvVar)
-	}()
-	assert.NoError(t, os.Setenv(ourGithub.EnvGhAppId, "-1"))
+	setupTestConfig(t).GitHub.AppId = -1
 
 	resetPemFileImpl := ourGithub.SetupTestPemFile(t)
 	defer resetPemFileImpl()
@@ -375,67 +765,704 @@ func verifyActionHandled(t *testing.T, actionText string) {
 		},
 	}
 
-	origGHWebhookSecret := clearEnvGHWebhookSecretMadness(t)
-	defer func() {
-		resetEnvVariable(t, envGhWebhookSecret, origGHWebhookSecret)
-	}()
-
 	assert.NoError(t, handleProcessWebhook(c))
 	assert.Equal(t, http.StatusAccepted, c.Response().Status)
 	assert.Equal(t, "accepted pull request for processing", rec.Body.String())
 }
 
-func setupMockContextSignCla(t *testing.T, headers map[string]string, user types.UserSignature) (c echo.Context, rec *httptest.ResponseRecorder) {
-	logger = zaptest.NewLogger(t)
+// setupTestTenants serves the given tenants for the duration of a test.
+func setupTestTenants(t *testing.T, tenants ...types.Tenant) {
+	assert.NoError(t, ourGithub.Tenants.Set(tenants))
+	t.Cleanup(func() {
+		assert.NoError(t, ourGithub.Tenants.Set(nil))
+	})
+}
 
-	// Setup
-	e := echo.New()
+func testTenant() types.Tenant {
+	return types.Tenant{Name: "apache", AppId: 7, KeyFile: "apache.pem", WebhookSecret: "apacheSecret",
+		CLAVersion: "2", CLATextUrl: "https://example.com/apache-cla.txt", NotifyEmail: "legal@apache.example", Admins: []string{"alice"}}
+}
 
-	reqBody, err := json.Marshal(user)
-	assert.NoError(t, err)
+func TestHandleProcessWebhookUnknownTenant(t *testing.T) {
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event": string(webhook.RepositoryEvent),
+		}, github.RepositoryEvent{})
+	c.SetParamNames(pathParamTenant)
+	c.SetParamValues("unknown")
 
-	req := httptest.NewRequest(http.MethodPut, pathSignCla, strings.NewReader(string(reqBody)))
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, "unknown tenant: unknown", rec.Body.String())
+}
 
-	for k, v := range headers {
-		req.Header.Set(k, v)
-	}
+func TestHandleProcessWebhookTenantOfGitHubHost(t *testing.T) {
+	setupTestGitHubHosts(t, `[{"name":"github.example.com","appId":5,"keyFile":"key.pem","webhookSecret":"myHostSecret"}]`)
+	setupTestTenants(t, testTenant())
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event":           string(webhook.RepositoryEvent),
+			"X-GitHub-Enterprise-Host": "github.example.com",
+		}, github.RepositoryEvent{})
+	c.SetParamNames(pathParamTenant)
+	c.SetParamValues("apache")
 
-	rec = httptest.NewRecorder()
-	c = e.NewContext(req, rec)
-	return
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, msgTenantOfGitHubHost, rec.Body.String())
 }
 
-func TestHandleProcessSignClaBindError(t *testing.T) {
-	c, rec := setupMockContextSignCla(t, map[string]string{}, types.UserSignature{})
-	assert.EqualError(t, handleProcessSignCla(c), "code=415, message=Unsupported Media Type")
-	assert.Equal(t, 0, c.Response().Status)
-	assert.Equal(t, "", rec.Body.String())
+func TestHandleProcessWebhookTenantSecret(t *testing.T) {
+	setupTestTenants(t, testTenant())
+	actionText := "renamed"
+	c, rec := setupMockContextSignedWebhook(t, "",
+		map[string]string{
+			"X-GitHub-Event": string(webhook.RepositoryEvent),
+		}, github.RepositoryEvent{Action: &actionText})
+	c.SetParamNames(pathParamTenant)
+	c.SetParamValues("apache")
+
+	// unsigned, while the tenant has a secret
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, webhook.ErrMissingHubSignatureHeader.Error(), rec.Body.String())
 }
 
-func setupMockContextSignature(t *testing.T, queryParams map[string]string) (c echo.Context, rec *httptest.ResponseRecorder) {
-	logger = zaptest.NewLogger(t)
+func TestHandleProcessWebhookTenantSignedByOtherApp(t *testing.T) {
+	setupTestTenants(t, testTenant())
+	actionText := "opened"
+	// claims to be of the tenant's app, but is signed with the secret of our github.com app
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event":     string(webhook.PullRequestEvent),
+			headerHookTargetType: "integration",
+			headerHookTargetID:   "7",
+		}, github.PullRequestEvent{Action: &actionText})
 
-	// Setup
-	e := echo.New()
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, webhook.ErrHMACVerificationFailed.Error(), rec.Body.String())
+}
 
-	req := httptest.NewRequest(http.MethodGet, pathSignCla, nil)
+func TestHandleProcessWebhookTenantPullRequest(t *testing.T) {
+	tenant := testTenant()
+	tenant.KeyFile = filepath.Join(t.TempDir(), "apache.pem")
+	ourGithub.WriteTestKeyFile(t, tenant.KeyFile)
+	setupTestTenants(t, tenant)
 
-	q := req.URL.Query()
-	for k, v := range queryParams {
-		q.Add(k, v)
-	}
-	req.URL.RawQuery = q.Encode()
+	actionText := "opened"
+	c, rec := setupMockContextSignedWebhook(t, tenant.WebhookSecret,
+		map[string]string{
+			"X-GitHub-Event":     string(webhook.PullRequestEvent),
+			headerHookTargetType: "integration",
+			headerHookTargetID:   "7",
+		}, github.PullRequestEvent{Action: &actionText})
 
-	rec = httptest.NewRecorder()
-	c = e.NewContext(req, rec)
-	return
-}
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
 
-func TestHandleSignatureMissingLogin(t *testing.T) {
-	c, rec := setupMockContextSignature(t, map[string]string{})
+	// pending, then success status, of the tenant's app
+	anyArg := sqlmock.AnyArg()
+	mock.ExpectExec(db.ConvertSqlToDbMockExpect(db.SqlUpsertPRStatus)).
+		WithArgs(anyArg, anyArg, anyArg, anyArg, anyArg, int64(7), anyArg, anyArg, anyArg, anyArg).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(db.ConvertSqlToDbMockExpect(db.SqlUpsertPRStatus)).
+		WithArgs(anyArg, anyArg, anyArg, anyArg, anyArg, int64(7), anyArg, anyArg, anyArg, anyArg).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	assert.NoError(t, handleSignature(c))
-	assert.Equal(t, http.StatusUnprocessableEntity, c.Response().Status)
+	resetPemFileImpl := ourGithub.SetupTestPemFile(t)
+	defer resetPemFileImpl()
+	resetGHJWTImpl := ourGithub.SetupMockGHJWT()
+	defer resetGHJWTImpl()
+	origGithubImpl := ourGithub.GHImpl
+	defer func() {
+		ourGithub.GHImpl = origGithubImpl
+	}()
+	ourGithub.GHImpl = &ourGithub.GHInterfaceMock{
+		IssuesMock: ourGithub.IssuesMock{
+			MockGetLabelResponse:    &github.Response{Response: &http.Response{}},
+			MockRemoveLabelResponse: &github.Response{Response: &http.Response{}},
+		},
+	}
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	assert.Equal(t, "accepted pull request for processing", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleProcessWebhookGitHubEventRepositoryRenamed(t *testing.T) {
+	actionText := "renamed"
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event": string(webhook.RepositoryEvent),
+		}, github.RepositoryEvent{
+			Action: &actionText,
+			Repo: &github.Repository{
+				ID:    github.Int64(1234),
+				Name:  github.String("newName"),
+				Owner: &github.User{Login: github.String("newOwner")},
+			},
+		})
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	mock.ExpectExec("UPDATE unsigned_pr SET RepoOwner").
+		WithArgs(int64(1234), "newOwner", "newName", vcs.ProviderGitHub).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	setupTestConfig(t).GitHub.AppId = -1
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	assert.Equal(t, "accepted repository change", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleProcessWebhookUnknownGitHubHost(t *testing.T) {
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event":           string(webhook.RepositoryEvent),
+			"X-GitHub-Enterprise-Host": "github.example.com",
+		}, github.RepositoryEvent{})
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, "unknown github host: github.example.com", rec.Body.String())
+}
+
+func TestHandleProcessWebhookGitHubHostRepositoryRenamed(t *testing.T) {
+	setupTestGitHubHosts(t, `[{"name":"github.example.com","appId":5,"keyFile":"key.pem","webhookSecret":"myHostSecret"}]`)
+
+	actionText := "renamed"
+	c, rec := setupMockContextSignedWebhook(t, "myHostSecret",
+		map[string]string{
+			"X-GitHub-Event":           string(webhook.RepositoryEvent),
+			"X-GitHub-Enterprise-Host": "GitHub.example.com",
+		}, github.RepositoryEvent{
+			Action: &actionText,
+			Repo: &github.Repository{
+				ID:    github.Int64(1234),
+				Name:  github.String("newName"),
+				Owner: &github.User{Login: github.String("newOwner")},
+			},
+		})
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	mock.ExpectExec("UPDATE unsigned_pr SET RepoOwner").
+		WithArgs(int64(1234), "newOwner", "newName", "github.example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	assert.Equal(t, "accepted repository change", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleProcessWebhookGitHubEventMember(t *testing.T) {
+	actionText := "added"
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event": string(webhook.MemberEvent),
+		}, github.MemberEvent{
+			Action: &actionText,
+			Member: &github.User{Login: github.String("myLogin")},
+			Repo: &github.Repository{
+				ID:    github.Int64(1234),
+				Owner: &github.User{Login: github.String("myOwner")},
+			},
+		})
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	origShared := ourGithub.Collaborators.Shared
+	defer func() {
+		ourGithub.Collaborators.Shared = origShared
+	}()
+	ourGithub.Collaborators.Shared = true
+
+	mock.ExpectExec("DELETE FROM collaborator_cache WHERE RepoID").
+		WithArgs(int64(1234), "myLogin").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	setupTestConfig(t).GitHub.AppId = -1
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	assert.Equal(t, "accepted collaborator change", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleProcessWebhookGitHubEventMembershipError(t *testing.T) {
+	actionText := "removed"
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event": string(webhook.MembershipEvent),
+		}, github.MembershipEvent{
+			Action: &actionText,
+			Scope:  github.String("team"),
+			Member: &github.User{Login: github.String("myLogin")},
+			Team:   &github.Team{Name: github.String("myTeam")},
+			Org:    &github.Organization{Login: github.String("myOrg")},
+		})
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	origShared := ourGithub.Collaborators.Shared
+	defer func() {
+		ourGithub.Collaborators.Shared = origShared
+	}()
+	ourGithub.Collaborators.Shared = true
+
+	forcedError := fmt.Errorf("forced invalidate collaborators error")
+	mock.ExpectExec("DELETE FROM collaborator_cache WHERE RepoOwner").
+		WithArgs("myOrg", "myLogin").
+		WillReturnError(forcedError)
+
+	setupTestConfig(t).GitHub.AppId = -1
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, forcedError.Error(), rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleProcessWebhookGitHubEventOrganization(t *testing.T) {
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event": string(webhook.OrganizationEvent),
+		}, github.OrganizationEvent{
+			Action:       github.String("member_added"),
+			Membership:   &github.Membership{User: &github.User{Login: github.String("myLogin")}},
+			Organization: &github.Organization{Login: github.String("myOrg")},
+		})
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	origShared := ourGithub.Collaborators.Shared
+	defer func() {
+		ourGithub.Collaborators.Shared = origShared
+	}()
+	ourGithub.Collaborators.Shared = true
+
+	mock.ExpectExec("DELETE FROM collaborator_cache WHERE RepoOwner").
+		WithArgs("myOrg", "myLogin").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	setupTestConfig(t).GitHub.AppId = -1
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	assert.Equal(t, "accepted organization membership change", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleProcessWebhookGitHubEventOrganizationIgnored(t *testing.T) {
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event": string(webhook.OrganizationEvent),
+		}, github.OrganizationEvent{
+			Action:       github.String("renamed"),
+			Organization: &github.Organization{Login: github.String("myOrg")},
+		})
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	assert.Equal(t, "No action taken for: renamed", rec.Body.String())
+}
+
+func setupMockContextMergeGroupWebhook(t *testing.T, action string) (c echo.Context, rec *httptest.ResponseRecorder) {
+	return setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event": ourGithub.EventMergeGroup,
+			"Content-Type":   "application/json",
+		}, github.MergeGroupEvent{
+			Action:     &action,
+			MergeGroup: &github.MergeGroup{HeadSHA: github.String("myHeadSha")},
+			Repo:       &github.Repository{ID: github.Int64(1)},
+		})
+}
+
+func TestHandleProcessWebhookMergeGroupActionIgnored(t *testing.T) {
+	c, rec := setupMockContextMergeGroupWebhook(t, "destroyed")
+
+	setupTestConfig(t).GitHub.AppId = -1
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	assert.Equal(t, "No action taken for: destroyed", rec.Body.String())
+}
+
+func TestHandleProcessWebhookMergeGroupBadContentType(t *testing.T) {
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event": ourGithub.EventMergeGroup,
+		}, github.MergeGroupEvent{})
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, "mime: no media type", rec.Body.String())
+}
+
+func TestHandleProcessWebhookMergeGroupMissingPemFile(t *testing.T) {
+	c, rec := setupMockContextMergeGroupWebhook(t, "checks_requested")
+
+	setupTestConfig(t).GitHub.AppId = -1
+
+	resetPemFileImpl := ourGithub.SetupTestPemFile(t)
+	defer resetPemFileImpl()
+	missingPemFile := filepath.Join(t.TempDir(), ourGithub.FilenameTheClaPem)
+	ourGithub.Apps.SetKeyFile(missingPemFile)
+
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, "could not read private key: open "+missingPemFile+": no such file or directory", rec.Body.String())
+}
+
+func TestConfigureCollaboratorCache(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	origTTL, origShared := ourGithub.Collaborators.TTL, ourGithub.Collaborators.Shared
+	defer func() {
+		ourGithub.Collaborators.TTL, ourGithub.Collaborators.Shared = origTTL, origShared
+	}()
+
+	configureCollaboratorCache(config.Default().Evaluation)
+	assert.Equal(t, ourGithub.DefaultCollaboratorCacheTTL, ourGithub.Collaborators.TTL)
+	assert.False(t, ourGithub.Collaborators.Shared)
+
+	configureCollaboratorCache(config.Evaluation{CollaboratorCacheShared: true})
+	assert.Equal(t, time.Duration(0), ourGithub.Collaborators.TTL)
+	assert.True(t, ourGithub.Collaborators.Shared)
+}
+
+func TestConfigureExemptions(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	origExemptions := ourGithub.Exemptions
+	defer func() {
+		ourGithub.Exemptions = origExemptions
+	}()
+
+	configureExemptions(config.Default().Evaluation)
+	assert.Equal(t, ourGithub.ExemptionPolicy{Collaborators: true}, ourGithub.Exemptions)
+
+	configureExemptions(config.Evaluation{
+		ExemptOrgMembers:           true,
+		ExemptOutsideCollaborators: true,
+		ExemptTeams:                []string{"core", "security"},
+		ExemptBotLogins:            []string{"release-bot"},
+		ExemptBotEmails:            []string{"*[bot]@users.noreply.github.com", "bot@example.com"},
+	})
+	assert.Equal(t, ourGithub.ExemptionPolicy{
+		OrgMembers:           true,
+		Teams:                []string{"core", "security"},
+		OutsideCollaborators: true,
+		BotLogins:            []string{"release-bot"},
+		BotEmails:            []string{"*[bot]@users.noreply.github.com", "bot@example.com"},
+	}, ourGithub.Exemptions)
+}
+
+func TestConfigureTrivialChanges(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	origTrivialChanges := ourGithub.TrivialChanges
+	defer func() {
+		ourGithub.TrivialChanges = origTrivialChanges
+	}()
+
+	configureTrivialChanges(config.Evaluation{
+		TrivialChangeRepos:    []string{"myOrg/*"},
+		TrivialChangeMaxLines: 5,
+		TrivialChangePaths:    []string{"docs/**", "*.md"},
+	})
+	assert.Equal(t, ourGithub.TrivialChangePolicy{
+		Repos:    []string{"myOrg/*"},
+		MaxLines: 5,
+		Paths:    []string{"docs/**", "*.md"},
+	}, ourGithub.TrivialChanges)
+}
+
+func TestConfigureEnforcement(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	origEnforcement := ourGithub.Enforcement
+	defer func() {
+		ourGithub.Enforcement = origEnforcement
+	}()
+
+	configureEnforcement(config.Evaluation{
+		EnforcedBaseBranches: []string{"main", "release/*", "myOrg/legacy:master"},
+		ExcludedRepos:        []string{"myOrg/sandbox"},
+		ExcludeArchivedRepos: config.ScopedFlag{"true", "myOrg:false"},
+	})
+	assert.Equal(t, ourGithub.EnforcementPolicy{
+		BaseBranches:    []string{"main", "release/*", "myOrg/legacy:master"},
+		ExcludeRepos:    []string{"myOrg/sandbox"},
+		ExcludeArchived: []string{"true", "myOrg:false"},
+	}, ourGithub.Enforcement)
+}
+
+func TestConfigureMessages(t *testing.T) {
+	origMessages := ourGithub.Messages
+	origRepoMessagesPath := ourGithub.RepoMessagesPath
+	defer func() {
+		ourGithub.Messages = origMessages
+		ourGithub.RepoMessagesPath = origRepoMessagesPath
+	}()
+
+	path := filepath.Join(t.TempDir(), "messages.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"statusPending": "Checking the CLA"}`), 0600))
+	cfg := config.CLA{MessagesFile: path, RepoMessagesPath: ".github/the-cla.json"}
+	assert.NoError(t, configureMessages(cfg))
+	assert.Equal(t, "Checking the CLA", ourGithub.Messages.StatusPending)
+	assert.Equal(t, ".github/the-cla.json", ourGithub.RepoMessagesPath)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"statusPending": "{{.Nope}}"}`), 0600))
+	assert.ErrorContains(t, configureMessages(cfg), "invalid statusPending template")
+}
+
+// setupTestGitHubHosts configures the GitHub Enterprise Server instances of a hosts file for the duration of a test.
+func setupTestGitHubHosts(t *testing.T, hostsJson string) {
+	logger = zaptest.NewLogger(t)
+	origHosts := ourGithub.Hosts
+	t.Cleanup(func() {
+		ourGithub.Hosts = origHosts
+	})
+
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	assert.NoError(t, os.WriteFile(path, []byte(hostsJson), 0600))
+	assert.NoError(t, configureGitHubHosts(config.GitHub{HostsFile: path}))
+}
+
+func TestConfigureGitHubHosts(t *testing.T) {
+	setupTestGitHubHosts(t, `[
+		{"name":"github.example.com","appId":5,"keyFile":"key.pem","webhookSecret":"myHostSecret","clientId":"myHostClientId","clientSecret":"myHostClientSecret"},
+		{"name":"ghe.example.org","appId":6,"keyFile":"other.pem","webhookSecret":"myHostSecret","apiURL":"https://api.ghe.example.org"}
+	]`)
+	assert.Equal(t, 2, len(ourGithub.Hosts))
+	assert.Equal(t, "https://github.example.com/api/v3/", ourGithub.HostOf("github.example.com").APIURL)
+	assert.Equal(t, "https://api.ghe.example.org/", ourGithub.HostOf("ghe.example.org").APIURL)
+
+	attempt, err := oauth.NewLoginAttempt("", "")
+	assert.NoError(t, err)
+	authURL, err := url.Parse(oauthFor("github.example.com").AuthCodeURL(attempt))
+	assert.NoError(t, err)
+	assert.Equal(t, "github.example.com", authURL.Host)
+	assert.Equal(t, "/login/oauth/authorize", authURL.Path)
+	assert.Equal(t, "myHostClientId", authURL.Query().Get("client_id"))
+	// signers can't log in with a host lacking a client
+	assert.Nil(t, oauthFor("ghe.example.org"))
+	assert.Nil(t, oauthFor("unknown.example.com"))
+
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`[{"name":"github.example.com"}]`), 0600))
+	assert.EqualError(t, configureGitHubHosts(config.GitHub{HostsFile: path}), "github host github.example.com needs an appId and keyFile")
+}
+
+func setupMockContextSignCla(t *testing.T, headers map[string]string, body any) (c echo.Context, rec *httptest.ResponseRecorder) {
+	logger = zaptest.NewLogger(t)
+
+	// Setup
+	e := echo.New()
+
+	reqBody, err := json.Marshal(body)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPut, pathSignCla, strings.NewReader(string(reqBody)))
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	return
+}
+
+func TestHandleProcessSignClaBindError(t *testing.T) {
+	c, rec := setupMockContextSignCla(t, map[string]string{}, types.UserSignature{})
+	assert.EqualError(t, handleProcessSignCla(c), "code=415, message=Unsupported Media Type")
+	assert.Equal(t, 0, c.Response().Status)
+	assert.Equal(t, "", rec.Body.String())
+}
+
+func setupSignLinks(t *testing.T) {
+	origSignLinks := ourGithub.SignLinks
+	ourGithub.SignLinks = ourGithub.NewSignLinkSigner([]byte("linkSecret"), time.Hour)
+	t.Cleanup(func() {
+		ourGithub.SignLinks = origSignLinks
+	})
+}
+
+func testSignLinkToken(t *testing.T) string {
+	token, err := ourGithub.SignLinks.Sign(ourGithub.SignLink{RepoOwner: "myOwner", RepoName: "myRepo", PRNumber: 5, CLAVersion: "2", Login: "alice"})
+	assert.NoError(t, err)
+	return token
+}
+
+func TestHandleProcessSignClaSignLinkInvalid(t *testing.T) {
+	setupSignLinks(t)
+	c, rec := setupMockContextSignCla(t, map[string]string{echo.HeaderContentType: echo.MIMEApplicationJSON},
+		signClaRequest{UserSignature: types.UserSignature{User: types.User{Login: "alice"}, CLAVersion: "2"}, SignLink: "bogus.link"})
+
+	assert.NoError(t, handleProcessSignCla(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, ourGithub.ErrSignLinkInvalid.Error(), rec.Body.String())
+}
+
+func TestHandleProcessSignClaSignLinkWrongLogin(t *testing.T) {
+	setupSignLinks(t)
+	c, rec := setupMockContextSignCla(t, map[string]string{echo.HeaderContentType: echo.MIMEApplicationJSON},
+		signClaRequest{UserSignature: types.UserSignature{User: types.User{Login: "mallory"}, CLAVersion: "2"}, SignLink: testSignLinkToken(t)})
+
+	assert.NoError(t, handleProcessSignCla(c))
+	assert.Equal(t, http.StatusForbidden, c.Response().Status)
+	assert.Equal(t, "this signing link is for @alice, not @mallory", rec.Body.String())
+}
+
+func TestHandleProcessSignClaSignLinkWrongCLAVersion(t *testing.T) {
+	setupSignLinks(t)
+	c, rec := setupMockContextSignCla(t, map[string]string{echo.HeaderContentType: echo.MIMEApplicationJSON},
+		signClaRequest{UserSignature: types.UserSignature{User: types.User{Login: "Alice"}, CLAVersion: "1"}, SignLink: testSignLinkToken(t)})
+
+	assert.NoError(t, handleProcessSignCla(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, "this signing link is for CLA version 2, not 1", rec.Body.String())
+}
+
+func TestHandleProcessSignClaSignLinkRedirect(t *testing.T) {
+	setupSignLinks(t)
+	c, rec := setupMockContextSignCla(t, map[string]string{echo.HeaderContentType: echo.MIMEApplicationJSON},
+		signClaRequest{UserSignature: types.UserSignature{User: types.User{Login: "alice"}, CLAVersion: "2"}, SignLink: testSignLinkToken(t)})
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+	mock.ExpectExec("INSERT INTO signatures").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	forcedError := fmt.Errorf("forced SQL query error")
+	mock.ExpectQuery("SELECT").
+		WillReturnError(forcedError)
+
+	assert.NoError(t, handleProcessSignCla(c))
+	assert.Equal(t, http.StatusCreated, c.Response().Status)
+	var response signClaResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "https://github.com/myOwner/myRepo/pull/5", response.RedirectURL)
+	assert.Equal(t, "alice", response.User.Login)
+}
+
+func TestHandleProcessGitHubOAuthSignLinkInvalid(t *testing.T) {
+	setupSignLinks(t)
+	setupOAuthLoginMock(t, &oauthLoginMock{})
+	attempt, cookie := setupOAuthLogin(t, "bogus.link")
+	c, rec := setupMockContextOAuth(t, map[string]string{"code": "myCode", "state": attempt.State}, cookie)
+
+	assert.NoError(t, handleProcessGitHubOAuth(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, ourGithub.ErrSignLinkInvalid.Error(), rec.Body.String())
+}
+
+func TestHandleProcessGitHubOAuthSignLinkWrongLogin(t *testing.T) {
+	setupSignLinks(t)
+	setupOAuthLoginMock(t, &oauthLoginMock{expectedCode: "myCode", user: &github.User{Login: github.String("mallory")}})
+	attempt, cookie := setupOAuthLogin(t, testSignLinkToken(t))
+	c, rec := setupMockContextOAuth(t, map[string]string{"code": "myCode", "state": attempt.State}, cookie)
+
+	assert.NoError(t, handleProcessGitHubOAuth(c))
+	assert.Equal(t, http.StatusForbidden, c.Response().Status)
+	assert.Equal(t, "this signing link is for @alice, not @mallory", rec.Body.String())
+}
+
+func TestHandleProcessGitHubOAuthSignLink(t *testing.T) {
+	setupSignLinks(t)
+	setupOAuthLoginMock(t, &oauthLoginMock{expectedCode: "myCode", user: &github.User{Login: github.String("Alice")}})
+	attempt, cookie := setupOAuthLogin(t, testSignLinkToken(t))
+	c, rec := setupMockContextOAuth(t, map[string]string{"code": "myCode", "state": attempt.State}, cookie)
+
+	assert.NoError(t, handleProcessGitHubOAuth(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	var response oauthUserResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, int64(5), response.SignLink.PRNumber)
+	assert.Equal(t, attempt.ReturnTo, response.ReturnTo)
+}
+
+func TestConfigureOAuth(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	origCreateOAuth := createOAuth
+	t.Cleanup(func() {
+		createOAuth = origCreateOAuth
+	})
+	attempt, err := oauth.NewLoginAttempt("", "")
+	assert.NoError(t, err)
+
+	testConfig := setupTestConfig(t)
+	testConfig.GitHub.OAuthClientId = "myOAuthClientId"
+	configureOAuth(testConfig.GitHub)
+	authURL, err := url.Parse(createOAuth().AuthCodeURL(attempt))
+	assert.NoError(t, err)
+	assert.Equal(t, "myOAuthClientId", authURL.Query().Get("client_id"))
+	assert.Equal(t, "user:email", authURL.Query().Get("scope"))
+
+	testConfig.GitHub.AppClientId = "myAppClientId"
+	testConfig.GitHub.AppClientSecret = "myAppClientSecret"
+	configureOAuth(testConfig.GitHub)
+	authURL, err = url.Parse(createOAuth().AuthCodeURL(attempt))
+	assert.NoError(t, err)
+	assert.Equal(t, "myAppClientId", authURL.Query().Get("client_id"))
+	assert.False(t, authURL.Query().Has("scope"))
+}
+
+func TestConfigureSignLinks(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	origSignLinks := ourGithub.SignLinks
+	t.Cleanup(func() {
+		ourGithub.SignLinks = origSignLinks
+	})
+
+	configureSignLinks(config.Default().CLA)
+	assert.False(t, ourGithub.SignLinks.Enabled())
+	assert.Equal(t, ourGithub.DefaultSignLinkTTL, ourGithub.SignLinks.TTL)
+
+	configureSignLinks(config.CLA{SignLinkSecret: "linkSecret", SignLinkTTL: 48 * time.Hour})
+	assert.True(t, ourGithub.SignLinks.Enabled())
+	assert.Equal(t, 48*time.Hour, ourGithub.SignLinks.TTL)
+}
+
+func setupMockContextSignature(t *testing.T, queryParams map[string]string) (c echo.Context, rec *httptest.ResponseRecorder) {
+	logger = zaptest.NewLogger(t)
+
+	// Setup
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, pathSignCla, nil)
+
+	q := req.URL.Query()
+	for k, v := range queryParams {
+		q.Add(k, v)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	return
+}
+
+func TestHandleSignatureMissingLogin(t *testing.T) {
+	c, rec := setupMockContextSignature(t, map[string]string{})
+
+	assert.NoError(t, handleSignature(c))
+	assert.Equal(t, http.StatusUnprocessableEntity, c.Response().Status)
 	assert.Equal(t, fmt.Sprintf(msgTemplateMissingQueryParam, queryParameterLogin), rec.Body.String())
 }
 
@@ -521,25 +1548,9 @@ func TestHandleSignatureHasAuthorSignedAndHidesFields(t *testing.T) {
 	assert.Equal(t, string(expectedJsonSignature)+"\n", rec.Body.String())
 }
 
-func saveEnvInfoCredentials(t *testing.T) (resetInfoCreds func()) {
-	origInfoUsername := os.Getenv(envInfoUsername)
-	origInfoPassword := os.Getenv(envInfoPassword)
-	resetInfoCreds = func() {
-		resetEnvVariable(t, envInfoUsername, origInfoUsername)
-		resetEnvVariable(t, envInfoUsername, origInfoPassword)
-	}
-
-	// setup testing logger while we're here
+func TestInfoBasicValidatorMissingConfig(t *testing.T) {
 	logger = zaptest.NewLogger(t)
-
-	return
-}
-
-func TestInfoBasicValidatorMissingEnv(t *testing.T) {
-	resetInfoCreds := saveEnvInfoCredentials(t)
-	defer resetInfoCreds()
-	assert.NoError(t, os.Unsetenv(envInfoUsername))
-	assert.NoError(t, os.Unsetenv(envInfoPassword))
+	setupTestConfig(t)
 
 	isValid, err := infoBasicValidator("yadda", "bing", nil)
 	assert.NoError(t, err)
@@ -547,10 +1558,10 @@ func TestInfoBasicValidatorMissingEnv(t *testing.T) {
 }
 
 func TestInfoBasicValidatorInValid(t *testing.T) {
-	resetInfoCreds := saveEnvInfoCredentials(t)
-	defer resetInfoCreds()
-	assert.NoError(t, os.Setenv(envInfoUsername, "yadda"))
-	assert.NoError(t, os.Setenv(envInfoPassword, "Doh!"))
+	logger = zaptest.NewLogger(t)
+	testConfig := setupTestConfig(t)
+	testConfig.Server.InfoUsername = "yadda"
+	testConfig.Server.InfoPassword = "Doh!"
 
 	isValid, err := infoBasicValidator("yadda", "bing", nil)
 	assert.NoError(t, err)
@@ -558,10 +1569,10 @@ func TestInfoBasicValidatorInValid(t *testing.T) {
 }
 
 func TestInfoBasicValidatorValid(t *testing.T) {
-	resetInfoCreds := saveEnvInfoCredentials(t)
-	defer resetInfoCreds()
-	assert.NoError(t, os.Setenv(envInfoUsername, "yadda"))
-	assert.NoError(t, os.Setenv(envInfoPassword, "bing"))
+	logger = zaptest.NewLogger(t)
+	testConfig := setupTestConfig(t)
+	testConfig.Server.InfoUsername = "yadda"
+	testConfig.Server.InfoPassword = "bing"
 
 	isValid, err := infoBasicValidator("yadda", "bing", nil)
 	assert.NoError(t, err)
@@ -584,3 +1595,519 @@ func TestNotifySignatureCompleteFails(t *testing.T) {
 
 	assert.EqualError(t, err, "SMTP Host, SMTP Port or Notification Address are empty - cannot send notification")
 }
+
+func setupMockContextPRStatus(t *testing.T, provider, repoId, prNumber string) (c echo.Context, rec *httptest.ResponseRecorder) {
+	logger = zaptest.NewLogger(t)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, ourGithub.PathPRStatusDiagnostics, nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames(pathParamProvider, pathParamRepoId, pathParamPRNumber)
+	c.SetParamValues(provider, repoId, prNumber)
+	return
+}
+
+func TestHandlePRStatusInvalidRepoId(t *testing.T) {
+	c, rec := setupMockContextPRStatus(t, vcs.ProviderGitHub, "notANumber", "1")
+
+	assert.NoError(t, handlePRStatus(c))
+	assert.Equal(t, http.StatusUnprocessableEntity, c.Response().Status)
+	assert.Equal(t, fmt.Sprintf(msgTemplateInvalidPathParam, pathParamRepoId), rec.Body.String())
+}
+
+func TestHandlePRStatusInvalidPRNumber(t *testing.T) {
+	c, rec := setupMockContextPRStatus(t, vcs.ProviderGitHub, "1", "notANumber")
+
+	assert.NoError(t, handlePRStatus(c))
+	assert.Equal(t, http.StatusUnprocessableEntity, c.Response().Status)
+	assert.Equal(t, fmt.Sprintf(msgTemplateInvalidPathParam, pathParamPRNumber), rec.Body.String())
+}
+
+func TestHandlePRStatusInvalidProvider(t *testing.T) {
+	c, rec := setupMockContextPRStatus(t, "%zz", "12", "34")
+
+	assert.NoError(t, handlePRStatus(c))
+	assert.Equal(t, http.StatusUnprocessableEntity, c.Response().Status)
+	assert.Equal(t, fmt.Sprintf(msgTemplateInvalidPathParam, pathParamProvider), rec.Body.String())
+}
+
+func TestHandlePRStatusEnterprise(t *testing.T) {
+	c, rec := setupMockContextPRStatus(t, "ghe.example.com%3A8443", "12", "34")
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	mock.ExpectQuery(db.ConvertSqlToDbMockExpect(db.SqlSelectPRStatus)).
+		WithArgs(12, 34, "ghe.example.com:8443").
+		WillReturnError(sql.ErrNoRows)
+
+	assert.NoError(t, handlePRStatus(c))
+	assert.Equal(t, http.StatusNotFound, c.Response().Status)
+	assert.Equal(t, "no status found for PR 34 in repository 12", rec.Body.String())
+}
+
+func TestHandlePRStatusDBError(t *testing.T) {
+	c, rec := setupMockContextPRStatus(t, vcs.ProviderGitHub, "12", "34")
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	forcedError := fmt.Errorf("forced SQL query error")
+	mock.ExpectQuery(db.ConvertSqlToDbMockExpect(db.SqlSelectPRStatus)).
+		WillReturnError(forcedError)
+
+	assert.NoError(t, handlePRStatus(c))
+	assert.Equal(t, http.StatusInternalServerError, c.Response().Status)
+	assert.Equal(t, msgPRStatusError, rec.Body.String())
+}
+
+func TestHandlePRStatusNotFound(t *testing.T) {
+	c, rec := setupMockContextPRStatus(t, vcs.ProviderGitHub, "12", "34")
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	mock.ExpectQuery(db.ConvertSqlToDbMockExpect(db.SqlSelectPRStatus)).
+		WithArgs(12, 34, vcs.ProviderGitHub).
+		WillReturnError(sql.ErrNoRows)
+
+	assert.NoError(t, handlePRStatus(c))
+	assert.Equal(t, http.StatusNotFound, c.Response().Status)
+	assert.Equal(t, "no status found for PR 34 in repository 12", rec.Body.String())
+}
+
+func TestHandlePRStatus(t *testing.T) {
+	c, rec := setupMockContextPRStatus(t, vcs.ProviderGitHub, "12", "34")
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	now := time.Now()
+	mock.ExpectQuery(db.ConvertSqlToDbMockExpect(db.SqlSelectPRStatus)).
+		WithArgs(12, 34, vcs.ProviderGitHub).
+		WillReturnRows(sqlmock.NewRows([]string{"RepoID", "RepoOwner", "RepoName", "PRNumber", "sha", "State", "UpdatedAt", "LastError", "Attempts", "NextAttemptAt"}).
+			AddRow(12, "myOwner", "myRepo", 34, "mySha", "error", now, "myError", 1, nil))
+
+	assert.NoError(t, handlePRStatus(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+
+	expectedJson, err := json.Marshal(prStatusResponse{
+		State:     "error",
+		UpdatedAt: now,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, string(expectedJson)+"\n", rec.Body.String())
+	// the error and the repository are not shown to anyone following the link
+	assert.NotContains(t, rec.Body.String(), "myError")
+	assert.NotContains(t, rec.Body.String(), "myOwner")
+}
+
+func TestHandleRateLimits(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, pathInfo+pathRateLimits, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	assert.NoError(t, handleRateLimits(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+
+	expectedJson, err := json.Marshal(ourGithub.AllRateLimits())
+	assert.NoError(t, err)
+	assert.Equal(t, string(expectedJson)+"\n", rec.Body.String())
+}
+
+func TestHandleConfig(t *testing.T) {
+	testConfig := setupTestConfig(t)
+	testConfig.Database.Host = "localhost"
+	testConfig.Database.Password = "myPGPassword"
+	c, rec := setupMockContextTenant(t, pathInfo+pathConfig, "")
+
+	assert.NoError(t, handleConfig(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	var shown config.Config
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &shown))
+	assert.Equal(t, "localhost", shown.Database.Host)
+	assert.Equal(t, config.RedactedValue, shown.Database.Password)
+	assert.NotContains(t, rec.Body.String(), "myPGPassword")
+}
+
+func TestClaVersionFor(t *testing.T) {
+	setupTestTenants(t, testTenant())
+	setupTestConfig(t).CLA.Version = "1.0"
+
+	assert.Equal(t, "apache:2", claVersionFor(&types.EvaluationInfo{AppId: 7}))
+	assert.Equal(t, "1.0", claVersionFor(&types.EvaluationInfo{AppId: 8}))
+	assert.Equal(t, "1.0", claVersionOf(nil))
+}
+
+func TestConfigureTenants(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+	t.Cleanup(func() {
+		assert.NoError(t, ourGithub.Tenants.Set(nil))
+	})
+
+	mock.ExpectQuery("SELECT Name, AppID").
+		WillReturnRows(sqlmock.NewRows([]string{"Name", "AppID", "KeyFile", "WebhookSecret", "ClaVersion", "ClaTextUrl", "NotifyEmail"}).
+			AddRow("apache", 7, "apache.pem", "apacheSecret", "2", "https://example.com/apache-cla.txt", ""))
+	mock.ExpectQuery("SELECT TenantName, LoginName").
+		WillReturnRows(sqlmock.NewRows([]string{"TenantName", "LoginName"}).AddRow("apache", "alice"))
+	assert.NoError(t, configureTenants())
+	assert.Equal(t, []string{"alice"}, ourGithub.Tenants.ByName("apache").Admins)
+
+	mock.ExpectQuery("SELECT Name, AppID").
+		WillReturnRows(sqlmock.NewRows([]string{"Name", "AppID", "KeyFile", "WebhookSecret", "ClaVersion", "ClaTextUrl", "NotifyEmail"}).
+			AddRow("Apache", 7, "apache.pem", "apacheSecret", "2", "https://example.com/apache-cla.txt", ""))
+	mock.ExpectQuery("SELECT TenantName, LoginName").
+		WillReturnRows(sqlmock.NewRows([]string{"TenantName", "LoginName"}))
+	assert.EqualError(t, configureTenants(), `invalid tenant name: "Apache"`)
+	// the tenants we had are kept
+	assert.NotNil(t, ourGithub.Tenants.ByName("apache"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func setupMockContextTenant(t *testing.T, target, name string) (c echo.Context, rec *httptest.ResponseRecorder) {
+	logger = zaptest.NewLogger(t)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	if name != "" {
+		c.SetParamNames(pathParamTenant)
+		c.SetParamValues(name)
+	}
+	return
+}
+
+func TestHandleTenant(t *testing.T) {
+	setupTestTenants(t, testTenant())
+
+	c, rec := setupMockContextTenant(t, pathTenant+"/apache", "apache")
+	assert.NoError(t, handleTenant(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	assert.JSONEq(t, `{"name":"apache","claVersion":"apache:2","claTextUrl":"https://example.com/apache-cla.txt"}`, rec.Body.String())
+
+	c, rec = setupMockContextTenant(t, pathTenant+"/unknown", "unknown")
+	assert.NoError(t, handleTenant(c))
+	assert.Equal(t, http.StatusNotFound, c.Response().Status)
+	assert.Equal(t, "unknown tenant: unknown", rec.Body.String())
+}
+
+func TestHandleTenants(t *testing.T) {
+	c, rec := setupMockContextTenant(t, pathInfo+pathTenants, "")
+	assert.NoError(t, handleTenants(c))
+	assert.Equal(t, "[]\n", rec.Body.String())
+
+	setupTestTenants(t, testTenant())
+	c, rec = setupMockContextTenant(t, pathInfo+pathTenants, "")
+	assert.NoError(t, handleTenants(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	assert.JSONEq(t, `[{"name":"apache","claVersion":"apache:2","claTextUrl":"https://example.com/apache-cla.txt",
+		"appId":7,"notifyEmail":"legal@apache.example","admins":["alice"]}]`, rec.Body.String())
+	assert.NotContains(t, rec.Body.String(), "apacheSecret")
+}
+
+func TestHandleRetrieveCLATextOfTenant(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/apache-cla.txt", r.URL.EscapedPath())
+		_, _ = w.Write([]byte("the apache cla"))
+	}))
+	defer ts.Close()
+	tenant := testTenant()
+	tenant.CLATextUrl = ts.URL + "/apache-cla.txt"
+	setupTestTenants(t, tenant)
+
+	c, rec := setupMockContextTenant(t, pathClaText+"?tenant=apache", "")
+	assert.NoError(t, handleRetrieveCLAText(c))
+	assert.Equal(t, "the apache cla", rec.Body.String())
+
+	c, rec = setupMockContextTenant(t, pathClaText+"?tenant=unknown", "")
+	assert.NoError(t, handleRetrieveCLAText(c))
+	assert.Equal(t, http.StatusNotFound, c.Response().Status)
+	assert.Equal(t, "unknown tenant: unknown", rec.Body.String())
+}
+
+func TestHandleProcessWebhookRotatedSecrets(t *testing.T) {
+	ourGithub.SetupTestDeliveries(t)
+	testConfig := setupTestConfig(t)
+	testConfig.GitHub.WebhookSecret = "newSecret, oldSecret"
+	testConfig.GitHub.AppId = 1
+	actionText := "renamed"
+	event := github.RepositoryEvent{
+		Action: &actionText,
+		Repo: &github.Repository{
+			ID:    github.Int64(1234),
+			Name:  github.String("newName"),
+			Owner: &github.User{Login: github.String("newOwner")},
+		},
+	}
+	body, err := json.Marshal(event)
+	assert.NoError(t, err)
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+	mock.ExpectExec("UPDATE unsigned_pr SET RepoOwner").
+		WithArgs(int64(1234), "newOwner", "newName", vcs.ProviderGitHub).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// GitHub still signs with the old secret, until the new one is saved in the app settings
+	c, rec := setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event":      string(webhook.RepositoryEvent),
+			"X-GitHub-Delivery":   "myDelivery",
+			"X-Hub-Signature-256": ourGithub.SignFakeWebhook("oldSecret", body),
+		}, event)
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusAccepted, c.Response().Status)
+	assert.Equal(t, "accepted repository change", rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	deliveries := ourGithub.Deliveries.Recent()
+	assert.Equal(t, 1, len(deliveries))
+	assert.Equal(t, "myDelivery", deliveries[0].ID)
+	assert.Equal(t, string(webhook.RepositoryEvent), deliveries[0].Event)
+	assert.Equal(t, int64(1), deliveries[0].AppId)
+	assert.Equal(t, ourGithub.SecretFingerprint("oldSecret"), deliveries[0].Secret)
+
+	// a retired secret is no longer accepted
+	c, rec = setupMockContextWebhook(t,
+		map[string]string{
+			"X-GitHub-Event":      string(webhook.RepositoryEvent),
+			"X-Hub-Signature-256": ourGithub.SignFakeWebhook("retiredSecret", body),
+		}, event)
+	assert.NoError(t, handleProcessWebhook(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, webhook.ErrHMACVerificationFailed.Error(), rec.Body.String())
+	assert.Equal(t, 1, len(ourGithub.Deliveries.Recent()))
+}
+
+// setupTestRotation serves a tenant whose app has a current and a new private key.
+func setupTestRotation(t *testing.T) (currentFingerprint, newFingerprint string) {
+	resetPemFileImpl := ourGithub.SetupTestPemFile(t)
+	t.Cleanup(resetPemFileImpl)
+	ourGithub.SetupTestPrivateKeys(t)
+	dir := t.TempDir()
+	currentFile, newFile := filepath.Join(dir, "current.pem"), filepath.Join(dir, "new.pem")
+	currentFingerprint, newFingerprint = ourGithub.WriteTestKeyFile(t, currentFile), ourGithub.WriteTestKeyFile(t, newFile)
+	tenant := testTenant()
+	tenant.KeyFile = currentFile + "," + newFile
+	setupTestTenants(t, tenant)
+	return
+}
+
+func setupMockContextSigningKey(t *testing.T, body string) (c echo.Context, rec *httptest.ResponseRecorder) {
+	logger = zaptest.NewLogger(t)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPut, pathInfo+pathRotation+pathSigningKey, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	return
+}
+
+func TestHandleRotation(t *testing.T) {
+	ourGithub.SetupTestDeliveries(t)
+	currentFingerprint, _ := setupTestRotation(t)
+	signingKey, err := ourGithub.Apps.SigningKey(7)
+	assert.NoError(t, err)
+	assert.Equal(t, currentFingerprint, signingKey)
+	ourGithub.Deliveries.Record(ourGithub.Delivery{ID: "myDelivery", Tenant: "apache", AppId: 7,
+		Secret: ourGithub.SecretFingerprint("apacheSecret"), SigningKey: signingKey})
+
+	c, rec := setupMockContextTenant(t, pathInfo+pathRotation, "")
+	assert.NoError(t, handleRotation(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	var status rotationStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, 1, len(status.Secrets))
+	assert.Equal(t, ourGithub.SecretFingerprint("apacheSecret"), status.Secrets[0].Fingerprint)
+	assert.Equal(t, 2, len(status.Keys))
+	assert.Equal(t, currentFingerprint, status.Keys[0].Fingerprint)
+	assert.True(t, status.Keys[0].Signing)
+	assert.False(t, status.Keys[1].Signing)
+	assert.Equal(t, 1, len(status.Deliveries))
+	assert.Equal(t, "myDelivery", status.Deliveries[0].ID)
+	assert.Equal(t, currentFingerprint, status.Deliveries[0].SigningKey)
+	assert.NotContains(t, rec.Body.String(), "apacheSecret")
+}
+
+func TestHandleSelectSigningKey(t *testing.T) {
+	_, newFingerprint := setupTestRotation(t)
+
+	c, rec := setupMockContextSigningKey(t, `{"fingerprint":"`+newFingerprint+`"}`)
+	assert.NoError(t, handleSelectSigningKey(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	assert.Contains(t, rec.Body.String(), newFingerprint)
+	signingKey, err := ourGithub.Apps.SigningKey(7)
+	assert.NoError(t, err)
+	assert.Equal(t, newFingerprint, signingKey)
+
+	c, rec = setupMockContextSigningKey(t, `{"fingerprint":"SHA256:unknown"}`)
+	assert.NoError(t, handleSelectSigningKey(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+	assert.Equal(t, "unknown private key: SHA256:unknown", rec.Body.String())
+
+	c, _ = setupMockContextSigningKey(t, `{`)
+	assert.NoError(t, handleSelectSigningKey(c))
+	assert.Equal(t, http.StatusBadRequest, c.Response().Status)
+}
+
+func setupMockContextBackfill(t *testing.T) (c echo.Context, rec *httptest.ResponseRecorder) {
+	logger = zaptest.NewLogger(t)
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, pathInfo+pathBackfillRepoIds, nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	return
+}
+
+func TestHandleBackfillRepoIds(t *testing.T) {
+	c, rec := setupMockContextBackfill(t)
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	mock.ExpectQuery(db.ConvertSqlToDbMockExpect(db.SqlSelectLegacyPRRepositories)).
+		WillReturnRows(sqlmock.NewRows([]string{"RepoOwner", "RepoName", "AppID", "InstallID"}))
+
+	assert.NoError(t, handleBackfillRepoIds(c))
+	assert.Equal(t, http.StatusOK, c.Response().Status)
+	assert.JSONEq(t, `{"repositories":0,"adopted":0}`, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleBackfillRepoIdsError(t *testing.T) {
+	c, rec := setupMockContextBackfill(t)
+
+	mock, dbIF, closeDbFunc := db.SetupMockDB(t)
+	defer closeDbFunc()
+	postgresDB = dbIF
+
+	forcedError := fmt.Errorf("forced select legacy repositories error")
+	mock.ExpectQuery(db.ConvertSqlToDbMockExpect(db.SqlSelectLegacyPRRepositories)).
+		WillReturnError(forcedError)
+
+	assert.NoError(t, handleBackfillRepoIds(c))
+	assert.Equal(t, http.StatusInternalServerError, c.Response().Status)
+	assert.Equal(t, forcedError.Error(), rec.Body.String())
+}
+
+func TestConfigureSigningKey(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	_, newFingerprint := setupTestRotation(t)
+
+	assert.NoError(t, configureSigningKey(config.GitHub{}))
+
+	assert.NoError(t, configureSigningKey(config.GitHub{SigningKey: newFingerprint}))
+	signingKey, err := ourGithub.Apps.SigningKey(7)
+	assert.NoError(t, err)
+	assert.Equal(t, newFingerprint, signingKey)
+
+	assert.EqualError(t, configureSigningKey(config.GitHub{SigningKey: "SHA256:unknown"}), "unknown private key: SHA256:unknown")
+}
+
+// writeTestSecret writes a secret file, and names it in the *_FILE variant of the environment variable
+func writeTestSecret(t *testing.T, envName, value string) (path string) {
+	path = filepath.Join(t.TempDir(), strings.ToLower(envName))
+	assert.NoError(t, os.WriteFile(path, []byte(value+"\n"), 0600))
+	t.Setenv(envName, "")
+	t.Setenv(envName+secrets.FileSuffix, path)
+	return
+}
+
+func TestLoadConfigSecretFiles(t *testing.T) {
+	setupTestEnv(t)
+	writeTestSecret(t, "PG_PASSWORD", "myPGPassword")
+	writeTestSecret(t, "GH_WEBHOOK_SECRET", "myFileWebhookSecret")
+	provider, err := secrets.FromEnv(os.Getenv)
+	assert.NoError(t, err)
+
+	cfg, err := loadConfig(context.Background(), provider)
+	assert.NoError(t, err)
+	assert.Equal(t, "myPGPassword", cfg.Database.Password)
+	assert.Equal(t, "myFileWebhookSecret", cfg.GitHub.WebhookSecret)
+
+	t.Setenv("PG_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	_, err = loadConfig(context.Background(), provider)
+	assert.ErrorContains(t, err, "could not read secret PG_PASSWORD_FILE: ")
+}
+
+func TestRefreshSecrets(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	setupTestEnv(t)
+	ourGithub.SetupTestPrivateKeys(t)
+	webhookSecretFile := writeTestSecret(t, "GH_WEBHOOK_SECRET", "oldSecret")
+	provider, err := secrets.FromEnv(os.Getenv)
+	assert.NoError(t, err)
+	cfg, err := loadConfig(context.Background(), provider)
+	assert.NoError(t, err)
+	appConfig.Store(cfg)
+
+	assert.NoError(t, refreshSecrets(context.Background(), provider))
+	assert.Same(t, cfg, currentConfig())
+
+	keyFile := filepath.Join(t.TempDir(), "rotated.pem")
+	fingerprint := ourGithub.WriteTestKeyFile(t, keyFile)
+	t.Setenv(config.EnvPrivateKey+secrets.FileSuffix, keyFile)
+	assert.NoError(t, os.WriteFile(webhookSecretFile, []byte("newSecret, oldSecret"), 0600))
+	t.Setenv("PG_HOST", "db.example.com")
+	assert.NoError(t, refreshSecrets(context.Background(), provider))
+	assert.Equal(t, "newSecret, oldSecret", currentConfig().GitHub.WebhookSecret)
+	signingKey, err := ourGithub.Apps.SigningKey(1)
+	assert.NoError(t, err)
+	assert.Equal(t, fingerprint, signingKey)
+	// other settings are only read at startup
+	assert.Equal(t, "bogus-db-hostname", currentConfig().Database.Host)
+
+	// invalid secrets are refused, and the ones we have kept
+	assert.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+	assert.NoError(t, os.WriteFile(webhookSecretFile, []byte("newerSecret"), 0600))
+	assert.EqualError(t, refreshSecrets(context.Background(), provider), "invalid configuration: GH_APP_PRIVATE_KEY is not PEM encoded")
+	assert.Equal(t, "newSecret, oldSecret", currentConfig().GitHub.WebhookSecret)
+	signingKey, err = ourGithub.Apps.SigningKey(1)
+	assert.NoError(t, err)
+	assert.Equal(t, fingerprint, signingKey)
+}
+
+func TestRefreshSecretsOfProviders(t *testing.T) {
+	logger = zaptest.NewLogger(t)
+	setupTestEnv(t)
+	t.Setenv("GITLAB_TOKEN", "myGitLabToken")
+	t.Setenv("GITLAB_WEBHOOK_SECRET", "myGitLabWebhookSecret")
+	t.Setenv("SIGN_LINK_SECRET", "mySignLinkSecret")
+	t.Setenv("PG_PASSWORD", "myPGPassword")
+	origSignLinks, origToken := ourGithub.SignLinks, gitlab.Token()
+	t.Cleanup(func() {
+		ourGithub.SignLinks = origSignLinks
+		gitlab.SetToken(origToken)
+	})
+	provider, err := secrets.FromEnv(os.Getenv)
+	assert.NoError(t, err)
+	cfg, err := loadConfig(context.Background(), provider)
+	assert.NoError(t, err)
+	appConfig.Store(cfg)
+	gitlab.SetToken(cfg.GitLab.Token)
+	configureSignLinks(cfg.CLA)
+	link, err := ourGithub.SignLinks.Sign(ourGithub.SignLink{Login: "alice"})
+	assert.NoError(t, err)
+
+	writeTestSecret(t, "GITLAB_TOKEN", "newGitLabToken")
+	writeTestSecret(t, "SIGN_LINK_SECRET", "newSignLinkSecret")
+	writeTestSecret(t, "PG_PASSWORD", "newPGPassword")
+	assert.NoError(t, refreshSecrets(context.Background(), provider))
+	assert.Equal(t, "newGitLabToken", gitlab.Token())
+	_, err = ourGithub.SignLinks.Verify(link)
+	assert.Equal(t, ourGithub.ErrSignLinkInvalid, err)
+	// new database connections log in with the new password
+	assert.Contains(t, psqlInfo(currentConfig().Database), "password=newPGPassword ")
+}
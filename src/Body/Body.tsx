@@ -14,7 +14,7 @@
  * limitations under the License.
  */
 import { NxButton, NxCheckbox, NxFieldset, NxFormGroup, NxLoadError, NxTextInput, nxTextInputStateHelpers, NxTooltip, useToggle } from "@sonatype/react-shared-components";
-import React, { FormEvent, useContext, useState } from "react";
+import React, { FormEvent, useContext, useEffect, useState } from "react";
 import { Action, ClientContext } from "react-fetching-library";
 import classnames from 'classnames';
 import { none } from 'ramda';
@@ -29,10 +29,26 @@ type GitHubUser = {
   name?: string
 }
 
+// SignLink is the PR a signer came from, when they followed the link in its comment
+type SignLink = {
+  repoOwner: string
+  repoName: string
+  prNumber: number
+  claVersion: string
+  login: string
+}
+
 type SignCla = {
   user: GitHubUser
   claVersion: string
   claTextUrl: string
+  signLink?: string
+}
+
+// TenantCLA is the CLA of the tenant whose PR a signer came from
+type TenantCLA = {
+  claVersion: string
+  claTextUrl: string
 }
 
 type queryError = {
@@ -53,6 +69,36 @@ const hasCode = (url: string): boolean => {
   return url.startsWith("?code=");
 }
 
+// providerName is where contributors log in, as linked from their PR (or merge request)
+const providerName = (): string => {
+  switch (new URLSearchParams(window.location.search).get("provider")) {
+    case "gitlab":
+      return "GitLab";
+    case "gitea":
+      return "Gitea";
+    default:
+      return "GitHub";
+  }
+}
+
+// the tenant is kept while the user is logging in, as the login does not come back with it
+const tenantStorageKey = "cla_tenant";
+
+// tenantName is the tenant whose CLA contributors sign, as linked from their PR, or null for the default CLA
+const tenantName = (): string | null => {
+  const tenant = new URLSearchParams(window.location.search).get("tenant");
+  if (tenant) {
+    window.sessionStorage.setItem(tenantStorageKey, tenant);
+    return tenant;
+  }
+  return (hasCode(window.location.search)) ? window.sessionStorage.getItem(tenantStorageKey) : null;
+}
+
+const defaultCLA: TenantCLA = {
+  claVersion: (process.env.REACT_APP_CLA_VERSION) ? process.env.REACT_APP_CLA_VERSION : "",
+  claTextUrl: (process.env.REACT_APP_CLA_URL) ? process.env.REACT_APP_CLA_URL : ""
+};
+
 const { initialState, userInput } = nxTextInputStateHelpers;
 
 const Body = () => {
@@ -68,9 +114,12 @@ const Body = () => {
           [email, setEmail] = useState(initialState('', validator)),
           [fullName, setFullName] = useState(initialState('', validator)),
           [user, setUser] = useState<GitHubUser | undefined>(undefined),
+          [signLink, setSignLink] = useState<SignLink | undefined>(undefined),
           [queryError, setQueryError] = useState<queryError>({error: false, errorMessage: ""}),
           [isOpen, dismiss] = useToggle(true),
-          [agreeToTerms, setAgreeToTerms] = useState(false);
+          [agreeToTerms, setAgreeToTerms] = useState(false),
+          [tenant] = useState<string | null>(tenantName),
+          [cla, setCLA] = useState<TenantCLA>(defaultCLA);
 
     const stateHasValidationErrors = (state: StateProps) => hasValidationErrors(state.validationErrors),
           isValid = none(stateHasValidationErrors, [username, email, fullName]),
@@ -81,6 +130,22 @@ const Body = () => {
 
     const clientContext = useContext(ClientContext);
 
+    useEffect(() => {
+      if (tenant) {
+        const getTenant: Action = {
+          method: 'GET',
+          endpoint: `/tenant/${encodeURIComponent(tenant)}`
+        };
+        clientContext.query(getTenant).then((res) => {
+          if (!res.error) {
+            setCLA({ claVersion: res.payload.claVersion, claTextUrl: res.payload.claTextUrl });
+          } else {
+            setQueryError({error: true, errorMessage: res.payload});
+          }
+        });
+      }
+    }, [tenant, clientContext]);
+
     const setTextInput = (setter: StatePropsSetter, validator?: Validator) => (value: string) => {
       setter(userInput(validator, value));
     };
@@ -88,13 +153,19 @@ const Body = () => {
     const getGitHubAuthUrl = (): string => {
       const urlParams = new URLSearchParams(window.location.search);
 
+      const signLinkToken = urlParams.get("sign");
       const originalUri = urlParams.get("original_uri");
 
-      const state: string = (originalUri) ? originalUri : process.env.REACT_APP_COMPANY_WEBSITE!;
+      // a signing link is passed through the login, so the server can check it once we know who logged in
+      const returnTo: string = (signLinkToken) ? signLinkToken : (originalUri) ? originalUri : process.env.REACT_APP_COMPANY_WEBSITE!;
 
       const currentUrl = window.location.href.split('?')[0];
 
-      return `https://github.com/login/oauth/authorize?client_id=${process.env.REACT_APP_GITHUB_CLIENT_ID}&redirect_uri=${currentUrl}&scope=user:email&state=${state}`;
+      // the server sends us on to GitHub (or GitLab, or Gitea), with a state and PKCE challenge it checks when we come back
+      const provider = urlParams.get("provider");
+      const providerParam = (provider) ? `&provider=${encodeURIComponent(provider)}` : "";
+
+      return `/oauth-login?redirect_uri=${encodeURIComponent(currentUrl)}&return=${encodeURIComponent(returnTo)}${providerParam}`;
     }
 
     const getUser = async (search: string) => {
@@ -106,7 +177,7 @@ const Body = () => {
   
         const checkOAuthCode: Action = {
           method: 'GET',
-          endpoint: `/oauth-callback?code=${code}&state=${redirectState}`
+          endpoint: `/oauth-callback?code=${code}&state=${encodeURIComponent(redirectState!)}`
         }
   
         const res = await clientContext.query(checkOAuthCode);
@@ -116,7 +187,9 @@ const Body = () => {
   
           setLoggedIn(true);
   
-          setGHState(redirectState!);
+          setGHState(res.payload.returnTo ? res.payload.returnTo : "");
+
+          setSignLink(res.payload.signLink);
   
           const user: GitHubUser = res.payload;
 
@@ -139,8 +212,9 @@ const Body = () => {
             email: email.value,
             name: fullName.value
           }, 
-          claVersion: (process.env.REACT_APP_CLA_VERSION) ? process.env.REACT_APP_CLA_VERSION : "",
-          claTextUrl: (process.env.REACT_APP_CLA_URL) ? process.env.REACT_APP_CLA_URL : ""
+          claVersion: cla.claVersion,
+          claTextUrl: cla.claTextUrl,
+          signLink: (signLink) ? ghState : undefined
         };
   
         const putSignCla: Action = {
@@ -155,7 +229,9 @@ const Body = () => {
         const res = await clientContext.query(putSignCla);
   
         if (!res.error) {
-          if (ghState !== "")
+          if (res.payload.redirectUrl)
+          window.location.href = res.payload.redirectUrl;
+          else if (ghState !== "" && !signLink)
           window.location.href = decodeURI(ghState);
         } else {
           setQueryError({error: true, errorMessage: res.payload});
@@ -188,25 +264,30 @@ const Body = () => {
           checkboxId="login-check" 
           isChecked={loggedIn}
           disabled={true}>
-          Authenticate with GitHub so we can associate your commits with your signed CLA
+          Authenticate with {providerName()} so we can associate your commits with your signed CLA
         </NxCheckbox>
 
         { !loggedIn && (
-          <a href={getGitHubAuthUrl()} className="nx-btn nx-btn--primary">Login to Github</a>
+          <a href={getGitHubAuthUrl()} className="nx-btn nx-btn--primary">Login to {providerName()}</a>
         )}
 
         { loggedIn && user && (
           <h3>Logged in as: { user.login }</h3>
         )}
 
+        { loggedIn && signLink && (
+          <h3>Signing for: { signLink.repoOwner }/{ signLink.repoName }#{ signLink.prNumber }, you will be taken back to it once signed</h3>
+        )}
+
         <NxCheckbox 
           checkboxId="cla-check" 
           isChecked={scrolled} 
           disabled={true}>
-          Review the CLA version: {process.env.REACT_APP_CLA_VERSION}
+          Review the CLA version: {cla.claVersion}
         </NxCheckbox>
 
         <CLABody 
+          tenant={tenant}
           handleScroll={(e: any) =>
             handleScroll(e, setScrolled)
           }/>
@@ -215,11 +296,11 @@ const Body = () => {
           checkboxId="sign-cla-check" 
           isChecked={agreeToTerms}
           disabled={true}>
-          I agree to the terms of CLA version {process.env.REACT_APP_CLA_VERSION}
+          I agree to the terms of CLA version {cla.claVersion}
         </NxCheckbox>
 
         { !loggedIn && (
-          <a href={getGitHubAuthUrl()} className="nx-btn nx-btn--primary">Login via Github to sign the CLA</a>
+          <a href={getGitHubAuthUrl()} className="nx-btn nx-btn--primary">Login via {providerName()} to sign the CLA</a>
         )}
 
         { loggedIn && user && (
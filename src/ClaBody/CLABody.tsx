@@ -13,22 +13,26 @@
  * See the License for the specific language governing permissions and
  * limitations under the License.
  */
-import React from 'react';
+import React, { useMemo } from 'react';
 import { NxLoadingSpinner } from '@sonatype/react-shared-components';
 import { Action, useQuery } from 'react-fetching-library';
 
-const fetchCLAText: Action = {
+const fetchCLAText = (tenant?: string | null): Action => ({
   method: 'GET',
-  endpoint: '/cla-text'
-};
+  endpoint: (tenant) ? `/cla-text?tenant=${encodeURIComponent(tenant)}` : '/cla-text'
+});
 
 type CLABodyProps = {
+  // tenant is whose CLA to show, the default one when not set
+  tenant?: string | null;
   handleScroll: (event: any) => void;
 }
 
 const CLABody = (props: CLABodyProps) => {
 
-  const { loading, payload, error, errorObject } = useQuery(fetchCLAText);
+  // the same action, so the text is not fetched again on every render
+  const action = useMemo(() => fetchCLAText(props.tenant), [props.tenant]);
+  const { loading, payload, error, errorObject } = useQuery(action);
 
   if (error) {
     console.log("errorObject: " + errorObject)
@@ -37,7 +37,10 @@ type UserSignature struct {
 // EvaluationInfo holds all the stuff we need to (re)validate a PR/user has the CLA signed,
 // basically just gather all the parameters together
 type EvaluationInfo struct {
+	// Provider hosts the PR (or merge request), see package vcs. Empty means GitHub.
+	Provider       string
 	UnsignedPRID   string
+	RepoId         int64
 	RepoOwner      string
 	RepoName       string
 	Sha            string
@@ -45,4 +48,84 @@ type EvaluationInfo struct {
 	AppId          int64
 	InstallId      int64
 	UserSignatures []UserSignature
+	// Exemptions lists the authors who need not sign the CLA, and why
+	Exemptions []Exemption
+	// SkippedCommits lists the commits made by automation, which were not checked at all
+	SkippedCommits []SkippedCommit
+}
+
+// SkippedCommit records why a commit was allowed without any checks.
+type SkippedCommit struct {
+	Sha    string `json:"sha"`
+	Login  string `json:"login,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Exemption records why an author was not asked to sign the CLA.
+type Exemption struct {
+	Login  string `json:"login"`
+	Reason string `json:"reason"`
+}
+
+// PRStatus is the latest commit status we reported for a PR, along with any failure details
+// needed to diagnose and retry an evaluation that did not finish.
+type PRStatus struct {
+	RepoId        int64      `json:"repoId"`
+	RepoOwner     string     `json:"repoOwner"`
+	RepoName      string     `json:"repoName"`
+	PRNumber      int64      `json:"prNumber"`
+	Sha           string     `json:"sha"`
+	State         string     `json:"state"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	LastError     string     `json:"lastError,omitempty"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+}
+
+// Collaborator is a cached answer to whether a login is a collaborator on a repository.
+type Collaborator struct {
+	RepoId         int64
+	RepoOwner      string
+	Login          string
+	IsCollaborator bool
+	CheckedAt      time.Time
+}
+
+const (
+	AuditActionOverrideApplied  = "override_applied"
+	AuditActionOverrideRemoved  = "override_removed"
+	AuditActionOverrideRejected = "override_rejected"
+)
+
+// AuditEvent records who did what to a PR outside the normal evaluation.
+type AuditEvent struct {
+	// Provider hosts the PR, empty for github.com
+	Provider  string    `json:"provider,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	RepoId    int64     `json:"repoId"`
+	RepoOwner string    `json:"repoOwner"`
+	RepoName  string    `json:"repoName"`
+	PRNumber  int64     `json:"prNumber"`
+	// Sha is the head of the PR the event applies to
+	Sha    string `json:"sha,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Tenant is an organization, or group of organizations, served by a GitHub App of its own, with its own CLA.
+// PRs of apps without a tenant belong to the default tenant, configured by the environment.
+type Tenant struct {
+	Name  string
+	AppId int64
+	// KeyFile and WebhookSecret are comma separated lists during a rotation, see github.WebhookSecrets
+	KeyFile       string
+	WebhookSecret string
+	CLAVersion    string
+	CLATextUrl    string
+	// NotifyEmail is told about signatures of the tenant's CLA, instead of NOTIFY_EMAIL
+	NotifyEmail string
+	// Admins are the logins allowed to override the CLA check on any PR of the tenant
+	Admins []string
 }
@@ -0,0 +1,92 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package vcs describes what evaluating the CLA on a PR needs of the service hosting it, so the same evaluation
+// (see github.EvaluateChange) works for GitHub and Gitea pull requests, and GitLab merge requests alike.
+package vcs
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	// ProviderGitea is Gitea and its fork Forgejo, which share their API
+	ProviderGitea = "gitea"
+)
+
+// Commit is a commit of a PR, with its author resolved to a user of the provider where possible.
+type Commit struct {
+	SHA string
+	URL string
+	// AuthorLogin is empty when the author email is not linked to any user
+	AuthorLogin string
+	AuthorEmail string
+	AuthorName  string
+	// AuthorBot tells the author is an automation account of the provider
+	AuthorBot bool
+	Verified  bool
+}
+
+// Provider is a service hosting PRs. All methods work on the PR of the evaluation they are passed.
+type Provider interface {
+	// Name is one of the Provider* constants
+	Name() string
+	ListCommits(ctx context.Context, evalInfo *types.EvaluationInfo) ([]Commit, error)
+	// SetStatus reports the CLA status ("pending", "success", "failure" or "error") on the head commit
+	SetStatus(ctx context.Context, evalInfo *types.EvaluationInfo, state, description string) error
+	// AddLabel adds a label, creating it in the repository first if needed
+	AddLabel(ctx context.Context, evalInfo *types.EvaluationInfo, name, color, description string) error
+	// RemoveLabel removes a label if it is applied
+	RemoveLabel(ctx context.Context, evalInfo *types.EvaluationInfo, name string) error
+	// Comment adds a comment, unless the PR already has the same one
+	Comment(ctx context.Context, evalInfo *types.EvaluationInfo, body string) error
+	// MembershipReason tells why login is a member of the repository who need not sign the CLA, or returns an
+	// empty reason if they are not.
+	MembershipReason(ctx context.Context, evalInfo *types.EvaluationInfo, login string) (string, error)
+	// ChangeURL is the web page of the PR
+	ChangeURL(evalInfo *types.EvaluationInfo) string
+}
+
+// ProviderOf returns the provider hosting the PR of an evaluation.
+func ProviderOf(evalInfo *types.EvaluationInfo) string {
+	if evalInfo.Provider == "" {
+		return ProviderGitHub
+	}
+	return evalInfo.Provider
+}
+
+// QualifiedLogin is how we store the login of a signer, so users of different providers sharing a login are told
+// apart. github.com logins stay as they are, so existing signatures remain valid.
+func QualifiedLogin(provider, login string) string {
+	if provider == "" || provider == ProviderGitHub {
+		return login
+	}
+	return provider + ":" + login
+}
+
+// ProviderOfLogin returns the provider of a login qualified by QualifiedLogin, and the login at that provider.
+func ProviderOfLogin(qualified string) (provider, login string) {
+	// logins can't contain a colon, but providers named by their host (e.g. GitHub Enterprise Server) may have a port
+	if i := strings.LastIndex(qualified, ":"); i >= 0 {
+		return qualified[:i], qualified[i+1:]
+	}
+	return ProviderGitHub, qualified
+}
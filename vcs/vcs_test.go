@@ -0,0 +1,52 @@
+//
+// Copyright (c) 2021-present Sonatype, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package vcs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sonatype-nexus-community/the-cla/types"
+)
+
+func TestProviderOf(t *testing.T) {
+	assert.Equal(t, ProviderGitHub, ProviderOf(&types.EvaluationInfo{}))
+	assert.Equal(t, ProviderGitLab, ProviderOf(&types.EvaluationInfo{Provider: ProviderGitLab}))
+}
+
+func TestQualifiedLogin(t *testing.T) {
+	assert.Equal(t, "alice", QualifiedLogin("", "alice"))
+	assert.Equal(t, "alice", QualifiedLogin(ProviderGitHub, "alice"))
+	assert.Equal(t, "gitlab:alice", QualifiedLogin(ProviderGitLab, "alice"))
+}
+
+func TestProviderOfLogin(t *testing.T) {
+	provider, login := ProviderOfLogin("alice")
+	assert.Equal(t, ProviderGitHub, provider)
+	assert.Equal(t, "alice", login)
+
+	provider, login = ProviderOfLogin("gitlab:alice")
+	assert.Equal(t, ProviderGitLab, provider)
+	assert.Equal(t, "alice", login)
+}
+
+func TestProviderOfLoginWithHostPort(t *testing.T) {
+	provider, login := ProviderOfLogin("github.example.com:8443:alice")
+	assert.Equal(t, "github.example.com:8443", provider)
+	assert.Equal(t, "alice", login)
+}